@@ -0,0 +1,247 @@
+// Утилита наполнения БД задач данными для нагрузочного тестирования.
+//
+// Использование:
+//
+//	loadgen [флаги]
+//
+// Создаёт в рабочем пространстве -tenant пользователей, метки и задачи в количестве,
+// заданном флагами -users, -labels и -tasks. Данные генерируются пакетом datagen
+// и зависят только от -seed и текущей даты, поэтому запуски с одинаковыми флагами
+// на пустом рабочем пространстве дают сравнимые наборы данных. Задачи вместе
+// с метками загружаются через COPY пакетами по -batch задач.
+// Пароль к Postgres берётся из переменной окружения POSTGRES_PASSWORD.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+
+	"SF-HW-30.8.1/pkg/datagen"
+	"SF-HW-30.8.1/pkg/storage"
+)
+
+func main() {
+	conf := storage.Config{
+		Password: os.Getenv("POSTGRES_PASSWORD"),
+	}
+	flag.StringVar(&conf.User, "user", "postgres", "пользователь Postgres")
+	flag.StringVar(&conf.Host, "host", "localhost", "хост Postgres")
+	flag.StringVar(&conf.Port, "port", "5433", "порт Postgres")
+	flag.StringVar(&conf.DBName, "db", "tasks", "имя БД")
+	tenantID := flag.Int("tenant", 1000, "рабочее пространство для данных")
+	tasks := flag.Int("tasks", 1000000, "количество задач")
+	users := flag.Int("users", 10000, "количество пользователей")
+	labels := flag.Int("labels", 100, "количество меток")
+	closed := flag.Float64("closed", 0.7, "доля выполненных задач")
+	batch := flag.Int("batch", 100000, "количество задач в одном COPY")
+	skew := flag.Float64("skew", 1.2, "неравномерность распределения задач по пользователям и меткам, 1 - равномерное")
+	seed := flag.Int64("seed", 1, "начальное значение генератора данных")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 0 || *tasks < 0 || *users < 1 || *labels < 0 || *batch < 1 || *closed < 0 || *closed > 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	ctx := context.Background()
+	db, err := storage.New(conf.ConString())
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close(ctx)
+	// у хранилища нет методов создания пользователей и меток, а импорт задач
+	// не сохраняет автора, ответственного и время
+	conn, err := pgx.Connect(ctx, conf.ConString())
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer conn.Close(ctx)
+
+	// отрицательная доля выполненных задач в datagen означает, что их нет
+	if *closed == 0 {
+		*closed = -1
+	}
+	g := datagen.New(datagen.Config{
+		Seed:        *seed,
+		Now:         time.Now().UTC().Truncate(24 * time.Hour),
+		ClosedRatio: *closed,
+		Skew:        *skew,
+	})
+
+	start := time.Now()
+	userIDs, err := seedUsers(ctx, conn, *tenantID, g.UserNames(*users))
+	if err != nil {
+		log.Fatal(err)
+	}
+	labelList := g.Labels(*labels)
+	labelIDs, err := seedLabels(ctx, conn, *tenantID, labelList)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("users: %d, labels: %d, %s", len(userIDs), len(labelIDs), time.Since(start).Round(time.Millisecond))
+
+	for done := 0; done < *tasks; done += *batch {
+		n := min(*batch, *tasks-done)
+		batchStart := time.Now()
+		err = seedTasks(ctx, conn, *tenantID, done, g.Tasks(n, userIDs, labelList), labelIDs)
+		if err != nil {
+			log.Fatal(err)
+		}
+		elapsed := time.Since(batchStart)
+		log.Printf("tasks: %d/%d, %.0f tasks/s", done+n, *tasks, float64(n)/elapsed.Seconds())
+	}
+
+	err = db.AnalyzeTables(ctx)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("done in %s", time.Since(start).Round(time.Second))
+}
+
+// seedUsers добавляет пользователей с именами names в рабочее пространство tenantID
+// и возвращает их id.
+func seedUsers(ctx context.Context, conn *pgx.Conn, tenantID int, names []string) ([]int, error) {
+	rows, err := conn.Query(ctx, `
+		INSERT INTO users (tenant_id, name)
+		SELECT $1, unnest($2::text[])
+		RETURNING id
+	`,
+		tenantID,
+		names,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		err = rows.Scan(&id)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// seedLabels добавляет метки labels в рабочее пространство tenantID и возвращает их id по названиям.
+func seedLabels(ctx context.Context, conn *pgx.Conn, tenantID int, labels []storage.Label) (map[string]int, error) {
+	names := make([]string, len(labels))
+	parents := make([]string, len(labels))
+	for i, l := range labels {
+		names[i], parents[i] = l.Name, l.Parent
+	}
+
+	rows, err := conn.Query(ctx, `
+		INSERT INTO labels (tenant_id, name)
+		SELECT $1, unnest($2::text[])
+		RETURNING id, name
+	`,
+		tenantID,
+		names,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	ids := make(map[string]int, len(labels))
+	for rows.Next() {
+		var id int
+		var name string
+		err = rows.Scan(&id, &name)
+		if err != nil {
+			return nil, err
+		}
+		ids[name] = id
+	}
+	if rows.Err() != nil {
+		return nil, rows.Err()
+	}
+
+	_, err = conn.Exec(ctx, `
+		UPDATE labels AS l
+		SET parent_id = p.id
+		FROM unnest($2::text[], $3::text[]) AS x(name, parent)
+		JOIN labels AS p
+		ON p.name = x.parent AND p.tenant_id = $1
+		WHERE l.name = x.name AND l.tenant_id = $1
+	`,
+		tenantID,
+		names,
+		parents,
+	)
+
+	return ids, err
+}
+
+// seedTasks загружает задачи tasks с номерами от from и их метки в рабочее пространство
+// tenantID. Номер добавляется к названию, чтобы имена задач для адресов не повторялись:
+// подбор свободного имени для повторяющегося названия замедляет загрузку.
+func seedTasks(ctx context.Context, conn *pgx.Conn, tenantID, from int, tasks []datagen.Task, labelIDs map[string]int) error {
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	// id выделяются заранее, чтобы загрузить метки задач вторым COPY
+	var ids []int
+	err = tx.QueryRow(ctx, `
+		SELECT array_agg(nextval('tasks_id_seq')) FROM generate_series(1, $1)
+	`,
+		len(tasks),
+	).Scan(&ids)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.CopyFrom(ctx,
+		pgx.Identifier{"tasks"},
+		[]string{"id", "tenant_id", "opened", "closed", "author_id", "assigned_id", "title", "content"},
+		pgx.CopyFromSlice(len(tasks), func(i int) ([]interface{}, error) {
+			t := tasks[i]
+			return []interface{}{
+				ids[i],
+				tenantID,
+				t.OpenedUnix(),
+				t.ClosedUnix(),
+				t.AuthorID,
+				t.AssignedID,
+				fmt.Sprintf("%s #%d", t.Title, from+i+1),
+				t.Content,
+			}, nil
+		}),
+	)
+	if err != nil {
+		return err
+	}
+
+	var links [][]interface{}
+	for i, t := range tasks {
+		for _, label := range t.Labels {
+			links = append(links, []interface{}{ids[i], labelIDs[label]})
+		}
+	}
+	_, err = tx.CopyFrom(ctx,
+		pgx.Identifier{"tasks_labels"},
+		[]string{"task_id", "label_id"},
+		pgx.CopyFromRows(links),
+	)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
@@ -1,2 +1,2 @@
 #!/bin/bash
-docker run -d --rm -p 5433:5432 --name db -e POSTGRES_PASSWORD=${POSTGRES_PASSWORD} -v $(pwd)/db_init:/docker-entrypoint-initdb.d postgres
\ No newline at end of file
+docker run -d --rm -p 5433:5432 --name db -e POSTGRES_PASSWORD=${POSTGRES_PASSWORD} -v $(pwd)/db_init:/docker-entrypoint-initdb.d postgres -c max_prepared_transactions=10
\ No newline at end of file
@@ -0,0 +1,329 @@
+// Утилита обслуживания БД задач.
+//
+// Использование:
+//
+//	taskctl [флаги] backup [файл]
+//	taskctl [флаги] restore [файл]
+//	taskctl [флаги] schedule
+//	taskctl [флаги] analyze|reindex|stats|refresh-stats|unsnooze|escalate|fetch-previews
+//	taskctl [флаги] verify
+//	taskctl [флаги] archive|retention
+//	taskctl [флаги] job <id>
+//	taskctl [флаги] plans [файл]
+//
+// Если файл не указан, используются стандартные вывод и ввод.
+// Команда schedule периодически загружает сжатые копии в S3-совместимое хранилище,
+// параметры хранилища берутся из переменных окружения S3_ENDPOINT, S3_REGION,
+// S3_BUCKET, S3_ACCESS_KEY и S3_SECRET_KEY.
+// Команды analyze, reindex и stats обновляют статистику планировщика, перестраивают
+// индекс поиска и выводят количество строк, размер и долю мёртвых строк таблиц.
+// Команда refresh-stats обновляет статистику задач по ответственным без блокировки чтения,
+// команда unsnooze снимает откладывание с задач, срок которого истёк, команда escalate
+// применяет правила эскалации, команда fetch-previews загружает превью ссылок из задач;
+// эти команды рассчитаны на запуск по cron.
+// Команда verify проверяет целостность данных и выводит нарушения, с флагом -repair
+// исправляет нарушения, для которых есть однозначное исправление.
+// Команда archive переносит задачи, выполненные раньше чем -archive-after назад,
+// в архив в том же хранилище объектов, что и резервные копии. Команда retention
+// применяет правила хранения рабочих пространств, с флагом -preview только выводит,
+// что изменит запуск; как и команды обслуживания, рассчитана на запуск по cron.
+// Команда job выводит ход выполнения длительной операции по id задания.
+// Команда plans без файла выводит свойства планов основных запросов в JSON для эталона,
+// а с файлом эталона сравнивает с ним текущие планы, выводит ухудшения и завершается
+// с ошибкой, если они есть, что позволяет проверять планы в CI.
+// Пароль к Postgres берётся из переменной окружения POSTGRES_PASSWORD.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"SF-HW-30.8.1/pkg/storage"
+)
+
+func main() {
+	conf := storage.Config{
+		Password: os.Getenv("POSTGRES_PASSWORD"),
+		Backup: storage.BackupConfig{
+			Endpoint:  os.Getenv("S3_ENDPOINT"),
+			Region:    os.Getenv("S3_REGION"),
+			Bucket:    os.Getenv("S3_BUCKET"),
+			AccessKey: os.Getenv("S3_ACCESS_KEY"),
+			SecretKey: os.Getenv("S3_SECRET_KEY"),
+		},
+	}
+	flag.StringVar(&conf.User, "user", "postgres", "пользователь Postgres")
+	flag.StringVar(&conf.Host, "host", "localhost", "хост Postgres")
+	flag.StringVar(&conf.Port, "port", "5433", "порт Postgres")
+	flag.StringVar(&conf.DBName, "db", "tasks", "имя БД")
+	flag.DurationVar(&conf.StatementTimeout, "statement-timeout", 0, "максимальное время выполнения запроса")
+	flag.DurationVar(&conf.LockTimeout, "lock-timeout", 0, "максимальное время ожидания блокировки")
+	flag.StringVar(&conf.Backup.Prefix, "prefix", "", "префикс ключей резервных копий в хранилище")
+	flag.DurationVar(&conf.Backup.Interval, "interval", 24*time.Hour, "интервал резервного копирования")
+	flag.IntVar(&conf.Backup.Keep, "keep", 7, "количество хранимых копий, 0 - хранить все")
+	archiveAfter := flag.Duration("archive-after", 365*24*time.Hour, "время после выполнения задачи до переноса в архив")
+	archiveLimit := flag.Int("archive-limit", 1000, "наибольшее количество задач в одном архиве")
+	preview := flag.Bool("preview", false, "вывести действия команды retention без их выполнения")
+	repair := flag.Bool("repair", false, "исправить найденные командой verify нарушения")
+	rowsGrowth := flag.Float64("plan-rows-growth", 10, "допустимый рост оценки количества строк плана по сравнению с эталоном, 0 - не проверять")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] backup|restore [file] | schedule | analyze|reindex|stats|refresh-stats|unsnooze|escalate|fetch-previews | verify | archive|retention | job id | plans [file]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() < 1 || flag.NArg() > 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	db, err := storage.New(conf.ConString())
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close(context.Background())
+
+	ctx := context.Background()
+	switch cmd, file := flag.Arg(0), flag.Arg(1); cmd {
+	case "backup":
+		err = backup(ctx, db, file)
+	case "restore":
+		err = restore(ctx, db, file)
+	case "schedule":
+		err = schedule(ctx, db, conf.Backup)
+	case "analyze":
+		err = db.AnalyzeTables(ctx)
+	case "reindex":
+		err = db.ReindexSearchIndex(ctx)
+	case "stats":
+		err = stats(ctx, db)
+	case "refresh-stats":
+		err = db.RefreshStats(ctx, true)
+	case "unsnooze":
+		var n int
+		n, err = db.UnsnoozeTasks(ctx)
+		if err == nil {
+			log.Printf("tasks unsnoozed: %d", n)
+		}
+	case "escalate":
+		err = escalate(ctx, db)
+	case "fetch-previews":
+		var n int
+		n, err = db.FetchLinkPreviews(ctx, storage.NewHTTPLinkFetcher(10*time.Second), 100)
+		if err == nil {
+			log.Printf("link previews fetched: %d", n)
+		}
+	case "verify":
+		err = verify(ctx, db, *repair)
+	case "archive":
+		err = archive(ctx, db, conf.Backup, *archiveAfter, *archiveLimit)
+	case "retention":
+		err = retention(ctx, db, conf.Backup, *archiveLimit, *preview)
+	case "job":
+		err = job(db, file)
+	case "plans":
+		err = plans(ctx, db, file, *rowsGrowth)
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// backup записывает резервную копию в файл или в стандартный вывод.
+func backup(ctx context.Context, db *storage.Storage, file string) error {
+	if file == "" {
+		return db.Backup(ctx, os.Stdout)
+	}
+
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	err = db.Backup(ctx, f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+
+	return err
+}
+
+// restore восстанавливает БД из файла или стандартного ввода.
+func restore(ctx context.Context, db *storage.Storage, file string) error {
+	var r io.Reader = os.Stdin
+	if file != "" {
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	return db.Restore(ctx, r)
+}
+
+// schedule загружает резервные копии в хранилище объектов сразу и далее по расписанию.
+func schedule(ctx context.Context, db *storage.Storage, conf storage.BackupConfig) error {
+	if conf.Bucket == "" {
+		return fmt.Errorf("S3_BUCKET is not set")
+	}
+
+	job := storage.NewBackupJob(db, conf)
+	key, err := job.Run(ctx)
+	if err != nil {
+		return err
+	}
+	log.Printf("backup uploaded: %s", key)
+
+	job.RunEvery(ctx, conf.Interval, func(err error) {
+		log.Printf("backup failed: %v", err)
+	})
+
+	return nil
+}
+
+// escalate применяет правила эскалации и выводит назначенные задачи.
+func escalate(ctx context.Context, db *storage.Storage) error {
+	escalations, err := db.RunEscalations(ctx)
+	if err != nil {
+		return err
+	}
+	for _, e := range escalations {
+		log.Printf("task %d assigned to user %d by rule %d", e.TaskID, e.AssignedID, e.RuleID)
+	}
+
+	return nil
+}
+
+// verify проверяет целостность данных и выводит найденные нарушения.
+func verify(ctx context.Context, db *storage.Storage, repair bool) error {
+	report, err := db.VerifyIntegrity(ctx, repair)
+	if err != nil {
+		return err
+	}
+	for _, issue := range report.Issues {
+		log.Printf("%s: task %d: %s", issue.Kind, issue.TaskID, issue.Detail)
+	}
+	log.Printf("issues found: %d, rows repaired: %d", len(report.Issues), report.Repaired)
+
+	return nil
+}
+
+// archive переносит давно выполненные задачи в архив в хранилище объектов.
+func archive(ctx context.Context, db *storage.Storage, conf storage.BackupConfig, after time.Duration, limit int) error {
+	if conf.Bucket == "" {
+		return fmt.Errorf("S3_BUCKET is not set")
+	}
+
+	store := storage.NewS3Store(conf.Endpoint, conf.Region, conf.Bucket, conf.AccessKey, conf.SecretKey)
+	result, err := db.ArchiveClosedTasks(ctx, store, conf.Prefix, after, limit)
+	if err != nil {
+		return err
+	}
+	log.Printf("tasks archived: %d %s", result.Tasks, result.Key)
+
+	return nil
+}
+
+// retention применяет правила хранения и выводит их действия по рабочим пространствам.
+func retention(ctx context.Context, db *storage.Storage, conf storage.BackupConfig, limit int, preview bool) error {
+	if conf.Bucket == "" && !preview {
+		return fmt.Errorf("S3_BUCKET is not set")
+	}
+
+	store := storage.NewS3Store(conf.Endpoint, conf.Region, conf.Bucket, conf.AccessKey, conf.SecretKey)
+	report, err := db.ApplyRetention(ctx, store, conf.Prefix, limit, preview)
+	if err != nil {
+		return err
+	}
+	for _, a := range report.Actions {
+		log.Printf("tenant %d: tasks archived: %d %v, deleted task records purged: %d", a.TenantID, len(a.Archived), a.Archived, a.Purged)
+	}
+	if report.Key != "" {
+		log.Printf("archive uploaded: %s", report.Key)
+	}
+
+	return nil
+}
+
+// job выводит состояние и ход выполнения задания.
+func job(db *storage.Storage, id string) error {
+	jobID, err := strconv.Atoi(id)
+	if err != nil {
+		return fmt.Errorf("invalid job id %q", id)
+	}
+
+	j, err := db.JobStatus(jobID)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s %s: %d/%d, errors: %d\n", j.Kind, j.State, j.Processed, j.Total, j.Errors)
+	if j.Error != "" {
+		fmt.Println(j.Error)
+	}
+
+	return nil
+}
+
+// plans выводит свойства планов основных запросов или сравнивает их с эталоном из файла.
+func plans(ctx context.Context, db *storage.Storage, file string, rowsGrowth float64) error {
+	current, err := db.CapturePlans(ctx, db.PlanQueries())
+	if err != nil {
+		return err
+	}
+	if file == "" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(current)
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	var baseline []storage.PlanSummary
+	err = json.Unmarshal(data, &baseline)
+	if err != nil {
+		return fmt.Errorf("invalid baseline %s: %w", file, err)
+	}
+	regressions := storage.ComparePlans(baseline, current, rowsGrowth)
+	for _, r := range regressions {
+		fmt.Printf("%s: %s\n", r.Query, r.Reason)
+	}
+	if len(regressions) > 0 {
+		return fmt.Errorf("query plans regressed: %d", len(regressions))
+	}
+
+	return nil
+}
+
+// stats выводит статистику таблиц.
+func stats(ctx context.Context, db *storage.Storage) error {
+	tables, err := db.TableStats(ctx)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "table\trows\tdead\tdead %\tsize, KiB\tlast vacuum\t")
+	for _, t := range tables {
+		vacuum := "-"
+		if !t.LastVacuum.IsZero() {
+			vacuum = t.LastVacuum.Format(time.DateTime)
+		}
+		fmt.Fprintf(w, "%s\t%d\t%d\t%.1f\t%d\t%s\t\n",
+			t.Name, t.LiveRows, t.DeadRows, t.DeadRowRatio*100, t.TotalBytes/1024, vacuum)
+	}
+
+	return w.Flush()
+}
@@ -3,29 +3,301 @@ CREATE DATABASE tasks;
 
 \c tasks;
 
-DROP TABLE IF EXISTS tasks_labels, tasks, labels, users;
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+DROP MATERIALIZED VIEW IF EXISTS task_stats;
+DROP TABLE IF EXISTS jobs, retention_policies, archived_tasks, task_title_keys, current_tasks, task_forms, intake_settings, link_previews, task_html, tenant_quotas, task_flags, label_rules, task_time_log, escalation_log, escalation_rules, rotation_members, rotations, sla_policies, task_translations, task_revisions, deleted_tasks, audit_log, share_link_views, share_links, task_grants, rate_limits, sessions, api_tokens, task_history, tasks_labels, tasks, labels, users;
 
 -- пользователи системы
 CREATE TABLE users (
     id SERIAL PRIMARY KEY,
-    name TEXT NOT NULL
+    tenant_id INTEGER NOT NULL DEFAULT 0, -- рабочее пространство
+    name TEXT NOT NULL,
+    role TEXT NOT NULL DEFAULT 'reporter' CHECK (role IN ('admin', 'maintainer', 'reporter', 'viewer'))
 );
 
 -- метки задач
 CREATE TABLE labels (
     id SERIAL PRIMARY KEY,
-    name TEXT NOT NULL
+    tenant_id INTEGER NOT NULL DEFAULT 0, -- рабочее пространство
+    name TEXT NOT NULL,
+    parent_id INTEGER REFERENCES labels(id) ON DELETE SET NULL DEFERRABLE -- родительская метка, задачи дочерних меток входят в родительскую
 );
 
 -- задачи
 CREATE TABLE tasks (
     id SERIAL PRIMARY KEY,
+    tenant_id INTEGER NOT NULL DEFAULT 0, -- рабочее пространство
     opened BIGINT NOT NULL DEFAULT extract(epoch from now()), -- время создания задачи
     closed BIGINT DEFAULT 0, -- время выполнения задачи
     author_id INTEGER REFERENCES users(id) DEFAULT 0, -- автор задачи
     assigned_id INTEGER REFERENCES users(id) DEFAULT 0, -- ответственный
     title TEXT, -- название задачи
-    content TEXT -- задачи
+    content TEXT, -- задачи
+    duplicate_of INTEGER REFERENCES tasks(id) ON DELETE SET NULL DEFERRABLE, -- задача, дубликатом которой является данная
+    parent_id INTEGER REFERENCES tasks(id) ON DELETE SET NULL DEFERRABLE, -- родительская задача
+    -- видимость задачи: public - всем, project - пользователям рабочего пространства,
+    -- private - автору, ответственному и пользователям с явным доступом
+    visibility TEXT NOT NULL DEFAULT 'public' CHECK (visibility IN ('public', 'project', 'private')),
+    updated BIGINT NOT NULL DEFAULT extract(epoch from now()), -- время последнего изменения
+    version INTEGER NOT NULL DEFAULT 1, -- версия задачи, увеличивается при каждом изменении
+    snoozed_until BIGINT, -- время, до которого задача отложена и скрыта из списков текущей работы
+    responded BIGINT, -- время первого назначения ответственного, считается ответом на задачу
+    estimate BIGINT CHECK (estimate >= 0), -- оценка трудозатрат в секундах, NULL - не оценена
+    fields JSONB NOT NULL DEFAULT '{}', -- значения пользовательских полей, например из формы приёма
+    slug TEXT, -- имя задачи для адресов страниц, получается из названия при создании
+    CONSTRAINT tasks_closed_after_opened CHECK (closed = 0 OR closed >= opened) -- задачу нельзя выполнить раньше создания
+);
+
+-- обновляет время изменения, если оно не задано явно, и увеличивает версию задачи
+CREATE FUNCTION touch_updated() RETURNS TRIGGER AS $$
+BEGIN
+    IF NEW.updated = OLD.updated THEN
+        NEW.updated := extract(epoch from now());
+    END IF;
+    NEW.version := OLD.version + 1;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER tasks_touch_updated
+BEFORE UPDATE ON tasks
+FOR EACH ROW EXECUTE FUNCTION touch_updated();
+
+-- отмечает время ответа на задачу при первом назначении ответственного
+CREATE FUNCTION mark_responded() RETURNS TRIGGER AS $$
+BEGIN
+    IF NEW.responded IS NULL AND COALESCE(NEW.assigned_id, 0) <> 0 THEN
+        NEW.responded := extract(epoch from now());
+    END IF;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER tasks_mark_responded
+BEFORE INSERT OR UPDATE OF assigned_id ON tasks
+FOR EACH ROW EXECUTE FUNCTION mark_responded();
+
+-- квоты рабочих пространств, NULL - без ограничения
+CREATE TABLE tenant_quotas (
+    tenant_id INTEGER PRIMARY KEY, -- рабочее пространство
+    max_open_tasks INTEGER CHECK (max_open_tasks >= 0) -- максимальное количество открытых задач
+);
+
+-- отклоняет создание и повторное открытие задач сверх квоты рабочего пространства;
+-- одновременные вставки могут немного превысить квоту, поэтому квота мягкая
+CREATE FUNCTION check_open_tasks_quota() RETURNS TRIGGER AS $$
+DECLARE
+    quota INTEGER;
+BEGIN
+    IF COALESCE(NEW.closed, 0) = 0 AND (TG_OP = 'INSERT' OR COALESCE(OLD.closed, 0) <> 0) THEN
+        SELECT max_open_tasks INTO quota FROM tenant_quotas WHERE tenant_id = NEW.tenant_id;
+        IF quota IS NOT NULL AND
+            (SELECT count(*) FROM tasks WHERE tenant_id = NEW.tenant_id AND closed = 0) >= quota THEN
+            RAISE EXCEPTION 'open tasks quota exceeded for tenant %', NEW.tenant_id USING ERRCODE = 'QT001';
+        END IF;
+    END IF;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER tasks_check_open_tasks_quota
+BEFORE INSERT OR UPDATE OF closed ON tasks
+FOR EACH ROW EXECUTE FUNCTION check_open_tasks_quota();
+
+-- преобразует текст в имя для адресов: латиница в нижнем регистре, цифры и дефисы,
+-- кириллица транслитерируется
+CREATE FUNCTION slugify(title TEXT) RETURNS TEXT AS $$
+    SELECT COALESCE(NULLIF(rtrim(left(trim(BOTH '-' FROM regexp_replace(
+        translate(
+            replace(replace(replace(replace(replace(replace(replace(replace(
+                lower(COALESCE(title, '')),
+                'ж', 'zh'), 'ч', 'ch'), 'ш', 'sh'), 'щ', 'sch'), 'ю', 'yu'), 'я', 'ya'), 'х', 'kh'), 'ц', 'ts'),
+            'абвгдеёзийклмнопрстуфыэьъ', 'abvgdeezijklmnoprstufye'
+        ),
+        '[^a-z0-9]+', '-', 'g'
+    )), 60), '-'), ''), 'task');
+$$ LANGUAGE sql IMMUTABLE;
+
+-- назначает задаче имя для адресов, при совпадении с именем другой задачи
+-- рабочего пространства добавляет номер: fix-login, fix-login-2, ...
+CREATE FUNCTION assign_task_slug() RETURNS TRIGGER AS $$
+DECLARE
+    base TEXT;
+    n INTEGER := 1;
+BEGIN
+    IF NEW.slug IS NOT NULL THEN
+        RETURN NEW;
+    END IF;
+    base := slugify(NEW.title);
+    NEW.slug := base;
+    WHILE EXISTS (SELECT 1 FROM tasks WHERE tenant_id = NEW.tenant_id AND slug = NEW.slug) LOOP
+        n := n + 1;
+        NEW.slug := base || '-' || n;
+    END LOOP;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER tasks_assign_slug
+BEFORE INSERT ON tasks
+FOR EACH ROW EXECUTE FUNCTION assign_task_slug();
+
+CREATE UNIQUE INDEX tasks_slug_idx ON tasks (tenant_id, slug);
+
+-- отложенных задач немного, индекс нужен для периодического снятия откладывания
+CREATE INDEX tasks_snoozed_until_idx ON tasks (snoozed_until) WHERE snoozed_until IS NOT NULL;
+
+-- удалённые задачи для синхронизации клиентов
+CREATE TABLE deleted_tasks (
+    task_id INTEGER PRIMARY KEY,
+    tenant_id INTEGER NOT NULL DEFAULT 0, -- рабочее пространство
+    deleted BIGINT NOT NULL DEFAULT extract(epoch from now()), -- время удаления
+    viewers INTEGER[] -- пользователи с доступом к приватной задаче, NULL - задача не была приватной
+);
+
+-- выполняется до удаления, пока права доступа к задаче ещё не удалены каскадно
+CREATE FUNCTION record_deleted_task() RETURNS TRIGGER AS $$
+BEGIN
+    INSERT INTO deleted_tasks (task_id, tenant_id, viewers)
+    VALUES (
+        OLD.id,
+        OLD.tenant_id,
+        CASE WHEN OLD.visibility = 'private' THEN
+            ARRAY[OLD.author_id, OLD.assigned_id] ||
+            ARRAY(SELECT user_id FROM task_grants WHERE task_id = OLD.id AND user_id IS NOT NULL)
+        END
+    );
+    RETURN OLD;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER tasks_record_deleted
+BEFORE DELETE ON tasks
+FOR EACH ROW EXECUTE FUNCTION record_deleted_task();
+
+-- задачи, перенесённые в архив в хранилище объектов
+CREATE TABLE archived_tasks (
+    task_id INTEGER PRIMARY KEY,
+    tenant_id INTEGER NOT NULL DEFAULT 0, -- рабочее пространство
+    archive_key TEXT NOT NULL, -- ключ архива в хранилище объектов
+    archived BIGINT NOT NULL DEFAULT extract(epoch from now()) -- время переноса в архив
+);
+
+-- длительные операции (импорт, объединение, перенос в архив) и ход их выполнения
+CREATE TABLE jobs (
+    id SERIAL PRIMARY KEY,
+    tenant_id INTEGER NOT NULL DEFAULT 0, -- рабочее пространство
+    kind TEXT NOT NULL DEFAULT '', -- операция, пустая - задание ещё не запущено
+    state TEXT NOT NULL DEFAULT 'pending' CHECK (state IN ('pending', 'running', 'done', 'failed')),
+    total INTEGER NOT NULL DEFAULT 0, -- количество обрабатываемых объектов
+    processed INTEGER NOT NULL DEFAULT 0, -- количество обработанных объектов
+    chunks INTEGER[] NOT NULL DEFAULT '{}', -- номера пакетов, созданных параллельным импортом
+    errors INTEGER NOT NULL DEFAULT 0, -- количество ошибок
+    error TEXT NOT NULL DEFAULT '', -- последняя ошибка
+    created BIGINT NOT NULL DEFAULT extract(epoch from now()),
+    updated BIGINT NOT NULL DEFAULT extract(epoch from now()),
+    finished BIGINT NOT NULL DEFAULT 0 -- время завершения, 0 - не завершено
+);
+
+-- правила хранения задач рабочих пространств, сроки в секундах, 0 - правило не действует
+CREATE TABLE retention_policies (
+    tenant_id INTEGER PRIMARY KEY, -- рабочее пространство
+    archive_after BIGINT NOT NULL DEFAULT 0 CHECK (archive_after >= 0), -- перенос выполненных задач в архив
+    purge_deleted_after BIGINT NOT NULL DEFAULT 0 CHECK (purge_deleted_after >= 0) -- удаление записей об удалённых задачах
+);
+
+-- снимки названия и содержимого задач при каждом изменении
+CREATE TABLE task_revisions (
+    id SERIAL PRIMARY KEY,
+    task_id INTEGER REFERENCES tasks(id) ON DELETE CASCADE,
+    created BIGINT NOT NULL DEFAULT extract(epoch from now()), -- время изменения
+    title TEXT,
+    content TEXT,
+    label_ids INTEGER[] NOT NULL DEFAULT '{}' -- метки задачи на момент изменения
+);
+
+-- задача, возвращаемая из архива (tasks.rehydrate = 'on'), приходит вместе со своими ревизиями
+CREATE FUNCTION record_task_revision() RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP = 'INSERT' AND current_setting('tasks.rehydrate', true) = 'on' THEN
+        RETURN NEW;
+    END IF;
+    INSERT INTO task_revisions (task_id, title, content, label_ids)
+    VALUES (
+        NEW.id,
+        NEW.title,
+        NEW.content,
+        ARRAY(SELECT label_id FROM tasks_labels WHERE task_id = NEW.id AND label_id IS NOT NULL ORDER BY label_id)
+    );
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER tasks_record_revision_insert
+AFTER INSERT ON tasks
+FOR EACH ROW EXECUTE FUNCTION record_task_revision();
+
+CREATE TRIGGER tasks_record_revision_update
+AFTER UPDATE OF title, content ON tasks
+FOR EACH ROW
+WHEN (OLD.title IS DISTINCT FROM NEW.title OR OLD.content IS DISTINCT FROM NEW.content)
+EXECUTE FUNCTION record_task_revision();
+
+-- триграммный индекс для поиска похожих задач
+CREATE INDEX tasks_title_trgm_idx ON tasks USING GIN (title gin_trgm_ops);
+
+-- индексы для частых фильтров
+CREATE INDEX tasks_author_id_idx ON tasks (author_id);
+CREATE INDEX tasks_assigned_id_idx ON tasks (assigned_id);
+CREATE INDEX tasks_closed_idx ON tasks (closed);
+
+-- количество задач по ответственным для панелей мониторинга, обновляется RefreshStats
+CREATE MATERIALIZED VIEW task_stats AS
+SELECT
+    tenant_id,
+    COALESCE(assigned_id, 0) AS assigned_id,
+    count(*) FILTER (WHERE closed = 0) AS open, -- открытые задачи
+    count(*) FILTER (WHERE closed > 0) AS closed, -- выполненные задачи
+    extract(epoch from now())::bigint AS refreshed -- время обновления
+FROM tasks
+GROUP BY tenant_id, COALESCE(assigned_id, 0);
+
+-- уникальный индекс нужен для REFRESH MATERIALIZED VIEW CONCURRENTLY
+CREATE UNIQUE INDEX task_stats_tenant_assigned_idx ON task_stats (tenant_id, assigned_id);
+
+-- кэш HTML, отрисованного из Markdown содержимого задачи;
+-- запись действительна, пока её версия совпадает с версией задачи
+CREATE TABLE task_html (
+    task_id INTEGER PRIMARY KEY REFERENCES tasks(id) ON DELETE CASCADE,
+    version INTEGER NOT NULL, -- версия задачи, из которой отрисован HTML
+    html TEXT NOT NULL
+);
+
+-- кэш превью ссылок из содержимого задач по рабочим пространствам;
+-- ссылка добавляется при просмотре задачи и загружается командой taskctl fetch-previews
+CREATE TABLE link_previews (
+    tenant_id INTEGER NOT NULL DEFAULT 0, -- рабочее пространство
+    url TEXT NOT NULL,
+    requested BIGINT NOT NULL DEFAULT extract(epoch from now()), -- время первого запроса превью
+    fetched BIGINT, -- время загрузки, NULL - ожидает загрузки
+    title TEXT NOT NULL DEFAULT '',
+    description TEXT NOT NULL DEFAULT '',
+    image TEXT NOT NULL DEFAULT '', -- адрес изображения
+    site_name TEXT NOT NULL DEFAULT '',
+    error TEXT NOT NULL DEFAULT '', -- ошибка загрузки, превью с ошибкой не показывается
+    PRIMARY KEY (tenant_id, url)
+);
+
+CREATE INDEX link_previews_pending_idx ON link_previews (requested) WHERE fetched IS NULL;
+
+-- переводы названия и содержимого задач, исходный текст задачи считается языком по умолчанию
+CREATE TABLE task_translations (
+    task_id INTEGER NOT NULL REFERENCES tasks(id) ON DELETE CASCADE,
+    locale TEXT NOT NULL, -- язык перевода, например en или pt-BR
+    title TEXT NOT NULL,
+    content TEXT NOT NULL,
+    PRIMARY KEY (task_id, locale)
 );
 
 -- связь многие - ко- многим между задачами и метками
@@ -33,6 +305,330 @@ CREATE TABLE tasks_labels (
     task_id INTEGER REFERENCES tasks(id) ON DELETE CASCADE,
     label_id INTEGER REFERENCES labels(id) ON DELETE CASCADE
 );
+
+CREATE INDEX tasks_labels_label_id_idx ON tasks_labels (label_id);
+
+-- настройки приёма задач рабочего пространства: значения по умолчанию и обязательные поля
+CREATE TABLE intake_settings (
+    tenant_id INTEGER PRIMARY KEY, -- рабочее пространство
+    default_assignee INTEGER REFERENCES users(id) ON DELETE SET NULL, -- ответственный новых задач
+    label_ids INTEGER[] NOT NULL DEFAULT '{}', -- метки новых задач, удалённые метки пропускаются
+    required_fields TEXT[] NOT NULL DEFAULT '{}', -- поля, которые нельзя оставить пустыми при создании
+    unique_titles BOOLEAN NOT NULL DEFAULT false -- названия задач уникальны без учёта регистра
+);
+
+-- названия задач рабочих пространств с уникальными названиями в нижнем регистре
+CREATE TABLE task_title_keys (
+    task_id INTEGER PRIMARY KEY REFERENCES tasks(id) ON DELETE CASCADE,
+    tenant_id INTEGER NOT NULL, -- рабочее пространство
+    title_key TEXT NOT NULL,
+    CONSTRAINT task_title_keys_unique UNIQUE (tenant_id, title_key)
+);
+
+-- сохраняет название задачи в task_title_keys, если в рабочем пространстве включены уникальные названия
+-- задача, возвращаемая из архива, не занимает название, которое уже использует другая задача
+CREATE FUNCTION record_title_key() RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP = 'INSERT' AND current_setting('tasks.rehydrate', true) = 'on' THEN
+        INSERT INTO task_title_keys (task_id, tenant_id, title_key)
+        SELECT NEW.id, NEW.tenant_id, lower(COALESCE(NEW.title, ''))
+        WHERE (SELECT unique_titles FROM intake_settings WHERE tenant_id = NEW.tenant_id)
+        ON CONFLICT DO NOTHING;
+        RETURN NEW;
+    END IF;
+    IF (SELECT unique_titles FROM intake_settings WHERE tenant_id = NEW.tenant_id) THEN
+        INSERT INTO task_title_keys (task_id, tenant_id, title_key)
+        VALUES (NEW.id, NEW.tenant_id, lower(COALESCE(NEW.title, '')))
+        ON CONFLICT (task_id) DO UPDATE SET title_key = EXCLUDED.title_key;
+    END IF;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER tasks_record_title_key
+AFTER INSERT OR UPDATE OF title ON tasks
+FOR EACH ROW EXECUTE FUNCTION record_title_key();
+
+-- формы приёма задач: описание полей в JSON и шаблоны названия и содержимого в синтаксисе text/template
+CREATE TABLE task_forms (
+    id SERIAL PRIMARY KEY,
+    tenant_id INTEGER NOT NULL DEFAULT 0, -- рабочее пространство
+    name TEXT NOT NULL,
+    fields JSONB NOT NULL DEFAULT '[]',
+    title_template TEXT NOT NULL,
+    content_template TEXT NOT NULL DEFAULT ''
+);
+
+-- правила автоматической разметки: при создании задачи ей добавляется метка правила,
+-- если задача подходит под все заданные условия; шаблоны - регулярные выражения без учёта регистра
+CREATE TABLE label_rules (
+    id SERIAL PRIMARY KEY,
+    tenant_id INTEGER NOT NULL DEFAULT 0, -- рабочее пространство
+    label_id INTEGER NOT NULL REFERENCES labels(id) ON DELETE CASCADE,
+    title_pattern TEXT, -- шаблон названия, NULL - любое
+    content_pattern TEXT, -- шаблон текста, NULL - любой
+    author_id INTEGER REFERENCES users(id) ON DELETE CASCADE, -- автор задачи, NULL - любой
+    enabled BOOLEAN NOT NULL DEFAULT true,
+    CHECK (title_pattern IS NOT NULL OR content_pattern IS NOT NULL OR author_id IS NOT NULL)
+);
+
+-- подходит ли задача с названием title, текстом content и автором author под условия правила разметки
+CREATE FUNCTION label_rule_matches(
+    title_pattern TEXT, content_pattern TEXT, author_id INTEGER,
+    title TEXT, content TEXT, author INTEGER
+) RETURNS BOOLEAN AS $$
+    SELECT
+        (title_pattern IS NULL OR COALESCE(title, '') ~* title_pattern) AND
+        (content_pattern IS NULL OR COALESCE(content, '') ~* content_pattern) AND
+        (author_id IS NULL OR author = author_id);
+$$ LANGUAGE SQL IMMUTABLE;
+
+-- соглашения об уровне обслуживания: сроки ответа и выполнения в секундах, 0 - без срока;
+-- политика без метки действует для задач, на метки которых нет политик
+CREATE TABLE sla_policies (
+    id SERIAL PRIMARY KEY,
+    tenant_id INTEGER NOT NULL DEFAULT 0, -- рабочее пространство
+    label_id INTEGER REFERENCES labels(id) ON DELETE CASCADE,
+    respond_within BIGINT NOT NULL DEFAULT 0 CHECK (respond_within >= 0),
+    resolve_within BIGINT NOT NULL DEFAULT 0 CHECK (resolve_within >= 0)
+);
+
+CREATE UNIQUE INDEX sla_policies_tenant_label_idx ON sla_policies (tenant_id, COALESCE(label_id, 0));
+
+-- сроки ответа и выполнения задачи по самым строгим из действующих для неё политик
+CREATE FUNCTION task_sla(t tasks, OUT respond_by BIGINT, OUT resolve_by BIGINT) AS $$
+    SELECT
+        t.opened + min(NULLIF(p.respond_within, 0)),
+        t.opened + min(NULLIF(p.resolve_within, 0))
+    FROM sla_policies AS p
+    WHERE p.tenant_id = t.tenant_id AND (
+        p.label_id IN (SELECT label_id FROM tasks_labels WHERE task_id = t.id)
+        OR p.label_id IS NULL AND NOT EXISTS (
+            SELECT 1
+            FROM sla_policies AS lp
+            JOIN tasks_labels AS tl ON tl.label_id = lp.label_id
+            WHERE tl.task_id = t.id AND lp.tenant_id = t.tenant_id
+        )
+    );
+$$ LANGUAGE SQL STABLE;
+
+-- графики дежурств: участники дежурят по очереди сменами заданной длительности
+CREATE TABLE rotations (
+    id SERIAL PRIMARY KEY,
+    tenant_id INTEGER NOT NULL DEFAULT 0, -- рабочее пространство
+    name TEXT NOT NULL,
+    starts BIGINT NOT NULL, -- начало первой смены
+    shift BIGINT NOT NULL CHECK (shift > 0) -- длительность смены в секундах
+);
+
+CREATE TABLE rotation_members (
+    rotation_id INTEGER NOT NULL REFERENCES rotations(id) ON DELETE CASCADE,
+    position INTEGER NOT NULL, -- порядок дежурства
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    PRIMARY KEY (rotation_id, position)
+);
+
+-- дежурный графика в момент at, NULL - график не начался или в нём нет участников
+CREATE FUNCTION on_call(rotation INTEGER, at BIGINT) RETURNS INTEGER AS $$
+    SELECT user_id
+    FROM (
+        SELECT
+            m.user_id,
+            row_number() OVER (ORDER BY m.position) - 1 AS idx,
+            count(*) OVER () AS members,
+            r.starts,
+            r.shift
+        FROM rotations AS r
+        JOIN rotation_members AS m ON m.rotation_id = r.id
+        WHERE r.id = rotation AND at >= r.starts
+    ) AS m
+    WHERE idx = (at - starts) / shift % members;
+$$ LANGUAGE SQL STABLE;
+
+-- правила эскалации: открытая задача с меткой, оставшаяся без ответственного
+-- дольше заданного времени, назначается указанному пользователю или дежурному графика
+CREATE TABLE escalation_rules (
+    id SERIAL PRIMARY KEY,
+    tenant_id INTEGER NOT NULL DEFAULT 0, -- рабочее пространство
+    name TEXT NOT NULL,
+    label_id INTEGER REFERENCES labels(id) ON DELETE CASCADE, -- NULL - задачи с любыми метками
+    unassigned_after BIGINT NOT NULL CHECK (unassigned_after >= 0), -- время без ответственного в секундах
+    assign_to INTEGER REFERENCES users(id) ON DELETE CASCADE, -- кому назначить задачу
+    rotation_id INTEGER REFERENCES rotations(id) ON DELETE CASCADE, -- или дежурному какого графика
+    enabled BOOLEAN NOT NULL DEFAULT true,
+    CHECK ((assign_to IS NULL) <> (rotation_id IS NULL))
+);
+
+-- журнал срабатываний правил эскалации
+CREATE TABLE escalation_log (
+    id BIGSERIAL PRIMARY KEY,
+    rule_id INTEGER NOT NULL REFERENCES escalation_rules(id) ON DELETE CASCADE,
+    task_id INTEGER NOT NULL REFERENCES tasks(id) ON DELETE CASCADE,
+    assigned_id INTEGER NOT NULL, -- назначенный пользователь
+    executed BIGINT NOT NULL DEFAULT extract(epoch from now()) -- время срабатывания
+);
+
+CREATE INDEX escalation_log_rule_id_idx ON escalation_log (rule_id);
+
+-- учёт затраченного на задачи времени
+CREATE TABLE task_time_log (
+    id SERIAL PRIMARY KEY,
+    task_id INTEGER NOT NULL REFERENCES tasks(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL DEFAULT 0 REFERENCES users(id) ON DELETE SET DEFAULT, -- кто затратил время
+    spent BIGINT NOT NULL CHECK (spent > 0), -- затраченное время в секундах
+    logged BIGINT NOT NULL DEFAULT extract(epoch from now()) -- время записи
+);
+
+CREATE INDEX task_time_log_task_id_idx ON task_time_log (task_id);
+
+-- задача, над которой пользователь работает сейчас
+CREATE TABLE current_tasks (
+    user_id INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    task_id INTEGER NOT NULL REFERENCES tasks(id) ON DELETE CASCADE,
+    started BIGINT NOT NULL DEFAULT extract(epoch from now()) -- время начала работы над задачей
+);
+
+CREATE INDEX current_tasks_task_id_idx ON current_tasks (task_id);
+
+-- снимает выполненную задачу с текущей работы пользователей
+CREATE FUNCTION clear_current_task() RETURNS TRIGGER AS $$
+BEGIN
+    DELETE FROM current_tasks WHERE task_id = NEW.id;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER tasks_clear_current_task
+AFTER UPDATE OF closed ON tasks
+FOR EACH ROW
+WHEN (OLD.closed = 0 AND NEW.closed <> 0)
+EXECUTE FUNCTION clear_current_task();
+
+-- история изменений задач
+CREATE TABLE task_history (
+    id SERIAL PRIMARY KEY,
+    task_id INTEGER REFERENCES tasks(id) ON DELETE CASCADE,
+    changed BIGINT NOT NULL DEFAULT extract(epoch from now()), -- время изменения
+    field TEXT NOT NULL, -- изменённый атрибут задачи
+    old_value TEXT, -- значение до изменения
+    new_value TEXT -- значение после изменения
+);
+
+-- токены доступа к API
+CREATE TABLE api_tokens (
+    id SERIAL PRIMARY KEY,
+    tenant_id INTEGER NOT NULL DEFAULT 0, -- рабочее пространство
+    user_id INTEGER REFERENCES users(id) ON DELETE CASCADE, -- владелец токена
+    name TEXT NOT NULL, -- описание токена
+    token_hash TEXT NOT NULL UNIQUE, -- SHA-256 секрета, сам секрет не хранится
+    created BIGINT NOT NULL DEFAULT extract(epoch from now()), -- время создания
+    expires BIGINT NOT NULL DEFAULT 0, -- время истечения, 0 - бессрочный
+    revoked BIGINT NOT NULL DEFAULT 0 -- время отзыва
+);
+
+-- сессии веб-интерфейса
+CREATE TABLE sessions (
+    id SERIAL PRIMARY KEY,
+    tenant_id INTEGER NOT NULL DEFAULT 0, -- рабочее пространство
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE, -- пользователь сессии
+    token_hash TEXT NOT NULL UNIQUE, -- SHA-256 секрета, сам секрет не хранится
+    created BIGINT NOT NULL DEFAULT extract(epoch from now()), -- время создания
+    expires BIGINT NOT NULL -- время истечения
+);
+
+CREATE INDEX sessions_expires_idx ON sessions (expires);
+
+-- ограничение частоты запросов пользователей по алгоритму token bucket
+CREATE TABLE rate_limits (
+    tenant_id INTEGER NOT NULL DEFAULT 0, -- рабочее пространство
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    key TEXT NOT NULL, -- название ограничения
+    tokens DOUBLE PRECISION NOT NULL, -- доступное количество запросов
+    updated DOUBLE PRECISION NOT NULL, -- время последнего списания с долями секунды
+    PRIMARY KEY (tenant_id, user_id, key)
+);
+
+-- явный доступ пользователей к задачам
+CREATE TABLE task_grants (
+    task_id INTEGER REFERENCES tasks(id) ON DELETE CASCADE,
+    user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+    PRIMARY KEY (task_id, user_id)
+);
+
+-- публичные ссылки на задачи, дающие доступ на чтение без учётной записи
+CREATE TABLE share_links (
+    id SERIAL PRIMARY KEY,
+    tenant_id INTEGER NOT NULL DEFAULT 0, -- рабочее пространство
+    task_id INTEGER NOT NULL REFERENCES tasks(id) ON DELETE CASCADE,
+    created_by INTEGER NOT NULL DEFAULT 0 REFERENCES users(id) ON DELETE SET DEFAULT, -- создатель ссылки
+    token_hash TEXT NOT NULL UNIQUE, -- SHA-256 секрета, сам секрет не хранится
+    created BIGINT NOT NULL DEFAULT extract(epoch from now()), -- время создания
+    expires BIGINT NOT NULL DEFAULT 0, -- время истечения, 0 - бессрочная
+    revoked BIGINT NOT NULL DEFAULT 0 -- время отзыва
+);
+
+-- журнал просмотров задач по публичным ссылкам
+CREATE TABLE share_link_views (
+    link_id INTEGER NOT NULL REFERENCES share_links(id) ON DELETE CASCADE,
+    viewed BIGINT NOT NULL DEFAULT extract(epoch from now()), -- время просмотра
+    client TEXT NOT NULL DEFAULT '' -- описание клиента, например адрес и User-Agent
+);
+
+CREATE INDEX share_link_views_link_id_idx ON share_link_views (link_id);
+
+-- жалобы пользователей на задачи, ожидающие решения модератора
+CREATE TABLE task_flags (
+    id SERIAL PRIMARY KEY,
+    task_id INTEGER NOT NULL REFERENCES tasks(id) ON DELETE CASCADE,
+    reporter_id INTEGER NOT NULL DEFAULT 0 REFERENCES users(id) ON DELETE SET DEFAULT, -- автор жалобы
+    reason TEXT NOT NULL CHECK (reason IN ('spam', 'abuse', 'off-topic', 'other')),
+    note TEXT NOT NULL DEFAULT '', -- пояснение автора жалобы
+    created BIGINT NOT NULL DEFAULT extract(epoch from now()), -- время жалобы
+    resolved BIGINT, -- время решения, NULL - жалоба в очереди модерации
+    resolution TEXT CHECK (resolution IN ('hide', 'delete', 'dismiss')) -- решение модератора
+);
+
+-- пользователь может оставить только одну нерассмотренную жалобу на задачу
+CREATE UNIQUE INDEX task_flags_open_idx ON task_flags (task_id, reporter_id) WHERE resolved IS NULL;
+
+-- проверка доступа пользователя к задаче, пользователь 0 - системный доступ без ограничений
+CREATE FUNCTION can_access(viewer INTEGER, t tasks) RETURNS BOOLEAN AS $$
+    SELECT viewer = 0
+        OR t.visibility = 'public'
+        OR t.author_id = viewer
+        OR t.assigned_id = viewer
+        OR (t.visibility = 'project' AND EXISTS (
+            SELECT 1 FROM users AS u WHERE u.id = viewer AND u.tenant_id = t.tenant_id
+        ))
+        OR EXISTS (
+            SELECT 1 FROM task_grants AS g WHERE g.task_id = t.id AND g.user_id = viewer
+        );
+$$ LANGUAGE SQL STABLE;
+
+-- отложена ли задача, срок откладывания сравнивается с текущим временем
+CREATE FUNCTION snoozed(t tasks) RETURNS BOOLEAN AS $$
+    SELECT COALESCE(t.snoozed_until > extract(epoch from now()), false);
+$$ LANGUAGE SQL STABLE;
+
+-- журнал аудита административных действий, записи нельзя изменять и удалять
+CREATE TABLE audit_log (
+    id BIGSERIAL PRIMARY KEY,
+    tenant_id INTEGER NOT NULL DEFAULT 0, -- рабочее пространство
+    actor_id INTEGER NOT NULL, -- пользователь, выполнивший действие, без ссылки на users, чтобы запись пережила удаление пользователя
+    created BIGINT NOT NULL DEFAULT extract(epoch from now()), -- время действия
+    action TEXT NOT NULL, -- действие
+    payload JSONB NOT NULL DEFAULT '{}' -- параметры действия
+);
+
+CREATE FUNCTION audit_log_append_only() RETURNS TRIGGER AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_log is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_log_append_only
+BEFORE UPDATE OR DELETE OR TRUNCATE ON audit_log
+FOR EACH STATEMENT EXECUTE FUNCTION audit_log_append_only();
 -- наполнение БД начальными данными
 INSERT INTO users (id, name) VALUES (0, 'default');
 
@@ -0,0 +1,249 @@
+// Пакет datagen генерирует правдоподобные тестовые данные хранилища задач:
+// имена пользователей, дерево меток и задачи с авторами, ответственными, метками
+// и временем создания и выполнения. Данные зависят только от Config и порядка
+// вызовов генератора, поэтому наборы данных для нагрузочного тестирования,
+// демонстраций и тестов воспроизводятся по начальному значению.
+package datagen
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"strings"
+	"time"
+
+	"SF-HW-30.8.1/pkg/storage"
+)
+
+// Параметры распределений генератора, нулевые значения заменяются значениями по умолчанию.
+type Config struct {
+	Seed int64
+	Now  time.Time // момент, до которого создаются задачи, нулевой - 2024-01-01 UTC
+	// период до Now, в котором равномерно распределено время создания задач, 0 - год
+	Period time.Duration
+	// доля выполненных задач, 0 - 0.7, отрицательная - выполненных задач нет
+	ClosedRatio float64
+	// среднее время от создания до выполнения задачи, распределённое экспоненциально, 0 - неделя
+	MeanTimeToClose time.Duration
+	// доля задач без ответственного, 0 - 0.25, отрицательная - у всех задач есть ответственный
+	UnassignedRatio float64
+	// неравномерность распределения задач по пользователям и меткам: показатель
+	// распределения Ципфа больше 1, при 1 и меньше - равномерное распределение;
+	// 0 - 1.2, при котором небольшая часть пользователей создаёт большую часть задач
+	Skew      float64
+	MaxLabels int // наибольшее количество меток задачи, 0 - 3, отрицательное - без меток
+}
+
+// Задача с названиями меток. AuthorID и AssignedID - id из списка пользователей,
+// переданного генератору, ID не заполняется.
+type Task struct {
+	storage.Task
+	Labels []string
+}
+
+// Генератор тестовых данных. Не предназначен для одновременного использования
+// из нескольких горутин.
+type Generator struct {
+	rnd *rand.Rand
+	c   Config
+}
+
+// New создаёт генератор с параметрами c.
+func New(c Config) *Generator {
+	if c.Now.IsZero() {
+		c.Now = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	}
+	if c.Period == 0 {
+		c.Period = 365 * 24 * time.Hour
+	}
+	if c.ClosedRatio == 0 {
+		c.ClosedRatio = 0.7
+	}
+	if c.MeanTimeToClose == 0 {
+		c.MeanTimeToClose = 7 * 24 * time.Hour
+	}
+	if c.UnassignedRatio == 0 {
+		c.UnassignedRatio = 0.25
+	}
+	if c.Skew == 0 {
+		c.Skew = 1.2
+	}
+	if c.MaxLabels == 0 {
+		c.MaxLabels = 3
+	}
+
+	return &Generator{rnd: rand.New(rand.NewSource(c.Seed)), c: c}
+}
+
+var (
+	firstNames = []string{
+		"Anna", "Boris", "Daria", "Egor", "Irina", "Kirill", "Maria", "Nikita", "Olga", "Pavel",
+		"Alice", "Ben", "Chloe", "David", "Emma", "Frank", "Grace", "Henry", "Julia", "Leo",
+	}
+	lastNames = []string{
+		"Ivanova", "Petrov", "Smirnova", "Kuznetsov", "Popova", "Sokolov", "Lebedeva", "Kozlov",
+		"Smith", "Johnson", "Brown", "Taylor", "Wilson", "Davies", "Evans", "Thomas",
+	}
+	// метки верхнего уровня и их дочерние метки
+	labelTree = []struct {
+		name     string
+		children []string
+	}{
+		{"bug", []string{"crash", "regression", "ui-glitch"}},
+		{"feature", []string{"enhancement", "integration"}},
+		{"backend", []string{"api", "database", "auth"}},
+		{"frontend", []string{"web", "mobile"}},
+		{"docs", nil},
+		{"ops", []string{"ci", "monitoring"}},
+		{"security", nil},
+		{"performance", nil},
+	}
+	verbs = []string{
+		"Fix", "Add", "Remove", "Refactor", "Document", "Investigate", "Speed up", "Test",
+		"Migrate", "Update", "Support", "Clean up",
+	}
+	nouns = []string{
+		"login page", "search", "CSV export", "email notifications", "user settings", "billing",
+		"API rate limits", "onboarding flow", "dashboard", "password reset", "file uploads",
+		"audit log", "mobile layout", "session handling", "report builder", "webhooks",
+	}
+	qualifiers = []string{
+		"", "", "", "on mobile", "in Safari", "after upgrade", "for large workspaces",
+		"under load", "for new users", "in dark mode",
+	}
+	sentences = []string{
+		"Reported by several customers this week.",
+		"Happens only after the session expires.",
+		"The error does not appear in the logs.",
+		"Blocks the next release.",
+		"See the attached screenshot for details.",
+		"Works as expected on staging.",
+		"We should add a test to prevent this from happening again.",
+		"The current behaviour is confusing for new users.",
+		"Needs a decision from the product team.",
+		"Probably related to the recent dependency update.",
+	}
+)
+
+// UserNames возвращает n имён пользователей, неповторяющихся в пределах вызова.
+func (g *Generator) UserNames(n int) []string {
+	names := make([]string, n)
+	used := make(map[string]int, n)
+	for i := range names {
+		name := firstNames[g.rnd.Intn(len(firstNames))] + " " + lastNames[g.rnd.Intn(len(lastNames))]
+		used[name]++
+		if used[name] > 1 {
+			name = fmt.Sprintf("%s %d", name, used[name])
+		}
+		names[i] = name
+	}
+
+	return names
+}
+
+// Labels возвращает n меток, родительские метки идут раньше дочерних. Когда
+// названия заканчиваются, к ним добавляется номер.
+func (g *Generator) Labels(n int) []storage.Label {
+	var all []storage.Label
+	for _, l := range labelTree {
+		all = append(all, storage.Label{Name: l.name})
+		for _, child := range l.children {
+			all = append(all, storage.Label{Name: child, Parent: l.name})
+		}
+	}
+
+	labels := make([]storage.Label, n)
+	for i := range labels {
+		l := all[i%len(all)]
+		if round := i / len(all); round > 0 {
+			l.Name = fmt.Sprintf("%s-%d", l.Name, round+1)
+			if l.Parent != "" {
+				l.Parent = fmt.Sprintf("%s-%d", l.Parent, round+1)
+			}
+		}
+		labels[i] = l
+	}
+
+	return labels
+}
+
+// Task возвращает задачу, автор и ответственный которой выбираются из users,
+// а метки - из labels. Без пользователей автор и ответственный остаются нулевыми.
+func (g *Generator) Task(users []int, labels []storage.Label) Task {
+	var t Task
+
+	title := verbs[g.rnd.Intn(len(verbs))] + " " + nouns[g.rnd.Intn(len(nouns))]
+	if q := qualifiers[g.rnd.Intn(len(qualifiers))]; q != "" {
+		title += " " + q
+	}
+	t.Title = title
+	t.Content = g.content()
+
+	opened := g.c.Now.Add(-time.Duration(g.rnd.Int63n(int64(g.c.Period)))).Truncate(time.Second)
+	t.Opened = opened
+	if g.rnd.Float64() < g.c.ClosedRatio {
+		closed := opened.Add(time.Duration(g.rnd.ExpFloat64() * float64(g.c.MeanTimeToClose))).Truncate(time.Second)
+		// задача, которая выполнилась бы позже Now, остаётся открытой
+		if !closed.After(g.c.Now) {
+			t.Closed = &closed
+		}
+	}
+
+	if len(users) > 0 {
+		t.AuthorID = users[g.pick(len(users))]
+		if g.rnd.Float64() >= g.c.UnassignedRatio {
+			t.AssignedID = users[g.pick(len(users))]
+		}
+	}
+
+	if len(labels) > 0 && g.c.MaxLabels > 0 {
+		n := g.rnd.Intn(g.c.MaxLabels + 1)
+		seen := make(map[string]bool, n)
+		for i := 0; i < n; i++ {
+			name := labels[g.pick(len(labels))].Name
+			if !seen[name] {
+				seen[name] = true
+				t.Labels = append(t.Labels, name)
+			}
+		}
+	}
+
+	return t
+}
+
+// Tasks возвращает n задач, как Task.
+func (g *Generator) Tasks(n int, users []int, labels []storage.Label) []Task {
+	tasks := make([]Task, n)
+	for i := range tasks {
+		tasks[i] = g.Task(users, labels)
+	}
+	return tasks
+}
+
+// content возвращает содержимое задачи из одного или двух абзацев.
+func (g *Generator) content() string {
+	paragraphs := make([]string, 1+g.rnd.Intn(2))
+	for i := range paragraphs {
+		n := 1 + g.rnd.Intn(3)
+		s := make([]string, n)
+		for j := range s {
+			s[j] = sentences[g.rnd.Intn(len(sentences))]
+		}
+		paragraphs[i] = strings.Join(s, " ")
+	}
+	return strings.Join(paragraphs, "\n\n")
+}
+
+// pick возвращает индекс от 0 до n-1 по распределению Ципфа с показателем Skew,
+// первые индексы выбираются чаще, или равномерно.
+func (g *Generator) pick(n int) int {
+	if g.c.Skew <= 1 || n == 1 {
+		return g.rnd.Intn(n)
+	}
+	// rand.Zipf создаётся для одного n, поэтому индекс получается обратной функцией
+	// непрерывного приближения распределения
+	u := g.rnd.Float64()
+	s := g.c.Skew
+	x := math.Pow(1-u*(1-math.Pow(float64(n)+1, 1-s)), 1/(1-s)) - 1
+	return min(int(x), n-1)
+}
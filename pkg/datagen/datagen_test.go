@@ -0,0 +1,112 @@
+package datagen
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestGenerator_deterministic(t *testing.T) {
+	generate := func(seed int64) ([]string, []Task) {
+		g := New(Config{Seed: seed})
+		names := g.UserNames(20)
+		tasks := g.Tasks(50, []int{1, 2, 3}, g.Labels(10))
+		return names, tasks
+	}
+
+	names1, tasks1 := generate(1)
+	names2, tasks2 := generate(1)
+	if !reflect.DeepEqual(names1, names2) || !reflect.DeepEqual(tasks1, tasks2) {
+		t.Errorf("same seed: want equal data")
+	}
+	_, tasks3 := generate(2)
+	if reflect.DeepEqual(tasks1, tasks3) {
+		t.Errorf("different seeds: want different tasks")
+	}
+}
+
+func TestGenerator_UserNames(t *testing.T) {
+	names := New(Config{}).UserNames(1000)
+	seen := make(map[string]bool)
+	for _, name := range names {
+		if seen[name] {
+			t.Fatalf("duplicate name %q", name)
+		}
+		seen[name] = true
+	}
+}
+
+func TestGenerator_Labels(t *testing.T) {
+	labels := New(Config{}).Labels(40)
+	seen := make(map[string]bool)
+	for _, l := range labels {
+		if seen[l.Name] {
+			t.Fatalf("duplicate label %q", l.Name)
+		}
+		if l.Parent != "" && !seen[l.Parent] {
+			t.Errorf("label %q: parent %q must come first", l.Name, l.Parent)
+		}
+		seen[l.Name] = true
+	}
+}
+
+func TestGenerator_Task(t *testing.T) {
+	now := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	users := []int{10, 20, 30, 40, 50, 60, 70, 80, 90, 100}
+	g := New(Config{Seed: 7, Now: now, Period: 30 * 24 * time.Hour, ClosedRatio: 0.5, UnassignedRatio: -1})
+	labels := g.Labels(5)
+	tasks := g.Tasks(5000, users, labels)
+
+	var closed int
+	authors := make(map[int]int)
+	for _, task := range tasks {
+		if task.Title == "" || task.Content == "" {
+			t.Fatalf("task without title or content: %+v", task)
+		}
+		if task.Opened.After(now) || task.Opened.Before(now.Add(-30*24*time.Hour)) {
+			t.Fatalf("opened: want within period, got %v", task.Opened)
+		}
+		if task.Closed != nil {
+			closed++
+			if task.Closed.Before(task.Opened) || task.Closed.After(now) {
+				t.Fatalf("closed: want between %v and %v, got %v", task.Opened, now, task.Closed)
+			}
+		}
+		if task.AssignedID == 0 {
+			t.Fatalf("assigned: want user, got 0")
+		}
+		if len(task.Labels) > 3 {
+			t.Fatalf("labels: want at most 3, got %v", task.Labels)
+		}
+		authors[task.AuthorID]++
+	}
+
+	// часть задач, которые выполнились бы позже Now, остаётся открытой
+	if ratio := float64(closed) / float64(len(tasks)); ratio < 0.35 || ratio > 0.55 {
+		t.Errorf("closed ratio: want about 0.5, got %.2f", ratio)
+	}
+	if authors[users[0]] <= authors[users[len(users)-1]] {
+		t.Errorf("authors: want first user more active than last, got %v", authors)
+	}
+}
+
+func TestGenerator_pick(t *testing.T) {
+	g := New(Config{Skew: 2})
+	counts := make([]int, 5)
+	for i := 0; i < 10000; i++ {
+		counts[g.pick(len(counts))]++
+	}
+	for i := 1; i < len(counts); i++ {
+		if counts[i] > counts[i-1] {
+			t.Errorf("counts: want decreasing, got %v", counts)
+			break
+		}
+	}
+
+	g = New(Config{Skew: 1})
+	for i := 0; i < 1000; i++ {
+		if n := g.pick(3); n < 0 || n > 2 {
+			t.Fatalf("pick: want 0..2, got %d", n)
+		}
+	}
+}
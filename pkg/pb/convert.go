@@ -0,0 +1,59 @@
+// Пакет pb содержит protobuf-сообщения общей схемы задач и их преобразование
+// в структуры хранилища и обратно. Сообщения генерируются из proto/tasks/v1
+// командой go generate.
+package pb
+
+//go:generate buf generate ../..
+
+import (
+	"SF-HW-30.8.1/pkg/storage"
+
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// FromTask преобразует задачу хранилища в сообщение.
+func FromTask(t storage.Task) *Task {
+	m := &Task{
+		Id:         int64(t.ID),
+		Title:      t.Title,
+		Content:    t.Content,
+		AuthorId:   int64(t.AuthorID),
+		AssignedId: int64(t.AssignedID),
+		Opened:     timestamppb.New(t.Opened),
+	}
+	if t.Closed != nil {
+		m.Closed = timestamppb.New(*t.Closed)
+	}
+
+	return m
+}
+
+// FromTasks преобразует список задач хранилища в сообщения.
+func FromTasks(tasks []storage.Task) []*Task {
+	msgs := make([]*Task, 0, len(tasks))
+	for _, t := range tasks {
+		msgs = append(msgs, FromTask(t))
+	}
+
+	return msgs
+}
+
+// ToTask преобразует сообщение в задачу хранилища. Время приводится к UTC.
+func (m *Task) ToTask() storage.Task {
+	t := storage.Task{
+		ID:         int(m.GetId()),
+		Title:      m.GetTitle(),
+		Content:    m.GetContent(),
+		AuthorID:   int(m.GetAuthorId()),
+		AssignedID: int(m.GetAssignedId()),
+	}
+	if m.GetOpened() != nil {
+		t.Opened = m.GetOpened().AsTime()
+	}
+	if m.GetClosed() != nil {
+		closed := m.GetClosed().AsTime()
+		t.Closed = &closed
+	}
+
+	return t
+}
@@ -0,0 +1,54 @@
+package pb
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"SF-HW-30.8.1/pkg/storage"
+
+	"google.golang.org/protobuf/proto"
+)
+
+func TestTaskConversion(t *testing.T) {
+	opened := time.Unix(1700000000, 0).UTC()
+	closed := time.Unix(1700003600, 0).UTC()
+	tests := []struct {
+		name string
+		task storage.Task
+	}{
+		{
+			name: "open task",
+			task: storage.Task{ID: 1, Opened: opened, AuthorID: 2, Title: "Title"},
+		},
+		{
+			name: "closed task",
+			task: storage.Task{
+				ID:         2,
+				Opened:     opened,
+				Closed:     &closed,
+				AuthorID:   1,
+				AssignedID: 3,
+				Title:      "Title",
+				Content:    "Content",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := proto.Marshal(FromTask(tt.task))
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			var m Task
+			err = proto.Unmarshal(b, &m)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if got := m.ToTask(); !reflect.DeepEqual(got, tt.task) {
+				t.Errorf("task: want %+v, got %+v", tt.task, got)
+			}
+		})
+	}
+}
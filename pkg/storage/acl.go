@@ -0,0 +1,188 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// Видимость задачи.
+const (
+	VisibilityPublic  = "public"  // видна всем
+	VisibilityProject = "project" // видна пользователям рабочего пространства
+	VisibilityPrivate = "private" // видна автору, ответственному и пользователям с явным доступом
+)
+
+var ErrInvalidVisibility = fmt.Errorf("invalid visibility")
+
+// CanAccess проверяет, доступна ли задача пользователю userID.
+func (s *Storage) CanAccess(userID, taskID int) (bool, error) {
+	var ok bool
+	err := s.db.QueryRow(context.Background(), `
+		SELECT can_access($1, tasks)
+		FROM tasks
+		WHERE id = $2 AND tenant_id = $3
+	`,
+		userID,
+		taskID,
+		s.tenantID,
+	).Scan(&ok)
+	if err == pgx.ErrNoRows {
+		return false, ErrTaskNotFound
+	}
+
+	return ok, err
+}
+
+// SetVisibility устанавливает видимость задачи.
+func (s *Storage) SetVisibility(taskID int, visibility string) error {
+	err := s.authorizeWrite(RoleMaintainer)
+	if err != nil {
+		return err
+	}
+
+	switch visibility {
+	case VisibilityPublic, VisibilityProject, VisibilityPrivate:
+	default:
+		return ErrInvalidVisibility
+	}
+
+	ctx := context.Background()
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx, `
+		UPDATE tasks
+		SET visibility = $2
+		WHERE id = $1 AND tenant_id = $3
+	`,
+		taskID,
+		visibility,
+		s.tenantID,
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrTaskNotFound
+	}
+
+	err = s.audit(ctx, tx, AuditTaskVisibility, map[string]interface{}{
+		"task_id":    taskID,
+		"visibility": visibility,
+	})
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// GrantAccess выдаёт пользователю явный доступ к задаче.
+func (s *Storage) GrantAccess(taskID, userID int) error {
+	err := s.authorizeWrite(RoleMaintainer)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	err = s.checkTaskExists(ctx, tx, taskID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO task_grants (task_id, user_id)
+		VALUES ($1, $2)
+		ON CONFLICT DO NOTHING
+	`,
+		taskID,
+		userID,
+	)
+	if err != nil {
+		return err
+	}
+
+	err = s.audit(ctx, tx, AuditAccessGrant, map[string]interface{}{
+		"task_id": taskID,
+		"user_id": userID,
+	})
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// RevokeAccess отзывает у пользователя явный доступ к задаче.
+func (s *Storage) RevokeAccess(taskID, userID int) error {
+	err := s.authorizeWrite(RoleMaintainer)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	err = s.checkTaskExists(ctx, tx, taskID)
+	if err != nil {
+		return err
+	}
+
+	tag, err := tx.Exec(ctx, `
+		DELETE FROM task_grants
+		WHERE task_id = $1 AND user_id = $2
+	`,
+		taskID,
+		userID,
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return nil
+	}
+
+	err = s.audit(ctx, tx, AuditAccessRevoke, map[string]interface{}{
+		"task_id": taskID,
+		"user_id": userID,
+	})
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// checkTaskExists возвращает ErrTaskNotFound, если задачи нет в рабочем пространстве.
+func (s *Storage) checkTaskExists(ctx context.Context, tx pgx.Tx, taskID int) error {
+	var exists bool
+	err := tx.QueryRow(ctx, `
+		SELECT EXISTS (SELECT 1 FROM tasks WHERE id = $1 AND tenant_id = $2)
+	`,
+		taskID,
+		s.tenantID,
+	).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrTaskNotFound
+	}
+
+	return nil
+}
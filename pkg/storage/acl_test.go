@@ -0,0 +1,132 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestStorage_ACL(t *testing.T) {
+	db, err := storageConnect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close(context.Background()) })
+
+	userID := newTestUser(t, db, "HR Viewer")
+	taskID := newTestTask(t, db, "Salary review")
+	viewer := db.AsUser(userID)
+
+	tests := []struct {
+		name       string
+		visibility string
+		grant      bool
+		wantAccess bool
+	}{
+		{"public task", VisibilityPublic, false, true},
+		{"project task", VisibilityProject, false, true},
+		{"private task", VisibilityPrivate, false, false},
+		{"private task with grant", VisibilityPrivate, true, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := db.SetVisibility(taskID, tt.visibility)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if tt.grant {
+				err = db.GrantAccess(taskID, userID)
+			} else {
+				err = db.RevokeAccess(taskID, userID)
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			ok, err := db.CanAccess(userID, taskID)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if ok != tt.wantAccess {
+				t.Errorf("access: want %v, got %v", tt.wantAccess, ok)
+			}
+
+			_, err = viewer.TaskByID(taskID)
+			if tt.wantAccess && err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+			if !tt.wantAccess && !errors.Is(err, ErrTaskNotFound) {
+				t.Errorf("error: want %v, got %v", ErrTaskNotFound, err)
+			}
+
+			tasks, err := viewer.TasksAll()
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			found := false
+			for _, task := range tasks {
+				if task.ID == taskID {
+					found = true
+				}
+			}
+			if found != tt.wantAccess {
+				t.Errorf("task listed: want %v, got %v", tt.wantAccess, found)
+			}
+		})
+	}
+
+	err = db.SetVisibility(taskID, "secret")
+	if !errors.Is(err, ErrInvalidVisibility) {
+		t.Errorf("error: want %v, got %v", ErrInvalidVisibility, err)
+	}
+	_, err = db.CanAccess(userID, 99999)
+	if !errors.Is(err, ErrTaskNotFound) {
+		t.Errorf("error: want %v, got %v", ErrTaskNotFound, err)
+	}
+	err = db.GrantAccess(99999, userID)
+	if !errors.Is(err, ErrTaskNotFound) {
+		t.Errorf("error: want %v, got %v", ErrTaskNotFound, err)
+	}
+}
+
+func TestStorage_ACLWrites(t *testing.T) {
+	db, err := storageConnect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close(context.Background()) })
+
+	userID := newTestUser(t, db, "Outsider")
+	taskID := newTestTask(t, db, "Private plan")
+	outsider := db.AsUser(userID)
+	err = db.SetVisibility(taskID, VisibilityPrivate)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	revisions, err := db.TaskRevisions(taskID)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	err = outsider.UpdateTask(taskID, 0, 0, "Renamed by outsider", "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	_, err = outsider.SplitTask(taskID, []NewTaskInput{{Title: "Copied part"}}, true)
+	if !errors.Is(err, ErrTaskNotFound) {
+		t.Errorf("SplitTask error: want %v, got %v", ErrTaskNotFound, err)
+	}
+	err = outsider.RevertTask(taskID, revisions[0].ID, false)
+	if !errors.Is(err, ErrRevisionNotFound) {
+		t.Errorf("RevertTask error: want %v, got %v", ErrRevisionNotFound, err)
+	}
+
+	task, err := db.TaskByID(taskID)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if task.Title != "Private plan" || task.Closed != nil {
+		t.Errorf("task: want unchanged, got %+v", task)
+	}
+}
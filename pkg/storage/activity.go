@@ -0,0 +1,75 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// Активность пользователя за день.
+type ActivityDay struct {
+	Date    time.Time // начало дня в UTC
+	Created int       // созданные пользователем задачи
+	Closed  int       // выполненные задачи, назначенные пользователю
+	Logged  int       // записи затраченного пользователем времени
+}
+
+// Total возвращает общее количество действий за день.
+func (d ActivityDay) Total() int {
+	return d.Created + d.Closed + d.Logged
+}
+
+// UserActivityHeatmap возвращает активность пользователя userID по дням года year
+// в UTC, включая дни без активности, для календаря активности.
+// Выполнение задачи засчитывается её ответственному.
+func (s *Storage) UserActivityHeatmap(userID, year int) ([]ActivityDay, error) {
+	from := time.Date(year, time.January, 1, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(1, 0, 0)
+
+	ctx := context.Background()
+	rows, err := s.db.Query(ctx, `
+		WITH events AS (
+			SELECT t.opened AS at, 1 AS created, 0 AS closed, 0 AS logged
+			FROM tasks AS t
+			WHERE t.author_id = $1 AND t.opened >= $4 AND t.opened < $5 AND t.tenant_id = $2 AND can_access($3, t)
+			UNION ALL
+			SELECT t.closed, 0, 1, 0
+			FROM tasks AS t
+			WHERE t.assigned_id = $1 AND t.closed >= $4 AND t.closed < $5 AND t.tenant_id = $2 AND can_access($3, t)
+			UNION ALL
+			SELECT l.logged, 0, 0, 1
+			FROM task_time_log AS l
+			JOIN tasks AS t
+			ON t.id = l.task_id
+			WHERE l.user_id = $1 AND l.logged >= $4 AND l.logged < $5 AND t.tenant_id = $2 AND can_access($3, t)
+		)
+		SELECT
+			d.day,
+			COALESCE(sum(e.created), 0),
+			COALESCE(sum(e.closed), 0),
+			COALESCE(sum(e.logged), 0)
+		FROM generate_series($4::bigint, $5::bigint - 86400, 86400) AS d(day)
+		LEFT JOIN events AS e
+		ON e.at >= d.day AND e.at < d.day + 86400
+		GROUP BY d.day
+		ORDER BY d.day
+	`,
+		userID,
+		s.tenantID,
+		s.userID,
+		from.Unix(),
+		to.Unix(),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return collectRows(rows, func(row pgx.Row) (ActivityDay, error) {
+		var d ActivityDay
+		var day int64
+		err := row.Scan(&day, &d.Created, &d.Closed, &d.Logged)
+		d.Date = unixTime(day)
+		return d, err
+	})
+}
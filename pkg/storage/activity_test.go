@@ -0,0 +1,45 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestStorage_UserActivityHeatmap(t *testing.T) {
+	db, err := storageConnect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close(context.Background()) })
+
+	userID := newTestUser(t, db, "Active")
+	taskID := newTestTask(t, db, "Leap day task")
+	day := time.Date(2024, time.February, 29, 0, 0, 0, 0, time.UTC)
+	_, err = db.db.Exec(context.Background(), `
+		UPDATE tasks SET opened = $2, closed = $3, author_id = $4, assigned_id = $4 WHERE id = $1
+	`, taskID, day.Add(time.Hour).Unix(), day.Add(2*time.Hour).Unix(), userID)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	days, err := db.UserActivityHeatmap(userID, 2024)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(days) != 366 {
+		t.Fatalf("days: want 366, got %d", len(days))
+	}
+	for _, d := range days {
+		want := 0
+		if d.Date.Equal(day) {
+			want = 2
+			if d.Created != 1 || d.Closed != 1 {
+				t.Errorf("activity: want 1 created and 1 closed, got %+v", d)
+			}
+		}
+		if d.Total() != want {
+			t.Errorf("activity on %s: want %d, got %d", d.Date.Format(time.DateOnly), want, d.Total())
+		}
+	}
+}
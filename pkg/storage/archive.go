@@ -0,0 +1,474 @@
+package storage
+
+import (
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+var (
+	ErrTaskNotArchived = fmt.Errorf("task is not archived")
+	ErrInvalidArchive  = fmt.Errorf("invalid archive")
+)
+
+// Формат и версия архива задач.
+const (
+	archiveFormat  = "tasks-archive"
+	archiveVersion = 1
+)
+
+// Таблицы с данными задачи, которые переносятся в архив вместе с ней, в порядке зависимостей.
+// Ссылки для просмотра, журнал эскалаций и кэши в архив не попадают и удаляются с задачей.
+var archiveTables = []string{
+	"tasks",
+	"tasks_labels",
+	"task_history",
+	"task_time_log",
+	"task_revisions",
+	"task_translations",
+	"task_grants",
+	"task_flags",
+}
+
+// Результат переноса задач в архив.
+type ArchiveResult struct {
+	Key   string // ключ архива в хранилище объектов, пустой - задач для переноса нет
+	Tasks int    // количество перенесённых задач
+}
+
+// ArchiveClosedTasks переносит до limit задач всех рабочих пространств, выполненных
+// раньше чем olderThan назад, вместе с их метками, историей, учётом времени,
+// ревизиями, переводами, правами доступа и жалобами в сжатый архив в хранилище store
+// с ключом вида <prefix>archive-<время>.jsonl.gz и удаляет их из БД.
+// Задачи удаляются только после загрузки архива; вернуть задачу можно методом RehydrateTask.
+// Задачи, изменённые во время загрузки, остаются в БД до следующего запуска.
+// Доступен только системному пользователю.
+func (s *Storage) ArchiveClosedTasks(ctx context.Context, store ObjectStore, prefix string, olderThan time.Duration, limit int) (ArchiveResult, error) {
+	err := s.authorizeSystemWrite()
+	if err != nil {
+		return ArchiveResult{}, err
+	}
+	err = s.startJob(ctx, JobArchive, 0)
+	if err != nil {
+		return ArchiveResult{}, err
+	}
+
+	result, err := s.archiveClosedTasks(ctx, store, prefix, olderThan, limit)
+	return result, s.finishJob(ctx, err)
+}
+
+// archiveClosedTasks переносит задачи в архив для ArchiveClosedTasks.
+func (s *Storage) archiveClosedTasks(ctx context.Context, store ObjectStore, prefix string, olderThan time.Duration, limit int) (ArchiveResult, error) {
+	var result ArchiveResult
+	// задачи выбираются и выгружаются на снимке данных без блокировок, чтобы загрузка
+	// архива в медленное хранилище не задерживала запись в задачи
+	tx, err := s.db.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return result, err
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx, `
+		SELECT id
+		FROM tasks
+		WHERE closed <> 0 AND closed < extract(epoch from now()) - $1
+		ORDER BY id
+		LIMIT $2
+	`,
+		int64(olderThan/time.Second),
+		limit,
+	)
+	if err != nil {
+		return result, err
+	}
+	ids, err := collectRows(rows, func(row pgx.Row) (int, error) {
+		var id int
+		err := row.Scan(&id)
+		return id, err
+	})
+	if err != nil || len(ids) == 0 {
+		return result, err
+	}
+	err = s.jobProgress(ctx, 0, len(ids))
+	if err != nil {
+		return result, err
+	}
+
+	key, digests, err := uploadArchive(ctx, tx, store, prefix, ids)
+	if err != nil {
+		return result, err
+	}
+	tx.Rollback(ctx)
+
+	tx, err = s.db.Begin(ctx)
+	if err != nil {
+		store.Delete(ctx, key)
+		return result, err
+	}
+	defer tx.Rollback(ctx)
+
+	archived, err := removeArchived(ctx, tx, key, digests)
+	if err == nil {
+		err = s.commit(ctx, tx)
+	}
+	if err != nil || len(archived) == 0 {
+		// архив без задач в БД не нужен, ошибка удаления не важнее ошибки фиксации
+		store.Delete(ctx, key)
+		return result, err
+	}
+
+	return ArchiveResult{Key: key, Tasks: len(archived)}, nil
+}
+
+// uploadArchive загружает в хранилище store архив задач ids, прочитанных в транзакции tx,
+// с ключом вида <prefix>archive-<время>.jsonl.gz и возвращает ключ и отпечатки
+// данных задач для removeArchived.
+func uploadArchive(ctx context.Context, tx pgx.Tx, store ObjectStore, prefix string, ids []int) (string, map[int]string, error) {
+	f, err := os.CreateTemp("", "tasks-archive-*.gz")
+	if err != nil {
+		return "", nil, err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	zw := gzip.NewWriter(f)
+	digests, err := writeArchive(ctx, tx, zw, ids)
+	if err != nil {
+		return "", nil, err
+	}
+	err = zw.Close()
+	if err != nil {
+		return "", nil, err
+	}
+
+	_, err = f.Seek(0, io.SeekStart)
+	if err != nil {
+		return "", nil, err
+	}
+	key := prefix + "archive-" + time.Now().UTC().Format(backupKeyTime) + ".jsonl.gz"
+	err = store.Put(ctx, key, f)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return key, digests, nil
+}
+
+// removeArchived блокирует задачи, загруженные в архив key, и удаляет в транзакции tx
+// те из них, данные которых совпадают с отпечатками digests, то есть не изменились
+// после выгрузки. Возвращает id удалённых задач.
+func removeArchived(ctx context.Context, tx pgx.Tx, key string, digests map[int]string) ([]int, error) {
+	ids := make([]int, 0, len(digests))
+	for id := range digests {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	_, err := tx.Exec(ctx, `
+		SELECT id FROM tasks WHERE id = ANY($1) ORDER BY id FOR UPDATE
+	`,
+		ids,
+	)
+	if err != nil {
+		return nil, err
+	}
+	current, err := writeArchive(ctx, tx, io.Discard, ids)
+	if err != nil {
+		return nil, err
+	}
+	var unchanged []int
+	for _, id := range ids {
+		if current[id] != "" && current[id] == digests[id] {
+			unchanged = append(unchanged, id)
+		}
+	}
+	if len(unchanged) == 0 {
+		return nil, nil
+	}
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO archived_tasks (task_id, tenant_id, archive_key)
+		SELECT id, tenant_id, $2
+		FROM tasks
+		WHERE id = ANY($1)
+	`,
+		unchanged,
+		key,
+	)
+	if err != nil {
+		return nil, err
+	}
+	_, err = tx.Exec(ctx, `
+		DELETE FROM tasks
+		WHERE id = ANY($1)
+	`,
+		unchanged,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return unchanged, nil
+}
+
+// writeArchive записывает в w заголовок архива и строки таблиц archiveTables для задач ids
+// и возвращает отпечатки данных каждой задачи по её id. Строки упорядочены, поэтому
+// отпечатки неизменённых задач совпадают между вызовами.
+func writeArchive(ctx context.Context, tx pgx.Tx, w io.Writer, ids []int) (map[int]string, error) {
+	enc := json.NewEncoder(w)
+	err := enc.Encode(backupHeader{Format: archiveFormat, Version: archiveVersion})
+	if err != nil {
+		return nil, err
+	}
+
+	hashes := make(map[int]hash.Hash)
+	for _, table := range archiveTables {
+		column := "task_id"
+		if table == "tasks" {
+			column = "id"
+		}
+		// имена таблиц берутся только из archiveTables
+		rows, err := tx.Query(ctx, fmt.Sprintf(`
+			SELECT %[2]s, row_to_json(t)::text AS line
+			FROM %[1]s AS t
+			WHERE %[2]s = ANY($1)
+			ORDER BY 1, 2
+		`, table, column), ids)
+		if err != nil {
+			return nil, err
+		}
+		lines, err := collectRows(rows, func(row pgx.Row) (archiveLine, error) {
+			var l archiveLine
+			err := row.Scan(&l.taskID, &l.json)
+			return l, err
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, l := range lines {
+			err = enc.Encode(backupRow{Table: table, Row: json.RawMessage(l.json)})
+			if err != nil {
+				return nil, err
+			}
+			h := hashes[l.taskID]
+			if h == nil {
+				h = sha256.New()
+				hashes[l.taskID] = h
+			}
+			fmt.Fprintf(h, "%s\n%s\n", table, l.json)
+		}
+	}
+
+	digests := make(map[int]string, len(hashes))
+	for id, h := range hashes {
+		digests[id] = hex.EncodeToString(h.Sum(nil))
+	}
+
+	return digests, nil
+}
+
+// Строка таблицы задачи для архива.
+type archiveLine struct {
+	taskID int
+	json   string
+}
+
+// RehydrateTask возвращает задачу taskID из архива в хранилище store в БД вместе
+// с данными, перенесёнными в архив. Метки и права пользователей, удалённых после
+// переноса, пропускаются, ссылки на удалённых пользователей заменяются пользователем 0,
+// а на удалённые или оставшиеся в архиве родительскую и основную задачи - сбрасываются.
+// Новая ревизия не создаётся, а название, занятое после переноса другой задачей,
+// не проверяется на уникальность. Для клиентов синхронизации возвращённая задача
+// выглядит изменённой.
+func (s *Storage) RehydrateTask(ctx context.Context, store ObjectStore, taskID int) error {
+	err := s.authorizeWrite(RoleMaintainer)
+	if err != nil {
+		return err
+	}
+
+	var key string
+	err = s.db.QueryRow(ctx, `
+		SELECT archive_key
+		FROM archived_tasks
+		WHERE task_id = $1 AND tenant_id = $2
+	`,
+		taskID,
+		s.tenantID,
+	).Scan(&key)
+	if err == pgx.ErrNoRows {
+		return ErrTaskNotArchived
+	}
+	if err != nil {
+		return err
+	}
+
+	rows, err := readArchive(ctx, store, key, taskID)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	// ссылки на родительскую и основную задачи проверяются при фиксации,
+	// после сброса ссылок на отсутствующие задачи
+	_, err = tx.Exec(ctx, `
+		SET CONSTRAINTS tasks_parent_id_fkey, tasks_duplicate_of_fkey DEFERRED
+	`)
+	if err != nil {
+		return err
+	}
+	// триггеры tasks не записывают ревизию и ключ названия возвращаемой задачи
+	_, err = tx.Exec(ctx, `
+		SELECT set_config('tasks.rehydrate', 'on', true)
+	`)
+	if err != nil {
+		return err
+	}
+
+	for _, row := range rows {
+		// имена таблиц проверены readArchive
+		_, err = tx.Exec(ctx, fmt.Sprintf(`
+			INSERT INTO %[1]s
+			SELECT r.*
+			FROM jsonb_populate_record(NULL::%[1]s, %[3]s) AS r
+			WHERE %[2]s
+		`, row.Table, archiveRowCondition(row.Table), archiveRowSource(row.Table)), string(row.Row))
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.Exec(ctx, `
+		DELETE FROM archived_tasks WHERE task_id = $1;
+	`,
+		taskID,
+	)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(ctx, `
+		DELETE FROM deleted_tasks WHERE task_id = $1;
+	`,
+		taskID,
+	)
+	if err != nil {
+		return err
+	}
+	// touch_updated обновляет время изменения, если оно не задано явно
+	_, err = tx.Exec(ctx, `
+		UPDATE tasks AS t
+		SET
+			updated = t.updated,
+			parent_id = (SELECT p.id FROM tasks AS p WHERE p.id = t.parent_id),
+			duplicate_of = (SELECT d.id FROM tasks AS d WHERE d.id = t.duplicate_of)
+		WHERE t.id = $1
+	`,
+		taskID,
+	)
+	if err != nil {
+		return err
+	}
+
+	return s.commit(ctx, tx)
+}
+
+// archiveRowCondition возвращает условие вставки строки r таблицы table из архива.
+func archiveRowCondition(table string) string {
+	switch table {
+	case "tasks_labels":
+		return `EXISTS (SELECT 1 FROM labels AS l WHERE l.id = r.label_id)`
+	case "task_grants":
+		return `(r.user_id IS NULL OR EXISTS (SELECT 1 FROM users AS u WHERE u.id = r.user_id))`
+	}
+	return `true`
+}
+
+// Столбцы таблиц архива со ссылками на пользователей, которые при удалении
+// пользователя получают значение 0.
+var archiveUserColumns = map[string][]string{
+	"tasks":         {"author_id", "assigned_id"},
+	"task_time_log": {"user_id"},
+	"task_flags":    {"reporter_id"},
+}
+
+// archiveRowSource возвращает выражение jsonb для строки $1 таблицы table из архива,
+// в котором ссылки на удалённых пользователей заменены на 0.
+func archiveRowSource(table string) string {
+	source := `$1::jsonb`
+	for _, column := range archiveUserColumns[table] {
+		source += fmt.Sprintf(` || CASE
+				WHEN $1::jsonb->>'%[1]s' IS NULL
+					OR EXISTS (SELECT 1 FROM users AS u WHERE u.id = ($1::jsonb->>'%[1]s')::int) THEN '{}'
+				ELSE '{"%[1]s": 0}'
+			END::jsonb`, column)
+	}
+	return source
+}
+
+// readArchive возвращает строки архива key, относящиеся к задаче taskID.
+func readArchive(ctx context.Context, store ObjectStore, key string, taskID int) ([]backupRow, error) {
+	body, err := store.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	zr, err := gzip.NewReader(body)
+	if err != nil {
+		return nil, ErrInvalidArchive
+	}
+
+	known := make(map[string]bool, len(archiveTables))
+	for _, table := range archiveTables {
+		known[table] = true
+	}
+
+	dec := json.NewDecoder(zr)
+	var header backupHeader
+	err = dec.Decode(&header)
+	if err != nil || header.Format != archiveFormat || header.Version != archiveVersion {
+		return nil, ErrInvalidArchive
+	}
+
+	var rows []backupRow
+	for {
+		var row backupRow
+		err = dec.Decode(&row)
+		if err == io.EOF {
+			break
+		}
+		if err != nil || !known[row.Table] {
+			return nil, ErrInvalidArchive
+		}
+
+		var ref struct {
+			ID     int `json:"id"`
+			TaskID int `json:"task_id"`
+		}
+		err = json.Unmarshal(row.Row, &ref)
+		if err != nil {
+			return nil, ErrInvalidArchive
+		}
+		if (row.Table == "tasks" && ref.ID == taskID) || (row.Table != "tasks" && ref.TaskID == taskID) {
+			rows = append(rows, row)
+		}
+	}
+	if len(rows) == 0 || rows[0].Table != "tasks" {
+		return nil, ErrInvalidArchive
+	}
+
+	return rows, nil
+}
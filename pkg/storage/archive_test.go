@@ -0,0 +1,138 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+func TestStorage_ArchiveSystemOnly(t *testing.T) {
+	s, err := NewWithPool(&pgxpool.Pool{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	_, err = s.ForTenant(1228).AsUser(1).ArchiveClosedTasks(context.Background(), memStore{}, "", time.Hour, 10)
+	if !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("error: want %v, got %v", ErrPermissionDenied, err)
+	}
+}
+
+func TestStorage_ArchiveClosedTasks(t *testing.T) {
+	db, err := storageConnect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close(context.Background()) })
+
+	tenant := db.ForTenant(1228)
+	ctx := context.Background()
+	_, err = db.db.Exec(ctx, `INSERT INTO labels (tenant_id, name) VALUES (1228, 'Cold')`)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	t.Cleanup(func() { db.db.Exec(ctx, `DELETE FROM labels WHERE tenant_id = 1228`) })
+	parentID := newTestTask(t, tenant, "Archived parent")
+	taskID := newTestTask(t, tenant, "Archived")
+	addTestLabel(t, tenant, taskID, "Cold")
+	// задачи выполнены задолго до начала работы с БД других тестов
+	_, err = db.db.Exec(ctx, `UPDATE tasks SET opened = 1, closed = 2 WHERE id = ANY($1)`, []int{parentID, taskID})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	_, err = db.db.Exec(ctx, `UPDATE tasks SET parent_id = $1 WHERE id = $2`, parentID, taskID)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	revisions, err := tenant.TaskRevisions(taskID)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	err = tenant.RehydrateTask(ctx, memStore{}, taskID)
+	if !errors.Is(err, ErrTaskNotArchived) {
+		t.Errorf("error: want %v, got %v", ErrTaskNotArchived, err)
+	}
+
+	store := memStore{}
+	result, err := db.ArchiveClosedTasks(ctx, store, "cold/", 50*365*24*time.Hour, 1000)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.Tasks == 0 || store[result.Key] == nil {
+		t.Fatalf("archive: want uploaded tasks, got %+v", result)
+	}
+	_, err = tenant.TaskByID(taskID)
+	if !errors.Is(err, ErrTaskNotFound) {
+		t.Errorf("archived task error: want %v, got %v", ErrTaskNotFound, err)
+	}
+
+	err = tenant.RehydrateTask(ctx, store, taskID)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	task, err := tenant.TaskByID(taskID)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if task.Title != "Archived" || task.ClosedUnix() != 2 {
+		t.Errorf("rehydrated task: want closed %q, got %+v", "Archived", task)
+	}
+	// родительская задача осталась в архиве
+	var parent *int
+	err = db.db.QueryRow(ctx, `SELECT parent_id FROM tasks WHERE id = $1`, taskID).Scan(&parent)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if parent != nil {
+		t.Errorf("parent: want nil, got %d", *parent)
+	}
+	rehydrated, err := tenant.TaskRevisions(taskID)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(rehydrated) != len(revisions) {
+		t.Errorf("revisions: want %d, got %d", len(revisions), len(rehydrated))
+	}
+	tasks, err := tenant.TasksByLabel("Cold")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(tasks) != 1 || tasks[0].ID != taskID {
+		t.Errorf("rehydrated label: want task %d, got %v", taskID, tasks)
+	}
+
+	err = tenant.RehydrateTask(ctx, store, taskID)
+	if !errors.Is(err, ErrTaskNotArchived) {
+		t.Errorf("error: want %v, got %v", ErrTaskNotArchived, err)
+	}
+}
+
+func TestRemoveArchived_changed(t *testing.T) {
+	db, err := storageConnect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close(context.Background()) })
+
+	tenant := db.ForTenant(1228)
+	ctx := context.Background()
+	taskID := newTestTask(t, tenant, "Changed during upload")
+
+	tx, err := db.db.Begin(ctx)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer tx.Rollback(ctx)
+
+	removed, err := removeArchived(ctx, tx, "changed", map[int]string{taskID: "stale"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(removed) != 0 {
+		t.Errorf("removed: want none, got %v", removed)
+	}
+}
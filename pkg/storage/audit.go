@@ -0,0 +1,123 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// Действия, записываемые в журнал аудита.
+const (
+	AuditTaskDelete     = "task.delete"
+	AuditTaskMerge      = "task.merge"
+	AuditTaskReassign   = "task.reassign"
+	AuditTaskVisibility = "task.visibility"
+	AuditAccessGrant    = "access.grant"
+	AuditAccessRevoke   = "access.revoke"
+	AuditRoleChange     = "user.role"
+	AuditUserErase      = "user.erase"
+	AuditTokenCreate    = "token.create"
+	AuditTokenRevoke    = "token.revoke"
+	AuditSessionCreate  = "session.create"
+	AuditShareCreate    = "share.create"
+	AuditShareRevoke    = "share.revoke"
+	AuditTaskModerate   = "task.moderate"
+	AuditRestore        = "db.restore"
+)
+
+// Запись журнала аудита.
+type AuditEntry struct {
+	ID       int
+	TenantID int
+	ActorID  int
+	Created  int64
+	Action   string
+	Payload  json.RawMessage
+}
+
+// Параметры выборки журнала аудита, нулевые значения не ограничивают выборку.
+type AuditFilter struct {
+	ActorID int
+	Action  string
+	From    int64
+	To      int64
+}
+
+// audit добавляет запись в журнал аудита в рамках транзакции tx.
+// В режиме пробного запуска действие также добавляется в отчёт.
+func (s *Storage) audit(ctx context.Context, tx pgx.Tx, action string, payload map[string]interface{}) error {
+	if s.dryRun != nil {
+		s.dryRun.Actions = append(s.dryRun.Actions, DryRunAction{Action: action, Payload: payload})
+	}
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO audit_log (tenant_id, actor_id, action, payload)
+		VALUES ($1, $2, $3, $4);
+	`,
+		s.tenantID,
+		s.userID,
+		action,
+		string(data),
+	)
+
+	return err
+}
+
+// AuditLog возвращает записи журнала аудита в хронологическом порядке.
+func (s *Storage) AuditLog(f AuditFilter) ([]AuditEntry, error) {
+	err := s.authorize(RoleAdmin)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+	rows, err := s.db.Query(ctx, `
+		SELECT
+			id,
+			tenant_id,
+			actor_id,
+			created,
+			action,
+			payload
+		FROM audit_log
+		WHERE
+			tenant_id = $1 AND
+			($2 = 0 OR actor_id = $2) AND
+			($3 = '' OR action = $3) AND
+			($4 = 0 OR created >= $4) AND
+			($5 = 0 OR created <= $5)
+		ORDER BY id
+	`,
+		s.tenantID,
+		f.ActorID,
+		f.Action,
+		f.From,
+		f.To,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return collectRows(rows, scanAuditEntry)
+}
+
+// scanAuditEntry сканирует запись журнала аудита.
+func scanAuditEntry(row pgx.Row) (AuditEntry, error) {
+	var e AuditEntry
+	err := row.Scan(
+		&e.ID,
+		&e.TenantID,
+		&e.ActorID,
+		&e.Created,
+		&e.Action,
+		&e.Payload,
+	)
+
+	return e, err
+}
@@ -0,0 +1,56 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestStorage_AuditLog(t *testing.T) {
+	db, err := storageConnect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close(context.Background()) })
+
+	userID := newTestUser(t, db, "Audited User")
+	err = db.SetRole(userID, RoleMaintainer)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	entries, err := db.AuditLog(AuditFilter{Action: AuditRoleChange})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(entries) == 0 {
+		t.Fatalf("audit log has no %s entries", AuditRoleChange)
+	}
+	last := entries[len(entries)-1]
+	var payload struct {
+		UserID int    `json:"user_id"`
+		Role   string `json:"role"`
+	}
+	err = json.Unmarshal(last.Payload, &payload)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if payload.UserID != userID || payload.Role != RoleMaintainer {
+		t.Errorf("audit payload: want user %d role %s, got %s", userID, RoleMaintainer, last.Payload)
+	}
+
+	_, err = db.db.Exec(context.Background(), `DELETE FROM audit_log WHERE id = $1`, last.ID)
+	if err == nil {
+		t.Errorf("audit log entry was deleted")
+	}
+	_, err = db.db.Exec(context.Background(), `UPDATE audit_log SET action = 'none' WHERE id = $1`, last.ID)
+	if err == nil {
+		t.Errorf("audit log entry was updated")
+	}
+
+	_, err = db.AsUser(userID).AuditLog(AuditFilter{})
+	if !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("error: want %v, got %v", ErrPermissionDenied, err)
+	}
+}
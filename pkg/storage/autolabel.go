@@ -0,0 +1,216 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+)
+
+var (
+	ErrLabelRuleNotFound = fmt.Errorf("label rule not found")
+	ErrInvalidLabelRule  = fmt.Errorf("label rule must have at least one condition")
+	ErrInvalidPattern    = fmt.Errorf("invalid regular expression")
+)
+
+// Правило автоматической разметки: при создании задачи ей добавляется метка Label,
+// если задача подходит под все заданные условия. Шаблоны - регулярные выражения Postgres
+// без учёта регистра, пустой шаблон или нулевой автор не ограничивают задачу.
+type LabelRule struct {
+	ID             int
+	Label          string
+	TitlePattern   string
+	ContentPattern string
+	AuthorID       int
+	Enabled        bool
+}
+
+// CreateLabelRule создаёт правило автоматической разметки и возвращает его id.
+func (s *Storage) CreateLabelRule(r LabelRule) (int, error) {
+	err := s.authorizeWrite(RoleMaintainer)
+	if err != nil {
+		return 0, err
+	}
+
+	ctx := context.Background()
+	labelID, err := s.validateLabelRule(ctx, r)
+	if err != nil {
+		return 0, err
+	}
+
+	var id int
+	err = s.db.QueryRow(ctx, `
+		INSERT INTO label_rules (tenant_id, label_id, title_pattern, content_pattern, author_id, enabled)
+		VALUES ($1, $2, NULLIF($3, ''), NULLIF($4, ''), NULLIF($5, 0), $6) RETURNING id
+	`,
+		s.tenantID,
+		labelID,
+		r.TitlePattern,
+		r.ContentPattern,
+		r.AuthorID,
+		r.Enabled,
+	).Scan(&id)
+
+	return id, err
+}
+
+// UpdateLabelRule заменяет параметры правила автоматической разметки r.ID.
+// Метки уже созданных задач не меняются.
+func (s *Storage) UpdateLabelRule(r LabelRule) error {
+	err := s.authorizeWrite(RoleMaintainer)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	labelID, err := s.validateLabelRule(ctx, r)
+	if err != nil {
+		return err
+	}
+
+	tag, err := s.db.Exec(ctx, `
+		UPDATE label_rules
+		SET
+			label_id = $2,
+			title_pattern = NULLIF($3, ''),
+			content_pattern = NULLIF($4, ''),
+			author_id = NULLIF($5, 0),
+			enabled = $6
+		WHERE id = $1 AND tenant_id = $7
+	`,
+		r.ID,
+		labelID,
+		r.TitlePattern,
+		r.ContentPattern,
+		r.AuthorID,
+		r.Enabled,
+		s.tenantID,
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrLabelRuleNotFound
+	}
+
+	return nil
+}
+
+// DeleteLabelRule удаляет правило автоматической разметки по ID.
+func (s *Storage) DeleteLabelRule(ruleID int) error {
+	err := s.authorizeWrite(RoleMaintainer)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	tag, err := s.db.Exec(ctx, `
+		DELETE FROM label_rules
+		WHERE id = $1 AND tenant_id = $2
+	`,
+		ruleID,
+		s.tenantID,
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrLabelRuleNotFound
+	}
+
+	return nil
+}
+
+// LabelRules возвращает правила автоматической разметки рабочего пространства.
+func (s *Storage) LabelRules() ([]LabelRule, error) {
+	ctx := context.Background()
+	rows, err := s.db.Query(ctx, `
+		SELECT
+			r.id,
+			l.name,
+			COALESCE(r.title_pattern, ''),
+			COALESCE(r.content_pattern, ''),
+			COALESCE(r.author_id, 0),
+			r.enabled
+		FROM label_rules AS r
+		JOIN labels AS l
+		ON l.id = r.label_id
+		WHERE r.tenant_id = $1
+		ORDER BY r.id
+	`,
+		s.tenantID,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return collectRows(rows, func(row pgx.Row) (LabelRule, error) {
+		var r LabelRule
+		err := row.Scan(&r.ID, &r.Label, &r.TitlePattern, &r.ContentPattern, &r.AuthorID, &r.Enabled)
+		return r, err
+	})
+}
+
+// TestLabelRule проверяет, добавило бы правило r метку задаче t при её создании.
+// Правило не сохраняется, поэтому его можно проверить до создания;
+// признак Enabled не учитывается.
+func (s *Storage) TestLabelRule(r LabelRule, t Task) (bool, error) {
+	ctx := context.Background()
+	_, err := s.validateLabelRule(ctx, r)
+	if err != nil {
+		return false, err
+	}
+
+	var match bool
+	err = s.db.QueryRow(ctx, `
+		SELECT label_rule_matches(NULLIF($1, ''), NULLIF($2, ''), NULLIF($3, 0), $4, $5, $6)
+	`,
+		r.TitlePattern,
+		r.ContentPattern,
+		r.AuthorID,
+		t.Title,
+		t.Content,
+		t.AuthorID,
+	).Scan(&match)
+
+	return match, err
+}
+
+// validateLabelRule проверяет условия и шаблоны правила и возвращает id его метки.
+func (s *Storage) validateLabelRule(ctx context.Context, r LabelRule) (int, error) {
+	if r.TitlePattern == "" && r.ContentPattern == "" && r.AuthorID == 0 {
+		return 0, ErrInvalidLabelRule
+	}
+	if r.Label == "" {
+		return 0, ErrEmptyLabel
+	}
+	labelID, err := s.labelID(ctx, r.Label)
+	if err != nil {
+		return 0, err
+	}
+
+	// шаблоны компилируются Postgres, чтобы правило не ломало создание задач
+	_, err = s.db.Exec(ctx, `
+		SELECT '' ~* $1, '' ~* $2
+	`,
+		r.TitlePattern,
+		r.ContentPattern,
+	)
+	if invalidRegexp(err) {
+		return 0, ErrInvalidPattern
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return *labelID, nil
+}
+
+// invalidRegexp сообщает, что запрос завершился ошибкой компиляции регулярного выражения.
+func invalidRegexp(err error) bool {
+	var pgErr *pgconn.PgError
+	// invalid_regular_expression
+	return errors.As(err, &pgErr) && pgErr.Code == "2201B"
+}
@@ -0,0 +1,159 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestStorage_LabelRules(t *testing.T) {
+	db, err := storageConnect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close(context.Background()) })
+
+	tenant := db.ForTenant(1203)
+	ctx := context.Background()
+	_, err = db.db.Exec(ctx, `INSERT INTO labels (tenant_id, name) VALUES (1203, 'Crash'), (1203, 'Docs')`)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	t.Cleanup(func() { db.db.Exec(ctx, `DELETE FROM labels WHERE tenant_id = 1203`) })
+
+	crashID, err := tenant.CreateLabelRule(LabelRule{Label: "Crash", TitlePattern: `\m(crash|panic)`, Enabled: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	_, err = tenant.CreateLabelRule(LabelRule{Label: "Docs", ContentPattern: "readme", Enabled: false})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		rule   LabelRule
+		wantID bool
+		err    error
+	}{
+		{"no conditions", LabelRule{Label: "Crash"}, false, ErrInvalidLabelRule},
+		{"invalid pattern", LabelRule{Label: "Crash", TitlePattern: "(crash"}, false, ErrInvalidPattern},
+		{"unknown label", LabelRule{Label: "Bug", TitlePattern: "bug"}, false, ErrLabelNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, err := tenant.CreateLabelRule(tt.rule)
+			if !errors.Is(err, tt.err) {
+				t.Errorf("error: want %v, got %v", tt.err, err)
+			}
+			if (id != 0) != tt.wantID {
+				t.Errorf("id: want %v, got %d", tt.wantID, id)
+			}
+		})
+	}
+
+	match, err := tenant.TestLabelRule(LabelRule{Label: "Crash", TitlePattern: `\m(crash|panic)`}, Task{Title: "Panic on start"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !match {
+		t.Errorf("match: want true, got false")
+	}
+	match, err = tenant.TestLabelRule(LabelRule{Label: "Crash", TitlePattern: `\m(crash|panic)`}, Task{Title: "Nonpanic"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if match {
+		t.Errorf("match: want false, got true")
+	}
+
+	crashed := newTestTask(t, tenant, "App CRASH on save")
+	newTestTask(t, tenant, "Update readme")
+	tasks, err := tenant.TasksByLabel("Crash")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(tasks) != 1 || tasks[0].ID != crashed {
+		t.Errorf("tasks labeled Crash: want [%d], got %+v", crashed, tasks)
+	}
+	// выключенное правило не применяется
+	tasks, err = tenant.TasksByLabel("Docs")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(tasks) != 0 {
+		t.Errorf("tasks labeled Docs: want 0, got %d", len(tasks))
+	}
+
+	err = tenant.DeleteLabelRule(crashID)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	rules, err := tenant.LabelRules()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(rules) != 1 || rules[0].Label != "Docs" || rules[0].ContentPattern != "readme" {
+		t.Errorf("rules: want Docs rule, got %+v", rules)
+	}
+	err = tenant.DeleteLabelRule(crashID)
+	if !errors.Is(err, ErrLabelRuleNotFound) {
+		t.Errorf("error: want %v, got %v", ErrLabelRuleNotFound, err)
+	}
+}
+
+func TestStorage_LabelRulesCloneSplit(t *testing.T) {
+	db, err := storageConnect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close(context.Background()) })
+
+	tenant := db.ForTenant(1203)
+	ctx := context.Background()
+	_, err = db.db.Exec(ctx, `INSERT INTO labels (tenant_id, name) VALUES (1203, 'Outage')`)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	t.Cleanup(func() { db.db.Exec(ctx, `DELETE FROM labels WHERE tenant_id = 1203 AND name = 'Outage'`) })
+	srcID := newTestTask(t, tenant, "Postmortem")
+	_, err = tenant.CreateLabelRule(LabelRule{Label: "Outage", TitlePattern: "postmortem", Enabled: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// копии и подзадачи создаются как новые задачи, с правилами разметки
+	clone, err := tenant.CloneTask(srcID, CloneOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	t.Cleanup(func() { tenant.DeleteTask(clone.ID) })
+	parts, err := tenant.SplitTask(srcID, []NewTaskInput{{Title: "Postmortem actions"}}, false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	t.Cleanup(func() { tenant.DeleteTask(parts[0]) })
+
+	tasks, err := tenant.TasksByLabel("Outage")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	labeled := make(map[int]bool)
+	for _, task := range tasks {
+		labeled[task.ID] = true
+	}
+	if !labeled[clone.ID] || !labeled[parts[0]] {
+		t.Errorf("labeled tasks: want clone %d and part %d, got %v", clone.ID, parts[0], tasks)
+	}
+
+	// и с проверкой обязательных полей
+	err = tenant.SetIntakeSettings(IntakeSettings{RequiredFields: []string{FieldContent}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	t.Cleanup(func() { db.db.Exec(ctx, `DELETE FROM intake_settings WHERE tenant_id = 1203`) })
+	_, err = tenant.SplitTask(srcID, []NewTaskInput{{Title: "Postmortem without content"}}, false)
+	if !errors.Is(err, ErrRequiredField) {
+		t.Errorf("error: want %v, got %v", ErrRequiredField, err)
+	}
+}
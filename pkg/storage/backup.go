@@ -0,0 +1,243 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/jackc/pgx/v4"
+)
+
+var ErrInvalidBackup = fmt.Errorf("invalid backup")
+
+// Формат и версия резервной копии.
+const (
+	backupFormat  = "tasks-backup"
+	backupVersion = 1
+)
+
+// Таблицы пакета в порядке зависимостей, признак наличия у таблицы последовательности id
+// и признак журнала только для добавления, который при восстановлении не очищается.
+var backupTables = []struct {
+	name       string
+	serial     bool
+	appendOnly bool
+}{
+	{"users", true, false},
+	{"tenant_quotas", false, false},
+	{"labels", true, false},
+	{"sla_policies", true, false},
+	{"tasks", true, false},
+	{"task_html", false, false},
+	{"link_previews", false, false},
+	{"deleted_tasks", false, false},
+	{"archived_tasks", false, false},
+	{"retention_policies", false, false},
+	{"task_revisions", true, false},
+	{"task_translations", false, false},
+	{"tasks_labels", false, false},
+	{"task_history", true, false},
+	{"task_time_log", true, false},
+	{"current_tasks", false, false},
+	{"label_rules", true, false},
+	{"intake_settings", false, false},
+	{"task_title_keys", false, false},
+	{"task_forms", true, false},
+	{"api_tokens", true, false},
+	{"sessions", true, false},
+	{"rate_limits", false, false},
+	{"jobs", true, false},
+	{"task_grants", false, false},
+	{"share_links", true, false},
+	{"share_link_views", false, false},
+	{"task_flags", true, false},
+	{"rotations", true, false},
+	{"rotation_members", false, false},
+	{"escalation_rules", true, false},
+	{"escalation_log", true, false},
+	{"audit_log", true, true},
+}
+
+// Количество строк, вставляемых при восстановлении одним пакетом запросов.
+const restoreBatchSize = 500
+
+// Заголовок резервной копии.
+type backupHeader struct {
+	Format  string `json:"format"`
+	Version int    `json:"version"`
+}
+
+// Строка таблицы в резервной копии.
+type backupRow struct {
+	Table string          `json:"table"`
+	Row   json.RawMessage `json:"row"`
+}
+
+// Backup записывает в w логическую копию всех таблиц пакета во всех рабочих пространствах.
+// Копия снимается на одном снимке данных и состоит из JSON-объектов, по одному на строку:
+// заголовок, затем строки таблиц в порядке зависимостей. Доступен только системному пользователю.
+func (s *Storage) Backup(ctx context.Context, w io.Writer) error {
+	err := s.authorizeSystem()
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.db.BeginTx(ctx, pgx.TxOptions{
+		IsoLevel:   pgx.RepeatableRead,
+		AccessMode: pgx.ReadOnly,
+	})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	enc := json.NewEncoder(w)
+	err = enc.Encode(backupHeader{Format: backupFormat, Version: backupVersion})
+	if err != nil {
+		return err
+	}
+
+	for _, table := range backupTables {
+		// имена таблиц берутся только из backupTables
+		rows, err := tx.Query(ctx, fmt.Sprintf(`
+			SELECT row_to_json(t)::text
+			FROM %s AS t
+		`, table.name))
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var row string
+			err = rows.Scan(&row)
+			if err != nil {
+				rows.Close()
+				return err
+			}
+			err = enc.Encode(backupRow{Table: table.name, Row: json.RawMessage(row)})
+			if err != nil {
+				rows.Close()
+				return err
+			}
+		}
+		if rows.Err() != nil {
+			return rows.Err()
+		}
+	}
+
+	return nil
+}
+
+// Restore заменяет содержимое всех таблиц пакета данными из резервной копии, созданной Backup,
+// во всех рабочих пространствах, поэтому доступен только системному пользователю.
+// Восстановление выполняется в одной транзакции, пользовательские триггеры на время
+// восстановления отключаются, чтобы сохранить исходные версии и времена изменений.
+// Журнал аудита не очищается: в него добавляются только записи копии, которых в нём нет.
+func (s *Storage) Restore(ctx context.Context, r io.Reader) error {
+	err := s.authorizeSystemWrite()
+	if err != nil {
+		return err
+	}
+
+	dec := json.NewDecoder(r)
+	var header backupHeader
+	err = dec.Decode(&header)
+	if err != nil || header.Format != backupFormat || header.Version != backupVersion {
+		return ErrInvalidBackup
+	}
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, `SET CONSTRAINTS ALL DEFERRED`)
+	if err != nil {
+		return err
+	}
+	// вставка строк копии по таблицам
+	inserts := make(map[string]string, len(backupTables))
+	for _, table := range backupTables {
+		inserts[table.name] = fmt.Sprintf(`
+			INSERT INTO %[1]s
+			SELECT * FROM json_populate_record(NULL::%[1]s, $1::json)
+		`, table.name)
+		if table.appendOnly {
+			inserts[table.name] += `ON CONFLICT (id) DO NOTHING`
+			continue
+		}
+		_, err = tx.Exec(ctx, fmt.Sprintf(`ALTER TABLE %s DISABLE TRIGGER USER`, table.name))
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(ctx, fmt.Sprintf(`TRUNCATE %s RESTART IDENTITY CASCADE`, table.name))
+		if err != nil {
+			return err
+		}
+	}
+
+	restored := 0
+	batch := new(pgx.Batch)
+	for {
+		var row backupRow
+		err = dec.Decode(&row)
+		if err == io.EOF {
+			break
+		}
+		insert, ok := inserts[row.Table]
+		if err != nil || !ok {
+			return ErrInvalidBackup
+		}
+		batch.Queue(insert, string(row.Row))
+		restored++
+
+		if batch.Len() >= restoreBatchSize {
+			err = tx.SendBatch(ctx, batch).Close()
+			if err != nil {
+				return err
+			}
+			batch = new(pgx.Batch)
+		}
+	}
+	if batch.Len() > 0 {
+		err = tx.SendBatch(ctx, batch).Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, table := range backupTables {
+		if table.serial {
+			_, err = tx.Exec(ctx, fmt.Sprintf(`
+				SELECT setval(pg_get_serial_sequence('%[1]s', 'id'), COALESCE(max(id), 0) + 1, false)
+				FROM %[1]s
+			`, table.name))
+			if err != nil {
+				return err
+			}
+		}
+		if table.appendOnly {
+			continue
+		}
+		_, err = tx.Exec(ctx, fmt.Sprintf(`ALTER TABLE %s ENABLE TRIGGER USER`, table.name))
+		if err != nil {
+			return err
+		}
+	}
+
+	// статистика строится по восстановленным задачам
+	_, err = tx.Exec(ctx, `REFRESH MATERIALIZED VIEW task_stats`)
+	if err != nil {
+		return err
+	}
+
+	err = s.audit(ctx, tx, AuditRestore, map[string]interface{}{
+		"rows": restored,
+	})
+	if err != nil {
+		return err
+	}
+
+	return s.commit(ctx, tx)
+}
@@ -0,0 +1,107 @@
+package storage
+
+import (
+	"compress/gzip"
+	"context"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// Формат времени в ключах резервных копий, сортируется лексикографически.
+const backupKeyTime = "20060102T150405Z"
+
+// Задание резервного копирования в хранилище объектов.
+type BackupJob struct {
+	storage *Storage
+	store   ObjectStore
+	prefix  string
+	keep    int
+}
+
+// NewBackupJob создаёт задание резервного копирования в S3-совместимое хранилище по настройкам c.
+func NewBackupJob(s *Storage, c BackupConfig) *BackupJob {
+	store := NewS3Store(c.Endpoint, c.Region, c.Bucket, c.AccessKey, c.SecretKey)
+	return &BackupJob{storage: s, store: store, prefix: c.Prefix, keep: c.Keep}
+}
+
+// Run снимает сжатую резервную копию, загружает её в хранилище с ключом
+// вида <prefix>tasks-<время>.jsonl.gz и удаляет копии сверх заданного количества.
+// Возвращает ключ загруженной копии.
+func (j *BackupJob) Run(ctx context.Context) (string, error) {
+	f, err := os.CreateTemp("", "tasks-backup-*.gz")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	zw := gzip.NewWriter(f)
+	err = j.storage.Backup(ctx, zw)
+	if err != nil {
+		return "", err
+	}
+	err = zw.Close()
+	if err != nil {
+		return "", err
+	}
+
+	_, err = f.Seek(0, io.SeekStart)
+	if err != nil {
+		return "", err
+	}
+	key := j.prefix + "tasks-" + time.Now().UTC().Format(backupKeyTime) + ".jsonl.gz"
+	err = j.store.Put(ctx, key, f)
+	if err != nil {
+		return "", err
+	}
+
+	return key, j.prune(ctx)
+}
+
+// RunEvery запускает Run каждые interval до отмены ctx.
+// Ошибки отдельных запусков передаются в onError и не прерывают расписание.
+func (j *BackupJob) RunEvery(ctx context.Context, interval time.Duration, onError func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			_, err := j.Run(ctx)
+			if err != nil && onError != nil {
+				onError(err)
+			}
+		}
+	}
+}
+
+// prune удаляет самые старые резервные копии, оставляя keep последних.
+func (j *BackupJob) prune(ctx context.Context) error {
+	if j.keep <= 0 {
+		return nil
+	}
+
+	keys, err := j.store.List(ctx, j.prefix+"tasks-")
+	if err != nil {
+		return err
+	}
+	var backups []string
+	for _, key := range keys {
+		if strings.HasSuffix(key, ".jsonl.gz") {
+			backups = append(backups, key)
+		}
+	}
+
+	for len(backups) > j.keep {
+		err = j.store.Delete(ctx, backups[0])
+		if err != nil {
+			return err
+		}
+		backups = backups[1:]
+	}
+
+	return nil
+}
@@ -0,0 +1,146 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+func TestStorage_BackupRestore(t *testing.T) {
+	db, err := storageConnect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close(context.Background()) })
+	ctx := context.Background()
+
+	tasksBefore, err := db.TasksAll()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var buf bytes.Buffer
+	err = db.Backup(ctx, &buf)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	backup := buf.String()
+	if !strings.HasPrefix(backup, `{"format":"tasks-backup","version":1}`) {
+		t.Fatalf("backup doesn't start with a header: %.100s", backup)
+	}
+
+	// задача, созданная после резервного копирования, пропадёт после восстановления
+	newTestTask(t, db, "Task after backup")
+	entries, err := db.AuditLog(AuditFilter{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	err = db.Restore(ctx, strings.NewReader(backup))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	tasksAfter, err := db.TasksAll()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(tasksBefore, tasksAfter) {
+		t.Errorf("tasks after restore:\nwant %+v\ngot  %+v", tasksBefore, tasksAfter)
+	}
+
+	// журнал аудита только дополняется: записи после копии и сама копия остаются
+	entriesAfter, err := db.AuditLog(AuditFilter{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(entriesAfter) != len(entries)+1 || entriesAfter[len(entriesAfter)-1].Action != AuditRestore {
+		t.Errorf("audit log after restore: want %d entries and a restore entry, got %+v", len(entries)+1, entriesAfter)
+	}
+
+	id := newTestTask(t, db, "Task after restore")
+	for _, task := range tasksBefore {
+		if task.ID == id {
+			t.Errorf("id sequence wasn't restored: id:%d reused", id)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		backup string
+	}{
+		{"empty", ""},
+		{"wrong header", `{"format":"other","version":1}`},
+		{"unknown table", `{"format":"tasks-backup","version":1}` + "\n" + `{"table":"pg_authid","row":{}}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := db.Restore(ctx, strings.NewReader(tt.backup))
+			if !errors.Is(err, ErrInvalidBackup) {
+				t.Errorf("error: want %v, got %v", ErrInvalidBackup, err)
+			}
+		})
+	}
+}
+
+func TestStorage_BackupSystemOnly(t *testing.T) {
+	s, err := NewWithPool(&pgxpool.Pool{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	admin := s.ForTenant(1158).AsUser(1)
+	ctx := context.Background()
+
+	err = admin.Backup(ctx, io.Discard)
+	if !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("Backup error: want %v, got %v", ErrPermissionDenied, err)
+	}
+	err = admin.Restore(ctx, strings.NewReader(""))
+	if !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("Restore error: want %v, got %v", ErrPermissionDenied, err)
+	}
+}
+
+func TestBackupTables(t *testing.T) {
+	db, err := storageConnect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close(context.Background()) })
+
+	// Restore очищает таблицы каскадно, поэтому в копию должны входить все таблицы схемы
+	rows, err := db.db.Query(context.Background(), `
+		SELECT table_name::text
+		FROM information_schema.tables
+		WHERE table_schema = current_schema() AND table_type = 'BASE TABLE'
+	`)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	tables, err := collectRows(rows, func(row pgx.Row) (string, error) {
+		var name string
+		err := row.Scan(&name)
+		return name, err
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	known := make(map[string]bool, len(backupTables))
+	for _, table := range backupTables {
+		known[table.name] = true
+	}
+	for _, name := range tables {
+		if !known[name] {
+			t.Errorf("table %s is missing from backupTables", name)
+		}
+	}
+}
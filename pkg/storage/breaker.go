@@ -0,0 +1,125 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+)
+
+var ErrStorageUnavailable = fmt.Errorf("storage unavailable")
+
+// Параметры автоматического выключателя запросов к БД.
+// Если в окне Window выполнено не меньше MinRequests запросов и доля отказов
+// (ошибок соединения и таймаутов) не меньше FailureRatio, выключатель размыкается
+// и запросы завершаются ошибкой ErrStorageUnavailable без обращения к БД.
+// Через Cooldown выполняется один пробный запрос: при успехе выключатель замыкается.
+type BreakerPolicy struct {
+	MinRequests  int
+	FailureRatio float64
+	Window       time.Duration
+	Cooldown     time.Duration
+}
+
+// WithCircuitBreaker включает автоматический выключатель запросов к БД.
+func WithCircuitBreaker(policy BreakerPolicy) Option {
+	return func(o *options) {
+		o.breaker = policy
+	}
+}
+
+// Состояния выключателя.
+const (
+	breakerClosed   = iota // запросы выполняются
+	breakerOpen            // запросы отклоняются
+	breakerHalfOpen        // выполняется пробный запрос
+)
+
+// Автоматический выключатель.
+type breaker struct {
+	policy BreakerPolicy
+	now    func() time.Time
+
+	mu          sync.Mutex
+	state       int
+	windowStart time.Time
+	requests    int
+	failures    int
+	openedAt    time.Time
+}
+
+func newBreaker(policy BreakerPolicy) *breaker {
+	return &breaker{policy: policy, now: time.Now}
+}
+
+// allow сообщает, можно ли выполнить запрос.
+func (b *breaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case breakerOpen:
+		if b.now().Sub(b.openedAt) < b.policy.Cooldown {
+			return ErrStorageUnavailable
+		}
+		b.state = breakerHalfOpen
+		return nil
+	case breakerHalfOpen:
+		// пробный запрос уже выполняется
+		return ErrStorageUnavailable
+	}
+
+	return nil
+}
+
+// record учитывает результат запроса.
+func (b *breaker) record(err error) {
+	failed := breakerFailure(err)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+	if b.state == breakerHalfOpen {
+		if failed {
+			b.state = breakerOpen
+			b.openedAt = now
+		} else {
+			b.state = breakerClosed
+			b.windowStart, b.requests, b.failures = now, 0, 0
+		}
+		return
+	}
+
+	if now.Sub(b.windowStart) >= b.policy.Window {
+		b.windowStart, b.requests, b.failures = now, 0, 0
+	}
+	b.requests++
+	if failed {
+		b.failures++
+	}
+	if b.requests >= b.policy.MinRequests &&
+		float64(b.failures) >= b.policy.FailureRatio*float64(b.requests) {
+		b.state = breakerOpen
+		b.openedAt = now
+	}
+}
+
+// breakerFailure сообщает, говорит ли ошибка о недоступности БД.
+// Ошибки выполнения SQL, кроме отмены запроса по таймауту, отказом не считаются.
+func breakerFailure(err error) bool {
+	if err == nil || err == pgx.ErrNoRows || err == context.Canceled {
+		return false
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		// query_canceled и ошибки соединения
+		return pgErr.Code == "57014" || pgErr.Code[:2] == "08"
+	}
+
+	return true
+}
@@ -0,0 +1,79 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgconn"
+)
+
+func TestBreaker(t *testing.T) {
+	now := time.Unix(0, 0)
+	b := newBreaker(BreakerPolicy{MinRequests: 4, FailureRatio: 0.5, Window: time.Minute, Cooldown: 10 * time.Second})
+	b.now = func() time.Time { return now }
+	outage := errors.New("dial tcp: connection refused")
+
+	// ошибки SQL не размыкают выключатель
+	for i := 0; i < 4; i++ {
+		b.record(&pgconn.PgError{Code: "23505"})
+	}
+	if err := b.allow(); err != nil {
+		t.Fatalf("after SQL errors: want closed, got %v", err)
+	}
+
+	now = now.Add(time.Minute)
+	b.record(nil)
+	b.record(outage)
+	b.record(nil)
+	if err := b.allow(); err != nil {
+		t.Fatalf("below MinRequests: want closed, got %v", err)
+	}
+	b.record(outage)
+	if err := b.allow(); err != ErrStorageUnavailable {
+		t.Fatalf("failure ratio reached: want %v, got %v", ErrStorageUnavailable, err)
+	}
+
+	now = now.Add(10 * time.Second)
+	if err := b.allow(); err != nil {
+		t.Fatalf("after cooldown: want trial request, got %v", err)
+	}
+	if err := b.allow(); err != ErrStorageUnavailable {
+		t.Fatalf("during trial: want %v, got %v", ErrStorageUnavailable, err)
+	}
+	b.record(outage)
+	if err := b.allow(); err != ErrStorageUnavailable {
+		t.Fatalf("failed trial: want %v, got %v", ErrStorageUnavailable, err)
+	}
+
+	now = now.Add(10 * time.Second)
+	if err := b.allow(); err != nil {
+		t.Fatalf("after cooldown: want trial request, got %v", err)
+	}
+	b.record(nil)
+	if err := b.allow(); err != nil {
+		t.Fatalf("successful trial: want closed, got %v", err)
+	}
+}
+
+func TestConn_breaker(t *testing.T) {
+	c := &conn{breaker: newBreaker(BreakerPolicy{MinRequests: 1, FailureRatio: 1, Window: time.Minute, Cooldown: time.Minute})}
+	runs := 0
+	fn := func(context.Context) error {
+		runs++
+		return context.DeadlineExceeded
+	}
+
+	err := c.run(context.Background(), "SELECT 1", false, fn)
+	if err != context.DeadlineExceeded {
+		t.Errorf("error: want %v, got %v", context.DeadlineExceeded, err)
+	}
+	err = c.run(context.Background(), "SELECT 1", false, fn)
+	if err != ErrStorageUnavailable {
+		t.Errorf("error: want %v, got %v", ErrStorageUnavailable, err)
+	}
+	if runs != 1 {
+		t.Errorf("runs: want 1, got %d", runs)
+	}
+}
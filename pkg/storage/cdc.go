@@ -0,0 +1,261 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// Изменения задач читаются из слота логической репликации с модулем вывода wal2json,
+// поэтому в события попадают и изменения, сделанные в обход пакета.
+// Для работы сервер должен быть запущен с wal_level=logical и модулем wal2json.
+
+// Операции событий изменения задач.
+const (
+	TaskInserted  = "insert"
+	TaskUpdated   = "update"
+	TaskDeleted   = "delete"
+	TaskTruncated = "truncate" // таблица задач очищена, например методом Restore
+)
+
+// Максимальное количество строк, читаемых из слота за один вызов ConsumeTaskEvents.
+// Слот отдаёт транзакции целиком, поэтому строк может быть больше.
+const cdcBatchSize = 1000
+
+// Событие изменения задачи.
+type TaskEvent struct {
+	LSN      string // позиция изменения в журнале
+	Op       string // TaskInserted, TaskUpdated, TaskDeleted или TaskTruncated
+	TenantID int    // для удалённых задач и очистки таблицы не заполняется
+	Task     Task   // состояние задачи после изменения, для удалённых задач заполнен только ID, для очистки пусто
+}
+
+// CreateTaskEventSlot создаёт слот логической репликации для чтения событий изменения задач.
+// Сервер хранит журнал, пока изменения не прочитаны из слота, поэтому неиспользуемый
+// слот нужно удалить методом DropTaskEventSlot. Слот содержит изменения всех рабочих
+// пространств, поэтому методы слота доступны только системному пользователю.
+func (s *Storage) CreateTaskEventSlot(ctx context.Context, slot string) error {
+	err := s.authorizeSystemWrite()
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.Exec(ctx, `SELECT pg_create_logical_replication_slot($1, 'wal2json')`, slot)
+
+	return err
+}
+
+// DropTaskEventSlot удаляет слот логической репликации.
+func (s *Storage) DropTaskEventSlot(ctx context.Context, slot string) error {
+	err := s.authorizeSystemWrite()
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.Exec(ctx, `SELECT pg_drop_replication_slot($1)`, slot)
+
+	return err
+}
+
+// ConsumeTaskEvents читает очередную порцию изменений задач из слота во всех рабочих
+// пространствах и передаёт их в handle. Позиция слота сдвигается только после успешного
+// завершения handle, поэтому при ошибке или сбое события будут получены повторно.
+// Возвращает количество переданных событий.
+func (s *Storage) ConsumeTaskEvents(ctx context.Context, slot string, handle func([]TaskEvent) error) (int, error) {
+	n, _, err := s.consumeTaskEvents(ctx, slot, handle)
+	return n, err
+}
+
+// consumeTaskEvents выполняет ConsumeTaskEvents и дополнительно сообщает,
+// что порция заняла весь cdcBatchSize и в слоте могут оставаться изменения.
+func (s *Storage) consumeTaskEvents(ctx context.Context, slot string, handle func([]TaskEvent) error) (int, bool, error) {
+	err := s.authorizeSystemWrite()
+	if err != nil {
+		return 0, false, err
+	}
+
+	// границы транзакций нужны, чтобы сдвинуть слот за запись фиксации:
+	// позиция изменения находится до неё, и транзакция читалась бы снова
+	rows, err := s.db.Query(ctx, `
+		SELECT lsn::text, data
+		FROM pg_logical_slot_peek_changes(
+			$1, NULL, $2,
+			'format-version', '2',
+			'include-transaction', 'true',
+			'add-tables', '*.tasks'
+		)
+	`,
+		slot,
+		cdcBatchSize,
+	)
+	if err != nil {
+		return 0, false, err
+	}
+	changes, err := collectRows(rows, func(row pgx.Row) ([2]string, error) {
+		var change [2]string
+		err := row.Scan(&change[0], &change[1])
+		return change, err
+	})
+	if err != nil {
+		return 0, false, err
+	}
+
+	var events, pending []TaskEvent
+	var commitLSN string
+	for _, change := range changes {
+		e, err := parseTaskEvent(change[0], change[1])
+		switch {
+		case err == errTxBegin:
+			pending = nil
+			continue
+		case err == errTxCommit:
+			// позиция фиксации в выводе слота указывает на конец записи фиксации
+			events = append(events, pending...)
+			pending = nil
+			commitLSN = change[0]
+			continue
+		case err != nil:
+			return 0, false, err
+		}
+		e.Task.Content, err = s.decrypt(e.Task.Content)
+		if err != nil {
+			return 0, false, err
+		}
+		pending = append(pending, e)
+	}
+	if commitLSN == "" {
+		return 0, false, nil
+	}
+
+	if len(events) > 0 {
+		err = handle(events)
+		if err != nil {
+			return 0, false, err
+		}
+	}
+
+	_, err = s.db.Exec(ctx, `
+		SELECT pg_replication_slot_advance($1, $2::pg_lsn)
+	`,
+		slot,
+		commitLSN,
+	)
+	if err != nil {
+		return 0, false, err
+	}
+
+	return len(events), len(changes) >= cdcBatchSize, nil
+}
+
+// WatchTaskEvents читает изменения задач из слота каждые interval до отмены ctx.
+// Возвращает первую ошибку чтения или обработки.
+func (s *Storage) WatchTaskEvents(ctx context.Context, slot string, interval time.Duration, handle func([]TaskEvent) error) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		_, more, err := s.consumeTaskEvents(ctx, slot, handle)
+		if err != nil {
+			return err
+		}
+		if more {
+			// в слоте могут оставаться изменения
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Изменение в формате wal2json версии 2.
+type wal2jsonChange struct {
+	Action   string           `json:"action"`
+	Table    string           `json:"table"`
+	Columns  []wal2jsonColumn `json:"columns"`
+	Identity []wal2jsonColumn `json:"identity"`
+}
+
+type wal2jsonColumn struct {
+	Name  string          `json:"name"`
+	Value json.RawMessage `json:"value"`
+}
+
+// Строки начала и фиксации транзакции в выводе wal2json.
+var (
+	errTxBegin  = fmt.Errorf("cdc: transaction begin")
+	errTxCommit = fmt.Errorf("cdc: transaction commit")
+)
+
+// parseTaskEvent разбирает изменение таблицы задач в формате wal2json версии 2.
+// Для строк начала и фиксации транзакции возвращает errTxBegin и errTxCommit.
+func parseTaskEvent(lsn, data string) (TaskEvent, error) {
+	var change wal2jsonChange
+	err := json.Unmarshal([]byte(data), &change)
+	if err != nil {
+		return TaskEvent{}, err
+	}
+
+	e := TaskEvent{LSN: lsn}
+	columns := change.Columns
+	switch change.Action {
+	case "I":
+		e.Op = TaskInserted
+	case "U":
+		e.Op = TaskUpdated
+	case "D":
+		e.Op = TaskDeleted
+		columns = change.Identity
+	case "T":
+		e.Op = TaskTruncated
+		return e, nil
+	case "B":
+		return TaskEvent{}, errTxBegin
+	case "C":
+		return TaskEvent{}, errTxCommit
+	default:
+		return TaskEvent{}, fmt.Errorf("cdc: unexpected action %q at %s", change.Action, lsn)
+	}
+
+	var opened, closed int64
+	for _, c := range columns {
+		if string(c.Value) == "null" {
+			continue
+		}
+		var dest interface{}
+		switch c.Name {
+		case "id":
+			dest = &e.Task.ID
+		case "tenant_id":
+			dest = &e.TenantID
+		case "opened":
+			dest = &opened
+		case "closed":
+			dest = &closed
+		case "author_id":
+			dest = &e.Task.AuthorID
+		case "assigned_id":
+			dest = &e.Task.AssignedID
+		case "title":
+			dest = &e.Task.Title
+		case "content":
+			dest = &e.Task.Content
+		default:
+			continue
+		}
+		err = json.Unmarshal(c.Value, dest)
+		if err != nil {
+			return TaskEvent{}, fmt.Errorf("cdc: column %s at %s: %w", c.Name, lsn, err)
+		}
+	}
+	if e.Op != TaskDeleted {
+		e.Task.Opened = unixTime(opened)
+		e.Task.Closed = closedTime(closed)
+	}
+
+	return e, nil
+}
@@ -0,0 +1,167 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+func TestParseTaskEvent(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    TaskEvent
+		wantErr bool
+	}{
+		{
+			name: "insert",
+			data: `{"action":"I","schema":"public","table":"tasks","columns":[` +
+				`{"name":"id","type":"integer","value":7},` +
+				`{"name":"tenant_id","type":"integer","value":3},` +
+				`{"name":"opened","type":"bigint","value":1700000000},` +
+				`{"name":"closed","type":"bigint","value":0},` +
+				`{"name":"author_id","type":"integer","value":1},` +
+				`{"name":"assigned_id","type":"integer","value":2},` +
+				`{"name":"title","type":"text","value":"Title"},` +
+				`{"name":"content","type":"text","value":null},` +
+				`{"name":"visibility","type":"text","value":"public"}]}`,
+			want: TaskEvent{
+				LSN:      "0/16B3748",
+				Op:       TaskInserted,
+				TenantID: 3,
+				Task: Task{
+					ID:         7,
+					Opened:     unixTime(1700000000),
+					AuthorID:   1,
+					AssignedID: 2,
+					Title:      "Title",
+				},
+			},
+		},
+		{
+			name: "update",
+			data: `{"action":"U","schema":"public","table":"tasks","columns":[` +
+				`{"name":"id","type":"integer","value":7},` +
+				`{"name":"opened","type":"bigint","value":1700000000},` +
+				`{"name":"closed","type":"bigint","value":1700003600},` +
+				`{"name":"content","type":"text","value":"Content"}],` +
+				`"identity":[{"name":"id","type":"integer","value":7}]}`,
+			want: TaskEvent{
+				LSN: "0/16B3748",
+				Op:  TaskUpdated,
+				Task: Task{
+					ID:      7,
+					Opened:  unixTime(1700000000),
+					Closed:  closedTime(1700003600),
+					Content: "Content",
+				},
+			},
+		},
+		{
+			name: "delete",
+			data: `{"action":"D","schema":"public","table":"tasks",` +
+				`"identity":[{"name":"id","type":"integer","value":7}]}`,
+			want: TaskEvent{LSN: "0/16B3748", Op: TaskDeleted, Task: Task{ID: 7}},
+		},
+		{
+			name: "truncate",
+			data: `{"action":"T","schema":"public","table":"tasks"}`,
+			want: TaskEvent{LSN: "0/16B3748", Op: TaskTruncated},
+		},
+		{
+			name:    "wrong type",
+			data:    `{"action":"I","table":"tasks","columns":[{"name":"id","value":"7"}]}`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseTaskEvent("0/16B3748", tt.data)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error: want %v, got %v", tt.wantErr, err)
+			}
+			if err != nil {
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("event: want %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestParseTaskEvent_transaction(t *testing.T) {
+	_, err := parseTaskEvent("0/16B3700", `{"action":"B"}`)
+	if err != errTxBegin {
+		t.Errorf("begin: want %v, got %v", errTxBegin, err)
+	}
+	_, err = parseTaskEvent("0/16B3790", `{"action":"C"}`)
+	if err != errTxCommit {
+		t.Errorf("commit: want %v, got %v", errTxCommit, err)
+	}
+}
+
+func TestStorage_TaskEventsSystemOnly(t *testing.T) {
+	s, err := NewWithPool(&pgxpool.Pool{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	admin := s.ForTenant(1179).AsUser(1)
+	ctx := context.Background()
+
+	_, err = admin.ConsumeTaskEvents(ctx, "slot", func([]TaskEvent) error { return nil })
+	if !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("ConsumeTaskEvents error: want %v, got %v", ErrPermissionDenied, err)
+	}
+	err = admin.CreateTaskEventSlot(ctx, "slot")
+	if !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("CreateTaskEventSlot error: want %v, got %v", ErrPermissionDenied, err)
+	}
+}
+
+func TestStorage_ConsumeTaskEvents(t *testing.T) {
+	db, err := storageConnect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close(context.Background()) })
+	ctx := context.Background()
+
+	slot := "test_task_events_1179"
+	err = db.CreateTaskEventSlot(ctx, slot)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	t.Cleanup(func() { db.DropTaskEventSlot(context.Background(), slot) })
+
+	id := newTestTask(t, db.ForTenant(1179), "Task event")
+
+	var got []TaskEvent
+	handle := func(events []TaskEvent) error {
+		got = append(got, events...)
+		return nil
+	}
+	_, err = db.ConsumeTaskEvents(ctx, slot, handle)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(got) == 0 || got[0].Op != TaskInserted || got[0].Task.ID != id {
+		t.Fatalf("events: want insert of task %d first, got %+v", id, got)
+	}
+
+	// слот сдвинут за фиксацию, прочитанная транзакция не возвращается повторно
+	got = nil
+	n, err := db.ConsumeTaskEvents(ctx, slot, handle)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for _, e := range got {
+		if e.Op == TaskInserted && e.Task.ID == id {
+			t.Errorf("events: insert of task %d consumed twice (%d events)", id, n)
+		}
+	}
+}
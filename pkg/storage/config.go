@@ -1,6 +1,11 @@
 package storage
 
-import "fmt"
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+)
 
 type Config struct {
 	User     string
@@ -8,8 +13,44 @@ type Config struct {
 	Host     string
 	Port     string
 	DBName   string
+	Backup   BackupConfig
+
+	StatementTimeout time.Duration // максимальное время выполнения запроса, 0 - без ограничения
+	LockTimeout      time.Duration // максимальное время ожидания блокировки, 0 - без ограничения
+	// схема с таблицами пакета, пустая - схема по умолчанию; расширения ищутся в схеме public
+	Schema string
+}
+
+// Настройки резервного копирования в S3-совместимое хранилище.
+type BackupConfig struct {
+	Endpoint  string        // адрес хранилища, например https://s3.amazonaws.com
+	Region    string        // регион для подписи запросов
+	Bucket    string        // бакет для резервных копий
+	AccessKey string        // ключ доступа
+	SecretKey string        // секретный ключ
+	Prefix    string        // префикс ключей резервных копий
+	Interval  time.Duration // интервал между резервными копиями
+	Keep      int           // количество хранимых копий, 0 - хранить все
 }
 
+// ConString возвращает строку подключения. Ограничения времени и схема передаются
+// как параметры сеанса и применяются ко всем соединениям пула.
 func (c *Config) ConString() string {
-	return fmt.Sprintf("postgres://%s:%s@%s:%s/%s", c.User, c.Password, c.Host, c.Port, c.DBName)
+	constr := fmt.Sprintf("postgres://%s:%s@%s:%s/%s", c.User, c.Password, c.Host, c.Port, c.DBName)
+
+	params := url.Values{}
+	if c.StatementTimeout > 0 {
+		params.Set("statement_timeout", strconv.FormatInt(c.StatementTimeout.Milliseconds(), 10))
+	}
+	if c.LockTimeout > 0 {
+		params.Set("lock_timeout", strconv.FormatInt(c.LockTimeout.Milliseconds(), 10))
+	}
+	if c.Schema != "" {
+		params.Set("search_path", c.Schema+", public")
+	}
+	if len(params) > 0 {
+		constr += "?" + params.Encode()
+	}
+
+	return constr
 }
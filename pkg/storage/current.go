@@ -0,0 +1,107 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+var (
+	ErrTaskClosed    = fmt.Errorf("task is closed")
+	ErrNoCurrentTask = fmt.Errorf("user has no current task")
+)
+
+// SetCurrentTask отмечает открытую задачу taskID как задачу, над которой сейчас
+// работает пользователь userID, заменяя предыдущую. Повторная отметка той же задачи
+// не меняет время начала работы. При выполнении задачи отметка снимается автоматически.
+func (s *Storage) SetCurrentTask(userID, taskID int) error {
+	err := s.authorizeWrite(RoleReporter)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	var userFound bool
+	var closed *int64
+	err = s.db.QueryRow(ctx, `
+		WITH u AS (
+			SELECT id FROM users WHERE id = $1 AND tenant_id = $3
+		), t AS (
+			SELECT id, closed FROM tasks WHERE id = $2 AND tenant_id = $3 AND can_access($4, tasks)
+		), marked AS (
+			INSERT INTO current_tasks (user_id, task_id)
+			SELECT u.id, t.id
+			FROM u, t
+			WHERE t.closed = 0
+			ON CONFLICT (user_id) DO UPDATE
+			SET task_id = EXCLUDED.task_id, started = EXCLUDED.started
+			WHERE current_tasks.task_id <> EXCLUDED.task_id
+		)
+		SELECT EXISTS (SELECT 1 FROM u), (SELECT closed FROM t)
+	`,
+		userID,
+		taskID,
+		s.tenantID,
+		s.userID,
+	).Scan(&userFound, &closed)
+	switch {
+	case err != nil:
+		return err
+	case !userFound:
+		return ErrUserNotFound
+	case closed == nil:
+		return ErrTaskNotFound
+	case *closed != 0:
+		return ErrTaskClosed
+	}
+
+	return nil
+}
+
+// ClearCurrentTask снимает отметку текущей задачи пользователя userID.
+func (s *Storage) ClearCurrentTask(userID int) error {
+	err := s.authorizeWrite(RoleReporter)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	_, err = s.db.Exec(ctx, `
+		DELETE FROM current_tasks AS c
+		USING users AS u
+		WHERE c.user_id = $1 AND u.id = c.user_id AND u.tenant_id = $2
+	`,
+		userID,
+		s.tenantID,
+	)
+
+	return err
+}
+
+// CurrentTask возвращает задачу, над которой сейчас работает пользователь userID,
+// и время начала работы над ней.
+func (s *Storage) CurrentTask(userID int) (Task, time.Time, error) {
+	ctx := context.Background()
+	var started int64
+	task, err := s.scanTask(s.db.QueryRow(ctx, `
+		SELECT `+taskColumnsOf("t")+`, c.started
+		FROM current_tasks AS c
+		JOIN tasks AS t
+		ON t.id = c.task_id
+		WHERE c.user_id = $1 AND t.tenant_id = $2 AND can_access($3, t)
+	`,
+		userID,
+		s.tenantID,
+		s.userID,
+	), &started)
+	if err == pgx.ErrNoRows {
+		return Task{}, time.Time{}, ErrNoCurrentTask
+	}
+	if err != nil {
+		return Task{}, time.Time{}, err
+	}
+
+	return task, unixTime(started), nil
+}
@@ -0,0 +1,81 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestStorage_SetCurrentTask(t *testing.T) {
+	db, err := storageConnect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close(context.Background()) })
+
+	userID := newTestUser(t, db, "Worker")
+	first := newTestTask(t, db, "First")
+	second := newTestTask(t, db, "Second")
+
+	_, _, err = db.CurrentTask(userID)
+	if !errors.Is(err, ErrNoCurrentTask) {
+		t.Errorf("error: want %v, got %v", ErrNoCurrentTask, err)
+	}
+
+	for _, taskID := range []int{first, second} {
+		err = db.SetCurrentTask(userID, taskID)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	task, started, err := db.CurrentTask(userID)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if task.ID != second || started.IsZero() {
+		t.Errorf("current task: want %d, got %d started at %v", second, task.ID, started)
+	}
+
+	// выполнение задачи снимает отметку
+	err = db.UpdateTask(second, 0, time.Now().Unix(), "", "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	_, _, err = db.CurrentTask(userID)
+	if !errors.Is(err, ErrNoCurrentTask) {
+		t.Errorf("error: want %v, got %v", ErrNoCurrentTask, err)
+	}
+
+	tests := []struct {
+		name   string
+		userID int
+		taskID int
+		err    error
+	}{
+		{"closed task", userID, second, ErrTaskClosed},
+		{"unknown task", userID, 99999999, ErrTaskNotFound},
+		{"unknown user", 99999999, first, ErrUserNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := db.SetCurrentTask(tt.userID, tt.taskID)
+			if !errors.Is(err, tt.err) {
+				t.Errorf("error: want %v, got %v", tt.err, err)
+			}
+		})
+	}
+
+	err = db.SetCurrentTask(userID, first)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	err = db.ClearCurrentTask(userID)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	_, _, err = db.CurrentTask(userID)
+	if !errors.Is(err, ErrNoCurrentTask) {
+		t.Errorf("error: want %v, got %v", ErrNoCurrentTask, err)
+	}
+}
@@ -0,0 +1,544 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// Option настраивает хранилище при создании.
+type Option func(*options)
+
+type options struct {
+	logger   *slog.Logger
+	tracer   Tracer
+	metrics  MetricsCollector
+	retry    RetryPolicy
+	timeout  time.Duration
+	lock     time.Duration
+	pool     *pgxpool.Pool
+	readOnly bool
+	breaker  BreakerPolicy
+	simple   bool
+
+	explain        ExplainFunc
+	explainMethods []string
+
+	replica       *pgxpool.Pool
+	replicaPolicy ReplicaPolicy
+	twoPhase      bool
+}
+
+// Трассировщик запросов к БД.
+// TraceQuery вызывается перед выполнением запроса и возвращает контекст,
+// с которым выполняется запрос, и функцию, вызываемую по его завершении.
+type Tracer interface {
+	TraceQuery(ctx context.Context, sql string) (context.Context, func(err error))
+}
+
+// Политика повтора запросов при временных ошибках: обрыве соединения
+// до отправки запроса, конфликте сериализации и взаимной блокировке.
+// Запросы внутри транзакций не повторяются.
+type RetryPolicy struct {
+	Attempts int           // общее количество попыток, 0 и 1 - без повторов
+	Backoff  time.Duration // пауза перед первым повтором, удваивается с каждой попыткой
+}
+
+// WithLogger включает журналирование запросов: успешные запросы пишутся
+// с уровнем Debug, ошибки - с уровнем Error.
+func WithLogger(logger *slog.Logger) Option {
+	return func(o *options) {
+		o.logger = logger
+	}
+}
+
+// WithTracer включает трассировку запросов.
+func WithTracer(tracer Tracer) Option {
+	return func(o *options) {
+		o.tracer = tracer
+	}
+}
+
+// WithRetryPolicy задаёт политику повтора запросов.
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(o *options) {
+		o.retry = policy
+	}
+}
+
+// WithStatementTimeout ограничивает время выполнения каждого запроса на стороне сервера.
+// Несовместима с WithPool: для готового пула ограничение задаётся в его конфигурации.
+func WithStatementTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.timeout = timeout
+	}
+}
+
+// WithPool использует готовый пул соединений вместо создания нового по строке подключения.
+// Пул остаётся во владении вызывающего и не закрывается методом Close.
+func WithPool(pool *pgxpool.Pool) Option {
+	return func(o *options) {
+		o.pool = pool
+	}
+}
+
+// WithReadOnly переводит хранилище в режим только для чтения: изменяющие методы
+// возвращают ErrReadOnly, а транзакции открываются в режиме READ ONLY.
+// Подходит для окон обслуживания и экземпляров отчётов, работающих с репликой.
+func WithReadOnly() Option {
+	return func(o *options) {
+		o.readOnly = true
+	}
+}
+
+// WithPgBouncer включает совместимость с PgBouncer в режиме пула транзакций:
+// запросы отправляются по простому протоколу, а подготовленные выражения не кэшируются.
+// Параметры сеанса, например от WithStatementTimeout, PgBouncer должен пропускать
+// (ignore_startup_parameters) либо их следует задать в настройках роли в БД.
+// Несовместима с WithPool: для готового пула эти параметры задаются в его конфигурации.
+func WithPgBouncer() Option {
+	return func(o *options) {
+		o.simple = true
+	}
+}
+
+// WithLockTimeout ограничивает время ожидания блокировок каждым запросом.
+// Несовместима с WithPool: для готового пула ограничение задаётся в его конфигурации.
+func WithLockTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.lock = timeout
+	}
+}
+
+var (
+	ErrReadOnly   = fmt.Errorf("storage is read-only")
+	errPoolConfig = fmt.Errorf("connection settings must be set in the pool config when WithPool is used")
+)
+
+// connect создаёт подключение к БД с учётом опций.
+func connect(ctx context.Context, constr string, o options) (*conn, error) {
+	c := &conn{
+		pool:     o.pool,
+		logger:   o.logger,
+		tracer:   o.tracer,
+		metrics:  o.metrics,
+		retry:    o.retry,
+		readOnly: o.readOnly,
+		twoPhase: o.twoPhase,
+	}
+	if o.breaker.Window > 0 {
+		c.breaker = newBreaker(o.breaker)
+	}
+	if o.explain != nil {
+		c.explainer = newExplainer(o.explain, o.explainMethods)
+	}
+	if o.replica != nil {
+		c.replica = newReplica(o.replica, o.replicaPolicy)
+		c.writes = new(writeTracker)
+	}
+	if c.pool != nil {
+		if o.timeout > 0 || o.lock > 0 || o.simple {
+			return nil, errPoolConfig
+		}
+		return c, nil
+	}
+
+	cfg, err := pgxpool.ParseConfig(constr)
+	if err != nil {
+		return nil, err
+	}
+	if o.timeout > 0 {
+		cfg.ConnConfig.RuntimeParams["statement_timeout"] = strconv.FormatInt(o.timeout.Milliseconds(), 10)
+	}
+	if o.lock > 0 {
+		cfg.ConnConfig.RuntimeParams["lock_timeout"] = strconv.FormatInt(o.lock.Milliseconds(), 10)
+	}
+	if o.readOnly {
+		cfg.ConnConfig.RuntimeParams["default_transaction_read_only"] = "on"
+	}
+	if o.simple {
+		cfg.ConnConfig.PreferSimpleProtocol = true
+		cfg.ConnConfig.BuildStatementCache = nil
+	}
+	c.pool, err = pgxpool.ConnectConfig(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	c.own = true
+
+	return c, nil
+}
+
+// Подключение к БД: пул соединений с журналированием, трассировкой и повтором запросов.
+// Методы повторяют сигнатуры pgxpool.Pool.
+type conn struct {
+	pool     *pgxpool.Pool
+	own      bool // пул создан хранилищем и закрывается в Close
+	logger   *slog.Logger
+	tracer   Tracer
+	metrics  MetricsCollector
+	retry    RetryPolicy
+	readOnly bool     // транзакции открываются в режиме READ ONLY
+	breaker  *breaker // автоматический выключатель, nil - выключен
+
+	explainer *explainer // отладочный вывод планов, nil - выключен
+
+	replica *replica      // реплика для чтения, nil - все запросы на основном сервере
+	writes  *writeTracker // последняя запись хранилища для чтения своих записей
+
+	twoPhase bool   // разрешены транзакции двухфазной фиксации
+	tx       pgx.Tx // транзакция двухфазной фиксации, в которой выполняются все запросы, nil - пул
+}
+
+// Исполнитель запросов: пул соединений или транзакция, к которой привязано подключение.
+type querier interface {
+	Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row
+	Begin(ctx context.Context) (pgx.Tx, error)
+	SendBatch(ctx context.Context, b *pgx.Batch) pgx.BatchResults
+}
+
+// querier возвращает исполнитель запросов: транзакцию, если подключение к ней привязано, иначе пул.
+func (c *conn) querier() querier {
+	if c.tx != nil {
+		return c.tx
+	}
+	return c.pool
+}
+
+func (c *conn) Ping(ctx context.Context) error {
+	return c.pool.Ping(ctx)
+}
+
+func (c *conn) Close(ctx context.Context) error {
+	if !c.own {
+		return nil
+	}
+
+	// pgxpool.Pool.Close сразу отклоняет новые запросы и ждёт возврата всех соединений
+	done := make(chan struct{})
+	go func() {
+		c.pool.Close()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (c *conn) Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error) {
+	q := c.querier()
+	if c.explainer != nil {
+		c.explainer.explain(ctx, q.Begin, sql, args...)
+	}
+
+	var tag pgconn.CommandTag
+	err := c.run(ctx, sql, c.tx == nil, func(ctx context.Context) error {
+		var err error
+		tag, err = q.Exec(ctx, sql, args...)
+		return err
+	})
+	c.wrote()
+
+	return tag, err
+}
+
+func (c *conn) Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error) {
+	if c.explainer != nil {
+		c.explainer.explain(ctx, c.querier().Begin, sql, args...)
+	}
+
+	q := c.readPool(ctx, sql)
+	var rows pgx.Rows
+	err := c.run(ctx, sql, c.tx == nil, func(ctx context.Context) error {
+		var err error
+		rows, err = q.Query(ctx, sql, args...)
+		return err
+	})
+	if c.replica != nil && !readQuery(sql) {
+		c.wrote()
+	}
+
+	return rows, err
+}
+
+// QueryRow откладывает выполнение запроса до вызова Scan, чтобы запрос
+// можно было повторить при временной ошибке.
+func (c *conn) QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row {
+	if c.explainer != nil {
+		c.explainer.explain(ctx, c.querier().Begin, sql, args...)
+	}
+
+	return rowFunc(func(dest ...interface{}) error {
+		q := c.readPool(ctx, sql)
+		err := c.run(ctx, sql, c.tx == nil, func(ctx context.Context) error {
+			return q.QueryRow(ctx, sql, args...).Scan(dest...)
+		})
+		if c.replica != nil && !readQuery(sql) {
+			c.wrote()
+		}
+		return err
+	})
+}
+
+func (c *conn) Begin(ctx context.Context) (pgx.Tx, error) {
+	return c.BeginTx(ctx, pgx.TxOptions{})
+}
+
+// BeginTx в подключении, привязанном к транзакции, создаёт точку сохранения,
+// параметры opts при этом не применяются.
+func (c *conn) BeginTx(ctx context.Context, opts pgx.TxOptions) (pgx.Tx, error) {
+	if c.tx != nil {
+		var tx pgx.Tx
+		err := c.run(ctx, "SAVEPOINT", false, func(ctx context.Context) error {
+			var err error
+			tx, err = c.tx.Begin(ctx)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		return &connTx{Tx: tx, c: c}, nil
+	}
+
+	if c.readOnly {
+		opts.AccessMode = pgx.ReadOnly
+	}
+
+	var tx pgx.Tx
+	err := c.run(ctx, "BEGIN", true, func(ctx context.Context) error {
+		var err error
+		tx, err = c.pool.BeginTx(ctx, opts)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &connTx{Tx: tx, c: c}, nil
+}
+
+// SendBatch отправляет пакет запросов за одно обращение к серверу и передаёт результаты в read.
+// При временной ошибке пакет отправляется повторно, поэтому read не должна
+// накапливать результаты между вызовами.
+func (c *conn) SendBatch(ctx context.Context, b *pgx.Batch, read func(pgx.BatchResults) error) error {
+	q := c.querier()
+	err := c.run(ctx, "BATCH", c.tx == nil, func(ctx context.Context) error {
+		br := q.SendBatch(ctx, b)
+		err := read(br)
+		if err != nil {
+			br.Close()
+			return err
+		}
+		return br.Close()
+	})
+	c.wrote()
+
+	return err
+}
+
+// run выполняет запрос fn с трассировкой и журналированием,
+// повторяя его по политике повтора, если retry равен true.
+// Ошибка после всех повторов учитывается в метриках.
+func (c *conn) run(ctx context.Context, sql string, retry bool, fn func(context.Context) error) error {
+	err := c.attempt(ctx, sql, retry, fn)
+	if err != nil && c.metrics != nil {
+		c.metrics.CountError(ErrorCategory(err))
+	}
+
+	return err
+}
+
+// attempt выполняет запрос fn для run, повторяя его при временных ошибках.
+func (c *conn) attempt(ctx context.Context, sql string, retry bool, fn func(context.Context) error) error {
+	attempts := 1
+	if retry && c.retry.Attempts > 1 {
+		attempts = c.retry.Attempts
+	}
+	backoff := c.retry.Backoff
+
+	var err error
+	for i := 0; i < attempts; i++ {
+		if i > 0 {
+			select {
+			case <-ctx.Done():
+				return err
+			case <-time.After(backoff):
+			}
+			backoff *= 2
+		}
+		if c.breaker != nil {
+			err = c.breaker.allow()
+			if err != nil {
+				return err
+			}
+		}
+		err = c.observe(ctx, sql, fn)
+		if c.breaker != nil {
+			c.breaker.record(err)
+		}
+		if c.readOnly && readOnlyViolation(err) {
+			return ErrReadOnly
+		}
+		if quotaViolation(err) {
+			return ErrQuotaExceeded
+		}
+		if closedBeforeOpened(err) {
+			return ErrClosedBeforeOpened
+		}
+		if duplicateTitle(err) {
+			return ErrDuplicateTitle
+		}
+		if err == nil || !retryable(err) {
+			return err
+		}
+	}
+
+	return err
+}
+
+// observe выполняет запрос fn с трассировкой и журналированием.
+func (c *conn) observe(ctx context.Context, sql string, fn func(context.Context) error) error {
+	end := func(error) {}
+	if c.tracer != nil {
+		ctx, end = c.tracer.TraceQuery(ctx, sql)
+	}
+
+	start := time.Now()
+	err := fn(ctx)
+	end(err)
+
+	if c.logger != nil {
+		level := slog.LevelDebug
+		if err != nil && err != pgx.ErrNoRows {
+			level = slog.LevelError
+		}
+		c.logger.LogAttrs(ctx, level, "query",
+			slog.String("sql", sql),
+			slog.Duration("duration", time.Since(start)),
+			slog.Any("error", err),
+		)
+	}
+
+	return err
+}
+
+// retryable сообщает, можно ли безопасно повторить запрос, завершившийся ошибкой err.
+func retryable(err error) bool {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		// serialization_failure, deadlock_detected
+		return pgErr.Code == "40001" || pgErr.Code == "40P01"
+	}
+
+	return pgconn.SafeToRetry(err)
+}
+
+// readOnlyViolation сообщает, что запрос пытался изменить данные в транзакции READ ONLY.
+func readOnlyViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	// read_only_sql_transaction
+	return errors.As(err, &pgErr) && pgErr.Code == "25006"
+}
+
+// quotaViolation сообщает, что запрос отклонён проверкой квоты рабочего пространства.
+func quotaViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	// код ошибки функции check_open_tasks_quota
+	return errors.As(err, &pgErr) && pgErr.Code == "QT001"
+}
+
+// closedBeforeOpened сообщает, что запрос отклонён ограничением на время выполнения задачи.
+func closedBeforeOpened(err error) bool {
+	var pgErr *pgconn.PgError
+	// check_violation
+	return errors.As(err, &pgErr) && pgErr.Code == "23514" && pgErr.ConstraintName == "tasks_closed_after_opened"
+}
+
+// duplicateTitle сообщает, что запрос отклонён проверкой уникальности названия задачи.
+func duplicateTitle(err error) bool {
+	var pgErr *pgconn.PgError
+	// unique_violation
+	return errors.As(err, &pgErr) && pgErr.Code == "23505" && pgErr.ConstraintName == "task_title_keys_unique"
+}
+
+// slugConflict сообщает, что адрес задачи уже занят задачей, созданной параллельно.
+func slugConflict(err error) bool {
+	var pgErr *pgconn.PgError
+	// unique_violation
+	return errors.As(err, &pgErr) && pgErr.Code == "23505" && pgErr.ConstraintName == "tasks_slug_idx"
+}
+
+// Транзакция, запросы которой трассируются и журналируются, но не повторяются.
+type connTx struct {
+	pgx.Tx
+	c *conn
+}
+
+// Commit фиксирует транзакцию и отмечает запись для чтения своих записей.
+func (tx *connTx) Commit(ctx context.Context) error {
+	err := tx.Tx.Commit(ctx)
+	tx.c.wrote()
+	return err
+}
+
+func (tx *connTx) Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error) {
+	if tx.c.explainer != nil {
+		tx.c.explainer.explain(ctx, tx.Tx.Begin, sql, args...)
+	}
+
+	var tag pgconn.CommandTag
+	err := tx.c.run(ctx, sql, false, func(ctx context.Context) error {
+		var err error
+		tag, err = tx.Tx.Exec(ctx, sql, args...)
+		return err
+	})
+
+	return tag, err
+}
+
+func (tx *connTx) Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error) {
+	if tx.c.explainer != nil {
+		tx.c.explainer.explain(ctx, tx.Tx.Begin, sql, args...)
+	}
+
+	var rows pgx.Rows
+	err := tx.c.run(ctx, sql, false, func(ctx context.Context) error {
+		var err error
+		rows, err = tx.Tx.Query(ctx, sql, args...)
+		return err
+	})
+
+	return rows, err
+}
+
+func (tx *connTx) QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row {
+	if tx.c.explainer != nil {
+		tx.c.explainer.explain(ctx, tx.Tx.Begin, sql, args...)
+	}
+
+	return rowFunc(func(dest ...interface{}) error {
+		return tx.c.run(ctx, sql, false, func(ctx context.Context) error {
+			return tx.Tx.QueryRow(ctx, sql, args...).Scan(dest...)
+		})
+	})
+}
+
+// Строка результата, запрос которой выполняется при сканировании.
+type rowFunc func(dest ...interface{}) error
+
+func (f rowFunc) Scan(dest ...interface{}) error {
+	return f(dest...)
+}
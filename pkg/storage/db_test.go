@@ -0,0 +1,146 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+type testTracer struct {
+	queries []string
+	errs    []error
+}
+
+func (tr *testTracer) TraceQuery(ctx context.Context, sql string) (context.Context, func(error)) {
+	tr.queries = append(tr.queries, sql)
+	return ctx, func(err error) { tr.errs = append(tr.errs, err) }
+}
+
+func TestConn_run(t *testing.T) {
+	serialization := &pgconn.PgError{Code: "40001"}
+	syntax := &pgconn.PgError{Code: "42601"}
+	tests := []struct {
+		name     string
+		attempts int
+		retry    bool
+		errs     []error
+		wantErr  error
+		wantRuns int
+	}{
+		{"no policy", 0, true, []error{serialization, nil}, serialization, 1},
+		{"retried until success", 3, true, []error{serialization, serialization, nil}, nil, 3},
+		{"attempts exhausted", 2, true, []error{serialization, serialization, nil}, serialization, 2},
+		{"permanent error", 3, true, []error{syntax, nil}, syntax, 1},
+		{"transaction query", 3, false, []error{serialization, nil}, serialization, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracer := &testTracer{}
+			c := &conn{tracer: tracer, retry: RetryPolicy{Attempts: tt.attempts}}
+			runs := 0
+			err := c.run(context.Background(), "SELECT 1", tt.retry, func(context.Context) error {
+				err := tt.errs[runs]
+				runs++
+				return err
+			})
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("error: want %v, got %v", tt.wantErr, err)
+			}
+			if runs != tt.wantRuns {
+				t.Errorf("runs: want %d, got %d", tt.wantRuns, runs)
+			}
+			if len(tracer.queries) != runs || len(tracer.errs) != runs {
+				t.Errorf("traced: want %d, got %d started and %d finished", runs, len(tracer.queries), len(tracer.errs))
+			}
+		})
+	}
+}
+
+func TestConn_logger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	c := &conn{logger: logger}
+
+	_ = c.run(context.Background(), "SELECT 1", false, func(context.Context) error { return nil })
+	_ = c.run(context.Background(), "SELECT 2", false, func(context.Context) error { return &pgconn.PgError{Code: "42601"} })
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("log lines: want 2, got %d", len(lines))
+	}
+	if !strings.Contains(lines[0], "level=DEBUG") || !strings.Contains(lines[0], `sql="SELECT 1"`) {
+		t.Errorf("log: unexpected line %q", lines[0])
+	}
+	if !strings.Contains(lines[1], "level=ERROR") || !strings.Contains(lines[1], `sql="SELECT 2"`) {
+		t.Errorf("log: unexpected line %q", lines[1])
+	}
+}
+
+func TestNew_poolWithConnSettings(t *testing.T) {
+	tests := []struct {
+		name string
+		opt  Option
+	}{
+		{"statement timeout", WithStatementTimeout(1)},
+		{"lock timeout", WithLockTimeout(1)},
+		{"pgbouncer", WithPgBouncer()},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := New("", WithPool(&pgxpool.Pool{}), tt.opt)
+			if err != errPoolConfig {
+				t.Errorf("error: want %v, got %v", errPoolConfig, err)
+			}
+		})
+	}
+}
+
+func TestNewWithPool(t *testing.T) {
+	pool := &pgxpool.Pool{}
+	s, err := NewWithPool(pool)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if s.db.pool != pool {
+		t.Error("pool: want the provided pool")
+	}
+	if s.db.own {
+		t.Error("own: want false for a provided pool")
+	}
+	err = s.Close(context.Background())
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestStorage_ReadOnly(t *testing.T) {
+	s, err := NewWithPool(&pgxpool.Pool{}, WithReadOnly())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	_, err = s.NewTask(Task{Title: "Read-only"})
+	if !errors.Is(err, ErrReadOnly) {
+		t.Errorf("error: want %v, got %v", ErrReadOnly, err)
+	}
+	err = s.DeleteTask(1)
+	if !errors.Is(err, ErrReadOnly) {
+		t.Errorf("error: want %v, got %v", ErrReadOnly, err)
+	}
+
+	c := &conn{readOnly: true}
+	err = c.run(context.Background(), "UPDATE tasks SET title = ''", false, func(context.Context) error {
+		return &pgconn.PgError{Code: "25006"}
+	})
+	if err != ErrReadOnly {
+		t.Errorf("error: want %v, got %v", ErrReadOnly, err)
+	}
+}
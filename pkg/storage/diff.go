@@ -0,0 +1,124 @@
+package storage
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Количество строк контекста вокруг изменений в unified diff.
+const diffContext = 3
+
+// Строка результата сравнения: ' ' - без изменений, '-' - удалена, '+' - добавлена.
+type diffLine struct {
+	kind byte
+	text string
+}
+
+// diffLines сравнивает два списка строк по наибольшей общей подпоследовательности.
+func diffLines(a, b []string) []diffLine {
+	// lcs[i][j] - длина наибольшей общей подпоследовательности a[i:] и b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var lines []diffLine
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			lines = append(lines, diffLine{' ', a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			lines = append(lines, diffLine{'-', a[i]})
+			i++
+		default:
+			lines = append(lines, diffLine{'+', b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		lines = append(lines, diffLine{'-', a[i]})
+	}
+	for ; j < len(b); j++ {
+		lines = append(lines, diffLine{'+', b[j]})
+	}
+
+	return lines
+}
+
+// unifiedDiff возвращает разницу между текстами from и to в формате unified diff.
+// Для одинаковых текстов возвращает пустую строку.
+func unifiedDiff(fromName, toName, from, to string) string {
+	lines := diffLines(strings.Split(from, "\n"), strings.Split(to, "\n"))
+
+	// номера строк в from и to перед каждой строкой результата
+	fromPos := make([]int, len(lines)+1)
+	toPos := make([]int, len(lines)+1)
+	for k, l := range lines {
+		fromPos[k+1], toPos[k+1] = fromPos[k], toPos[k]
+		if l.kind != '+' {
+			fromPos[k+1]++
+		}
+		if l.kind != '-' {
+			toPos[k+1]++
+		}
+	}
+
+	var sb strings.Builder
+	for i := 0; i < len(lines); {
+		for i < len(lines) && lines[i].kind == ' ' {
+			i++
+		}
+		if i == len(lines) {
+			break
+		}
+
+		// изменения, между которыми не больше 2*diffContext строк, попадают в один блок
+		last := i
+		for k := i + 1; k < len(lines) && k-last-1 <= 2*diffContext; k++ {
+			if lines[k].kind != ' ' {
+				last = k
+			}
+		}
+		start := max(i-diffContext, 0)
+		end := min(last+diffContext+1, len(lines))
+
+		if sb.Len() == 0 {
+			fmt.Fprintf(&sb, "--- %s\n+++ %s\n", fromName, toName)
+		}
+		fmt.Fprintf(&sb, "@@ -%s +%s @@\n",
+			hunkRange(fromPos[start], fromPos[end]-fromPos[start]),
+			hunkRange(toPos[start], toPos[end]-toPos[start]),
+		)
+		for _, l := range lines[start:end] {
+			sb.WriteByte(l.kind)
+			sb.WriteString(l.text)
+			sb.WriteByte('\n')
+		}
+		i = end
+	}
+
+	return sb.String()
+}
+
+// hunkRange форматирует диапазон строк блока unified diff.
+func hunkRange(before, n int) string {
+	if n == 0 {
+		return fmt.Sprintf("%d,0", before)
+	}
+	if n == 1 {
+		return fmt.Sprintf("%d", before+1)
+	}
+	return fmt.Sprintf("%d,%d", before+1, n)
+}
@@ -0,0 +1,61 @@
+package storage
+
+import "testing"
+
+func TestUnifiedDiff(t *testing.T) {
+	tests := []struct {
+		name string
+		from string
+		to   string
+		want string
+	}{
+		{
+			name: "equal texts",
+			from: "a\nb",
+			to:   "a\nb",
+			want: "",
+		},
+		{
+			name: "changed line",
+			from: "a\nb\nc",
+			to:   "a\nB\nc",
+			want: "--- from\n+++ to\n@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n",
+		},
+		{
+			name: "added line at the end",
+			from: "a",
+			to:   "a\nb",
+			want: "--- from\n+++ to\n@@ -1 +1,2 @@\n a\n+b\n",
+		},
+		{
+			name: "removed everything",
+			from: "a\nb",
+			to:   "",
+			want: "--- from\n+++ to\n@@ -1,2 +1 @@\n-a\n-b\n+\n",
+		},
+		{
+			name: "distant changes in separate hunks",
+			from: "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12",
+			to:   "one\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\ntwelve",
+			want: "--- from\n+++ to\n" +
+				"@@ -1,4 +1,4 @@\n-1\n+one\n 2\n 3\n 4\n" +
+				"@@ -9,4 +9,4 @@\n 9\n 10\n 11\n-12\n+twelve\n",
+		},
+		{
+			name: "close changes in one hunk",
+			from: "1\n2\n3\n4\n5\n6\n7\n8",
+			to:   "one\n2\n3\n4\n5\n6\n7\neight",
+			want: "--- from\n+++ to\n" +
+				"@@ -1,8 +1,8 @@\n-1\n+one\n 2\n 3\n 4\n 5\n 6\n 7\n-8\n+eight\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := unifiedDiff("from", "to", tt.from, tt.to)
+			if got != tt.want {
+				t.Errorf("diff:\nwant:\n%s\ngot:\n%s", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,37 @@
+package storage
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// Отчёт пробного запуска: действия, которые были бы выполнены.
+type DryRunReport struct {
+	Actions []DryRunAction
+}
+
+// Действие пробного запуска с параметрами, которые были бы записаны в журнал аудита.
+type DryRunAction struct {
+	Action  string
+	Payload map[string]interface{}
+}
+
+// DryRun возвращает хранилище, разрушающие операции которого (DeleteTask, MergeTasks,
+// ReassignTasks, EraseUserData, Restore, AddLabelToTasks, RemoveLabelFromTasks,
+// ApplyClientChanges) выполняются полностью, но откатываются вместо фиксации.
+// Затронутые задачи и количества записываются в report или возвращаются операцией.
+// Задание WithJob в пробном запуске не изменяется.
+func (s *Storage) DryRun(report *DryRunReport) *Storage {
+	scoped := *s
+	scoped.dryRun = report
+	return &scoped
+}
+
+// commit фиксирует транзакцию, а в режиме пробного запуска откатывает её.
+func (s *Storage) commit(ctx context.Context, tx pgx.Tx) error {
+	if s.dryRun != nil {
+		return tx.Rollback(ctx)
+	}
+	return tx.Commit(ctx)
+}
@@ -0,0 +1,161 @@
+package storage
+
+import (
+	"context"
+	"testing"
+)
+
+func TestStorage_DryRun(t *testing.T) {
+	db, err := storageConnect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close(context.Background()) })
+
+	taskID := newTestTask(t, db, "Dry run")
+
+	var report DryRunReport
+	err = db.DryRun(&report).DeleteTask(taskID)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	_, err = db.TaskByID(taskID)
+	if err != nil {
+		t.Errorf("task after dry run: want kept, got %v", err)
+	}
+	if len(report.Actions) != 1 || report.Actions[0].Action != AuditTaskDelete {
+		t.Fatalf("report: want one %q action, got %+v", AuditTaskDelete, report.Actions)
+	}
+	if got := report.Actions[0].Payload["task_id"]; got != taskID {
+		t.Errorf("task_id: want %d, got %v", taskID, got)
+	}
+
+	userID := newTestUser(t, db, "Dry run assignee")
+	otherID := newTestUser(t, db, "Dry run other")
+	err = db.UpdateTask(taskID, userID, 0, "", "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	report = DryRunReport{}
+	n, err := db.DryRun(&report).ReassignTasks(userID, otherID, false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if n != 1 {
+		t.Errorf("reassigned: want 1, got %d", n)
+	}
+	task, err := db.TaskByID(taskID)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if task.AssignedID != userID {
+		t.Errorf("assigned_id after dry run: want %d, got %d", userID, task.AssignedID)
+	}
+	ids, _ := report.Actions[0].Payload["task_ids"].([]int)
+	if len(ids) != 1 || ids[0] != taskID {
+		t.Errorf("task_ids: want [%d], got %v", taskID, report.Actions[0].Payload["task_ids"])
+	}
+}
+
+func TestStorage_DryRunLabelsAndJobs(t *testing.T) {
+	db, err := storageConnect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close(context.Background()) })
+
+	tenant := db.ForTenant(1170)
+	ctx := context.Background()
+	t.Cleanup(func() {
+		db.db.Exec(ctx, `DELETE FROM tasks WHERE tenant_id = 1170`)
+		db.db.Exec(ctx, `DELETE FROM labels WHERE tenant_id = 1170`)
+		db.db.Exec(ctx, `DELETE FROM jobs WHERE tenant_id = 1170`)
+	})
+	_, err = db.db.Exec(ctx, `INSERT INTO labels (tenant_id, name) VALUES (1170, 'Dry run')`)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	primaryID, err := tenant.NewTask(Task{Title: "Dry run primary"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	dupID, err := tenant.NewTask(Task{Title: "Dry run duplicate"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var report DryRunReport
+	n, err := tenant.DryRun(&report).AddLabelToTasks("Dry run", []int{primaryID, dupID})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if n != 2 {
+		t.Errorf("labeled: want 2, got %d", n)
+	}
+	labeled, err := tenant.TasksByLabel("Dry run")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(labeled) != 0 {
+		t.Errorf("labeled after dry run: want 0, got %d", len(labeled))
+	}
+
+	_, err = tenant.AddLabelToTasks("Dry run", []int{primaryID})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	n, err = tenant.DryRun(&report).RemoveLabelFromTasks("Dry run", []int{primaryID})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if n != 1 {
+		t.Errorf("unlabeled: want 1, got %d", n)
+	}
+	labeled, err = tenant.TasksByLabel("Dry run")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(labeled) != 1 {
+		t.Errorf("labeled after dry run: want 1, got %d", len(labeled))
+	}
+
+	// пробный запуск не запускает и не завершает задание
+	jobID, err := tenant.NewJob()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	err = tenant.WithJob(jobID).DryRun(&report).MergeTasks(primaryID, []int{dupID})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	job, err := tenant.JobStatus(jobID)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if job.State != JobPending || job.Kind != "" {
+		t.Errorf("job after dry run: want pending, got %+v", job)
+	}
+
+	delta, err := tenant.TasksModifiedSince(0)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	report = DryRunReport{}
+	res, err := tenant.DryRun(&report).ApplyClientChanges([]TaskChange{
+		{TaskID: dupID, Version: delta.Versions[dupID], Delete: true},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(res.Applied) != 1 {
+		t.Errorf("applied changes: want 1, got %+v", res.Applied)
+	}
+	_, err = tenant.TaskByID(dupID)
+	if err != nil {
+		t.Errorf("task after dry run sync: want kept, got %v", err)
+	}
+	if len(report.Actions) != 1 || report.Actions[0].Action != AuditTaskDelete {
+		t.Errorf("report: want one %q action, got %+v", AuditTaskDelete, report.Actions)
+	}
+}
@@ -0,0 +1,73 @@
+package storage
+
+import "time"
+
+// Представление задачи для внешних API.
+// Имена полей стабильны и не зависят от представления задачи в хранилище,
+// время передаётся в формате RFC 3339.
+type TaskDTO struct {
+	ID         int    `json:"id"`
+	Title      string `json:"title"`
+	Content    string `json:"content,omitempty"`
+	AuthorID   int    `json:"author_id,omitempty"`
+	AssignedID int    `json:"assigned_id,omitempty"`
+	Opened     string `json:"opened"`
+	Closed     string `json:"closed,omitempty"` // пусто для открытой задачи
+}
+
+// NewTaskDTO возвращает представление задачи для внешних API.
+func NewTaskDTO(t Task) TaskDTO {
+	d := TaskDTO{
+		ID:         t.ID,
+		Title:      t.Title,
+		Content:    t.Content,
+		AuthorID:   t.AuthorID,
+		AssignedID: t.AssignedID,
+		Opened:     t.Opened.UTC().Format(time.RFC3339),
+	}
+	if t.Closed != nil {
+		d.Closed = t.Closed.UTC().Format(time.RFC3339)
+	}
+
+	return d
+}
+
+// NewTaskDTOs возвращает представления списка задач.
+func NewTaskDTOs(tasks []Task) []TaskDTO {
+	dtos := make([]TaskDTO, 0, len(tasks))
+	for _, t := range tasks {
+		dtos = append(dtos, NewTaskDTO(t))
+	}
+
+	return dtos
+}
+
+// Task преобразует представление обратно в задачу.
+// Возвращает ошибку, если время указано не в формате RFC 3339.
+func (d TaskDTO) Task() (Task, error) {
+	t := Task{
+		ID:         d.ID,
+		Title:      d.Title,
+		Content:    d.Content,
+		AuthorID:   d.AuthorID,
+		AssignedID: d.AssignedID,
+	}
+
+	if d.Opened != "" {
+		opened, err := time.Parse(time.RFC3339, d.Opened)
+		if err != nil {
+			return Task{}, err
+		}
+		t.Opened = opened.UTC()
+	}
+	if d.Closed != "" {
+		closed, err := time.Parse(time.RFC3339, d.Closed)
+		if err != nil {
+			return Task{}, err
+		}
+		closed = closed.UTC()
+		t.Closed = &closed
+	}
+
+	return t, nil
+}
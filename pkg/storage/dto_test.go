@@ -0,0 +1,138 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+var updateGolden = flag.Bool("update", false, "перезаписать эталонные ответы в testdata/golden")
+
+// assertGolden сравнивает JSON-представление v с эталоном testdata/golden/<name>.json,
+// с флагом -update перезаписывает эталон.
+func assertGolden(t *testing.T, name string, v interface{}) {
+	t.Helper()
+
+	got, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	got = append(got, '\n')
+
+	path := filepath.Join("testdata", "golden", name+".json")
+	if *updateGolden {
+		err = os.MkdirAll(filepath.Dir(path), 0o755)
+		if err == nil {
+			err = os.WriteFile(path, got, 0o644)
+		}
+		if err != nil {
+			t.Fatalf("Can't update golden file: %v", err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Can't read golden file, run with -update to create it: %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s: response differs from golden file, run with -update if the change is intended\nwant:\n%s\ngot:\n%s", path, want, got)
+	}
+}
+
+func TestTaskDTO(t *testing.T) {
+	tests := []struct {
+		name string
+		task Task
+		want string
+	}{
+		{
+			name: "open task",
+			task: Task{ID: 1, Opened: unixTime(1700000000), Title: "Title", AuthorID: 2},
+			want: `{"id":1,"title":"Title","author_id":2,"opened":"2023-11-14T22:13:20Z"}`,
+		},
+		{
+			name: "closed task",
+			task: Task{
+				ID:         2,
+				Opened:     unixTime(1700000000),
+				Closed:     closedTime(1700003600),
+				AuthorID:   1,
+				AssignedID: 3,
+				Title:      "Title",
+				Content:    "Content",
+			},
+			want: `{"id":2,"title":"Title","content":"Content","author_id":1,"assigned_id":3,` +
+				`"opened":"2023-11-14T22:13:20Z","closed":"2023-11-14T23:13:20Z"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := json.Marshal(NewTaskDTO(tt.task))
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if string(b) != tt.want {
+				t.Errorf("json: want %s, got %s", tt.want, b)
+			}
+
+			var d TaskDTO
+			err = json.Unmarshal(b, &d)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			got, err := d.Task()
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.task) {
+				t.Errorf("task: want %+v, got %+v", tt.task, got)
+			}
+		})
+	}
+
+	_, err := TaskDTO{Opened: "yesterday"}.Task()
+	if err == nil {
+		t.Error("error: want parse error, got nil")
+	}
+}
+
+// Набор задач для эталонных ответов: открытая, выполненная, без необязательных
+// полей и с текстом, который кодируется в JSON с экранированием.
+var goldenTasks = []Task{
+	{ID: 1, Opened: unixTime(1700000000), AuthorID: 2, AssignedID: 3, Title: "Login fails", Content: "Steps:\n\n1. Open the page"},
+	{ID: 2, Opened: unixTime(1700000000), Closed: closedTime(1700086400), AuthorID: 2, Title: "Export to CSV", Content: "Done"},
+	{ID: 3, Opened: unixTime(1700172800), Title: "Пустая задача"},
+	{ID: 4, Opened: unixTime(1700172800), AuthorID: 3, Title: `<b>"Quoted" & escaped</b>`, Content: "Tab\there"},
+}
+
+// Ответы внешних API и представления, которые сохраняются в клиентах, не должны
+// меняться незаметно: изменение формата требует обновления эталонов через -update.
+func TestGoldenResponses(t *testing.T) {
+	tests := []struct {
+		name string
+		v    interface{}
+	}{
+		{"task_dto", NewTaskDTO(goldenTasks[0])},
+		{"task_dto_closed", NewTaskDTO(goldenTasks[1])},
+		{"task_dtos", NewTaskDTOs(goldenTasks)},
+		{"task_dtos_empty", NewTaskDTOs(nil)},
+		{"tasks", goldenTasks},
+		{"form_fields", []FormField{
+			{Name: "version", Type: FormFieldText, Required: true, MaxLength: 20, Pattern: `^\d+\.\d+$`},
+			{Name: "severity", Type: FormFieldChoice, Choices: []string{"low", "high"}},
+			{Name: "blocker", Type: FormFieldBool},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assertGolden(t, tt.name, tt.v)
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package storage
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// Минимальная триграммная схожесть заголовков, при которой задача считается возможным дубликатом.
+// Не может быть меньше pg_trgm.similarity_threshold (0.3 по умолчанию), иначе не будет использован индекс.
+const duplicateSimilarity = 0.5
+
+// Максимальное количество возвращаемых возможных дубликатов.
+const duplicateCandidates = 5
+
+// Возможный дубликат задачи.
+type DuplicateCandidate struct {
+	Task
+	Similarity float64
+}
+
+// NewTaskWithDuplicates создаёт новую задачу и возвращает её id вместе с открытыми задачами,
+// заголовок которых совпадает с заголовком новой задачи или похож на него.
+func (s *Storage) NewTaskWithDuplicates(t Task) (int, []DuplicateCandidate, error) {
+	id, err := s.NewTask(t)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	ctx := context.Background()
+	rows, err := s.db.Query(ctx, `
+		SELECT `+taskColumns+`, similarity(title, $1)
+		FROM tasks
+		WHERE
+			(lower(title) = lower($1) OR (title % $1 AND similarity(title, $1) >= $2)) AND
+			closed = 0 AND
+			id <> $3 AND
+			tenant_id = $4 AND
+			can_access($5, tasks)
+		ORDER BY 8 DESC, id
+		LIMIT $6
+	`,
+		t.Title,
+		duplicateSimilarity,
+		id,
+		s.tenantID,
+		s.userID,
+		duplicateCandidates,
+	)
+	if err != nil {
+		return id, nil, err
+	}
+
+	candidates, err := collectRows(rows, func(row pgx.Row) (DuplicateCandidate, error) {
+		var c DuplicateCandidate
+		var err error
+		c.Task, err = s.scanTask(row, &c.Similarity)
+		return c, err
+	})
+
+	return id, candidates, err
+}
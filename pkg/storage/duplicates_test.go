@@ -0,0 +1,77 @@
+package storage
+
+import (
+	"context"
+	"testing"
+)
+
+func TestStorage_NewTaskWithDuplicates(t *testing.T) {
+	db, err := storageConnect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close(context.Background()) })
+
+	existingID := newTestTask(t, db, "Login page crashes on submit")
+	closedID := newTestTask(t, db, "Login page crashes on submit")
+	err = db.UpdateTask(closedID, 0, 9999999999, "", "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		title   string
+		wantIDs []int
+	}{
+		{"same title", "login page crashes on submit", []int{existingID}},
+		{"similar title", "Login page crashes on submitting", []int{existingID}},
+		{"different title", "Add dark theme", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, candidates, err := db.NewTaskWithDuplicates(Task{Title: tt.title})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			t.Cleanup(func() {
+				err := db.DeleteTask(id)
+				if err != nil {
+					t.Errorf("Can't remove test task: %v", err)
+				}
+			})
+
+			if id == 0 {
+				t.Errorf("new task wasn't created")
+			}
+			var gotIDs []int
+			for _, c := range candidates {
+				gotIDs = append(gotIDs, c.ID)
+			}
+			if len(gotIDs) != len(tt.wantIDs) || (len(gotIDs) > 0 && gotIDs[0] != tt.wantIDs[0]) {
+				t.Errorf("candidates: want %v, got %v", tt.wantIDs, gotIDs)
+			}
+		})
+	}
+}
+
+// Поиск похожих задач по триграммному индексу названий.
+func BenchmarkStorage_NewTaskWithDuplicates(b *testing.B) {
+	db, err := storageConnect()
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() { db.Close(context.Background()) })
+
+	tenant := db.ForTenant(1237)
+	newBenchTasks(b, tenant, benchTasks)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, _, err := tenant.NewTaskWithDuplicates(Task{Title: benchTaskBatch(i%benchTasks, 1)[0].Title + " again"})
+		if err != nil {
+			b.Fatalf("Unexpected error: %v", err)
+		}
+	}
+}
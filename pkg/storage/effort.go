@@ -0,0 +1,142 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+var ErrInvalidDuration = fmt.Errorf("duration must be positive")
+
+// Трудозатраты по дереву подзадач.
+type EffortRollup struct {
+	TaskID         int           // корневая задача
+	Tasks          int           // задачи дерева, включая корневую
+	ClosedTasks    int           // выполненные задачи дерева
+	Unestimated    int           // задачи дерева без оценки
+	Estimate       time.Duration // сумма оценок
+	ClosedEstimate time.Duration // сумма оценок выполненных задач
+	Logged         time.Duration // затраченное время
+}
+
+// SetEstimate устанавливает оценку трудозатрат задачи, 0 снимает оценку.
+func (s *Storage) SetEstimate(taskID int, estimate time.Duration) error {
+	err := s.authorizeWrite(RoleReporter)
+	if err != nil {
+		return err
+	}
+	if estimate < 0 {
+		return ErrInvalidDuration
+	}
+
+	ctx := context.Background()
+	tag, err := s.db.Exec(ctx, `
+		UPDATE tasks
+		SET estimate = NULLIF($2, 0)
+		WHERE id = $1 AND tenant_id = $3 AND can_access($4, tasks)
+	`,
+		taskID,
+		int64(estimate/time.Second),
+		s.tenantID,
+		s.userID,
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrTaskNotFound
+	}
+
+	return nil
+}
+
+// LogTime записывает затраченное пользователем хранилища на задачу время и возвращает id записи.
+func (s *Storage) LogTime(taskID int, spent time.Duration) (int, error) {
+	err := s.authorizeWrite(RoleReporter)
+	if err != nil {
+		return 0, err
+	}
+	if spent < time.Second {
+		return 0, ErrInvalidDuration
+	}
+
+	ctx := context.Background()
+	var id int
+	err = s.db.QueryRow(ctx, `
+		INSERT INTO task_time_log (task_id, user_id, spent)
+		SELECT id, $3, $2
+		FROM tasks
+		WHERE id = $1 AND tenant_id = $4 AND can_access($3, tasks)
+		RETURNING id
+	`,
+		taskID,
+		int64(spent/time.Second),
+		s.userID,
+		s.tenantID,
+	).Scan(&id)
+	if err == pgx.ErrNoRows {
+		return 0, ErrTaskNotFound
+	}
+
+	return id, err
+}
+
+// RollupEstimates суммирует оценки и затраченное время по задаче rootTaskID
+// и всем её подзадачам на любой глубине.
+func (s *Storage) RollupEstimates(rootTaskID int) (EffortRollup, error) {
+	r := EffortRollup{TaskID: rootTaskID}
+	var estimate, closedEstimate, logged int64
+
+	ctx := context.Background()
+	err := s.db.QueryRow(ctx, `
+		WITH RECURSIVE tree AS (
+			SELECT id, closed, estimate
+			FROM tasks
+			WHERE id = $1 AND tenant_id = $2 AND can_access($3, tasks)
+			UNION
+			-- UNION вместо UNION ALL останавливает обход при циклических ссылках на родителя
+			SELECT t.id, t.closed, t.estimate
+			FROM tasks AS t
+			JOIN tree
+			ON t.parent_id = tree.id
+			WHERE t.tenant_id = $2
+		)
+		SELECT
+			count(*),
+			count(*) FILTER (WHERE closed > 0),
+			count(*) FILTER (WHERE estimate IS NULL),
+			COALESCE(sum(estimate), 0)::bigint,
+			COALESCE(sum(estimate) FILTER (WHERE closed > 0), 0)::bigint,
+			COALESCE((
+				SELECT sum(l.spent)
+				FROM task_time_log AS l
+				WHERE l.task_id IN (SELECT id FROM tree)
+			), 0)::bigint
+		FROM tree
+	`,
+		rootTaskID,
+		s.tenantID,
+		s.userID,
+	).Scan(
+		&r.Tasks,
+		&r.ClosedTasks,
+		&r.Unestimated,
+		&estimate,
+		&closedEstimate,
+		&logged,
+	)
+	if err != nil {
+		return EffortRollup{}, err
+	}
+	if r.Tasks == 0 {
+		return EffortRollup{}, ErrTaskNotFound
+	}
+
+	r.Estimate = time.Duration(estimate) * time.Second
+	r.ClosedEstimate = time.Duration(closedEstimate) * time.Second
+	r.Logged = time.Duration(logged) * time.Second
+
+	return r, nil
+}
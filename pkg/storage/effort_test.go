@@ -0,0 +1,72 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestStorage_RollupEstimates(t *testing.T) {
+	db, err := storageConnect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close(context.Background()) })
+
+	tenant := db.ForTenant(1200)
+	epic := newTestTask(t, tenant, "Epic")
+	story := newTestTask(t, tenant, "Story")
+	subtask := newTestTask(t, tenant, "Subtask")
+	_, err = db.db.Exec(context.Background(), `
+		UPDATE tasks
+		SET parent_id = CASE id WHEN $2 THEN $1 WHEN $3 THEN $2 END
+		WHERE id IN ($2, $3)
+	`, epic, story, subtask)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	for id, estimate := range map[int]time.Duration{story: 8 * time.Hour, subtask: 2 * time.Hour} {
+		err = tenant.SetEstimate(id, estimate)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	err = tenant.UpdateTask(subtask, 0, time.Now().Unix(), "", "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for _, id := range []int{subtask, subtask, epic} {
+		_, err = tenant.LogTime(id, time.Hour)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	got, err := tenant.RollupEstimates(epic)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	want := EffortRollup{
+		TaskID:         epic,
+		Tasks:          3,
+		ClosedTasks:    1,
+		Unestimated:    1,
+		Estimate:       10 * time.Hour,
+		ClosedEstimate: 2 * time.Hour,
+		Logged:         3 * time.Hour,
+	}
+	if got != want {
+		t.Errorf("rollup: want %+v, got %+v", want, got)
+	}
+
+	_, err = tenant.RollupEstimates(-1)
+	if !errors.Is(err, ErrTaskNotFound) {
+		t.Errorf("error: want %v, got %v", ErrTaskNotFound, err)
+	}
+	_, err = tenant.LogTime(epic, 0)
+	if !errors.Is(err, ErrInvalidDuration) {
+		t.Errorf("error: want %v, got %v", ErrInvalidDuration, err)
+	}
+}
@@ -0,0 +1,103 @@
+package storage
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
+
+var (
+	ErrNoEncryptionKey = fmt.Errorf("content is encrypted but no key provider is set")
+	ErrDecrypt         = fmt.Errorf("unable to decrypt content")
+)
+
+// Префикс зашифрованных значений, значения без префикса считаются открытым текстом.
+const encryptedPrefix = "enc:v1:"
+
+// KeyProvider предоставляет ключ AES (16, 24 или 32 байта) для шифрования содержимого задач.
+type KeyProvider interface {
+	Key() ([]byte, error)
+}
+
+// StaticKey - KeyProvider с постоянным ключом.
+type StaticKey []byte
+
+func (k StaticKey) Key() ([]byte, error) {
+	return k, nil
+}
+
+// WithEncryption возвращает хранилище, которое шифрует содержимое задач
+// при записи и расшифровывает при чтении ключом из keys.
+func (s *Storage) WithEncryption(keys KeyProvider) *Storage {
+	scoped := *s
+	scoped.keys = keys
+	return &scoped
+}
+
+// aead возвращает AES-GCM с ключом из KeyProvider.
+func (s *Storage) aead() (cipher.AEAD, error) {
+	key, err := s.keys.Key()
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// encrypt шифрует значение, если задан KeyProvider.
+// Пустые значения не шифруются.
+func (s *Storage) encrypt(plain string) (string, error) {
+	if s.keys == nil || plain == "" {
+		return plain, nil
+	}
+
+	gcm, err := s.aead()
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(plain), nil)
+
+	return encryptedPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// decrypt расшифровывает значение, записанное encrypt.
+// Значения без префикса возвращаются как есть.
+func (s *Storage) decrypt(stored string) (string, error) {
+	if !strings.HasPrefix(stored, encryptedPrefix) {
+		return stored, nil
+	}
+	if s.keys == nil {
+		return "", ErrNoEncryptionKey
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(stored, encryptedPrefix))
+	if err != nil {
+		return "", ErrDecrypt
+	}
+	gcm, err := s.aead()
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return "", ErrDecrypt
+	}
+	nonce, data := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	plain, err := gcm.Open(nil, nonce, data, nil)
+	if err != nil {
+		return "", ErrDecrypt
+	}
+
+	return string(plain), nil
+}
@@ -0,0 +1,106 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func testKey() StaticKey {
+	return StaticKey(bytes.Repeat([]byte{7}, 32))
+}
+
+func TestStorage_EncryptDecrypt(t *testing.T) {
+	s := (&Storage{}).WithEncryption(testKey())
+
+	tests := []struct {
+		name  string
+		plain string
+	}{
+		{"empty", ""},
+		{"ascii", "Salary review for Q3"},
+		{"unicode", "Задача с конфиденциальными данными"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			enc, err := s.encrypt(tt.plain)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if tt.plain != "" && (enc == tt.plain || !strings.HasPrefix(enc, encryptedPrefix)) {
+				t.Errorf("value wasn't encrypted: %q", enc)
+			}
+			dec, err := s.decrypt(enc)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if dec != tt.plain {
+				t.Errorf("decrypted: want %q, got %q", tt.plain, dec)
+			}
+		})
+	}
+
+	enc, err := s.encrypt("secret")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	_, err = (&Storage{}).decrypt(enc)
+	if !errors.Is(err, ErrNoEncryptionKey) {
+		t.Errorf("error: want %v, got %v", ErrNoEncryptionKey, err)
+	}
+	other := (&Storage{}).WithEncryption(StaticKey(bytes.Repeat([]byte{8}, 32)))
+	_, err = other.decrypt(enc)
+	if !errors.Is(err, ErrDecrypt) {
+		t.Errorf("error: want %v, got %v", ErrDecrypt, err)
+	}
+	plain, err := (&Storage{}).decrypt("legacy plain text")
+	if err != nil || plain != "legacy plain text" {
+		t.Errorf("plain text: want unchanged value, got %q, %v", plain, err)
+	}
+}
+
+func TestStorage_WithEncryption(t *testing.T) {
+	db, err := storageConnect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close(context.Background()) })
+
+	enc := db.WithEncryption(testKey())
+	const content = "Security incident details"
+	id, err := enc.NewTask(Task{Title: "Incident", Content: content})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	t.Cleanup(func() {
+		err := db.DeleteTask(id)
+		if err != nil {
+			t.Errorf("Can't remove test task: %v", err)
+		}
+	})
+
+	var stored string
+	err = db.db.QueryRow(context.Background(), `SELECT content FROM tasks WHERE id = $1`, id).Scan(&stored)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if stored == content {
+		t.Errorf("content is stored unencrypted")
+	}
+
+	task, err := enc.TaskByID(id)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if task.Content != content {
+		t.Errorf("task.content: want %q, got %q", content, task.Content)
+	}
+
+	_, err = db.TaskByID(id)
+	if !errors.Is(err, ErrNoEncryptionKey) {
+		t.Errorf("error: want %v, got %v", ErrNoEncryptionKey, err)
+	}
+}
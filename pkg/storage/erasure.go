@@ -0,0 +1,155 @@
+package storage
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// Отчёт об удалении данных пользователя: количество затронутых записей.
+type ErasureReport struct {
+	UserID          int
+	TasksAuthored   int // задачи, автор которых обезличен, а название и текст стёрты
+	TasksAssigned   int // задачи, с которых снят ответственный
+	Revisions       int // удалённые ревизии задач пользователя
+	Translations    int // удалённые переводы задач пользователя
+	HistoryEntries  int // записи истории, в которых обезличен пользователь
+	TimeEntries     int // записи учёта времени, перешедшие к пользователю по умолчанию
+	Flags           int // жалобы, перешедшие к пользователю по умолчанию, без пояснений
+	ShareLinks      int // ссылки доступа, перешедшие к пользователю по умолчанию
+	Tokens          int // удалённые токены доступа
+	Sessions        int // удалённые сессии
+	Grants          int // удалённые права доступа к задачам
+	LabelRules      int // удалённые правила разметки задач пользователя
+	EscalationRules int // удалённые правила эскалации с назначением пользователю
+	RotationShifts  int // удалённые места пользователя в графиках дежурств
+	IntakeDefaults  int // настройки приёма, в которых снят ответственный по умолчанию
+}
+
+// EraseUserData удаляет пользователя рабочего пространства и обезличивает связанные
+// с ним данные этого рабочего пространства: задачи, записи истории, учёта времени,
+// жалобы и ссылки доступа переходят к пользователю по умолчанию, токены, сессии
+// и права доступа удаляются. У задач пользователя стираются название, текст,
+// пользовательские поля и имя для адресов, а их ревизии и переводы удаляются;
+// задачи остаются в рабочем пространстве вместе со связями, метками и историей.
+// Пояснения жалоб пользователя стираются.
+// Правила разметки по автору-пользователю и правила эскалации с назначением
+// ему больше не могут сработать и удаляются, пользователь исключается из графиков
+// дежурств и перестаёт быть ответственным по умолчанию.
+// Все изменения и запись в журнал аудита выполняются в одной транзакции.
+func (s *Storage) EraseUserData(userID int) (ErasureReport, error) {
+	report := ErasureReport{UserID: userID}
+	err := s.authorizeWrite(RoleAdmin)
+	if err != nil {
+		return report, err
+	}
+
+	ctx := context.Background()
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return report, err
+	}
+	defer tx.Rollback(ctx)
+
+	var id int
+	err = tx.QueryRow(ctx, `
+		SELECT id
+		FROM users
+		WHERE id = $1 AND tenant_id = $2 AND id <> 0
+		FOR UPDATE
+	`,
+		userID,
+		s.tenantID,
+	).Scan(&id)
+	if err == pgx.ErrNoRows {
+		return report, ErrUserNotFound
+	}
+	if err != nil {
+		return report, err
+	}
+
+	// ревизии и переводы удаляются до стирания задач, после которого остаётся
+	// только ревизия со стёртым текстом
+	for _, step := range []struct {
+		sql   string
+		count *int
+	}{
+		{`DELETE FROM task_revisions WHERE task_id IN (SELECT id FROM tasks WHERE author_id = $1 AND tenant_id = $2)`, &report.Revisions},
+		{`DELETE FROM task_translations WHERE task_id IN (SELECT id FROM tasks WHERE author_id = $1 AND tenant_id = $2)`, &report.Translations},
+		{`
+			UPDATE tasks
+			SET author_id = 0, title = 'Erased task #' || id, content = '', fields = '{}', slug = NULL
+			WHERE author_id = $1 AND tenant_id = $2
+		`, &report.TasksAuthored},
+		{`UPDATE tasks SET assigned_id = 0 WHERE assigned_id = $1 AND tenant_id = $2`, &report.TasksAssigned},
+		{`UPDATE task_time_log SET user_id = 0 WHERE user_id = $1 AND task_id IN (SELECT id FROM tasks WHERE tenant_id = $2)`, &report.TimeEntries},
+		{`UPDATE task_flags SET reporter_id = 0, note = '' WHERE reporter_id = $1 AND task_id IN (SELECT id FROM tasks WHERE tenant_id = $2)`, &report.Flags},
+		{`UPDATE share_links SET created_by = 0 WHERE created_by = $1 AND tenant_id = $2`, &report.ShareLinks},
+		{`DELETE FROM api_tokens WHERE user_id = $1 AND tenant_id = $2`, &report.Tokens},
+		{`DELETE FROM sessions WHERE user_id = $1 AND tenant_id = $2`, &report.Sessions},
+		{`DELETE FROM task_grants WHERE user_id = $1 AND task_id IN (SELECT id FROM tasks WHERE tenant_id = $2)`, &report.Grants},
+		{`DELETE FROM label_rules WHERE author_id = $1 AND tenant_id = $2`, &report.LabelRules},
+		{`DELETE FROM escalation_rules WHERE assign_to = $1 AND tenant_id = $2`, &report.EscalationRules},
+		{`DELETE FROM rotation_members WHERE user_id = $1 AND rotation_id IN (SELECT id FROM rotations WHERE tenant_id = $2)`, &report.RotationShifts},
+		{`UPDATE intake_settings SET default_assignee = NULL WHERE default_assignee = $1 AND tenant_id = $2`, &report.IntakeDefaults},
+	} {
+		tag, err := tx.Exec(ctx, step.sql, userID, s.tenantID)
+		if err != nil {
+			return report, err
+		}
+		*step.count = int(tag.RowsAffected())
+	}
+
+	tag, err := tx.Exec(ctx, `
+		UPDATE task_history
+		SET
+			old_value = CASE WHEN old_value = $1 THEN '0' ELSE old_value END,
+			new_value = CASE WHEN new_value = $1 THEN '0' ELSE new_value END
+		WHERE
+			field = 'assigned_id' AND (old_value = $1 OR new_value = $1) AND
+			task_id IN (SELECT id FROM tasks WHERE tenant_id = $2)
+	`,
+		strconv.Itoa(userID),
+		s.tenantID,
+	)
+	if err != nil {
+		return report, err
+	}
+	report.HistoryEntries = int(tag.RowsAffected())
+
+	_, err = tx.Exec(ctx, `
+		DELETE FROM users
+		WHERE id = $1 AND tenant_id = $2
+	`,
+		userID,
+		s.tenantID,
+	)
+	if err != nil {
+		return report, err
+	}
+
+	err = s.audit(ctx, tx, AuditUserErase, map[string]interface{}{
+		"user_id":          report.UserID,
+		"tasks_authored":   report.TasksAuthored,
+		"tasks_assigned":   report.TasksAssigned,
+		"revisions":        report.Revisions,
+		"translations":     report.Translations,
+		"history_entries":  report.HistoryEntries,
+		"time_entries":     report.TimeEntries,
+		"flags":            report.Flags,
+		"share_links":      report.ShareLinks,
+		"tokens":           report.Tokens,
+		"sessions":         report.Sessions,
+		"grants":           report.Grants,
+		"label_rules":      report.LabelRules,
+		"escalation_rules": report.EscalationRules,
+		"rotation_shifts":  report.RotationShifts,
+		"intake_defaults":  report.IntakeDefaults,
+	})
+	if err != nil {
+		return report, err
+	}
+
+	return report, s.commit(ctx, tx)
+}
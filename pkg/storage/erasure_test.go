@@ -0,0 +1,130 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestStorage_EraseUserData(t *testing.T) {
+	db, err := storageConnect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close(context.Background()) })
+
+	userID := newTestUser(t, db, "Former Employee")
+	authoredID := newTestTask(t, db, "Authored task")
+	assignedID := newTestTask(t, db, "Assigned task")
+
+	_, err = db.db.Exec(context.Background(), `UPDATE tasks SET author_id = $1 WHERE id = $2`, userID, authoredID)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	err = db.UpdateTask(assignedID, userID, 0, "", "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	_, err = db.ReassignTasks(userID, 1, false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	err = db.UpdateTask(assignedID, userID, 0, "", "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	_, _, err = db.CreateToken(userID, "Personal", 0)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	err = db.GrantAccess(authoredID, userID)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	err = db.SetTaskTranslation(authoredID, "de", "Verfasste Aufgabe", "Persönlicher Text")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	ctx := context.Background()
+	var labelID int
+	err = db.db.QueryRow(ctx, `INSERT INTO labels (name) VALUES ('Erasure 1150') RETURNING id`).Scan(&labelID)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	t.Cleanup(func() { db.db.Exec(ctx, `DELETE FROM labels WHERE id = $1`, labelID) })
+	_, err = db.db.Exec(ctx, `
+		INSERT INTO label_rules (label_id, author_id) VALUES ($1, $2);
+	`, labelID, userID)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	_, err = db.db.Exec(ctx, `
+		INSERT INTO escalation_rules (name, label_id, unassigned_after, assign_to) VALUES ('Erasure 1150', $1, 0, $2)
+	`, labelID, userID)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	report, err := db.EraseUserData(userID)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	want := ErasureReport{
+		UserID:          userID,
+		TasksAuthored:   1,
+		TasksAssigned:   1,
+		Revisions:       1,
+		Translations:    1,
+		HistoryEntries:  1,
+		Tokens:          1,
+		Grants:          1,
+		LabelRules:      1,
+		EscalationRules: 1,
+	}
+	if report != want {
+		t.Errorf("report: want %+v, got %+v", want, report)
+	}
+
+	task, err := db.TaskByID(authoredID)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if task.AuthorID != 0 {
+		t.Errorf("task.author_id: want 0, got %d", task.AuthorID)
+	}
+	wantTitle := fmt.Sprintf("Erased task #%d", authoredID)
+	if task.Title != wantTitle || task.Content != "" {
+		t.Errorf("task: want title %q without content, got %q %q", wantTitle, task.Title, task.Content)
+	}
+	revisions, err := db.TaskRevisions(authoredID)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(revisions) != 1 || revisions[0].Title != wantTitle {
+		t.Errorf("revisions: want only erased revision, got %+v", revisions)
+	}
+	locales, err := db.TaskTranslations(authoredID)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(locales) != 0 {
+		t.Errorf("translations: want none, got %v", locales)
+	}
+	history, err := db.TaskHistory(assignedID)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(history) != 1 || history[0].OldValue != "0" {
+		t.Errorf("task history: want anonymized entry, got %+v", history)
+	}
+
+	_, err = db.UserRole(userID)
+	if !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("error: want %v, got %v", ErrUserNotFound, err)
+	}
+	_, err = db.EraseUserData(userID)
+	if !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("error: want %v, got %v", ErrUserNotFound, err)
+	}
+}
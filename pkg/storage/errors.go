@@ -0,0 +1,52 @@
+package storage
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// Ошибка операции хранилища с описанием операции, например "TaskByID task id=42: task not found".
+// Ошибки пакета, например ErrTaskNotFound, проверяются через errors.Is,
+// а StorageError извлекается из цепочки через errors.As.
+// Ошибки в этой обёртке возвращают основные методы работы с задачами: NewTask, NewTasks,
+// TaskByID, TaskBySlug, TaskSlug, UpdateTask, DeleteTask, ReassignTasks, MergeTasks,
+// CloneTask и SplitTask. Остальные методы возвращают ошибки без обёртки.
+type StorageError struct {
+	Op     string // метод хранилища
+	Entity string // сущность, с которой работает метод, например "task"
+	Key    string // ключ сущности, например "id=42"
+	Err    error  // исходная ошибка
+}
+
+func (e *StorageError) Error() string {
+	op := e.Op
+	for _, part := range []string{e.Entity, e.Key} {
+		if part != "" {
+			op += " " + part
+		}
+	}
+	return fmt.Sprintf("%s: %v", op, e.Err)
+}
+
+func (e *StorageError) Unwrap() error {
+	return e.Err
+}
+
+// opError дополняет ошибку err описанием операции op над сущностью entity с ключом key,
+// nil возвращается без изменений.
+func opError(op, entity, key string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &StorageError{Op: op, Entity: entity, Key: key, Err: err}
+}
+
+// taskError дополняет ошибку err описанием операции op над задачей taskID.
+func taskError(op string, taskID int, err error) error {
+	return opError(op, "task", "id="+strconv.Itoa(taskID), err)
+}
+
+// userError дополняет ошибку err описанием операции op над пользователем userID.
+func userError(op string, userID int, err error) error {
+	return opError(op, "user", "id="+strconv.Itoa(userID), err)
+}
@@ -0,0 +1,27 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestStorageError(t *testing.T) {
+	err := taskError("TaskByID", 42, ErrTaskNotFound)
+
+	if want := "TaskByID task id=42: task not found"; err.Error() != want {
+		t.Errorf("message: want %q, got %q", want, err.Error())
+	}
+	if !errors.Is(err, ErrTaskNotFound) {
+		t.Errorf("errors.Is: want %v in %v", ErrTaskNotFound, err)
+	}
+	var se *StorageError
+	if !errors.As(err, &se) || se.Op != "TaskByID" || se.Entity != "task" || se.Key != "id=42" {
+		t.Errorf("errors.As: want TaskByID task id=42, got %+v", se)
+	}
+	if taskError("TaskByID", 42, nil) != nil {
+		t.Errorf("nil error: want nil")
+	}
+	if want := "NewTasks task: empty tasks slice"; opError("NewTasks", "task", "", ErrNoTasksToAdd).Error() != want {
+		t.Errorf("message without key: want %q, got %q", want, opError("NewTasks", "task", "", ErrNoTasksToAdd))
+	}
+}
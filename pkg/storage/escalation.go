@@ -0,0 +1,306 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+var (
+	ErrEscalationRuleNotFound = fmt.Errorf("escalation rule not found")
+	ErrInvalidEscalationRule  = fmt.Errorf("escalation rule must assign either a user or a rotation")
+)
+
+// Правило эскалации: открытая задача с меткой Label, оставшаяся без ответственного
+// дольше UnassignedAfter с момента создания, назначается пользователю AssignTo
+// или текущему дежурному графика RotationID. Задаётся только одно из двух.
+type EscalationRule struct {
+	ID              int
+	Name            string
+	Label           string // пустая метка - задачи с любыми метками
+	UnassignedAfter time.Duration
+	AssignTo        int
+	RotationID      int
+	Enabled         bool
+}
+
+// validate проверяет, что правило назначает задачу пользователю или дежурному.
+func (r EscalationRule) validate() error {
+	if (r.AssignTo == 0) == (r.RotationID == 0) {
+		return ErrInvalidEscalationRule
+	}
+	return nil
+}
+
+// Срабатывание правила эскалации.
+type Escalation struct {
+	ID         int64
+	RuleID     int
+	TaskID     int
+	AssignedID int
+	Executed   int64
+}
+
+// CreateEscalationRule создаёт правило эскалации и возвращает его id.
+func (s *Storage) CreateEscalationRule(r EscalationRule) (int, error) {
+	err := s.authorizeWrite(RoleMaintainer)
+	if err != nil {
+		return 0, err
+	}
+	err = r.validate()
+	if err != nil {
+		return 0, err
+	}
+
+	ctx := context.Background()
+	labelID, err := s.labelID(ctx, r.Label)
+	if err != nil {
+		return 0, err
+	}
+
+	var id int
+	err = s.db.QueryRow(ctx, `
+		INSERT INTO escalation_rules (tenant_id, name, label_id, unassigned_after, assign_to, rotation_id, enabled)
+		VALUES ($1, $2, $3, $4, NULLIF($5, 0), NULLIF($6, 0), $7) RETURNING id
+	`,
+		s.tenantID,
+		r.Name,
+		labelID,
+		int64(r.UnassignedAfter/time.Second),
+		r.AssignTo,
+		r.RotationID,
+		r.Enabled,
+	).Scan(&id)
+
+	return id, err
+}
+
+// UpdateEscalationRule заменяет параметры правила эскалации r.ID.
+func (s *Storage) UpdateEscalationRule(r EscalationRule) error {
+	err := s.authorizeWrite(RoleMaintainer)
+	if err != nil {
+		return err
+	}
+	err = r.validate()
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	labelID, err := s.labelID(ctx, r.Label)
+	if err != nil {
+		return err
+	}
+
+	tag, err := s.db.Exec(ctx, `
+		UPDATE escalation_rules
+		SET
+			name = $2,
+			label_id = $3,
+			unassigned_after = $4,
+			assign_to = NULLIF($5, 0),
+			rotation_id = NULLIF($6, 0),
+			enabled = $7
+		WHERE id = $1 AND tenant_id = $8
+	`,
+		r.ID,
+		r.Name,
+		labelID,
+		int64(r.UnassignedAfter/time.Second),
+		r.AssignTo,
+		r.RotationID,
+		r.Enabled,
+		s.tenantID,
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrEscalationRuleNotFound
+	}
+
+	return nil
+}
+
+// DeleteEscalationRule удаляет правило эскалации вместе с журналом его срабатываний.
+func (s *Storage) DeleteEscalationRule(ruleID int) error {
+	err := s.authorizeWrite(RoleMaintainer)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	tag, err := s.db.Exec(ctx, `
+		DELETE FROM escalation_rules
+		WHERE id = $1 AND tenant_id = $2
+	`,
+		ruleID,
+		s.tenantID,
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrEscalationRuleNotFound
+	}
+
+	return nil
+}
+
+// EscalationRules возвращает правила эскалации рабочего пространства.
+func (s *Storage) EscalationRules() ([]EscalationRule, error) {
+	ctx := context.Background()
+	rows, err := s.db.Query(ctx, `
+		SELECT
+			r.id,
+			r.name,
+			COALESCE(l.name, ''),
+			r.unassigned_after,
+			COALESCE(r.assign_to, 0),
+			COALESCE(r.rotation_id, 0),
+			r.enabled
+		FROM escalation_rules AS r
+		LEFT JOIN labels AS l
+		ON l.id = r.label_id
+		WHERE r.tenant_id = $1
+		ORDER BY r.id
+	`,
+		s.tenantID,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return collectRows(rows, func(row pgx.Row) (EscalationRule, error) {
+		var r EscalationRule
+		var after int64
+		err := row.Scan(&r.ID, &r.Name, &r.Label, &after, &r.AssignTo, &r.RotationID, &r.Enabled)
+		r.UnassignedAfter = time.Duration(after) * time.Second
+		return r, err
+	})
+}
+
+// EscalationLog возвращает журнал срабатываний правила эскалации, начиная с последних.
+func (s *Storage) EscalationLog(ruleID int) ([]Escalation, error) {
+	ctx := context.Background()
+	rows, err := s.db.Query(ctx, `
+		SELECT e.id, e.rule_id, e.task_id, e.assigned_id, e.executed
+		FROM escalation_log AS e
+		JOIN escalation_rules AS r
+		ON r.id = e.rule_id
+		WHERE e.rule_id = $1 AND r.tenant_id = $2
+		ORDER BY e.id DESC
+	`,
+		ruleID,
+		s.tenantID,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return collectRows(rows, scanEscalation)
+}
+
+// scanEscalation сканирует срабатывание правила эскалации.
+func scanEscalation(row pgx.Row) (Escalation, error) {
+	var e Escalation
+	err := row.Scan(
+		&e.ID,
+		&e.RuleID,
+		&e.TaskID,
+		&e.AssignedID,
+		&e.Executed,
+	)
+
+	return e, err
+}
+
+// RunEscalations применяет включённые правила эскалации во всех рабочих пространствах
+// и возвращает их срабатывания, например для отправки уведомлений.
+// Если задаче подходят несколько правил, применяется правило с меньшим id.
+// Назначенная задача больше не подходит под правила, поэтому повторный запуск её не затрагивает.
+// Правила с графиком, в котором сейчас нет дежурного, пропускаются.
+// Доступен только системному пользователю.
+func (s *Storage) RunEscalations(ctx context.Context) ([]Escalation, error) {
+	err := s.authorizeSystemWrite()
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx, `
+		WITH matched AS (
+			SELECT DISTINCT ON (t.id) t.id AS task_id, r.id AS rule_id, a.assign_to
+			FROM escalation_rules AS r
+			CROSS JOIN LATERAL (
+				SELECT COALESCE(r.assign_to, on_call(r.rotation_id, extract(epoch from now())::bigint)) AS assign_to
+			) AS a
+			JOIN tasks AS t
+			ON t.tenant_id = r.tenant_id
+			WHERE
+				r.enabled AND a.assign_to IS NOT NULL AND t.closed = 0 AND t.assigned_id = 0 AND
+				t.opened <= extract(epoch from now()) - r.unassigned_after AND
+				(r.label_id IS NULL OR EXISTS (
+					SELECT 1 FROM tasks_labels AS tl WHERE tl.task_id = t.id AND tl.label_id = r.label_id
+				))
+			ORDER BY t.id, r.id
+		), assigned AS (
+			-- условие назначения повторно проверяется после ожидания блокировки строки,
+			-- поэтому одновременные запуски не назначают задачу дважды
+			UPDATE tasks AS t
+			SET assigned_id = m.assign_to
+			FROM matched AS m
+			WHERE t.id = m.task_id AND t.assigned_id = 0
+			RETURNING t.id, m.rule_id, m.assign_to
+		), history AS (
+			INSERT INTO task_history (task_id, field, old_value, new_value)
+			SELECT id, 'assigned_id', '0', assign_to::text
+			FROM assigned
+		)
+		INSERT INTO escalation_log (rule_id, task_id, assigned_id)
+		SELECT rule_id, id, assign_to
+		FROM assigned
+		RETURNING id, rule_id, task_id, assigned_id, executed
+	`)
+	if err != nil {
+		return nil, err
+	}
+	escalations, err := collectRows(rows, scanEscalation)
+	if err != nil {
+		return nil, err
+	}
+
+	return escalations, s.commit(ctx, tx)
+}
+
+// labelID возвращает id метки рабочего пространства по названию, для пустого названия - nil.
+func (s *Storage) labelID(ctx context.Context, label string) (*int, error) {
+	if label == "" {
+		return nil, nil
+	}
+
+	var id int
+	err := s.db.QueryRow(ctx, `
+		SELECT id
+		FROM labels
+		WHERE name = $1 AND tenant_id = $2
+	`,
+		label,
+		s.tenantID,
+	).Scan(&id)
+	if err == pgx.ErrNoRows {
+		return nil, ErrLabelNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &id, nil
+}
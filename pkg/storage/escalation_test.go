@@ -0,0 +1,110 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+func TestStorage_RunEscalationsSystemOnly(t *testing.T) {
+	s, err := NewWithPool(&pgxpool.Pool{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	_, err = s.ForTenant(1195).AsUser(1).RunEscalations(context.Background())
+	if !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("error: want %v, got %v", ErrPermissionDenied, err)
+	}
+}
+
+func TestStorage_RunEscalations(t *testing.T) {
+	db, err := storageConnect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close(context.Background()) })
+
+	tenant := db.ForTenant(1195)
+	ctx := context.Background()
+	_, err = db.db.Exec(ctx, `INSERT INTO labels (tenant_id, name) VALUES (1195, 'Urgent')`)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	t.Cleanup(func() { db.db.Exec(ctx, `DELETE FROM labels WHERE tenant_id = 1195`) })
+	onCallID := newTestUser(t, db, "On Call")
+
+	ruleID, err := tenant.CreateEscalationRule(EscalationRule{
+		Name:            "Urgent without assignee",
+		Label:           "Urgent",
+		UnassignedAfter: time.Hour,
+		AssignTo:        onCallID,
+		Enabled:         true,
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	t.Cleanup(func() { tenant.DeleteEscalationRule(ruleID) })
+
+	stale := newTestTask(t, tenant, "Stale")
+	addTestLabel(t, tenant, stale, "Urgent")
+	fresh := newTestTask(t, tenant, "Fresh")
+	addTestLabel(t, tenant, fresh, "Urgent")
+	unlabeled := newTestTask(t, tenant, "Unlabeled")
+	_, err = db.db.Exec(ctx, `
+		UPDATE tasks SET opened = opened - 7200 WHERE id = ANY($1)
+	`, []int{stale, unlabeled})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	escalations, err := db.RunEscalations(ctx)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var got []int
+	for _, e := range escalations {
+		if e.RuleID == ruleID {
+			got = append(got, e.TaskID)
+		}
+	}
+	if len(got) != 1 || got[0] != stale {
+		t.Errorf("escalated tasks: want [%d], got %v", stale, got)
+	}
+	task, err := tenant.TaskByID(stale)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if task.AssignedID != onCallID {
+		t.Errorf("assigned: want %d, got %d", onCallID, task.AssignedID)
+	}
+
+	// назначенные задачи повторно не эскалируются
+	_, err = db.RunEscalations(ctx)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	log, err := tenant.EscalationLog(ruleID)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(log) != 1 {
+		t.Errorf("log entries: want 1, got %d", len(log))
+	}
+
+	err = tenant.UpdateEscalationRule(EscalationRule{ID: ruleID, Label: "Missing", AssignTo: onCallID})
+	if !errors.Is(err, ErrLabelNotFound) {
+		t.Errorf("error: want %v, got %v", ErrLabelNotFound, err)
+	}
+	err = tenant.UpdateEscalationRule(EscalationRule{ID: ruleID, AssignTo: onCallID, RotationID: 1})
+	if !errors.Is(err, ErrInvalidEscalationRule) {
+		t.Errorf("error: want %v, got %v", ErrInvalidEscalationRule, err)
+	}
+	err = tenant.UpdateEscalationRule(EscalationRule{ID: -1, AssignTo: onCallID})
+	if !errors.Is(err, ErrEscalationRuleNotFound) {
+		t.Errorf("error: want %v, got %v", ErrEscalationRuleNotFound, err)
+	}
+}
@@ -0,0 +1,111 @@
+package storage
+
+import (
+	"context"
+	"runtime"
+	"strings"
+	"unicode"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// Получатель планов запросов: метод хранилища, текст запроса и план
+// EXPLAIN (ANALYZE, BUFFERS) либо ошибка его получения.
+type ExplainFunc func(method, sql, plan string, err error)
+
+// WithExplain включает отладочный режим: для запросов, выполняемых методами methods
+// (например "TasksAll"), либо для всех методов, если список пуст, выполняется
+// EXPLAIN (ANALYZE, BUFFERS) и план передаётся в fn.
+// План строится в отдельной транзакции или точке сохранения, которая откатывается,
+// поэтому изменяющие запросы не применяются дважды. Режим замедляет каждый запрос
+// и предназначен только для разработки.
+func WithExplain(fn ExplainFunc, methods ...string) Option {
+	return func(o *options) {
+		o.explain = fn
+		o.explainMethods = methods
+	}
+}
+
+// Построитель планов.
+type explainer struct {
+	fn      ExplainFunc
+	methods map[string]bool // nil - все методы
+}
+
+func newExplainer(fn ExplainFunc, methods []string) *explainer {
+	e := &explainer{fn: fn}
+	if len(methods) > 0 {
+		e.methods = make(map[string]bool, len(methods))
+		for _, m := range methods {
+			e.methods[m] = true
+		}
+	}
+	return e
+}
+
+// explain передаёт план запроса sql в fn, если запрос выполняется одним из настроенных методов.
+// begin открывает транзакцию или точку сохранения, в которой строится план.
+func (e *explainer) explain(ctx context.Context, begin func(context.Context) (pgx.Tx, error), sql string, args ...interface{}) {
+	if !explainable(sql) {
+		return
+	}
+	method := storageMethod()
+	if method == "" || (e.methods != nil && !e.methods[method]) {
+		return
+	}
+
+	tx, err := begin(ctx)
+	if err != nil {
+		e.fn(method, sql, "", err)
+		return
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx, `EXPLAIN (ANALYZE, BUFFERS) `+sql, args...)
+	if err != nil {
+		e.fn(method, sql, "", err)
+		return
+	}
+	lines, err := collectRows(rows, func(row pgx.Row) (string, error) {
+		var line string
+		err := row.Scan(&line)
+		return line, err
+	})
+	e.fn(method, sql, strings.Join(lines, "\n"), err)
+}
+
+// explainable сообщает, можно ли построить план запроса.
+func explainable(sql string) bool {
+	fields := strings.Fields(sql)
+	if len(fields) == 0 {
+		return false
+	}
+	switch strings.ToUpper(fields[0]) {
+	case "SELECT", "INSERT", "UPDATE", "DELETE", "WITH", "VALUES":
+		return true
+	}
+	return false
+}
+
+// storageMethod возвращает имя ближайшего по стеку вызовов экспортируемого метода Storage.
+func storageMethod() string {
+	pcs := make([]uintptr, 32)
+	n := runtime.Callers(3, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+	for {
+		frame, more := frames.Next()
+		const recv = "(*Storage)."
+		if i := strings.LastIndex(frame.Function, recv); i >= 0 {
+			name := frame.Function[i+len(recv):]
+			if j := strings.IndexByte(name, '.'); j >= 0 {
+				name = name[:j] // замыкания внутри метода
+			}
+			if name != "" && unicode.IsUpper(rune(name[0])) {
+				return name
+			}
+		}
+		if !more {
+			return ""
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package storage
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestExplainable(t *testing.T) {
+	tests := []struct {
+		sql  string
+		want bool
+	}{
+		{"\n\t\tSELECT id FROM tasks", true},
+		{"WITH x AS (SELECT 1) SELECT * FROM x", true},
+		{"delete from tasks", true},
+		{"ANALYZE tasks", false},
+		{"SET CONSTRAINTS ALL DEFERRED", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		if got := explainable(tt.sql); got != tt.want {
+			t.Errorf("explainable(%q): want %v, got %v", tt.sql, tt.want, got)
+		}
+	}
+}
+
+func (s *Storage) ExplainProbe() string {
+	return explainProbe()
+}
+
+func explainProbe() string {
+	return func() string { return storageMethod() }()
+}
+
+func TestStorageMethod(t *testing.T) {
+	s := &Storage{}
+	if got := s.ExplainProbe(); got != "ExplainProbe" {
+		t.Errorf("method: want %q, got %q", "ExplainProbe", got)
+	}
+	if got := explainProbe(); got != "" {
+		t.Errorf("method outside Storage: want empty, got %q", got)
+	}
+}
+
+func TestStorage_WithExplain(t *testing.T) {
+	db, err := storageConnect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close(context.Background()) })
+
+	var methods []string
+	var plans []string
+	explained, err := NewWithPool(db.db.pool, WithExplain(func(method, sql, plan string, err error) {
+		if err != nil {
+			t.Errorf("Unexpected error: %v", err)
+		}
+		methods = append(methods, method)
+		plans = append(plans, plan)
+	}, "TasksAll"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	_, err = explained.TaskByID(1)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(methods) != 0 {
+		t.Errorf("explained methods: want none for TaskByID, got %v", methods)
+	}
+
+	_, err = explained.TasksAll()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(methods) != 1 || methods[0] != "TasksAll" {
+		t.Fatalf("explained methods: want [TasksAll], got %v", methods)
+	}
+	if !strings.Contains(plans[0], "Execution Time") {
+		t.Errorf("plan: want EXPLAIN ANALYZE output, got %q", plans[0])
+	}
+}
@@ -0,0 +1,363 @@
+package storage
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// Поля сортировки списка задач.
+const (
+	OrderByID     = "id"
+	OrderByOpened = "opened"
+	OrderByClosed = "closed"
+	OrderByTitle  = "title"
+)
+
+// Состояния задач для выборки.
+const (
+	TaskStateOpen   = "open"
+	TaskStateClosed = "closed"
+)
+
+// Поля задачи для TasksFilter.Fields в дополнение к FieldTitle и FieldContent.
+const (
+	FieldID         = "id"
+	FieldOpened     = "opened"
+	FieldClosed     = "closed"
+	FieldAuthorID   = "author_id"
+	FieldAssignedID = "assigned_id"
+)
+
+var (
+	ErrInvalidOrder  = fmt.Errorf("invalid sort order")
+	ErrInvalidCursor = fmt.Errorf("invalid cursor")
+	ErrInvalidState  = fmt.Errorf("invalid task state")
+)
+
+// Параметры выборки задач, нулевые значения не ограничивают выборку.
+type TasksFilter struct {
+	Label      string // метка, включая дочерние метки на любой глубине
+	AuthorID   int
+	AssignedID int
+	State      string // TaskStateOpen или TaskStateClosed
+	OrderBy    string // поле сортировки, пустое - OrderByID
+	Desc       bool   // сортировка по убыванию
+	Limit      int    // размер страницы
+	Offset     int    // смещение, не используется вместе с Cursor
+	Cursor     string // курсор TaskPage.Next предыдущей страницы с теми же OrderBy и Desc
+	// длина выдержки из содержимого в символах: вместо содержимого возвращается
+	// его первый абзац, обрезанный до Excerpt символов; 0 - полное содержимое
+	Excerpt int
+	// поля задачи, которые нужно прочитать, пустой список - все поля;
+	// id и поле сортировки читаются всегда, остальные поля остаются нулевыми
+	Fields []string
+}
+
+// Страница списка задач.
+type TaskPage struct {
+	Tasks []Task
+	Next  string // курсор следующей страницы, пустой для последней страницы
+}
+
+// Позиция в списке задач: значение поля сортировки и id последней задачи страницы.
+type taskCursor struct {
+	OrderBy string          `json:"o"`
+	Desc    bool            `json:"d,omitempty"`
+	Value   json.RawMessage `json:"v"`
+	ID      int             `json:"id"`
+}
+
+// Столбцы сортировки списка задач.
+var taskOrderColumns = map[string]string{
+	OrderByID:     "t.id",
+	OrderByOpened: "t.opened",
+	OrderByClosed: "t.closed",
+	OrderByTitle:  "t.title",
+}
+
+// taskFilterSQL - условие отбора задач t по фильтру: метка $1 (с подзапросом
+// labelSubtreeSQL), рабочее пространство $2, пользователь $3, автор $4,
+// ответственный $5 и состояние $6.
+const taskFilterSQL = `
+	($1 = '' OR EXISTS (
+		SELECT 1 FROM tasks_labels AS tl WHERE tl.task_id = t.id AND tl.label_id IN (SELECT id FROM matched)
+	)) AND
+	($4 = 0 OR t.author_id = $4) AND
+	($5 = 0 OR t.assigned_id = $5) AND
+	($6 = '' OR ($6 = 'open') = (t.closed = 0)) AND
+	t.tenant_id = $2 AND can_access($3, t)`
+
+// Нулевые значения столбцов задачи, которые не запрошены в TasksFilter.Fields.
+var taskFieldZero = map[string]string{
+	FieldOpened:     "0",
+	FieldClosed:     "0",
+	FieldAuthorID:   "0",
+	FieldAssignedID: "0",
+	FieldTitle:      "''",
+	FieldContent:    "''",
+}
+
+// columns возвращает столбцы taskColumns задачи t, заменяя не запрошенные
+// в f.Fields столбцы нулевыми значениями, чтобы строку можно было сканировать scanTask.
+func (f TasksFilter) columns() (string, error) {
+	if len(f.Fields) == 0 && f.Excerpt <= 0 {
+		return taskColumnsOf("t"), nil
+	}
+	if len(f.Fields) == 0 {
+		f.Fields = strings.Split(taskColumns, ", ")
+	}
+
+	orderBy := f.OrderBy
+	if orderBy == "" {
+		orderBy = OrderByID
+	}
+	requested := map[string]bool{FieldID: true, orderBy: true}
+	for _, field := range f.Fields {
+		if _, ok := taskFieldZero[field]; !ok && field != FieldID {
+			return "", fmt.Errorf("%w: %s", ErrInvalidField, field)
+		}
+		requested[field] = true
+	}
+
+	columns := strings.Split(taskColumns, ", ")
+	for i, c := range columns {
+		switch {
+		case !requested[c]:
+			columns[i] = taskFieldZero[c]
+		case c == FieldContent && f.Excerpt > 0:
+			columns[i] = f.excerptColumn()
+		default:
+			columns[i] = "t." + c
+		}
+	}
+
+	return strings.Join(columns, ", "), nil
+}
+
+// excerptColumn возвращает выражение для выдержки из содержимого задачи t.
+// Зашифрованное содержимое читается полностью, выдержка из него получается
+// после расшифровки функцией excerpt.
+func (f TasksFilter) excerptColumn() string {
+	return `CASE WHEN starts_with(t.content, '` + encryptedPrefix + `') THEN t.content
+		ELSE left(split_part(t.content, E'\n\n', 1), ` + strconv.Itoa(f.Excerpt) + `) END`
+}
+
+// excerpt возвращает первый абзац текста, обрезанный до n символов.
+func excerpt(text string, n int) string {
+	text, _, _ = strings.Cut(text, "\n\n")
+	for i := range text {
+		if n == 0 {
+			return text[:i]
+		}
+		n--
+	}
+	return text
+}
+
+// orderValue возвращает значение поля сортировки задачи.
+func orderValue(t Task, orderBy string) interface{} {
+	switch orderBy {
+	case OrderByOpened:
+		return t.OpenedUnix()
+	case OrderByClosed:
+		return t.ClosedUnix()
+	case OrderByTitle:
+		return t.Title
+	}
+	return int64(t.ID)
+}
+
+// encodeCursor возвращает курсор, указывающий на задачу t.
+func encodeCursor(t Task, orderBy string, desc bool) (string, error) {
+	value, err := json.Marshal(orderValue(t, orderBy))
+	if err != nil {
+		return "", err
+	}
+	data, err := json.Marshal(taskCursor{OrderBy: orderBy, Desc: desc, Value: value, ID: t.ID})
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// decodeCursor возвращает значение поля сортировки и id задачи из курсора.
+// Курсор должен быть получен с тем же порядком сортировки.
+func decodeCursor(cursor, orderBy string, desc bool) (interface{}, int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, 0, ErrInvalidCursor
+	}
+	var c taskCursor
+	err = json.Unmarshal(data, &c)
+	if err != nil || c.OrderBy != orderBy || c.Desc != desc {
+		return nil, 0, ErrInvalidCursor
+	}
+
+	if orderBy == OrderByTitle {
+		var value string
+		err = json.Unmarshal(c.Value, &value)
+		if err != nil {
+			return nil, 0, ErrInvalidCursor
+		}
+		return value, c.ID, nil
+	}
+	var value int64
+	err = json.Unmarshal(c.Value, &value)
+	if err != nil {
+		return nil, 0, ErrInvalidCursor
+	}
+
+	return value, c.ID, nil
+}
+
+// validateState проверяет состояние задач фильтра.
+func (f TasksFilter) validateState() error {
+	if f.State != "" && f.State != TaskStateOpen && f.State != TaskStateClosed {
+		return ErrInvalidState
+	}
+	return nil
+}
+
+// TasksFiltered возвращает страницу задач, подходящих под фильтр f.
+// Задачи с одинаковым значением поля сортировки упорядочиваются по id.
+// Для последовательного обхода больших списков следует использовать Cursor:
+// в отличие от Offset, он не пропускает и не повторяет задачи при добавлении
+// и удалении задач между запросами страниц.
+func (s *Storage) TasksFiltered(f TasksFilter) (TaskPage, error) {
+	columns, err := f.columns()
+	if err != nil {
+		return TaskPage{}, err
+	}
+
+	tasks, next, err := filteredPage(s, f, columns,
+		func(row pgx.Row) (Task, error) {
+			t, err := s.scanTask(row)
+			if f.Excerpt > 0 {
+				t.Content = excerpt(t.Content, f.Excerpt)
+			}
+			return t, err
+		},
+		func(t Task) Task { return t },
+	)
+	return TaskPage{Tasks: tasks, Next: next}, err
+}
+
+// filteredPage выбирает страницу задач по фильтру f и возвращает её вместе с курсором
+// следующей страницы. columns - выбираемые столбцы задачи t, scan сканирует строку,
+// task возвращает задачу с полями сортировки для курсора.
+func filteredPage[T any](s *Storage, f TasksFilter, columns string, scan func(pgx.Row) (T, error), task func(T) Task) ([]T, string, error) {
+	if f.OrderBy == "" {
+		f.OrderBy = OrderByID
+	}
+	column, ok := taskOrderColumns[f.OrderBy]
+	if !ok {
+		return nil, "", ErrInvalidOrder
+	}
+	err := f.validateState()
+	if err != nil {
+		return nil, "", err
+	}
+	if f.Cursor != "" && f.Offset > 0 {
+		return nil, "", ErrInvalidCursor
+	}
+
+	// значение после курсора должно иметь тип столбца сортировки даже без курсора
+	var after interface{} = int64(0)
+	if f.OrderBy == OrderByTitle {
+		after = ""
+	}
+	var afterID int
+	if f.Cursor != "" {
+		after, afterID, err = decodeCursor(f.Cursor, f.OrderBy, f.Desc)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+	direction, compare := "ASC", ">"
+	if f.Desc {
+		direction, compare = "DESC", "<"
+	}
+
+	ctx := context.Background()
+	rows, err := s.db.Query(ctx, fmt.Sprintf(`
+		`+labelSubtreeSQL+`
+		SELECT `+columns+`
+		FROM tasks AS t
+		WHERE `+taskFilterSQL+` AND
+			(NOT $7 OR (%[1]s, t.id) %[3]s ($8, $9))
+		ORDER BY %[1]s %[2]s, t.id %[2]s
+		LIMIT NULLIF($10, 0) + 1
+		OFFSET $11
+	`, column, direction, compare),
+		f.Label,
+		s.tenantID,
+		s.userID,
+		f.AuthorID,
+		f.AssignedID,
+		f.State,
+		f.Cursor != "",
+		after,
+		afterID,
+		f.Limit,
+		f.Offset,
+	)
+	if err != nil {
+		return nil, "", err
+	}
+	items, err := collectRows(rows, scan)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// лишняя задача запрашивается, чтобы узнать, есть ли следующая страница
+	var next string
+	if f.Limit > 0 && len(items) > f.Limit {
+		items = items[:f.Limit]
+		next, err = encodeCursor(task(items[f.Limit-1]), f.OrderBy, f.Desc)
+	}
+
+	return items, next, err
+}
+
+// Наибольший размер случайной выборки задач.
+const maxSampleSize = 1000
+
+// SampleTasks возвращает до n случайных задач, подходящих под фильтр f,
+// например выполненные задачи для выборочной проверки качества.
+// Сортировка и постраничный вывод фильтра не используются, n не больше 1000.
+func (s *Storage) SampleTasks(f TasksFilter, n int) ([]Task, error) {
+	err := f.validateState()
+	if err != nil {
+		return nil, err
+	}
+	if n <= 0 {
+		return nil, nil
+	}
+	if n > maxSampleSize {
+		n = maxSampleSize
+	}
+
+	ctx := context.Background()
+	return s.queryTasks(ctx, labelSubtreeSQL+`
+		SELECT `+taskColumnsOf("t")+`
+		FROM tasks AS t
+		WHERE `+taskFilterSQL+`
+		ORDER BY random()
+		LIMIT $7
+	`,
+		f.Label,
+		s.tenantID,
+		s.userID,
+		f.AuthorID,
+		f.AssignedID,
+		f.State,
+		n,
+	)
+}
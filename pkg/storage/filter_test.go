@@ -0,0 +1,457 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestDecodeCursor(t *testing.T) {
+	task := Task{ID: 7, Title: "Deploy"}
+	cursor, err := encodeCursor(task, OrderByTitle, true)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		cursor  string
+		orderBy string
+		desc    bool
+		err     error
+	}{
+		{"same order", cursor, OrderByTitle, true, nil},
+		{"other field", cursor, OrderByOpened, true, ErrInvalidCursor},
+		{"other direction", cursor, OrderByTitle, false, ErrInvalidCursor},
+		{"garbage", "not a cursor", OrderByTitle, true, ErrInvalidCursor},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			value, id, err := decodeCursor(tt.cursor, tt.orderBy, tt.desc)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("error: want %v, got %v", tt.err, err)
+			}
+			if err == nil && (value != "Deploy" || id != 7) {
+				t.Errorf("cursor: want Deploy, 7, got %v, %d", value, id)
+			}
+		})
+	}
+}
+
+func TestTasksFilter_columns(t *testing.T) {
+	tests := []struct {
+		name string
+		f    TasksFilter
+		want string
+		err  error
+	}{
+		{"all fields", TasksFilter{}, taskColumnsOf("t"), nil},
+		{"title", TasksFilter{Fields: []string{FieldTitle}}, `t.id, 0, 0, 0, 0, t.title, ''`, nil},
+		{"order field", TasksFilter{Fields: []string{FieldID}, OrderBy: OrderByClosed}, `t.id, 0, t.closed, 0, 0, '', ''`, nil},
+		{"unknown field", TasksFilter{Fields: []string{"tenant_id"}}, "", ErrInvalidField},
+		{"excerpt", TasksFilter{Fields: []string{FieldContent}, Excerpt: 80}, `t.id, 0, 0, 0, 0, '', ` + TasksFilter{Excerpt: 80}.excerptColumn(), nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.f.columns()
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("error: want %v, got %v", tt.err, err)
+			}
+			if got != tt.want {
+				t.Errorf("columns: want %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestExcerpt(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		n    int
+		want string
+	}{
+		{"short", "Fix it", 10, "Fix it"},
+		{"truncated", "Принтер не печатает", 7, "Принтер"},
+		{"first paragraph", "Steps:\nopen\n\nLogs:\nnone", 100, "Steps:\nopen"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := excerpt(tt.text, tt.n); got != tt.want {
+				t.Errorf("excerpt: want %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestStorage_TasksFiltered(t *testing.T) {
+	db, err := storageConnect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close(context.Background()) })
+
+	tenant := db.ForTenant(1214)
+	ctx := context.Background()
+	_, err = db.db.Exec(ctx, `INSERT INTO labels (tenant_id, name) VALUES (1214, 'Bug')`)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	t.Cleanup(func() { db.db.Exec(ctx, `DELETE FROM labels WHERE tenant_id = 1214`) })
+
+	ids := make(map[string]int)
+	for _, title := range []string{"E", "B", "D", "A", "C"} {
+		ids[title] = newTestTask(t, tenant, title)
+		addTestLabel(t, tenant, ids[title], "Bug")
+	}
+	newTestTask(t, tenant, "Unlabeled")
+
+	want := []int{ids["E"], ids["D"], ids["C"], ids["B"], ids["A"]}
+	var got []int
+	f := TasksFilter{Label: "Bug", OrderBy: OrderByTitle, Desc: true, Limit: 2}
+	for pages := 0; ; pages++ {
+		page, err := tenant.TasksFiltered(f)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		for _, task := range page.Tasks {
+			got = append(got, task.ID)
+		}
+		if page.Next == "" {
+			if pages != 2 {
+				t.Errorf("pages: want 3, got %d", pages+1)
+			}
+			break
+		}
+		f.Cursor = page.Next
+	}
+	if len(got) != len(want) {
+		t.Fatalf("tasks: want %v, got %v", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("tasks: want %v, got %v", want, got)
+			break
+		}
+	}
+
+	page, err := tenant.TasksFiltered(TasksFilter{Label: "Bug", Fields: []string{FieldTitle}, Limit: 1})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(page.Tasks) != 1 || page.Tasks[0].Title != "E" || page.Tasks[0].Content != "" {
+		t.Errorf("partial task: want title E without content, got %+v", page.Tasks)
+	}
+
+	page, err = tenant.TasksFiltered(TasksFilter{Label: "Bug", OrderBy: OrderByTitle, Offset: 4})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(page.Tasks) != 1 || page.Tasks[0].Title != "E" || page.Next != "" {
+		t.Errorf("offset page: want [E], got %+v", page)
+	}
+
+	_, err = tenant.TasksFiltered(TasksFilter{OrderBy: "content"})
+	if !errors.Is(err, ErrInvalidOrder) {
+		t.Errorf("error: want %v, got %v", ErrInvalidOrder, err)
+	}
+	_, err = tenant.TasksFiltered(TasksFilter{OrderBy: OrderByTitle, Cursor: f.Cursor})
+	if !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("error: want %v, got %v", ErrInvalidCursor, err)
+	}
+}
+
+// Задача набора данных FuzzTasksFiltered для эталонной выборки в памяти.
+type fuzzTask struct {
+	id       int
+	title    string
+	author   int
+	assigned int
+	opened   int64
+	closed   int64
+	labels   []string
+}
+
+// FuzzTasksFiltered сравнивает выборки TasksFiltered по случайным фильтрам
+// с эталонной выборкой в памяти, включая обход списка по курсору.
+func FuzzTasksFiltered(f *testing.F) {
+	db, err := storageConnect()
+	if err != nil {
+		f.Fatal(err)
+	}
+	f.Cleanup(func() { db.Close(context.Background()) })
+
+	tenant := db.ForTenant(1236)
+	ctx := context.Background()
+	f.Cleanup(func() {
+		db.db.Exec(ctx, `DELETE FROM tasks WHERE tenant_id = 1236`)
+		db.db.Exec(ctx, `DELETE FROM deleted_tasks WHERE tenant_id = 1236`)
+		db.db.Exec(ctx, `DELETE FROM labels WHERE tenant_id = 1236`)
+		db.db.Exec(ctx, `DELETE FROM users WHERE tenant_id = 1236`)
+	})
+
+	var users [2]int
+	for i := range users {
+		err = db.db.QueryRow(ctx, `
+			INSERT INTO users (tenant_id, name) VALUES (1236, $1) RETURNING id
+		`, fmt.Sprintf("Fuzzer %d", i)).Scan(&users[i])
+		if err != nil {
+			f.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	_, err = db.db.Exec(ctx, `
+		INSERT INTO labels (tenant_id, name) VALUES (1236, 'Area'), (1236, 'UI'), (1236, 'Docs')
+	`)
+	if err != nil {
+		f.Fatalf("Unexpected error: %v", err)
+	}
+	err = tenant.SetLabelParent("UI", "Area")
+	if err != nil {
+		f.Fatalf("Unexpected error: %v", err)
+	}
+
+	// повторяющиеся значения проверяют упорядочивание по id при равных полях сортировки
+	titles := []string{"alpha", "bravo", "charlie"}
+	labels := [][]string{{"Area"}, {"UI"}, {"Docs"}, nil, {"UI", "Docs"}}
+	var tasks []fuzzTask
+	base := time.Now().Add(-24 * time.Hour).Unix()
+	for i := 0; i < 15; i++ {
+		task := fuzzTask{
+			title:  titles[i%len(titles)],
+			author: users[i%2],
+			opened: base + int64(i%4)*60,
+			labels: labels[i%len(labels)],
+		}
+		if i%3 != 0 {
+			task.assigned = users[(i+1)%2]
+		}
+		if i%3 == 1 {
+			task.closed = task.opened + int64(i%2)*3600
+		}
+		err = db.db.QueryRow(ctx, `
+			INSERT INTO tasks (tenant_id, title, content, author_id, assigned_id, opened, closed)
+			VALUES (1236, $1, 'Fuzz content', $2, $3, $4, $5)
+			RETURNING id
+		`, task.title, task.author, task.assigned, task.opened, task.closed).Scan(&task.id)
+		if err != nil {
+			f.Fatalf("Unexpected error: %v", err)
+		}
+		for _, label := range task.labels {
+			_, err = db.db.Exec(ctx, `
+				INSERT INTO tasks_labels (task_id, label_id)
+				SELECT $1, id FROM labels WHERE tenant_id = 1236 AND name = $2
+			`, task.id, label)
+			if err != nil {
+				f.Fatalf("Unexpected error: %v", err)
+			}
+		}
+		tasks = append(tasks, task)
+	}
+
+	f.Add(uint8(0), uint8(0), uint8(0), uint8(0), uint8(0), false, uint8(0), uint8(0), false, uint8(0))
+	f.Add(uint8(1), uint8(1), uint8(0), uint8(1), uint8(4), true, uint8(2), uint8(1), false, uint8(1))
+	f.Add(uint8(2), uint8(0), uint8(2), uint8(2), uint8(2), false, uint8(3), uint8(0), true, uint8(5))
+	f.Add(uint8(3), uint8(2), uint8(1), uint8(0), uint8(3), true, uint8(1), uint8(0), true, uint8(63))
+	f.Add(uint8(4), uint8(3), uint8(3), uint8(3), uint8(5), false, uint8(0), uint8(2), false, uint8(0))
+
+	labelNames := []string{"", "Area", "UI", "Docs", "Missing"}
+	userIDs := []int{0, users[0], users[1], -1}
+	states := []string{"", TaskStateOpen, TaskStateClosed, "snoozed"}
+	orders := []string{"", OrderByID, OrderByOpened, OrderByClosed, OrderByTitle, "content"}
+	fields := []string{FieldTitle, FieldContent, FieldOpened, FieldClosed, FieldAuthorID, FieldAssignedID}
+
+	f.Fuzz(func(t *testing.T, label, author, assigned, state, order uint8, desc bool, limit, offset uint8, cursor bool, mask uint8) {
+		filter := TasksFilter{
+			Label:      labelNames[int(label)%len(labelNames)],
+			AuthorID:   userIDs[int(author)%len(userIDs)],
+			AssignedID: userIDs[int(assigned)%len(userIDs)],
+			State:      states[int(state)%len(states)],
+			OrderBy:    orders[int(order)%len(orders)],
+			Desc:       desc,
+			Limit:      int(limit) % 6,
+		}
+		if !cursor {
+			filter.Offset = int(offset) % 4
+		}
+		for i, field := range fields {
+			if mask&(1<<i) != 0 {
+				filter.Fields = append(filter.Fields, field)
+			}
+		}
+
+		var got []Task
+		for pages := 0; pages <= len(tasks); pages++ {
+			page, err := tenant.TasksFiltered(filter)
+			if filter.OrderBy == "content" {
+				if !errors.Is(err, ErrInvalidOrder) {
+					t.Fatalf("error: want %v, got %v", ErrInvalidOrder, err)
+				}
+				return
+			}
+			if filter.State == "snoozed" {
+				if !errors.Is(err, ErrInvalidState) {
+					t.Fatalf("error: want %v, got %v", ErrInvalidState, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("filter %+v: unexpected error: %v", filter, err)
+			}
+			got = append(got, page.Tasks...)
+			if !cursor || page.Next == "" {
+				break
+			}
+			filter.Cursor = page.Next
+		}
+
+		want := filterFuzzTasks(tasks, filter)
+		if !cursor {
+			want = want[min(filter.Offset, len(want)):]
+			if filter.Limit > 0 {
+				want = want[:min(filter.Limit, len(want))]
+			}
+		}
+		if len(got) != len(want) {
+			t.Fatalf("filter %+v: want %d tasks, got %d", filter, len(want), len(got))
+		}
+		for i := range want {
+			if got[i].ID != want[i].id {
+				t.Fatalf("filter %+v: task %d: want id %d, got %d", filter, i, want[i].id, got[i].ID)
+			}
+			if (len(filter.Fields) == 0 || mask&1 != 0 || filter.OrderBy == OrderByTitle) && got[i].Title != want[i].title {
+				t.Errorf("filter %+v: task %d: want title %q, got %q", filter, want[i].id, want[i].title, got[i].Title)
+			}
+			if len(filter.Fields) > 0 && mask&(1<<1) == 0 && got[i].Content != "" {
+				t.Errorf("filter %+v: task %d: want no content, got %q", filter, want[i].id, got[i].Content)
+			}
+		}
+	})
+}
+
+// filterFuzzTasks - эталонная выборка задач по фильтру f без учёта страниц.
+func filterFuzzTasks(tasks []fuzzTask, f TasksFilter) []fuzzTask {
+	// метки с дочерними метками набора данных FuzzTasksFiltered
+	subtree := map[string][]string{"Area": {"Area", "UI"}, "UI": {"UI"}, "Docs": {"Docs"}}
+
+	var matched []fuzzTask
+	for _, task := range tasks {
+		if f.Label != "" && !hasAnyLabel(task.labels, subtree[f.Label]) {
+			continue
+		}
+		if f.AuthorID != 0 && task.author != f.AuthorID {
+			continue
+		}
+		if f.AssignedID != 0 && task.assigned != f.AssignedID {
+			continue
+		}
+		if f.State != "" && (f.State == TaskStateOpen) != (task.closed == 0) {
+			continue
+		}
+		matched = append(matched, task)
+	}
+
+	less := func(a, b fuzzTask) bool {
+		switch {
+		case f.OrderBy == OrderByOpened && a.opened != b.opened:
+			return a.opened < b.opened
+		case f.OrderBy == OrderByClosed && a.closed != b.closed:
+			return a.closed < b.closed
+		case f.OrderBy == OrderByTitle && a.title != b.title:
+			return a.title < b.title
+		}
+		return a.id < b.id
+	}
+	sort.Slice(matched, func(i, j int) bool {
+		if f.Desc {
+			return less(matched[j], matched[i])
+		}
+		return less(matched[i], matched[j])
+	})
+
+	return matched
+}
+
+// hasAnyLabel сообщает, есть ли среди меток labels хотя бы одна из want.
+func hasAnyLabel(labels, want []string) bool {
+	for _, label := range labels {
+		for _, w := range want {
+			if label == w {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func TestStorage_SampleTasks(t *testing.T) {
+	db, err := storageConnect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close(context.Background()) })
+
+	tenant := db.ForTenant(1216)
+	closed := make(map[int]bool)
+	for i := 0; i < 6; i++ {
+		id := newTestTask(t, tenant, "Support request")
+		if i%2 == 0 {
+			err = tenant.UpdateTask(id, 0, time.Now().Unix(), "", "")
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			closed[id] = true
+		}
+	}
+
+	tasks, err := tenant.SampleTasks(TasksFilter{State: TaskStateClosed}, 2)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(tasks) != 2 || tasks[0].ID == tasks[1].ID {
+		t.Fatalf("sample: want 2 distinct tasks, got %+v", tasks)
+	}
+	for _, task := range tasks {
+		if !closed[task.ID] {
+			t.Errorf("sample: want closed tasks, got %+v", task)
+		}
+	}
+
+	tasks, err = tenant.SampleTasks(TasksFilter{State: TaskStateClosed}, 10)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(tasks) != len(closed) {
+		t.Errorf("sample: want %d tasks, got %d", len(closed), len(tasks))
+	}
+}
+
+func BenchmarkStorage_TasksFiltered(b *testing.B) {
+	db, err := storageConnect()
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() { db.Close(context.Background()) })
+
+	tenant := db.ForTenant(1237)
+	newBenchTasks(b, tenant, benchTasks)
+
+	filters := map[string]TasksFilter{
+		"first page":  {Limit: 50},
+		"by title":    {OrderBy: OrderByTitle, Desc: true, Limit: 50},
+		"deep offset": {Limit: 50, Offset: benchTasks - 100},
+		"fields":      {Fields: []string{FieldTitle}, Limit: 50},
+	}
+	for name, f := range filters {
+		b.Run(name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				_, err := tenant.TasksFiltered(f)
+				if err != nil {
+					b.Fatalf("Unexpected error: %v", err)
+				}
+			}
+		})
+	}
+}
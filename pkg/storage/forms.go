@@ -0,0 +1,321 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+	"unicode/utf8"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// Типы полей формы приёма задач.
+const (
+	FormFieldText   = "text"
+	FormFieldNumber = "number"
+	FormFieldBool   = "bool"
+	FormFieldChoice = "choice"
+)
+
+var (
+	ErrFormNotFound     = fmt.Errorf("form not found")
+	ErrInvalidForm      = fmt.Errorf("invalid form definition")
+	ErrInvalidFormValue = fmt.Errorf("invalid form value")
+)
+
+// Поле формы приёма задач.
+type FormField struct {
+	Name      string   `json:"name"`
+	Type      string   `json:"type"`
+	Required  bool     `json:"required,omitempty"`
+	MaxLength int      `json:"max_length,omitempty"` // максимальная длина текста в символах, 0 - без ограничения
+	Pattern   string   `json:"pattern,omitempty"`    // регулярное выражение для текста, пустое - любой текст
+	Choices   []string `json:"choices,omitempty"`    // допустимые значения поля FormFieldChoice
+}
+
+// Форма приёма задач. Название и содержимое задачи получаются из шаблонов
+// text/template, в которых значения полей доступны по имени, например {{.version}}.
+type TaskForm struct {
+	ID              int
+	Name            string
+	Fields          []FormField
+	TitleTemplate   string
+	ContentTemplate string
+}
+
+// validate проверяет описание полей и шаблоны формы.
+func (f TaskForm) validate() error {
+	names := make(map[string]bool)
+	for _, field := range f.Fields {
+		if field.Name == "" || names[field.Name] {
+			return fmt.Errorf("%w: field name %q is empty or repeated", ErrInvalidForm, field.Name)
+		}
+		names[field.Name] = true
+
+		switch field.Type {
+		case FormFieldText:
+			if _, err := regexp.Compile(field.Pattern); err != nil {
+				return fmt.Errorf("%w: field %s: %v", ErrInvalidForm, field.Name, err)
+			}
+		case FormFieldNumber, FormFieldBool:
+		case FormFieldChoice:
+			if len(field.Choices) == 0 {
+				return fmt.Errorf("%w: field %s has no choices", ErrInvalidForm, field.Name)
+			}
+		default:
+			return fmt.Errorf("%w: field %s has unknown type %q", ErrInvalidForm, field.Name, field.Type)
+		}
+	}
+	if strings.TrimSpace(f.TitleTemplate) == "" {
+		return fmt.Errorf("%w: title template is empty", ErrInvalidForm)
+	}
+	_, _, err := f.templates()
+	return err
+}
+
+// templates разбирает шаблоны названия и содержимого.
+func (f TaskForm) templates() (*template.Template, *template.Template, error) {
+	title, err := template.New("title").Option("missingkey=zero").Parse(f.TitleTemplate)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrInvalidForm, err)
+	}
+	content, err := template.New("content").Option("missingkey=zero").Parse(f.ContentTemplate)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrInvalidForm, err)
+	}
+
+	return title, content, nil
+}
+
+// parseValues проверяет значения полей формы и приводит их к типам полей.
+// Значения незаполненных необязательных полей не сохраняются.
+func (f TaskForm) parseValues(values map[string]string) (map[string]interface{}, error) {
+	fields := make(map[string]FormField, len(f.Fields))
+	for _, field := range f.Fields {
+		fields[field.Name] = field
+	}
+	for name := range values {
+		if _, ok := fields[name]; !ok {
+			return nil, fmt.Errorf("%w: unknown field %s", ErrInvalidFormValue, name)
+		}
+	}
+
+	parsed := make(map[string]interface{}, len(values))
+	for _, field := range f.Fields {
+		raw := strings.TrimSpace(values[field.Name])
+		if raw == "" {
+			if field.Required {
+				return nil, fmt.Errorf("%w: %s is required", ErrInvalidFormValue, field.Name)
+			}
+			continue
+		}
+
+		var value interface{}
+		var err error
+		switch field.Type {
+		case FormFieldText:
+			if field.MaxLength > 0 && utf8.RuneCountInString(raw) > field.MaxLength {
+				err = fmt.Errorf("longer than %d characters", field.MaxLength)
+			} else if field.Pattern != "" && !regexp.MustCompile(field.Pattern).MatchString(raw) {
+				err = fmt.Errorf("does not match %s", field.Pattern)
+			}
+			value = raw
+		case FormFieldNumber:
+			value, err = strconv.ParseFloat(raw, 64)
+		case FormFieldBool:
+			value, err = strconv.ParseBool(raw)
+		case FormFieldChoice:
+			err = fmt.Errorf("is not one of %s", strings.Join(field.Choices, ", "))
+			for _, c := range field.Choices {
+				if raw == c {
+					err = nil
+				}
+			}
+			value = raw
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", ErrInvalidFormValue, field.Name, err)
+		}
+		parsed[field.Name] = value
+	}
+
+	return parsed, nil
+}
+
+// CreateTaskForm создаёт форму приёма задач и возвращает её id.
+func (s *Storage) CreateTaskForm(f TaskForm) (int, error) {
+	err := s.authorizeWrite(RoleMaintainer)
+	if err != nil {
+		return 0, err
+	}
+	err = f.validate()
+	if err != nil {
+		return 0, err
+	}
+	fields, err := json.Marshal(f.Fields)
+	if err != nil {
+		return 0, err
+	}
+
+	ctx := context.Background()
+	var id int
+	err = s.db.QueryRow(ctx, `
+		INSERT INTO task_forms (tenant_id, name, fields, title_template, content_template)
+		VALUES ($1, $2, $3, $4, $5) RETURNING id
+	`,
+		s.tenantID,
+		f.Name,
+		fields,
+		f.TitleTemplate,
+		f.ContentTemplate,
+	).Scan(&id)
+
+	return id, err
+}
+
+// DeleteTaskForm удаляет форму приёма задач, созданные по ней задачи не меняются.
+func (s *Storage) DeleteTaskForm(formID int) error {
+	err := s.authorizeWrite(RoleMaintainer)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	tag, err := s.db.Exec(ctx, `
+		DELETE FROM task_forms
+		WHERE id = $1 AND tenant_id = $2
+	`,
+		formID,
+		s.tenantID,
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrFormNotFound
+	}
+
+	return nil
+}
+
+// TaskForms возвращает формы приёма задач рабочего пространства.
+func (s *Storage) TaskForms() ([]TaskForm, error) {
+	ctx := context.Background()
+	rows, err := s.db.Query(ctx, `
+		SELECT id, name, fields, title_template, content_template
+		FROM task_forms
+		WHERE tenant_id = $1
+		ORDER BY name, id
+	`,
+		s.tenantID,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return collectRows(rows, scanTaskForm)
+}
+
+// taskForm возвращает форму приёма задач по ID.
+func (s *Storage) taskForm(ctx context.Context, formID int) (TaskForm, error) {
+	f, err := scanTaskForm(s.db.QueryRow(ctx, `
+		SELECT id, name, fields, title_template, content_template
+		FROM task_forms
+		WHERE id = $1 AND tenant_id = $2
+	`,
+		formID,
+		s.tenantID,
+	))
+	if err == pgx.ErrNoRows {
+		return TaskForm{}, ErrFormNotFound
+	}
+
+	return f, err
+}
+
+// scanTaskForm сканирует форму приёма задач.
+func scanTaskForm(row pgx.Row) (TaskForm, error) {
+	var f TaskForm
+	var fields []byte
+	err := row.Scan(&f.ID, &f.Name, &fields, &f.TitleTemplate, &f.ContentTemplate)
+	if err != nil {
+		return TaskForm{}, err
+	}
+	err = json.Unmarshal(fields, &f.Fields)
+
+	return f, err
+}
+
+// CreateTaskFromForm проверяет значения полей формы, создаёт задачу с названием
+// и содержимым по шаблонам формы и возвращает её id.
+// Значения полей сохраняются в пользовательских полях задачи без шифрования.
+func (s *Storage) CreateTaskFromForm(formID int, values map[string]string) (int, error) {
+	err := s.authorizeWrite(RoleReporter)
+	if err != nil {
+		return 0, err
+	}
+
+	ctx := context.Background()
+	f, err := s.taskForm(ctx, formID)
+	if err != nil {
+		return 0, err
+	}
+	parsed, err := f.parseValues(values)
+	if err != nil {
+		return 0, err
+	}
+
+	titleTmpl, contentTmpl, err := f.templates()
+	if err != nil {
+		return 0, err
+	}
+	var title, content strings.Builder
+	err = titleTmpl.Execute(&title, parsed)
+	if err != nil {
+		return 0, err
+	}
+	err = contentTmpl.Execute(&content, parsed)
+	if err != nil {
+		return 0, err
+	}
+
+	fields, err := json.Marshal(parsed)
+	if err != nil {
+		return 0, err
+	}
+
+	return s.insertTask(ctx, s.db, Task{
+		Title:   strings.TrimSpace(title.String()),
+		Content: content.String(),
+	}, 0, fields)
+}
+
+// TaskFields возвращает значения пользовательских полей задачи.
+func (s *Storage) TaskFields(taskID int) (map[string]interface{}, error) {
+	ctx := context.Background()
+	var data []byte
+	err := s.db.QueryRow(ctx, `
+		SELECT fields
+		FROM tasks
+		WHERE id = $1 AND tenant_id = $2 AND can_access($3, tasks)
+	`,
+		taskID,
+		s.tenantID,
+		s.userID,
+	).Scan(&data)
+	if err == pgx.ErrNoRows {
+		return nil, ErrTaskNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var fields map[string]interface{}
+	err = json.Unmarshal(data, &fields)
+
+	return fields, err
+}
@@ -0,0 +1,113 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// Форма сообщения об ошибке для тестов.
+var bugForm = TaskForm{
+	Name: "Bug report",
+	Fields: []FormField{
+		{Name: "component", Type: FormFieldChoice, Required: true, Choices: []string{"api", "web"}},
+		{Name: "version", Type: FormFieldText, Required: true, Pattern: `^\d+\.\d+$`},
+		{Name: "steps", Type: FormFieldText, MaxLength: 20},
+		{Name: "users", Type: FormFieldNumber},
+		{Name: "blocker", Type: FormFieldBool},
+	},
+	TitleTemplate:   "[{{.component}}] crash in {{.version}}",
+	ContentTemplate: "Steps: {{.steps}}{{if .blocker}}\nBlocker{{end}}",
+}
+
+func TestTaskForm_parseValues(t *testing.T) {
+	tests := []struct {
+		name   string
+		values map[string]string
+		err    error
+	}{
+		{"valid", map[string]string{"component": "api", "version": "1.2", "users": "10", "blocker": "true"}, nil},
+		{"missing required", map[string]string{"component": "api"}, ErrInvalidFormValue},
+		{"unknown choice", map[string]string{"component": "db", "version": "1.2"}, ErrInvalidFormValue},
+		{"pattern mismatch", map[string]string{"component": "api", "version": "latest"}, ErrInvalidFormValue},
+		{"too long", map[string]string{"component": "api", "version": "1.2", "steps": "open the app and wait a minute"}, ErrInvalidFormValue},
+		{"not a number", map[string]string{"component": "api", "version": "1.2", "users": "many"}, ErrInvalidFormValue},
+		{"unknown field", map[string]string{"component": "api", "version": "1.2", "priority": "high"}, ErrInvalidFormValue},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := bugForm.parseValues(tt.values)
+			if !errors.Is(err, tt.err) {
+				t.Errorf("error: want %v, got %v", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestStorage_CreateTaskFromForm(t *testing.T) {
+	db, err := storageConnect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close(context.Background()) })
+
+	tenant := db.ForTenant(1212)
+	_, err = tenant.CreateTaskForm(TaskForm{Name: "Broken", TitleTemplate: "{{.x"})
+	if !errors.Is(err, ErrInvalidForm) {
+		t.Errorf("error: want %v, got %v", ErrInvalidForm, err)
+	}
+	formID, err := tenant.CreateTaskForm(bugForm)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	t.Cleanup(func() { tenant.DeleteTaskForm(formID) })
+
+	forms, err := tenant.TaskForms()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(forms) != 1 || len(forms[0].Fields) != len(bugForm.Fields) {
+		t.Errorf("forms: want %+v, got %+v", bugForm, forms)
+	}
+
+	_, err = tenant.CreateTaskFromForm(formID, map[string]string{
+		"component": "web",
+		"version":   "2.0",
+		"blocker":   "yes",
+	})
+	if !errors.Is(err, ErrInvalidFormValue) {
+		t.Errorf("error: want %v, got %v", ErrInvalidFormValue, err)
+	}
+	taskID, err := tenant.CreateTaskFromForm(formID, map[string]string{
+		"component": "web",
+		"version":   "2.0",
+		"steps":     "click save",
+		"users":     "3",
+		"blocker":   "true",
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	t.Cleanup(func() { tenant.DeleteTask(taskID) })
+
+	task, err := tenant.TaskByID(taskID)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if task.Title != "[web] crash in 2.0" || task.Content != "Steps: click save\nBlocker" {
+		t.Errorf("task: want rendered title and content, got %q, %q", task.Title, task.Content)
+	}
+	fields, err := tenant.TaskFields(taskID)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if fields["component"] != "web" || fields["users"] != 3.0 || fields["blocker"] != true {
+		t.Errorf("fields: want typed form values, got %v", fields)
+	}
+
+	_, err = tenant.CreateTaskFromForm(99999999, nil)
+	if !errors.Is(err, ErrFormNotFound) {
+		t.Errorf("error: want %v, got %v", ErrFormNotFound, err)
+	}
+}
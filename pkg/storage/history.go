@@ -0,0 +1,60 @@
+package storage
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// Запись истории изменений задачи.
+type HistoryEntry struct {
+	ID       int
+	TaskID   int
+	Changed  int64
+	Field    string
+	OldValue string
+	NewValue string
+}
+
+// TaskHistory возвращает историю изменений задачи в хронологическом порядке.
+func (s *Storage) TaskHistory(taskID int) ([]HistoryEntry, error) {
+	ctx := context.Background()
+	rows, err := s.db.Query(ctx, `
+		SELECT
+			h.id,
+			h.task_id,
+			h.changed,
+			h.field,
+			COALESCE(h.old_value, ''),
+			COALESCE(h.new_value, '')
+		FROM task_history AS h
+		JOIN tasks AS t
+		ON t.id = h.task_id
+		WHERE h.task_id = $1 AND t.tenant_id = $2 AND can_access($3, t)
+		ORDER BY h.id
+	`,
+		taskID,
+		s.tenantID,
+		s.userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return collectRows(rows, scanHistoryEntry)
+}
+
+// scanHistoryEntry сканирует запись истории изменений.
+func scanHistoryEntry(row pgx.Row) (HistoryEntry, error) {
+	var e HistoryEntry
+	err := row.Scan(
+		&e.ID,
+		&e.TaskID,
+		&e.Changed,
+		&e.Field,
+		&e.OldValue,
+		&e.NewValue,
+	)
+
+	return e, err
+}
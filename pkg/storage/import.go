@@ -0,0 +1,410 @@
+package storage
+
+import (
+	"context"
+	"sync"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// ImportTasks создаёт задачи tasks, фиксируя каждый пакет из 500 задач в отдельной
+// транзакции вместе с количеством созданных задач в задании WithJob, без которого
+// возвращается ErrNoJob. Если импорт прерывается ошибкой, задачи уже зафиксированных
+// пакетов остаются, а повторный вызов с тем же заданием и теми же задачами в том же
+// порядке продолжает импорт с первого незафиксированного пакета.
+// В отличие от NewTasks, подходит для импорта сотен тысяч задач.
+func (s *Storage) ImportTasks(tasks []Task) error {
+	err := s.authorizeWrite(RoleReporter)
+	if err != nil {
+		return err
+	}
+	if s.jobID == 0 {
+		return ErrNoJob
+	}
+	if len(tasks) == 0 {
+		return ErrNoTasksToAdd
+	}
+
+	ctx := context.Background()
+	done, err := s.resumeJob(ctx, JobImport, len(tasks))
+	if err != nil {
+		return err
+	}
+
+	return s.finishJob(ctx, s.importTasks(ctx, tasks, done))
+}
+
+// importTasks создаёт задачи tasks, начиная с задачи done, для ImportTasks.
+func (s *Storage) importTasks(ctx context.Context, tasks []Task, done int) error {
+	intake, err := s.intakeSettings(ctx)
+	if err != nil {
+		return err
+	}
+	for _, t := range tasks[done:] {
+		err = intake.checkRequired(t)
+		if err != nil {
+			return err
+		}
+	}
+
+	for start := done; start < len(tasks); start += importChunkSize {
+		end := min(start+importChunkSize, len(tasks))
+		err = s.importChunk(ctx, tasks[start:end], end)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// importChunk создаёт задачи chunk и отмечает в задании хранилища, что создано processed задач.
+func (s *Storage) importChunk(ctx context.Context, chunk []Task, processed int) error {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	err = s.insertTasks(ctx, tx, chunk)
+	if err != nil {
+		return err
+	}
+	err = s.jobCheckpoint(ctx, tx, processed)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// Наибольшее количество попыток создать пакет задач при параллельном импорте.
+const importAttempts = 3
+
+// Задача для ImportTasksParallel с пользователями и метками исходной системы.
+type ImportTask struct {
+	Task
+	Author   string   // имя автора, пустое - без автора
+	Assignee string   // имя ответственного, пустое - по настройкам приёма
+	Labels   []string // названия меток
+}
+
+// Id меток и пользователей импорта по названиям и именам.
+type importRefs struct {
+	labels map[string]int
+	users  map[string]int
+}
+
+// Метка или пользователь импорта.
+type importName struct {
+	name string
+	id   int
+}
+
+// ImportTasksParallel, как ImportTasks, создаёт задачи tasks пакетами по 500 в отдельных
+// транзакциях, но пакеты создаются параллельно в workers соединениях: каждое загружает
+// пакет во временную таблицу командой COPY и создаёт задачи одним запросом.
+// Задачи получают id в порядке следования в пакете, но пакеты создаются в произвольном
+// порядке. При первой ошибке импорт останавливается; повторный вызов с тем же заданием
+// и теми же задачами создаёт только пакеты, не созданные раньше.
+// Метки и пользователи задач, отсутствующие в рабочем пространстве, создаются до загрузки
+// пакетов одной транзакцией, поэтому соединения не создают одни и те же строки; создание
+// пользователей требует роли администратора. Метки по настройкам приёма и правилам
+// назначаются, как в NewTasks.
+func (s *Storage) ImportTasksParallel(tasks []ImportTask, workers int) error {
+	err := s.authorizeWrite(RoleReporter)
+	if err != nil {
+		return err
+	}
+	for _, t := range tasks {
+		if t.Author != "" || t.Assignee != "" {
+			err = s.authorizeWrite(RoleAdmin)
+			if err != nil {
+				return err
+			}
+			break
+		}
+	}
+	if s.jobID == 0 {
+		return ErrNoJob
+	}
+	if len(tasks) == 0 {
+		return ErrNoTasksToAdd
+	}
+	if workers < 1 {
+		workers = 1
+	}
+
+	ctx := context.Background()
+	_, err = s.resumeJob(ctx, JobParallelImport, len(tasks))
+	if err != nil {
+		return err
+	}
+
+	return s.finishJob(ctx, s.importParallel(ctx, tasks, workers))
+}
+
+// importParallel создаёт пакеты задач tasks, не отмеченные в задании, в workers
+// горутинах для ImportTasksParallel и возвращает первую ошибку.
+func (s *Storage) importParallel(ctx context.Context, tasks []ImportTask, workers int) error {
+	intake, err := s.intakeSettings(ctx)
+	if err != nil {
+		return err
+	}
+	for _, t := range tasks {
+		err = intake.checkRequired(t.Task)
+		if err != nil {
+			return err
+		}
+	}
+	done, err := s.jobChunks(ctx)
+	if err != nil {
+		return err
+	}
+	refs, err := s.upsertImportRefs(ctx, tasks)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	chunks := make(chan int)
+	// первая ошибка отменяет ctx, поэтому остальные горутины возвращают ошибку отмены после неё
+	errs := make(chan error, workers)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := range chunks {
+				err := s.copyChunk(ctx, tasks, refs, n)
+				if err != nil {
+					errs <- err
+					cancel()
+					return
+				}
+			}
+		}()
+	}
+
+feed:
+	for n := 0; n*importChunkSize < len(tasks); n++ {
+		if done[n] {
+			continue
+		}
+		select {
+		case chunks <- n:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(chunks)
+	wg.Wait()
+	close(errs)
+
+	return <-errs
+}
+
+// copyChunk создаёт пакет задач с номером n. Адреса задач назначаются по уже
+// созданным задачам, поэтому при совпадении адресов с задачами параллельного
+// пакета создание повторяется.
+func (s *Storage) copyChunk(ctx context.Context, tasks []ImportTask, refs importRefs, n int) error {
+	start := n * importChunkSize
+	chunk := tasks[start:min(start+importChunkSize, len(tasks))]
+
+	var err error
+	for attempt := 0; attempt < importAttempts; attempt++ {
+		err = s.copyChunkOnce(ctx, chunk, refs, n)
+		if !slugConflict(err) {
+			return err
+		}
+	}
+
+	return err
+}
+
+// copyChunkOnce создаёт пакет задач chunk с номером n в одной транзакции.
+func (s *Storage) copyChunkOnce(ctx context.Context, chunk []ImportTask, refs importRefs, n int) error {
+	rows := make([][]interface{}, len(chunk))
+	for i, t := range chunk {
+		content, err := s.encrypt(t.Content)
+		if err != nil {
+			return err
+		}
+		labelIDs := make([]int, 0, len(t.Labels))
+		for _, name := range t.Labels {
+			labelIDs = append(labelIDs, refs.labels[name])
+		}
+		rows[i] = []interface{}{i, t.Title, content, t.Content, refs.users[t.Author], refs.users[t.Assignee], labelIDs}
+	}
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, `
+		CREATE TEMP TABLE import_tasks (
+			n INTEGER NOT NULL,
+			title TEXT NOT NULL,
+			content TEXT NOT NULL,
+			plain TEXT NOT NULL,
+			author_id INTEGER NOT NULL,
+			assigned_id INTEGER NOT NULL,
+			label_ids INTEGER[] NOT NULL
+		) ON COMMIT DROP
+	`)
+	if err != nil {
+		return err
+	}
+	_, err = tx.CopyFrom(ctx,
+		pgx.Identifier{"import_tasks"},
+		[]string{"n", "title", "content", "plain", "author_id", "assigned_id", "label_ids"},
+		pgx.CopyFromRows(rows),
+	)
+	if err != nil {
+		return err
+	}
+
+	// id выделяются заранее, чтобы назначить метки по исходному содержимому
+	_, err = tx.Exec(ctx, `
+		WITH intake AS (
+			SELECT default_assignee, label_ids
+			FROM intake_settings
+			WHERE tenant_id = $1
+		), source AS (
+			SELECT nextval(pg_get_serial_sequence('tasks', 'id'))::integer AS id, i.*
+			FROM (SELECT * FROM import_tasks ORDER BY n) AS i
+		), task AS (
+			INSERT INTO tasks (id, tenant_id, title, content, author_id, assigned_id)
+			SELECT
+				id, $1, title, content, author_id,
+				CASE WHEN assigned_id > 0 THEN assigned_id ELSE COALESCE((SELECT default_assignee FROM intake), 0) END
+			FROM source
+			RETURNING id, author_id
+		)
+		INSERT INTO tasks_labels (task_id, label_id)
+		SELECT task.id, l.id
+		FROM task
+		JOIN source ON source.id = task.id
+		JOIN labels AS l ON l.tenant_id = $1
+		WHERE
+			l.id = ANY(source.label_ids) OR
+			l.id IN (SELECT unnest(label_ids) FROM intake) OR
+			EXISTS (
+				SELECT 1
+				FROM label_rules AS r
+				WHERE
+					r.label_id = l.id AND r.enabled AND
+					label_rule_matches(r.title_pattern, r.content_pattern, r.author_id, source.title, source.plain, task.author_id)
+			)
+	`,
+		s.tenantID,
+	)
+	if err != nil {
+		return err
+	}
+
+	err = s.jobChunkDone(ctx, tx, n, len(chunk))
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// upsertImportRefs создаёт метки и пользователей задач tasks, отсутствующие в рабочем
+// пространстве, и возвращает их id. Названия меток и имена пользователей не уникальны,
+// поэтому импорты рабочего пространства создают их по очереди под рекомендательной
+// блокировкой, а из одноимённых выбирается созданная раньше.
+func (s *Storage) upsertImportRefs(ctx context.Context, tasks []ImportTask) (importRefs, error) {
+	var labels, users []string
+	seenLabels, seenUsers := make(map[string]bool), make(map[string]bool)
+	for _, t := range tasks {
+		for _, name := range t.Labels {
+			if !seenLabels[name] {
+				seenLabels[name] = true
+				labels = append(labels, name)
+			}
+		}
+		for _, name := range []string{t.Author, t.Assignee} {
+			if name != "" && !seenUsers[name] {
+				seenUsers[name] = true
+				users = append(users, name)
+			}
+		}
+	}
+	if len(labels) == 0 && len(users) == 0 {
+		return importRefs{}, nil
+	}
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return importRefs{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtext('import_refs'), $1)`, s.tenantID)
+	if err != nil {
+		return importRefs{}, err
+	}
+	var refs importRefs
+	refs.labels, err = s.upsertNames(ctx, tx, "labels", labels)
+	if err != nil {
+		return importRefs{}, err
+	}
+	refs.users, err = s.upsertNames(ctx, tx, "users", users)
+	if err != nil {
+		return importRefs{}, err
+	}
+
+	return refs, tx.Commit(ctx)
+}
+
+// upsertNames создаёт в таблице table (labels или users) строки рабочего пространства
+// с названиями names, которых ещё нет, и возвращает id строк по названиям.
+func (s *Storage) upsertNames(ctx context.Context, tx pgx.Tx, table string, names []string) (map[string]int, error) {
+	ids := make(map[string]int, len(names))
+	if len(names) == 0 {
+		return ids, nil
+	}
+
+	// строки, вставленные в запросе, не видны его SELECT из таблицы
+	rows, err := tx.Query(ctx, `
+		WITH created AS (
+			INSERT INTO `+table+` (tenant_id, name)
+			SELECT $1, n.name
+			FROM unnest($2::text[]) AS n(name)
+			WHERE NOT EXISTS (SELECT 1 FROM `+table+` AS e WHERE e.tenant_id = $1 AND e.name = n.name)
+			RETURNING id, name
+		)
+		SELECT name, min(id)
+		FROM (
+			SELECT id, name FROM `+table+` WHERE tenant_id = $1 AND name = ANY($2)
+			UNION ALL
+			SELECT id, name FROM created
+		) AS r
+		GROUP BY name
+	`,
+		s.tenantID,
+		names,
+	)
+	if err != nil {
+		return nil, err
+	}
+	found, err := collectRows(rows, func(row pgx.Row) (importName, error) {
+		var n importName
+		err := row.Scan(&n.name, &n.id)
+		return n, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, n := range found {
+		ids[n.name] = n.id
+	}
+
+	return ids, nil
+}
@@ -0,0 +1,197 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestStorage_ImportTasks(t *testing.T) {
+	db, err := storageConnect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close(context.Background()) })
+
+	tenant := db.ForTenant(1231)
+	ctx := context.Background()
+	t.Cleanup(func() {
+		db.db.Exec(ctx, `DELETE FROM tasks WHERE tenant_id = 1231`)
+		db.db.Exec(ctx, `DELETE FROM jobs WHERE tenant_id = 1231`)
+		db.db.Exec(ctx, `DELETE FROM task_title_keys WHERE tenant_id = 1231`)
+		db.db.Exec(ctx, `DELETE FROM intake_settings WHERE tenant_id = 1231`)
+	})
+	err = tenant.SetIntakeSettings(IntakeSettings{UniqueTitles: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	tasks := make([]Task, 2*importChunkSize+1)
+	for i := range tasks {
+		tasks[i] = Task{Title: fmt.Sprintf("Imported %d", i), Content: "Test content"}
+	}
+	// второй пакет не создаётся из-за повторяющегося названия
+	tasks[importChunkSize+1].Title = tasks[0].Title
+
+	err = tenant.ImportTasks(tasks)
+	if !errors.Is(err, ErrNoJob) {
+		t.Errorf("error: want %v, got %v", ErrNoJob, err)
+	}
+
+	jobID, err := tenant.NewJob()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	err = tenant.WithJob(jobID).ImportTasks(tasks)
+	if !errors.Is(err, ErrDuplicateTitle) {
+		t.Errorf("error: want %v, got %v", ErrDuplicateTitle, err)
+	}
+	job, err := tenant.JobStatus(jobID)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if job.State != JobFailed || job.Processed != importChunkSize {
+		t.Errorf("failed import: want failed at %d, got %+v", importChunkSize, job)
+	}
+
+	// задачи другого импорта не продолжают задание
+	err = tenant.WithJob(jobID).ImportTasks(tasks[:1])
+	if !errors.Is(err, ErrJobStarted) {
+		t.Errorf("error: want %v, got %v", ErrJobStarted, err)
+	}
+
+	tasks[importChunkSize+1].Title = "Fixed"
+	err = tenant.WithJob(jobID).ImportTasks(tasks)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	job, err = tenant.JobStatus(jobID)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if job.State != JobDone || job.Processed != len(tasks) || job.Errors != 1 {
+		t.Errorf("resumed import: want done %d with 1 error, got %+v", len(tasks), job)
+	}
+	all, err := tenant.TasksAll()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(all) != len(tasks) {
+		t.Errorf("imported tasks: want %d, got %d", len(tasks), len(all))
+	}
+}
+
+func TestStorage_ImportTasksParallel(t *testing.T) {
+	db, err := storageConnect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close(context.Background()) })
+
+	tenant := db.ForTenant(1232)
+	ctx := context.Background()
+	t.Cleanup(func() {
+		db.db.Exec(ctx, `DELETE FROM tasks WHERE tenant_id = 1232`)
+		db.db.Exec(ctx, `DELETE FROM jobs WHERE tenant_id = 1232`)
+		db.db.Exec(ctx, `DELETE FROM task_title_keys WHERE tenant_id = 1232`)
+		db.db.Exec(ctx, `DELETE FROM intake_settings WHERE tenant_id = 1232`)
+		db.db.Exec(ctx, `DELETE FROM labels WHERE tenant_id = 1232`)
+		db.db.Exec(ctx, `DELETE FROM users WHERE tenant_id = 1232`)
+	})
+	_, err = db.db.Exec(ctx, `INSERT INTO labels (tenant_id, name) VALUES (1232, 'Migrated')`)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	err = tenant.SetIntakeSettings(IntakeSettings{DefaultLabels: []string{"Migrated"}, UniqueTitles: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	tasks := make([]ImportTask, 2*importChunkSize+1)
+	for i := range tasks {
+		tasks[i] = ImportTask{
+			Task:     Task{Title: fmt.Sprintf("Migrated %d", i), Content: "Test content"},
+			Author:   fmt.Sprintf("Legacy author %d", i%3),
+			Assignee: "Legacy assignee",
+			Labels:   []string{"Legacy", "Migrated"},
+		}
+	}
+	// второй пакет не создаётся из-за повторяющегося названия
+	tasks[importChunkSize+1].Title = tasks[importChunkSize].Title
+
+	jobID, err := tenant.NewJob()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var reporterID int
+	err = db.db.QueryRow(ctx, `INSERT INTO users (tenant_id, name) VALUES (1232, 'Import reporter') RETURNING id`).Scan(&reporterID)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	err = tenant.AsUser(reporterID).WithJob(jobID).ImportTasksParallel(tasks, 3)
+	if !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("reporter error: want %v, got %v", ErrPermissionDenied, err)
+	}
+
+	err = tenant.WithJob(jobID).ImportTasksParallel(tasks, 3)
+	if !errors.Is(err, ErrDuplicateTitle) {
+		t.Errorf("error: want %v, got %v", ErrDuplicateTitle, err)
+	}
+
+	tasks[importChunkSize+1].Title = "Fixed"
+	err = tenant.WithJob(jobID).ImportTasksParallel(tasks, 3)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	job, err := tenant.JobStatus(jobID)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if job.Kind != JobParallelImport || job.State != JobDone || job.Processed != len(tasks) {
+		t.Errorf("parallel import: want done %d, got %+v", len(tasks), job)
+	}
+	imported, err := tenant.TasksByLabel("Migrated")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(imported) != len(tasks) {
+		t.Errorf("imported tasks: want %d, got %d", len(tasks), len(imported))
+	}
+	legacy, err := tenant.TasksByLabel("Legacy")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(legacy) != len(tasks) {
+		t.Errorf("tasks with created label: want %d, got %d", len(tasks), len(legacy))
+	}
+
+	// метки и пользователи создаются один раз, несмотря на повторный импорт и параллельные пакеты
+	var labels, users int
+	err = db.db.QueryRow(ctx, `
+		SELECT
+			(SELECT count(*) FROM labels WHERE tenant_id = 1232),
+			(SELECT count(*) FROM users WHERE tenant_id = 1232 AND name LIKE 'Legacy %')
+	`).Scan(&labels, &users)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if labels != 2 || users != 4 {
+		t.Errorf("created: want 2 labels and 4 users, got %d and %d", labels, users)
+	}
+
+	var authors, assignees int
+	err = db.db.QueryRow(ctx, `
+		SELECT count(DISTINCT t.author_id), count(DISTINCT t.assigned_id)
+		FROM tasks AS t
+		JOIN users AS u ON u.id = t.author_id AND u.name LIKE 'Legacy author %'
+		WHERE t.tenant_id = 1232
+	`).Scan(&authors, &assignees)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if authors != 3 || assignees != 1 {
+		t.Errorf("imported users: want 3 authors and 1 assignee, got %d and %d", authors, assignees)
+	}
+}
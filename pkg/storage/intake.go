@@ -0,0 +1,158 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// Поля задачи, которые можно сделать обязательными при создании.
+const (
+	FieldTitle   = "title"
+	FieldContent = "content"
+)
+
+var (
+	ErrInvalidField   = fmt.Errorf("invalid task field")
+	ErrRequiredField  = fmt.Errorf("required task field is empty")
+	ErrDuplicateTitle = fmt.Errorf("task with this title already exists")
+)
+
+// Настройки приёма задач рабочего пространства. Применяются при создании задач
+// методами NewTask, NewTasks, ApplyClientChanges, CloneTask и SplitTask,
+// уже созданные задачи не меняются.
+type IntakeSettings struct {
+	DefaultAssignee int      // ответственный новых задач, 0 - без ответственного
+	DefaultLabels   []string // метки новых задач
+	RequiredFields  []string // поля FieldTitle и FieldContent, которые нельзя оставить пустыми
+	// названия задач уникальны без учёта регистра: создание и переименование задачи
+	// с уже занятым названием отклоняется с ErrDuplicateTitle
+	UniqueTitles bool
+}
+
+// SetIntakeSettings заменяет настройки приёма задач рабочего пространства.
+// Если UniqueTitles включается, а в рабочем пространстве уже есть задачи
+// с одинаковыми названиями, настройки не меняются и возвращается ErrDuplicateTitle.
+func (s *Storage) SetIntakeSettings(is IntakeSettings) error {
+	err := s.authorizeWrite(RoleMaintainer)
+	if err != nil {
+		return err
+	}
+	for _, f := range is.RequiredFields {
+		if f != FieldTitle && f != FieldContent {
+			return ErrInvalidField
+		}
+	}
+
+	ctx := context.Background()
+	labelIDs := make([]int, 0, len(is.DefaultLabels))
+	for _, label := range is.DefaultLabels {
+		id, err := s.labelID(ctx, label)
+		if err != nil {
+			return err
+		}
+		if id == nil {
+			return ErrEmptyLabel
+		}
+		labelIDs = append(labelIDs, *id)
+	}
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO intake_settings (tenant_id, default_assignee, label_ids, required_fields, unique_titles)
+		VALUES ($1, NULLIF($2, 0), $3, $4, $5)
+		ON CONFLICT (tenant_id) DO UPDATE
+		SET
+			default_assignee = EXCLUDED.default_assignee,
+			label_ids = EXCLUDED.label_ids,
+			required_fields = EXCLUDED.required_fields,
+			unique_titles = EXCLUDED.unique_titles
+	`,
+		s.tenantID,
+		is.DefaultAssignee,
+		labelIDs,
+		append([]string{}, is.RequiredFields...),
+		is.UniqueTitles,
+	)
+	if err != nil {
+		return err
+	}
+
+	// при включении уникальных названий существующие задачи с одинаковыми
+	// названиями нарушают ограничение, и настройки не сохраняются
+	if is.UniqueTitles {
+		_, err = tx.Exec(ctx, `
+			INSERT INTO task_title_keys (task_id, tenant_id, title_key)
+			SELECT id, tenant_id, lower(COALESCE(title, ''))
+			FROM tasks
+			WHERE tenant_id = $1
+			ON CONFLICT (task_id) DO NOTHING
+		`,
+			s.tenantID,
+		)
+	} else {
+		_, err = tx.Exec(ctx, `
+			DELETE FROM task_title_keys
+			WHERE tenant_id = $1
+		`,
+			s.tenantID,
+		)
+	}
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// IntakeSettings возвращает настройки приёма задач рабочего пространства.
+func (s *Storage) IntakeSettings() (IntakeSettings, error) {
+	ctx := context.Background()
+	return s.intakeSettings(ctx)
+}
+
+// intakeSettings возвращает настройки приёма задач, для рабочего пространства без настроек - пустые.
+func (s *Storage) intakeSettings(ctx context.Context) (IntakeSettings, error) {
+	var is IntakeSettings
+	err := s.db.QueryRow(ctx, `
+		SELECT
+			COALESCE(i.default_assignee, 0),
+			ARRAY(SELECT l.name FROM labels AS l WHERE l.id = ANY(i.label_ids) ORDER BY l.name),
+			i.required_fields,
+			i.unique_titles
+		FROM intake_settings AS i
+		WHERE i.tenant_id = $1
+	`,
+		s.tenantID,
+	).Scan(&is.DefaultAssignee, &is.DefaultLabels, &is.RequiredFields, &is.UniqueTitles)
+	if err == pgx.ErrNoRows {
+		return IntakeSettings{}, nil
+	}
+
+	return is, err
+}
+
+// checkRequired проверяет, что обязательные поля задачи заполнены.
+func (is IntakeSettings) checkRequired(t Task) error {
+	for _, f := range is.RequiredFields {
+		var value string
+		switch f {
+		case FieldTitle:
+			value = t.Title
+		case FieldContent:
+			value = t.Content
+		}
+		if strings.TrimSpace(value) == "" {
+			return fmt.Errorf("%w: %s", ErrRequiredField, f)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,120 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestStorage_IntakeSettings(t *testing.T) {
+	db, err := storageConnect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close(context.Background()) })
+
+	tenant := db.ForTenant(1211)
+	ctx := context.Background()
+	_, err = db.db.Exec(ctx, `INSERT INTO labels (tenant_id, name) VALUES (1211, 'Triage'), (1211, 'Support')`)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	t.Cleanup(func() {
+		db.db.Exec(ctx, `DELETE FROM intake_settings WHERE tenant_id = 1211`)
+		db.db.Exec(ctx, `DELETE FROM labels WHERE tenant_id = 1211`)
+	})
+	triagerID := newTestUser(t, db, "Triager")
+
+	err = tenant.SetIntakeSettings(IntakeSettings{RequiredFields: []string{"priority"}})
+	if !errors.Is(err, ErrInvalidField) {
+		t.Errorf("error: want %v, got %v", ErrInvalidField, err)
+	}
+	want := IntakeSettings{
+		DefaultAssignee: triagerID,
+		DefaultLabels:   []string{"Support", "Triage"},
+		RequiredFields:  []string{FieldContent},
+	}
+	err = tenant.SetIntakeSettings(want)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	got, err := tenant.IntakeSettings()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("settings: want %+v, got %+v", want, got)
+	}
+
+	_, err = tenant.NewTask(Task{Title: "No details", Content: "  "})
+	if !errors.Is(err, ErrRequiredField) {
+		t.Errorf("error: want %v, got %v", ErrRequiredField, err)
+	}
+	err = tenant.NewTasks([]Task{{Title: "Fine", Content: "Details"}, {Title: "No details"}})
+	if !errors.Is(err, ErrRequiredField) {
+		t.Errorf("error: want %v, got %v", ErrRequiredField, err)
+	}
+
+	taskID := newTestTask(t, tenant, "Printer is broken")
+	task, err := tenant.TaskByID(taskID)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if task.AssignedID != triagerID {
+		t.Errorf("assigned: want %d, got %d", triagerID, task.AssignedID)
+	}
+	for _, label := range want.DefaultLabels {
+		tasks, err := tenant.TasksByLabel(label)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if len(tasks) != 1 || tasks[0].ID != taskID {
+			t.Errorf("tasks labeled %s: want [%d], got %+v", label, taskID, tasks)
+		}
+	}
+}
+
+func TestStorage_UniqueTitles(t *testing.T) {
+	db, err := storageConnect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close(context.Background()) })
+
+	tenant := db.ForTenant(1226)
+	t.Cleanup(func() { db.db.Exec(context.Background(), `DELETE FROM intake_settings WHERE tenant_id = 1226`) })
+
+	newTestTask(t, tenant, "Release 1.0")
+	duplicate := newTestTask(t, tenant, "release 1.0")
+	err = tenant.SetIntakeSettings(IntakeSettings{UniqueTitles: true})
+	if !errors.Is(err, ErrDuplicateTitle) {
+		t.Fatalf("error: want %v, got %v", ErrDuplicateTitle, err)
+	}
+
+	err = tenant.UpdateTask(duplicate, 0, 0, "Release 1.1", "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	err = tenant.SetIntakeSettings(IntakeSettings{UniqueTitles: true})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	_, err = tenant.NewTask(Task{Title: "RELEASE 1.0"})
+	if !errors.Is(err, ErrDuplicateTitle) {
+		t.Errorf("error: want %v, got %v", ErrDuplicateTitle, err)
+	}
+	err = tenant.UpdateTask(duplicate, 0, 0, "Release 1.0", "")
+	if !errors.Is(err, ErrDuplicateTitle) {
+		t.Errorf("error: want %v, got %v", ErrDuplicateTitle, err)
+	}
+	// в другом рабочем пространстве название свободно
+	newTestTask(t, db.ForTenant(1225), "Release 1.0")
+
+	err = tenant.SetIntakeSettings(IntakeSettings{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	newTestTask(t, tenant, "Release 1.0")
+}
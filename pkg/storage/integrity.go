@@ -0,0 +1,221 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// Виды нарушений целостности данных.
+const (
+	IssueOrphanLabelLink   = "orphan_label_link"    // связь с меткой без задачи или без метки
+	IssueCrossTenantLabel  = "cross_tenant_label"   // метка задачи из другого рабочего пространства
+	IssueCrossTenantLink   = "cross_tenant_link"    // родитель или оригинал задачи из другого рабочего пространства
+	IssueParentCycle       = "parent_cycle"         // задача входит в цикл родительских задач
+	IssueDuplicateCycle    = "duplicate_cycle"      // задача входит в цикл дубликатов
+	IssueNegativeTimestamp = "negative_timestamp"   // отрицательное время создания или выполнения
+	IssueClosedBeforeOpen  = "closed_before_opened" // время выполнения раньше времени создания
+)
+
+// Нарушение целостности данных.
+type IntegrityIssue struct {
+	Kind   string
+	TaskID int // 0, если нарушение не относится к существующей задаче
+	Detail string
+}
+
+// Результат проверки целостности данных.
+type IntegrityReport struct {
+	Issues   []IntegrityIssue
+	Repaired int // количество исправленных строк
+}
+
+// Проверка целостности: запрос возвращает id задачи и описание нарушения,
+// запрос repair исправляет нарушения, пустой - нарушения исправляются вручную.
+type integrityCheck struct {
+	kind   string
+	query  string
+	repair string
+}
+
+// taskCycleSQL выбирает в walk пути по ссылкам column между задачами. Путь, вернувшийся
+// к начальной задаче start, проходит по циклу и содержит в path все задачи цикла.
+func taskCycleSQL(column string) string {
+	return fmt.Sprintf(`
+		WITH RECURSIVE walk (start, id, path) AS (
+			SELECT id, %[1]s, ARRAY[id]
+			FROM tasks
+			WHERE %[1]s IS NOT NULL
+			UNION ALL
+			SELECT w.start, t.%[1]s, w.path || w.id
+			FROM walk AS w
+			JOIN tasks AS t
+			ON t.id = w.id
+			WHERE t.%[1]s IS NOT NULL AND NOT w.id = ANY(w.path)
+		)`, column)
+}
+
+// Проверки целостности в порядке выполнения.
+var integrityChecks = []integrityCheck{
+	{
+		kind: IssueOrphanLabelLink,
+		query: `
+			SELECT COALESCE(task_id, 0), format('task %s, label %s', COALESCE(task_id::text, 'none'), COALESCE(label_id::text, 'none'))
+			FROM tasks_labels
+			WHERE task_id IS NULL OR label_id IS NULL
+		`,
+		repair: `
+			DELETE FROM tasks_labels
+			WHERE task_id IS NULL OR label_id IS NULL
+		`,
+	},
+	{
+		kind: IssueCrossTenantLabel,
+		query: `
+			SELECT tl.task_id, format('label %s of tenant %s on task of tenant %s', l.id, l.tenant_id, t.tenant_id)
+			FROM tasks_labels AS tl
+			JOIN tasks AS t ON t.id = tl.task_id
+			JOIN labels AS l ON l.id = tl.label_id
+			WHERE l.tenant_id <> t.tenant_id
+		`,
+		repair: `
+			DELETE FROM tasks_labels AS tl
+			USING tasks AS t, labels AS l
+			WHERE t.id = tl.task_id AND l.id = tl.label_id AND l.tenant_id <> t.tenant_id
+		`,
+	},
+	{
+		kind: IssueCrossTenantLink,
+		query: `
+			SELECT t.id, format('parent %s, duplicate of %s', COALESCE(p.id::text, 'ok'), COALESCE(d.id::text, 'ok'))
+			FROM tasks AS t
+			LEFT JOIN tasks AS p ON p.id = t.parent_id AND p.tenant_id <> t.tenant_id
+			LEFT JOIN tasks AS d ON d.id = t.duplicate_of AND d.tenant_id <> t.tenant_id
+			WHERE p.id IS NOT NULL OR d.id IS NOT NULL
+		`,
+		repair: `
+			UPDATE tasks AS t
+			SET
+				parent_id = CASE WHEN p.tenant_id <> t.tenant_id THEN NULL ELSE t.parent_id END,
+				duplicate_of = CASE WHEN d.tenant_id <> t.tenant_id THEN NULL ELSE t.duplicate_of END
+			FROM tasks AS p, tasks AS d
+			WHERE
+				p.id = COALESCE(t.parent_id, t.id) AND d.id = COALESCE(t.duplicate_of, t.id) AND
+				(p.tenant_id <> t.tenant_id OR d.tenant_id <> t.tenant_id)
+		`,
+	},
+	{
+		kind: IssueParentCycle,
+		query: taskCycleSQL("parent_id") + `
+			SELECT start, format('cycle %s', path)
+			FROM walk
+			WHERE id = start
+		`,
+		// цикл разрывается у задачи с наименьшим id
+		repair: taskCycleSQL("parent_id") + `
+			UPDATE tasks
+			SET parent_id = NULL
+			WHERE id IN (
+				SELECT start FROM walk WHERE id = start AND start = (SELECT min(x) FROM unnest(path) AS x)
+			)
+		`,
+	},
+	{
+		kind: IssueDuplicateCycle,
+		query: taskCycleSQL("duplicate_of") + `
+			SELECT start, format('cycle %s', path)
+			FROM walk
+			WHERE id = start
+		`,
+		repair: taskCycleSQL("duplicate_of") + `
+			UPDATE tasks
+			SET duplicate_of = NULL
+			WHERE id IN (
+				SELECT start FROM walk WHERE id = start AND start = (SELECT min(x) FROM unnest(path) AS x)
+			)
+		`,
+	},
+	{
+		kind: IssueNegativeTimestamp,
+		query: `
+			SELECT id, format('opened %s, closed %s', opened, closed)
+			FROM tasks
+			WHERE opened < 0 OR closed < 0
+		`,
+	},
+	{
+		// нарушения возможны в БД, созданных до ограничения tasks_closed_after_opened;
+		// время выполнения неизвестно, поэтому задача считается выполненной при создании
+		kind: IssueClosedBeforeOpen,
+		query: `
+			SELECT id, format('opened %s, closed %s', opened, closed)
+			FROM tasks
+			WHERE closed <> 0 AND closed < opened
+		`,
+		repair: `
+			UPDATE tasks
+			SET closed = opened
+			WHERE closed <> 0 AND closed < opened
+		`,
+	},
+}
+
+// VerifyIntegrity проверяет целостность данных во всех рабочих пространствах:
+// связи задач с отсутствующими и чужими метками, ссылки на задачи других рабочих
+// пространств, циклы родительских задач и дубликатов, отрицательное время
+// и время выполнения раньше времени создания.
+// С repair нарушения, для которых есть однозначное исправление, исправляются
+// в той же транзакции: лишние связи с метками удаляются, ссылки и циклы разрываются,
+// время выполнения раньше создания заменяется временем создания.
+// Возвращаются нарушения, найденные до исправления.
+// Доступен только системному пользователю.
+func (s *Storage) VerifyIntegrity(ctx context.Context, repair bool) (IntegrityReport, error) {
+	var report IntegrityReport
+	var err error
+	if repair {
+		err = s.authorizeSystemWrite()
+	} else {
+		err = s.authorizeSystem()
+	}
+	if err != nil {
+		return report, err
+	}
+
+	opts := pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly}
+	if repair {
+		opts = pgx.TxOptions{}
+	}
+	tx, err := s.db.BeginTx(ctx, opts)
+	if err != nil {
+		return report, err
+	}
+	defer tx.Rollback(ctx)
+
+	for _, check := range integrityChecks {
+		rows, err := tx.Query(ctx, check.query)
+		if err != nil {
+			return report, err
+		}
+		issues, err := collectRows(rows, func(row pgx.Row) (IntegrityIssue, error) {
+			issue := IntegrityIssue{Kind: check.kind}
+			err := row.Scan(&issue.TaskID, &issue.Detail)
+			return issue, err
+		})
+		if err != nil {
+			return report, err
+		}
+		report.Issues = append(report.Issues, issues...)
+
+		if !repair || check.repair == "" || len(issues) == 0 {
+			continue
+		}
+		tag, err := tx.Exec(ctx, check.repair)
+		if err != nil {
+			return report, err
+		}
+		report.Repaired += int(tag.RowsAffected())
+	}
+
+	return report, tx.Commit(ctx)
+}
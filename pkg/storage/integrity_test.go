@@ -0,0 +1,90 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+func TestStorage_VerifyIntegritySystemOnly(t *testing.T) {
+	s, err := NewWithPool(&pgxpool.Pool{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	admin := s.ForTenant(1224).AsUser(1)
+
+	for _, repair := range []bool{false, true} {
+		_, err = admin.VerifyIntegrity(context.Background(), repair)
+		if !errors.Is(err, ErrPermissionDenied) {
+			t.Errorf("repair %v error: want %v, got %v", repair, ErrPermissionDenied, err)
+		}
+	}
+}
+
+func TestStorage_VerifyIntegrity(t *testing.T) {
+	db, err := storageConnect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close(context.Background()) })
+
+	ctx := context.Background()
+	first := newTestTask(t, db, "First")
+	second := newTestTask(t, db, "Second")
+	third := newTestTask(t, db, "Third")
+	_, err = db.db.Exec(ctx, `
+		UPDATE tasks SET parent_id = CASE id WHEN $1 THEN $2 WHEN $2 THEN $1 ELSE $1 END
+		WHERE id IN ($1, $2, $3)
+	`, first, second, third)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	t.Cleanup(func() {
+		db.db.Exec(ctx, `UPDATE tasks SET parent_id = NULL WHERE id IN ($1, $2, $3)`, first, second, third)
+	})
+
+	// задачи first и second входят в цикл, third ссылается на цикл, но не входит в него
+	cycleIssues := func(report IntegrityReport) map[int]bool {
+		found := make(map[int]bool)
+		for _, issue := range report.Issues {
+			if issue.Kind == IssueParentCycle && (issue.TaskID == first || issue.TaskID == second || issue.TaskID == third) {
+				found[issue.TaskID] = true
+			}
+		}
+		return found
+	}
+
+	report, err := db.VerifyIntegrity(ctx, false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if found := cycleIssues(report); len(found) != 2 || !found[first] || !found[second] {
+		t.Errorf("cycle: want tasks %d and %d, got %v", first, second, found)
+	}
+
+	report, err = db.VerifyIntegrity(ctx, true)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if report.Repaired == 0 {
+		t.Errorf("repaired: want at least 1, got 0")
+	}
+	report, err = db.VerifyIntegrity(ctx, false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if found := cycleIssues(report); len(found) != 0 {
+		t.Errorf("cycle after repair: want none, got %v", found)
+	}
+	// цикл разрывается у задачи с наименьшим id
+	var parentID *int
+	err = db.db.QueryRow(ctx, `SELECT parent_id FROM tasks WHERE id = $1`, first).Scan(&parentID)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if parentID != nil {
+		t.Errorf("parent of %d: want nil, got %d", first, *parentID)
+	}
+}
@@ -0,0 +1,280 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// Операции, ход выполнения которых записывается в задание.
+const (
+	JobImport         = "import"          // NewTasks и ImportTasks
+	JobParallelImport = "parallel_import" // ImportTasksParallel
+	JobMerge          = "merge"           // MergeTasks
+	JobArchive        = "archive"         // ArchiveClosedTasks
+	JobRetention      = "retention"       // ApplyRetention
+)
+
+// Состояния задания.
+const (
+	JobPending = "pending"
+	JobRunning = "running"
+	JobDone    = "done"
+	JobFailed  = "failed"
+)
+
+var (
+	ErrJobNotFound = fmt.Errorf("job not found")
+	ErrJobStarted  = fmt.Errorf("job already started")
+	ErrNoJob       = fmt.Errorf("operation requires a job")
+)
+
+// Задание: ход выполнения длительной операции.
+type Job struct {
+	ID        int
+	Kind      string // операция, пустая до запуска
+	State     string
+	Total     int    // количество обрабатываемых объектов, 0 - пока неизвестно
+	Processed int    // количество обработанных объектов
+	Errors    int    // количество ошибок
+	Error     string // последняя ошибка
+	Created   time.Time
+	Updated   time.Time
+	Finished  *time.Time // nil, пока операция выполняется
+}
+
+// NewJob создаёт задание для длительной операции и возвращает его id.
+// Задание передаётся операции через WithJob, а ход её выполнения читается
+// методом JobStatus, в том числе из другого процесса и после переподключения.
+func (s *Storage) NewJob() (int, error) {
+	err := s.authorizeWrite(RoleReporter)
+	if err != nil {
+		return 0, err
+	}
+
+	var id int
+	ctx := context.Background()
+	err = s.db.QueryRow(ctx, `
+		INSERT INTO jobs (tenant_id) VALUES ($1) RETURNING id
+	`,
+		s.tenantID,
+	).Scan(&id)
+
+	return id, err
+}
+
+// WithJob возвращает хранилище, длительные операции которого (NewTasks, MergeTasks,
+// ArchiveClosedTasks, ApplyRetention) записывают ход выполнения в задание jobID.
+// Задание используется одной операцией, повторный запуск возвращает ErrJobStarted;
+// только ImportTasks и ImportTasksParallel могут продолжить своё задание,
+// завершившееся ошибкой.
+func (s *Storage) WithJob(jobID int) *Storage {
+	scoped := *s
+	scoped.jobID = jobID
+	return &scoped
+}
+
+// JobStatus возвращает задание по id.
+func (s *Storage) JobStatus(jobID int) (Job, error) {
+	var j Job
+	var created, updated, finished int64
+	ctx := context.Background()
+	err := s.db.QueryRow(ctx, `
+		SELECT id, kind, state, total, processed, errors, error, created, updated, finished
+		FROM jobs
+		WHERE id = $1 AND tenant_id = $2
+	`,
+		jobID,
+		s.tenantID,
+	).Scan(&j.ID, &j.Kind, &j.State, &j.Total, &j.Processed, &j.Errors, &j.Error, &created, &updated, &finished)
+	if err == pgx.ErrNoRows {
+		return j, ErrJobNotFound
+	}
+	j.Created = unixTime(created)
+	j.Updated = unixTime(updated)
+	j.Finished = closedTime(finished)
+
+	return j, err
+}
+
+// startJob отмечает запуск операции kind над total объектами в задании хранилища.
+// Ход выполнения записывается вне транзакций операции, чтобы его было видно сразу.
+func (s *Storage) startJob(ctx context.Context, kind string, total int) error {
+	_, err := s.claimJob(ctx, kind, total, false)
+	return err
+}
+
+// resumeJob, как startJob, запускает задание хранилища или продолжает задание той же
+// операции над тем же количеством объектов, завершившееся ошибкой. Возвращает
+// количество объектов, обработанных до ошибки.
+func (s *Storage) resumeJob(ctx context.Context, kind string, total int) (int, error) {
+	return s.claimJob(ctx, kind, total, true)
+}
+
+// tracksJob сообщает, записывается ли ход операции в задание хранилища: задание
+// задано WithJob, а хранилище не в режиме пробного запуска, изменения которого не фиксируются.
+func (s *Storage) tracksJob() bool {
+	return s.jobID != 0 && s.dryRun == nil
+}
+
+// claimJob переводит задание хранилища в состояние выполнения для startJob и resumeJob.
+func (s *Storage) claimJob(ctx context.Context, kind string, total int, resume bool) (int, error) {
+	if !s.tracksJob() {
+		return 0, nil
+	}
+
+	// задание, которое не удалось запустить, нужно отличить от отсутствующего
+	var started bool
+	var processed int
+	err := s.db.QueryRow(ctx, `
+		WITH started AS (
+			UPDATE jobs
+			SET
+				kind = $3,
+				state = 'running',
+				total = $4,
+				error = '',
+				updated = extract(epoch from now()),
+				finished = 0
+			WHERE id = $1 AND tenant_id = $2 AND (
+				state = 'pending' OR
+				($5 AND state = 'failed' AND kind = $3 AND total = $4)
+			)
+			RETURNING processed
+		)
+		SELECT true, processed FROM started
+		UNION ALL
+		SELECT false, 0 FROM jobs WHERE id = $1 AND tenant_id = $2 AND NOT EXISTS (SELECT 1 FROM started)
+	`,
+		s.jobID,
+		s.tenantID,
+		kind,
+		total,
+		resume,
+	).Scan(&started, &processed)
+	if err == pgx.ErrNoRows {
+		return 0, ErrJobNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+	if !started {
+		return 0, ErrJobStarted
+	}
+
+	return processed, nil
+}
+
+// jobCheckpoint записывает в задание хранилища количество обработанных объектов
+// в транзакции tx, чтобы оно изменилось только вместе с их обработкой.
+func (s *Storage) jobCheckpoint(ctx context.Context, tx pgx.Tx, processed int) error {
+	if !s.tracksJob() {
+		return nil
+	}
+
+	_, err := tx.Exec(ctx, `
+		UPDATE jobs
+		SET processed = $2, updated = extract(epoch from now())
+		WHERE id = $1
+	`,
+		s.jobID,
+		processed,
+	)
+
+	return err
+}
+
+// jobChunkDone отмечает в задании хранилища в транзакции tx, что пакет chunk
+// из n объектов обработан. В отличие от jobCheckpoint, пакеты могут
+// обрабатываться в любом порядке.
+func (s *Storage) jobChunkDone(ctx context.Context, tx pgx.Tx, chunk, n int) error {
+	if !s.tracksJob() {
+		return nil
+	}
+
+	_, err := tx.Exec(ctx, `
+		UPDATE jobs
+		SET processed = processed + $3, chunks = array_append(chunks, $2), updated = extract(epoch from now())
+		WHERE id = $1
+	`,
+		s.jobID,
+		chunk,
+		n,
+	)
+
+	return err
+}
+
+// jobChunks возвращает номера пакетов, обработанных в задании хранилища.
+func (s *Storage) jobChunks(ctx context.Context) (map[int]bool, error) {
+	var chunks []int
+	err := s.db.QueryRow(ctx, `
+		SELECT chunks FROM jobs WHERE id = $1
+	`,
+		s.jobID,
+	).Scan(&chunks)
+	if err != nil {
+		return nil, err
+	}
+
+	done := make(map[int]bool, len(chunks))
+	for _, n := range chunks {
+		done[n] = true
+	}
+
+	return done, nil
+}
+
+// jobProgress записывает в задание хранилища количество обработанных и всех объектов.
+func (s *Storage) jobProgress(ctx context.Context, processed, total int) error {
+	if !s.tracksJob() {
+		return nil
+	}
+
+	_, err := s.db.Exec(ctx, `
+		UPDATE jobs
+		SET processed = $2, total = $3, updated = extract(epoch from now())
+		WHERE id = $1
+	`,
+		s.jobID,
+		processed,
+		total,
+	)
+
+	return err
+}
+
+// finishJob отмечает в задании хранилища завершение операции с ошибкой opErr
+// и возвращает opErr, а если её нет - ошибку записи в задание.
+// При успешном завершении все объекты считаются обработанными.
+func (s *Storage) finishJob(ctx context.Context, opErr error) error {
+	if !s.tracksJob() {
+		return opErr
+	}
+
+	var message string
+	if opErr != nil {
+		message = opErr.Error()
+	}
+	_, err := s.db.Exec(ctx, `
+		UPDATE jobs
+		SET
+			state = CASE WHEN $2 = '' THEN 'done' ELSE 'failed' END,
+			processed = CASE WHEN $2 = '' THEN total ELSE processed END,
+			errors = errors + CASE WHEN $2 = '' THEN 0 ELSE 1 END,
+			error = $2,
+			updated = extract(epoch from now()),
+			finished = extract(epoch from now())
+		WHERE id = $1
+	`,
+		s.jobID,
+		message,
+	)
+	if opErr != nil {
+		return opErr
+	}
+
+	return err
+}
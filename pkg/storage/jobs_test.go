@@ -0,0 +1,82 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestStorage_JobStatus(t *testing.T) {
+	db, err := storageConnect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close(context.Background()) })
+
+	tenant := db.ForTenant(1230)
+	ctx := context.Background()
+	t.Cleanup(func() {
+		db.db.Exec(ctx, `DELETE FROM tasks WHERE tenant_id = 1230`)
+		db.db.Exec(ctx, `DELETE FROM jobs WHERE tenant_id = 1230`)
+	})
+
+	jobID, err := tenant.NewJob()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	job, err := tenant.JobStatus(jobID)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if job.State != JobPending || job.Kind != "" || job.Finished != nil {
+		t.Errorf("new job: want pending, got %+v", job)
+	}
+
+	tasks := make([]Task, importChunkSize+1)
+	for i := range tasks {
+		tasks[i] = Task{Title: fmt.Sprintf("Imported %d", i), Content: "Test content"}
+	}
+	err = tenant.WithJob(jobID).NewTasks(tasks)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	job, err = tenant.JobStatus(jobID)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if job.Kind != JobImport || job.State != JobDone || job.Processed != len(tasks) || job.Total != len(tasks) || job.Finished == nil {
+		t.Errorf("import job: want done %d/%d, got %+v", len(tasks), len(tasks), job)
+	}
+
+	err = tenant.WithJob(jobID).NewTasks(tasks[:1])
+	if !errors.Is(err, ErrJobStarted) {
+		t.Errorf("error: want %v, got %v", ErrJobStarted, err)
+	}
+	err = db.WithJob(jobID).NewTasks(tasks[:1])
+	if !errors.Is(err, ErrJobNotFound) {
+		t.Errorf("error: want %v, got %v", ErrJobNotFound, err)
+	}
+
+	// ошибка операции записывается в задание
+	jobID, err = tenant.NewJob()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	err = tenant.WithJob(jobID).MergeTasks(99999999, []int{99999998})
+	if !errors.Is(err, ErrTaskNotFound) {
+		t.Errorf("error: want %v, got %v", ErrTaskNotFound, err)
+	}
+	job, err = tenant.JobStatus(jobID)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if job.Kind != JobMerge || job.State != JobFailed || job.Errors != 1 || job.Error != ErrTaskNotFound.Error() {
+		t.Errorf("merge job: want failed with %v, got %+v", ErrTaskNotFound, job)
+	}
+
+	_, err = tenant.JobStatus(99999999)
+	if !errors.Is(err, ErrJobNotFound) {
+		t.Errorf("error: want %v, got %v", ErrJobNotFound, err)
+	}
+}
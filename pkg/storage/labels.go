@@ -0,0 +1,216 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v4"
+)
+
+var ErrLabelCycle = fmt.Errorf("label cannot be nested under itself or its descendant")
+
+// labelSubtreeSQL выбирает в matched id метки с названием $1 рабочего пространства $2
+// и всех её дочерних меток на любой глубине.
+const labelSubtreeSQL = `
+	WITH RECURSIVE matched AS (
+		SELECT id
+		FROM labels
+		WHERE name = $1 AND tenant_id = $2
+		UNION
+		SELECT l.id
+		FROM labels AS l
+		JOIN matched AS m
+		ON l.parent_id = m.id
+		WHERE l.tenant_id = $2
+	)`
+
+// Метка задач. Метки образуют иерархию, например "area" и "area/backend":
+// задачи дочерних меток входят в родительскую метку.
+type Label struct {
+	ID     int
+	Name   string
+	Parent string // пустое название - метка верхнего уровня
+}
+
+// Labels возвращает метки рабочего пространства в порядке названий.
+func (s *Storage) Labels() ([]Label, error) {
+	ctx := context.Background()
+	rows, err := s.db.Query(ctx, `
+		SELECT l.id, l.name, COALESCE(p.name, '')
+		FROM labels AS l
+		LEFT JOIN labels AS p
+		ON p.id = l.parent_id
+		WHERE l.tenant_id = $1
+		ORDER BY l.name, l.id
+	`,
+		s.tenantID,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return collectRows(rows, func(row pgx.Row) (Label, error) {
+		var l Label
+		err := row.Scan(&l.ID, &l.Name, &l.Parent)
+		return l, err
+	})
+}
+
+// SetLabelParent делает метку label дочерней для метки parent, пустой parent
+// переносит метку на верхний уровень.
+// Метку нельзя вложить в саму себя или в её потомка.
+func (s *Storage) SetLabelParent(label, parent string) error {
+	err := s.authorizeWrite(RoleMaintainer)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	id, err := s.labelID(ctx, label)
+	if err != nil {
+		return err
+	}
+	if id == nil {
+		return ErrEmptyLabel
+	}
+	parentID, err := s.labelID(ctx, parent)
+	if err != nil {
+		return err
+	}
+
+	tag, err := s.db.Exec(ctx, `
+		WITH RECURSIVE descendants AS (
+			SELECT id
+			FROM labels
+			WHERE id = $1
+			UNION
+			SELECT l.id
+			FROM labels AS l
+			JOIN descendants AS d
+			ON l.parent_id = d.id
+		)
+		UPDATE labels
+		SET parent_id = $2
+		WHERE id = $1 AND tenant_id = $3 AND ($2::integer IS NULL OR $2 NOT IN (SELECT id FROM descendants))
+	`,
+		*id,
+		parentID,
+		s.tenantID,
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrLabelCycle
+	}
+
+	return nil
+}
+
+// AddLabelToTasks добавляет метку задачам taskIDs одним запросом и возвращает количество
+// задач, получивших метку. Задачи, у которых метка уже есть, и недоступные пользователю
+// задачи пропускаются. Каждое добавление записывается в историю задачи.
+// В режиме пробного запуска возвращает количество, не добавляя метку.
+func (s *Storage) AddLabelToTasks(label string, taskIDs []int) (int, error) {
+	err := s.authorizeWrite(RoleReporter)
+	if err != nil {
+		return 0, err
+	}
+	if label == "" {
+		return 0, ErrEmptyLabel
+	}
+
+	ctx := context.Background()
+	labelID, err := s.labelID(ctx, label)
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	var n int
+	err = tx.QueryRow(ctx, `
+		WITH added AS (
+			INSERT INTO tasks_labels (task_id, label_id)
+			SELECT t.id, $1
+			FROM tasks AS t
+			WHERE
+				t.id = ANY($2) AND t.tenant_id = $3 AND can_access($4, t) AND
+				NOT EXISTS (SELECT 1 FROM tasks_labels AS tl WHERE tl.task_id = t.id AND tl.label_id = $1)
+			RETURNING task_id
+		), history AS (
+			INSERT INTO task_history (task_id, field, new_value)
+			SELECT task_id, 'label', $5
+			FROM added
+		)
+		SELECT count(*) FROM added
+	`,
+		*labelID,
+		taskIDs,
+		s.tenantID,
+		s.userID,
+		label,
+	).Scan(&n)
+	if err != nil {
+		return 0, err
+	}
+
+	return n, s.commit(ctx, tx)
+}
+
+// RemoveLabelFromTasks снимает метку с задач taskIDs одним запросом и возвращает количество
+// задач, с которых метка снята. Каждое снятие записывается в историю задачи.
+// В режиме пробного запуска возвращает количество, не снимая метку.
+func (s *Storage) RemoveLabelFromTasks(label string, taskIDs []int) (int, error) {
+	err := s.authorizeWrite(RoleReporter)
+	if err != nil {
+		return 0, err
+	}
+	if label == "" {
+		return 0, ErrEmptyLabel
+	}
+
+	ctx := context.Background()
+	labelID, err := s.labelID(ctx, label)
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	var n int
+	err = tx.QueryRow(ctx, `
+		WITH removed AS (
+			DELETE FROM tasks_labels AS tl
+			USING tasks AS t
+			WHERE
+				tl.task_id = t.id AND tl.label_id = $1 AND
+				t.id = ANY($2) AND t.tenant_id = $3 AND can_access($4, t)
+			RETURNING tl.task_id
+		), history AS (
+			INSERT INTO task_history (task_id, field, old_value)
+			SELECT DISTINCT task_id, 'label', $5
+			FROM removed
+		)
+		SELECT count(DISTINCT task_id) FROM removed
+	`,
+		*labelID,
+		taskIDs,
+		s.tenantID,
+		s.userID,
+		label,
+	).Scan(&n)
+	if err != nil {
+		return 0, err
+	}
+
+	return n, s.commit(ctx, tx)
+}
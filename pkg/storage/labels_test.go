@@ -0,0 +1,168 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestStorage_SetLabelParent(t *testing.T) {
+	db, err := storageConnect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close(context.Background()) })
+
+	tenant := db.ForTenant(1202)
+	ctx := context.Background()
+	_, err = db.db.Exec(ctx, `
+		INSERT INTO labels (tenant_id, name) VALUES (1202, 'area'), (1202, 'area/backend'), (1202, 'area/backend/db'), (1202, 'area/frontend')
+	`)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	t.Cleanup(func() { db.db.Exec(ctx, `DELETE FROM labels WHERE tenant_id = 1202`) })
+
+	for label, parent := range map[string]string{
+		"area/backend":    "area",
+		"area/backend/db": "area/backend",
+		"area/frontend":   "area",
+	} {
+		err = tenant.SetLabelParent(label, parent)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	backend := newTestTask(t, tenant, "Backend")
+	addTestLabel(t, tenant, backend, "area/backend")
+	db1 := newTestTask(t, tenant, "DB")
+	addTestLabel(t, tenant, db1, "area/backend/db")
+	addTestLabel(t, tenant, db1, "area")
+	frontend := newTestTask(t, tenant, "Frontend")
+	addTestLabel(t, tenant, frontend, "area/frontend")
+
+	tests := []struct {
+		label string
+		want  int
+	}{
+		{"area", 3},
+		{"area/backend", 2},
+		{"area/backend/db", 1},
+		{"area/frontend", 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.label, func(t *testing.T) {
+			tasks, err := tenant.TasksByLabel(tt.label)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if len(tasks) != tt.want {
+				t.Errorf("tasks: want %d, got %d", tt.want, len(tasks))
+			}
+		})
+	}
+
+	err = tenant.SetLabelParent("area", "area/backend/db")
+	if !errors.Is(err, ErrLabelCycle) {
+		t.Errorf("error: want %v, got %v", ErrLabelCycle, err)
+	}
+	err = tenant.SetLabelParent("area", "area")
+	if !errors.Is(err, ErrLabelCycle) {
+		t.Errorf("error: want %v, got %v", ErrLabelCycle, err)
+	}
+	err = tenant.SetLabelParent("area", "Bug")
+	if !errors.Is(err, ErrLabelNotFound) {
+		t.Errorf("error: want %v, got %v", ErrLabelNotFound, err)
+	}
+
+	err = tenant.SetLabelParent("area/frontend", "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	labels, err := tenant.Labels()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	parents := make(map[string]string)
+	for _, l := range labels {
+		parents[l.Name] = l.Parent
+	}
+	want := map[string]string{
+		"area":            "",
+		"area/backend":    "area",
+		"area/backend/db": "area/backend",
+		"area/frontend":   "",
+	}
+	for name, parent := range want {
+		if got, ok := parents[name]; !ok || got != parent {
+			t.Errorf("parent of %q: want %q, got %q", name, parent, got)
+		}
+	}
+}
+
+func TestStorage_AddLabelToTasks(t *testing.T) {
+	db, err := storageConnect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close(context.Background()) })
+
+	tenant := db.ForTenant(1213)
+	ctx := context.Background()
+	_, err = db.db.Exec(ctx, `INSERT INTO labels (tenant_id, name) VALUES (1213, 'Triaged')`)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	t.Cleanup(func() { db.db.Exec(ctx, `DELETE FROM labels WHERE tenant_id = 1213`) })
+
+	first := newTestTask(t, tenant, "First")
+	second := newTestTask(t, tenant, "Second")
+	foreign := newTestTask(t, db, "Other tenant")
+
+	n, err := tenant.AddLabelToTasks("Triaged", []int{first, second, foreign})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if n != 2 {
+		t.Errorf("labeled: want 2, got %d", n)
+	}
+	// повторное добавление пропускает задачи с меткой
+	n, err = tenant.AddLabelToTasks("Triaged", []int{first, second})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if n != 0 {
+		t.Errorf("labeled again: want 0, got %d", n)
+	}
+
+	n, err = tenant.RemoveLabelFromTasks("Triaged", []int{first})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if n != 1 {
+		t.Errorf("unlabeled: want 1, got %d", n)
+	}
+	tasks, err := tenant.TasksByLabel("Triaged")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(tasks) != 1 || tasks[0].ID != second {
+		t.Errorf("tasks: want [%d], got %+v", second, tasks)
+	}
+
+	history, err := tenant.TaskHistory(first)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(history) != 2 ||
+		history[0].Field != "label" || history[0].NewValue != "Triaged" ||
+		history[1].Field != "label" || history[1].OldValue != "Triaged" {
+		t.Errorf("history: want label added and removed, got %+v", history)
+	}
+
+	_, err = tenant.AddLabelToTasks("Bug", []int{first})
+	if !errors.Is(err, ErrLabelNotFound) {
+		t.Errorf("error: want %v, got %v", ErrLabelNotFound, err)
+	}
+}
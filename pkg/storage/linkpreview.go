@@ -0,0 +1,309 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+	"syscall"
+	"time"
+	"unicode/utf8"
+
+	"github.com/jackc/pgx/v4"
+)
+
+var ErrPrivateAddress = fmt.Errorf("link points to a private address")
+
+// Ограничения превью ссылок.
+const (
+	maxTaskLinks       = 10        // количество ссылок задачи, для которых строятся превью
+	maxPreviewPage     = 512 << 10 // количество загружаемых байт страницы
+	maxPreviewFieldLen = 300       // длина полей превью в символах
+)
+
+var (
+	linkURL   = regexp.MustCompile(`https?://[^\s<>()\[\]"'` + "`" + `]+`)
+	pageTitle = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+	pageMeta  = regexp.MustCompile(`(?is)<meta\s[^>]*>`)
+	metaAttr  = regexp.MustCompile(`(?is)([a-z][a-z:-]*)\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s"'>]+))`)
+)
+
+// Превью ссылки: заголовок, описание и изображение страницы по данным OpenGraph или тегу title.
+type LinkPreview struct {
+	URL         string
+	Title       string
+	Description string
+	Image       string
+	SiteName    string
+	Fetched     int64
+}
+
+// Загрузчик превью ссылок.
+type LinkFetcher interface {
+	FetchLinkPreview(ctx context.Context, url string) (LinkPreview, error)
+}
+
+// TaskLinkPreviews возвращает загруженные превью ссылок из содержимого задачи в порядке их появления.
+// Ссылки без превью ставятся в очередь загрузки рабочего пространства, их превью появятся
+// после запуска FetchLinkPreviews. Хранилище с шифрованием (WithEncryption) превью не строит:
+// очередь и кэш хранят ссылки открытым текстом, а загрузка раскрыла бы их внешним сайтам.
+func (s *Storage) TaskLinkPreviews(taskID int) ([]LinkPreview, error) {
+	task, err := s.TaskByID(taskID)
+	if err != nil {
+		return nil, err
+	}
+	if s.keys != nil {
+		return nil, nil
+	}
+	urls := extractLinks(task.Content)
+	if len(urls) == 0 {
+		return nil, nil
+	}
+
+	ctx := context.Background()
+	if !s.db.readOnly {
+		_, err = s.db.Exec(ctx, `
+			INSERT INTO link_previews (tenant_id, url)
+			SELECT $2, unnest($1::text[])
+			ON CONFLICT DO NOTHING
+		`,
+			urls,
+			s.tenantID,
+		)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	rows, err := s.db.Query(ctx, `
+		SELECT p.url, p.title, p.description, p.image, p.site_name, p.fetched
+		FROM unnest($1::text[]) WITH ORDINALITY AS u(url, n)
+		JOIN link_previews AS p
+		ON p.tenant_id = $2 AND p.url = u.url
+		WHERE p.fetched IS NOT NULL AND p.error = ''
+		ORDER BY u.n
+	`,
+		urls,
+		s.tenantID,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return collectRows(rows, func(row pgx.Row) (LinkPreview, error) {
+		var p LinkPreview
+		err := row.Scan(&p.URL, &p.Title, &p.Description, &p.Image, &p.SiteName, &p.Fetched)
+		return p, err
+	})
+}
+
+// FetchLinkPreviews загружает не более limit превью из очереди рабочего пространства,
+// начиная с давно запрошенных, и возвращает количество обработанных ссылок. Системный
+// пользователь загружает превью всех рабочих пространств. Ошибка загрузки сохраняется
+// вместе с превью, чтобы ссылка не загружалась повторно; возвращаются только ошибки БД.
+func (s *Storage) FetchLinkPreviews(ctx context.Context, f LinkFetcher, limit int) (int, error) {
+	err := s.authorizeWrite(RoleAdmin)
+	if err != nil {
+		return 0, err
+	}
+
+	rows, err := s.db.Query(ctx, `
+		SELECT tenant_id, url
+		FROM link_previews
+		WHERE fetched IS NULL AND (tenant_id = $2 OR $3)
+		ORDER BY requested
+		LIMIT $1
+	`,
+		limit,
+		s.tenantID,
+		s.authorizeSystem() == nil,
+	)
+	if err != nil {
+		return 0, err
+	}
+	links, err := collectRows(rows, func(row pgx.Row) (pendingLink, error) {
+		var l pendingLink
+		err := row.Scan(&l.tenantID, &l.url)
+		return l, err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	for i, link := range links {
+		p, ferr := f.FetchLinkPreview(ctx, link.url)
+		if ctx.Err() != nil {
+			return i, ctx.Err()
+		}
+		var msg string
+		if ferr != nil {
+			msg = ferr.Error()
+		}
+		_, err = s.db.Exec(ctx, `
+			UPDATE link_previews
+			SET
+				fetched = extract(epoch from now()),
+				title = $2,
+				description = $3,
+				image = $4,
+				site_name = $5,
+				error = $6
+			WHERE tenant_id = $7 AND url = $1
+		`,
+			link.url,
+			p.Title,
+			p.Description,
+			p.Image,
+			p.SiteName,
+			msg,
+			link.tenantID,
+		)
+		if err != nil {
+			return i, err
+		}
+	}
+
+	return len(links), nil
+}
+
+// Ссылка в очереди загрузки превью.
+type pendingLink struct {
+	tenantID int
+	url      string
+}
+
+// extractLinks возвращает ссылки http и https из текста без повторов
+// в порядке появления, не более maxTaskLinks.
+func extractLinks(text string) []string {
+	var urls []string
+	seen := make(map[string]bool)
+	for _, url := range linkURL.FindAllString(text, -1) {
+		// знаки препинания в конце предложения не входят в ссылку
+		url = strings.TrimRight(url, ".,;:!?")
+		if seen[url] {
+			continue
+		}
+		seen[url] = true
+		urls = append(urls, url)
+		if len(urls) == maxTaskLinks {
+			break
+		}
+	}
+
+	return urls
+}
+
+// Загрузчик превью по HTTP. Не обращается к адресам внутренней сети,
+// чтобы ссылки в задачах нельзя было использовать для доступа к внутренним сервисам.
+type httpLinkFetcher struct {
+	http *http.Client
+}
+
+// NewHTTPLinkFetcher возвращает LinkFetcher, загружающий страницы по HTTP с тайм-аутом timeout.
+func NewHTTPLinkFetcher(timeout time.Duration) LinkFetcher {
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip := net.ParseIP(host)
+			if ip == nil || !ip.IsGlobalUnicast() || ip.IsPrivate() {
+				return ErrPrivateAddress
+			}
+			return nil
+		},
+	}
+
+	return &httpLinkFetcher{
+		http: &http.Client{
+			Timeout: timeout,
+			// без прокси, иначе проверка адреса применялась бы к прокси, а не к странице
+			Transport: &http.Transport{DialContext: dialer.DialContext},
+		},
+	}
+}
+
+// FetchLinkPreview загружает страницу и извлекает из неё превью.
+func (f *httpLinkFetcher) FetchLinkPreview(ctx context.Context, url string) (LinkPreview, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return LinkPreview{}, err
+	}
+	req.Header.Set("Accept", "text/html")
+	resp, err := f.http.Do(req)
+	if err != nil {
+		return LinkPreview{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return LinkPreview{}, fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType != "text/html" {
+		return LinkPreview{}, fmt.Errorf("unexpected content type: %s", mediaType)
+	}
+	page, err := io.ReadAll(io.LimitReader(resp.Body, maxPreviewPage))
+	if err != nil {
+		return LinkPreview{}, err
+	}
+
+	p := parseLinkPreview(string(page))
+	p.URL = url
+	return p, nil
+}
+
+// parseLinkPreview извлекает превью из HTML страницы: свойства OpenGraph,
+// а при их отсутствии тег title и метатег description.
+func parseLinkPreview(page string) LinkPreview {
+	meta := make(map[string]string)
+	for _, tag := range pageMeta.FindAllString(page, -1) {
+		attrs := make(map[string]string)
+		for _, m := range metaAttr.FindAllStringSubmatch(tag, -1) {
+			attrs[strings.ToLower(m[1])] = m[2] + m[3] + m[4]
+		}
+		key := attrs["property"]
+		if key == "" {
+			key = attrs["name"]
+		}
+		key = strings.ToLower(key)
+		if _, ok := meta[key]; !ok && key != "" {
+			meta[key] = attrs["content"]
+		}
+	}
+
+	var p LinkPreview
+	p.Title = previewField(meta["og:title"])
+	if p.Title == "" {
+		if m := pageTitle.FindStringSubmatch(page); m != nil {
+			p.Title = previewField(m[1])
+		}
+	}
+	p.Description = previewField(meta["og:description"])
+	if p.Description == "" {
+		p.Description = previewField(meta["description"])
+	}
+	p.SiteName = previewField(meta["og:site_name"])
+	if image := previewField(meta["og:image"]); strings.HasPrefix(image, "https://") || strings.HasPrefix(image, "http://") {
+		p.Image = image
+	}
+
+	return p
+}
+
+// previewField раскодирует сущности HTML, схлопывает пробелы и обрезает значение до maxPreviewFieldLen символов.
+func previewField(s string) string {
+	s = strings.Join(strings.Fields(html.UnescapeString(s)), " ")
+	if utf8.RuneCountInString(s) <= maxPreviewFieldLen {
+		return s
+	}
+
+	return string([]rune(s)[:maxPreviewFieldLen]) + "…"
+}
@@ -0,0 +1,170 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestExtractLinks(t *testing.T) {
+	text := "See https://example.com/a?b=1, and (http://example.org/x). Again https://example.com/a?b=1 or ftp://example.net"
+	got := extractLinks(text)
+	want := []string{"https://example.com/a?b=1", "http://example.org/x"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("links: want %v, got %v", want, got)
+	}
+}
+
+func TestParseLinkPreview(t *testing.T) {
+	tests := []struct {
+		name string
+		page string
+		want LinkPreview
+	}{
+		{
+			name: "open graph",
+			page: `<html><head><title>Fallback</title>
+				<meta property="og:title" content="Release &amp; notes">
+				<meta content='Everything   new' property='og:description'>
+				<meta property="og:site_name" content="Example">
+				<meta property="og:image" content="https://example.com/i.png">`,
+			want: LinkPreview{Title: "Release & notes", Description: "Everything new", SiteName: "Example", Image: "https://example.com/i.png"},
+		},
+		{
+			name: "title and description",
+			page: `<TITLE>
+				Plain page
+			</TITLE><meta name="description" content="Short"><meta property="og:image" content="javascript:alert(1)">`,
+			want: LinkPreview{Title: "Plain page", Description: "Short"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseLinkPreview(tt.page)
+			if got != tt.want {
+				t.Errorf("preview: want %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestHTTPLinkFetcher_PrivateAddress(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<title>Internal</title>"))
+	}))
+	t.Cleanup(srv.Close)
+
+	_, err := NewHTTPLinkFetcher(time.Second).FetchLinkPreview(context.Background(), srv.URL)
+	if !errors.Is(err, ErrPrivateAddress) {
+		t.Errorf("error: want %v, got %v", ErrPrivateAddress, err)
+	}
+}
+
+// Загрузчик превью для тестов.
+type fakeLinkFetcher map[string]LinkPreview
+
+func (f fakeLinkFetcher) FetchLinkPreview(ctx context.Context, url string) (LinkPreview, error) {
+	p, ok := f[url]
+	if !ok {
+		return LinkPreview{}, fmt.Errorf("not found")
+	}
+	return p, nil
+}
+
+func TestStorage_TaskLinkPreviews(t *testing.T) {
+	db, err := storageConnect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close(context.Background()) })
+
+	ctx := context.Background()
+	urls := []string{"https://preview.test/1210/ok", "https://preview.test/1210/missing"}
+	t.Cleanup(func() { db.db.Exec(ctx, `DELETE FROM link_previews WHERE url = ANY($1)`, urls) })
+
+	taskID := newTestTask(t, db, "Links")
+	err = db.UpdateTask(taskID, 0, 0, "", "Docs: "+urls[0]+" and "+urls[1])
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// первый просмотр ставит ссылки в очередь
+	previews, err := db.TaskLinkPreviews(taskID)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(previews) != 0 {
+		t.Errorf("previews: want none, got %+v", previews)
+	}
+
+	_, err = db.FetchLinkPreviews(ctx, fakeLinkFetcher{urls[0]: {Title: "Docs"}}, 1000)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	previews, err = db.TaskLinkPreviews(taskID)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(previews) != 1 || previews[0].URL != urls[0] || previews[0].Title != "Docs" {
+		t.Errorf("previews: want Docs for %s, got %+v", urls[0], previews)
+	}
+
+	// администратор рабочего пространства не загружает превью ссылок других пространств
+	tenant := db.ForTenant(1210)
+	other := "https://preview.test/1210/other"
+	t.Cleanup(func() { db.db.Exec(ctx, `DELETE FROM link_previews WHERE url = $1`, other) })
+	otherID := newTestTask(t, tenant, "Other tenant links")
+	err = tenant.UpdateTask(otherID, 0, 0, "", "See "+other)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	_, err = tenant.TaskLinkPreviews(otherID)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	adminID := newTestUser(t, db, "Preview admin")
+	err = db.SetRole(adminID, RoleAdmin)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	_, err = db.AsUser(adminID).FetchLinkPreviews(ctx, fakeLinkFetcher{other: {Title: "Other"}}, 1000)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var fetched *int64
+	err = db.db.QueryRow(ctx, `SELECT fetched FROM link_previews WHERE tenant_id = 1210 AND url = $1`, other).Scan(&fetched)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if fetched != nil {
+		t.Errorf("other tenant link: want pending, got fetched at %d", *fetched)
+	}
+
+	// ссылки зашифрованных задач не попадают в очередь
+	encrypted := tenant.WithEncryption(StaticKey(make([]byte, 32)))
+	secret := "https://preview.test/1210/secret"
+	t.Cleanup(func() { db.db.Exec(ctx, `DELETE FROM link_previews WHERE url = $1`, secret) })
+	err = encrypted.UpdateTask(otherID, 0, 0, "", "See "+secret)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	previews, err = encrypted.TaskLinkPreviews(otherID)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var queued int
+	err = db.db.QueryRow(ctx, `SELECT count(*) FROM link_previews WHERE url = $1`, secret).Scan(&queued)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(previews) != 0 || queued != 0 {
+		t.Errorf("encrypted task: want no previews, got %+v, queued %d", previews, queued)
+	}
+}
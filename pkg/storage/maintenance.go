@@ -0,0 +1,148 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// Статистика таблицы для контроля её состояния.
+type TableStats struct {
+	Name         string
+	LiveRows     int64     // оценка количества строк
+	DeadRows     int64     // оценка количества удалённых, но не очищенных строк
+	TotalBytes   int64     // размер таблицы с индексами и TOAST
+	LastVacuum   time.Time // последняя очистка, ручная или автоматическая, нулевое значение - не было
+	LastAnalyze  time.Time // последний сбор статистики, ручной или автоматический
+	DeadRowRatio float64   // доля мёртвых строк, оценка раздувания таблицы
+}
+
+// AnalyzeTables обновляет статистику планировщика для всех таблиц пакета.
+func (s *Storage) AnalyzeTables(ctx context.Context) error {
+	err := s.authorizeWrite(RoleAdmin)
+	if err != nil {
+		return err
+	}
+
+	for _, table := range backupTables {
+		// имена таблиц берутся только из backupTables
+		_, err = s.db.Exec(ctx, fmt.Sprintf(`ANALYZE %s`, table.name))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ReindexSearchIndex перестраивает триграммный индекс поиска по названиям задач
+// без блокировки записи в таблицу задач.
+func (s *Storage) ReindexSearchIndex(ctx context.Context) error {
+	err := s.authorizeWrite(RoleAdmin)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.Exec(ctx, `REINDEX INDEX CONCURRENTLY tasks_title_trgm_idx`)
+
+	return err
+}
+
+// TableStats возвращает количество строк, размер и оценку раздувания таблиц пакета.
+func (s *Storage) TableStats(ctx context.Context) ([]TableStats, error) {
+	err := s.authorize(RoleAdmin)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(backupTables))
+	for _, table := range backupTables {
+		names = append(names, table.name)
+	}
+
+	rows, err := s.db.Query(ctx, `
+		SELECT
+			relname,
+			n_live_tup,
+			n_dead_tup,
+			pg_total_relation_size(relid),
+			COALESCE(extract(epoch from greatest(last_vacuum, last_autovacuum))::bigint, 0),
+			COALESCE(extract(epoch from greatest(last_analyze, last_autoanalyze))::bigint, 0)
+		FROM pg_stat_user_tables
+		WHERE relname = ANY($1) AND schemaname = current_schema()
+		ORDER BY relname
+	`,
+		names,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return collectRows(rows, scanTableStats)
+}
+
+// scanTableStats сканирует статистику таблицы.
+func scanTableStats(row pgx.Row) (TableStats, error) {
+	var t TableStats
+	var vacuum, analyze int64
+	err := row.Scan(
+		&t.Name,
+		&t.LiveRows,
+		&t.DeadRows,
+		&t.TotalBytes,
+		&vacuum,
+		&analyze,
+	)
+	if err != nil {
+		return TableStats{}, err
+	}
+	if vacuum > 0 {
+		t.LastVacuum = unixTime(vacuum)
+	}
+	if analyze > 0 {
+		t.LastAnalyze = unixTime(analyze)
+	}
+	if total := t.LiveRows + t.DeadRows; total > 0 {
+		t.DeadRowRatio = float64(t.DeadRows) / float64(total)
+	}
+
+	return t, nil
+}
+
+// Индексы, которые должны быть созданы схемой БД.
+var expectedIndexes = []string{
+	"tasks_title_trgm_idx",
+	"tasks_author_id_idx",
+	"tasks_assigned_id_idx",
+	"tasks_closed_idx",
+	"tasks_labels_label_id_idx",
+}
+
+// VerifyIndexes возвращает индексы схемы, отсутствующие в БД.
+// Без них запросы с фильтрами по автору, ответственному, времени выполнения
+// и метке выполняются полным просмотром таблиц.
+func (s *Storage) VerifyIndexes(ctx context.Context) ([]string, error) {
+	rows, err := s.db.Query(ctx, `
+		SELECT name
+		FROM unnest($1::text[]) AS name
+		WHERE NOT EXISTS (
+			SELECT 1
+			FROM pg_indexes
+			WHERE indexname = name AND schemaname = current_schema()
+		)
+		ORDER BY name
+	`,
+		expectedIndexes,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return collectRows(rows, func(row pgx.Row) (string, error) {
+		var name string
+		err := row.Scan(&name)
+		return name, err
+	})
+}
@@ -0,0 +1,63 @@
+package storage
+
+import (
+	"context"
+	"testing"
+)
+
+func TestStorage_Maintenance(t *testing.T) {
+	db, err := storageConnect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close(context.Background()) })
+	ctx := context.Background()
+
+	err = db.AnalyzeTables(ctx)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	err = db.ReindexSearchIndex(ctx)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	stats, err := db.TableStats(ctx)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(stats) != len(backupTables) {
+		t.Errorf("tables: want %d, got %d", len(backupTables), len(stats))
+	}
+	for _, st := range stats {
+		if st.Name == "tasks" {
+			if st.LiveRows == 0 {
+				t.Error("tasks rows: want > 0, got 0")
+			}
+			if st.LastAnalyze.IsZero() {
+				t.Error("tasks last analyze: want set after AnalyzeTables")
+			}
+		}
+	}
+
+	_, err = db.AsUser(newTestUser(t, db, "Maintenance viewer")).TableStats(ctx)
+	if err != ErrPermissionDenied {
+		t.Errorf("error: want %v, got %v", ErrPermissionDenied, err)
+	}
+}
+
+func TestStorage_VerifyIndexes(t *testing.T) {
+	db, err := storageConnect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close(context.Background()) })
+
+	missing, err := db.VerifyIndexes(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(missing) != 0 {
+		t.Errorf("missing indexes: want none, got %v", missing)
+	}
+}
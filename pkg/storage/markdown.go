@@ -0,0 +1,195 @@
+package storage
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// Строки Markdown, начинающие блоки.
+var (
+	mdHeading = regexp.MustCompile(`^(#{1,6})\s+(.*?)\s*#*\s*$`)
+	mdBullet  = regexp.MustCompile(`^\s{0,3}[-*+]\s+(.*)$`)
+	mdOrdered = regexp.MustCompile(`^\s{0,3}\d{1,9}[.)]\s+(.*)$`)
+	mdRule    = regexp.MustCompile(`^\s{0,3}(?:(?:-\s*){3,}|(?:\*\s*){3,}|(?:_\s*){3,})$`)
+	mdFence   = regexp.MustCompile("^\\s{0,3}(```|~~~)")
+	mdQuote   = regexp.MustCompile(`^\s{0,3}>\s?(.*)$`)
+)
+
+var (
+	// схемы, допустимые в ссылках; пустая схема - относительная ссылка
+	mdURLSafe = map[string]bool{"": true, "http": true, "https": true, "mailto": true}
+	// символы, которые можно экранировать обратной косой чертой
+	mdEscapes  = "\\`*_{}[]()#+-.!>~|"
+	mdReplacer = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&#34;", "'", "&#39;")
+)
+
+// renderMarkdown преобразует текст Markdown в HTML.
+// Поддерживаются заголовки, абзацы, маркированные и нумерованные списки, цитаты,
+// блоки кода, горизонтальные линии, выделение, код и ссылки.
+// HTML в исходном тексте экранируется, а ссылки допускаются только со схемами
+// http, https и mailto, поэтому результат безопасно выводить без дополнительной очистки.
+func renderMarkdown(src string) string {
+	lines := strings.Split(strings.ReplaceAll(src, "\r\n", "\n"), "\n")
+
+	var b strings.Builder
+	for i := 0; i < len(lines); {
+		line := lines[i]
+		switch {
+		case strings.TrimSpace(line) == "":
+			i++
+
+		case mdFence.MatchString(line):
+			fence := mdFence.FindStringSubmatch(line)[1]
+			i++
+			var code []string
+			for ; i < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[i]), fence); i++ {
+				code = append(code, lines[i])
+			}
+			i++ // закрывающая строка блока
+			b.WriteString("<pre><code>")
+			for _, l := range code {
+				b.WriteString(mdReplacer.Replace(l))
+				b.WriteByte('\n')
+			}
+			b.WriteString("</code></pre>\n")
+
+		case mdHeading.MatchString(line):
+			m := mdHeading.FindStringSubmatch(line)
+			fmt.Fprintf(&b, "<h%d>%s</h%[1]d>\n", len(m[1]), renderInline(m[2]))
+			i++
+
+		case mdRule.MatchString(line):
+			b.WriteString("<hr>\n")
+			i++
+
+		case mdQuote.MatchString(line):
+			var quote []string
+			for ; i < len(lines) && mdQuote.MatchString(lines[i]); i++ {
+				quote = append(quote, mdQuote.FindStringSubmatch(lines[i])[1])
+			}
+			b.WriteString("<blockquote>\n")
+			b.WriteString(renderMarkdown(strings.Join(quote, "\n")))
+			b.WriteString("</blockquote>\n")
+
+		case mdBullet.MatchString(line), mdOrdered.MatchString(line):
+			item, tag := mdBullet, "ul"
+			if !mdBullet.MatchString(line) {
+				item, tag = mdOrdered, "ol"
+			}
+			b.WriteString("<" + tag + ">\n")
+			for ; i < len(lines) && item.MatchString(lines[i]) && !mdRule.MatchString(lines[i]); i++ {
+				b.WriteString("<li>" + renderInline(item.FindStringSubmatch(lines[i])[1]) + "</li>\n")
+			}
+			b.WriteString("</" + tag + ">\n")
+
+		default:
+			// абзац продолжается до пустой строки или начала другого блока
+			var para []string
+			for ; i < len(lines) && !mdBlockStart(lines[i]); i++ {
+				para = append(para, strings.TrimSpace(lines[i]))
+			}
+			b.WriteString("<p>" + renderInline(strings.Join(para, "\n")) + "</p>\n")
+		}
+	}
+
+	return b.String()
+}
+
+// mdBlockStart сообщает, завершает ли строка абзац.
+func mdBlockStart(line string) bool {
+	return strings.TrimSpace(line) == "" ||
+		mdFence.MatchString(line) ||
+		mdHeading.MatchString(line) ||
+		mdRule.MatchString(line) ||
+		mdQuote.MatchString(line) ||
+		mdBullet.MatchString(line) ||
+		mdOrdered.MatchString(line)
+}
+
+// renderInline преобразует строчную разметку: экранирование, код, выделение и ссылки.
+func renderInline(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == '\\' && i+1 < len(s) && strings.IndexByte(mdEscapes, s[i+1]) >= 0:
+			b.WriteString(mdReplacer.Replace(s[i+1 : i+2]))
+			i += 2
+			continue
+
+		case c == '`':
+			if end := strings.IndexByte(s[i+1:], '`'); end >= 0 {
+				b.WriteString("<code>" + mdReplacer.Replace(s[i+1:i+1+end]) + "</code>")
+				i += end + 2
+				continue
+			}
+
+		case c == '*' || c == '_' && (i == 0 || !mdWordByte(s[i-1])):
+			delim := s[i : i+1]
+			tag := "em"
+			if strings.HasPrefix(s[i:], delim+delim) {
+				delim, tag = delim+delim, "strong"
+			}
+			inner := s[i+len(delim):]
+			if end := strings.Index(inner, delim); end > 0 && inner[0] != ' ' && inner[end-1] != ' ' {
+				b.WriteString("<" + tag + ">" + renderInline(inner[:end]) + "</" + tag + ">")
+				i += 2*len(delim) + end
+				continue
+			}
+
+		case c == '[':
+			if text, href, n, ok := mdLink(s[i:]); ok {
+				if u, err := url.Parse(href); err == nil && mdURLSafe[u.Scheme] {
+					b.WriteString(`<a href="` + mdReplacer.Replace(href) + `" rel="nofollow noopener">` + renderInline(text) + "</a>")
+				} else {
+					b.WriteString(renderInline(text))
+				}
+				i += n
+				continue
+			}
+		}
+
+		b.WriteString(mdReplacer.Replace(s[i : i+1]))
+		i++
+	}
+
+	return b.String()
+}
+
+// mdWordByte сообщает, является ли байт частью слова: подчёркивание внутри слова
+// не начинает выделение, например в snake_case.
+func mdWordByte(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c >= 0x80
+}
+
+// mdLink разбирает ссылку [text](href) в начале s и возвращает её текст, адрес и длину.
+func mdLink(s string) (text, href string, n int, ok bool) {
+	depth := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '[':
+			depth++
+		case ']':
+			depth--
+			if depth > 0 {
+				continue
+			}
+			if !strings.HasPrefix(s[i+1:], "(") {
+				return "", "", 0, false
+			}
+			end := strings.IndexByte(s[i+2:], ')')
+			if end < 0 {
+				return "", "", 0, false
+			}
+			href = strings.TrimSpace(s[i+2 : i+2+end])
+			if strings.ContainsAny(href, " \n\t") {
+				return "", "", 0, false
+			}
+			return s[1:i], href, i + 3 + end, true
+		}
+	}
+
+	return "", "", 0, false
+}
@@ -0,0 +1,71 @@
+package storage
+
+import "testing"
+
+func TestRenderMarkdown(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{
+			name: "paragraphs",
+			src:  "first\nline\n\nsecond",
+			want: "<p>first\nline</p>\n<p>second</p>\n",
+		},
+		{
+			name: "heading and rule",
+			src:  "## Steps ##\n---",
+			want: "<h2>Steps</h2>\n<hr>\n",
+		},
+		{
+			name: "emphasis and code",
+			src:  "**bold** *em* `a < b` snake_case_name",
+			want: "<p><strong>bold</strong> <em>em</em> <code>a &lt; b</code> snake_case_name</p>\n",
+		},
+		{
+			name: "lists",
+			src:  "- one\n- *two*\n1. first\n2. second",
+			want: "<ul>\n<li>one</li>\n<li><em>two</em></li>\n</ul>\n<ol>\n<li>first</li>\n<li>second</li>\n</ol>\n",
+		},
+		{
+			name: "quote",
+			src:  "> quoted\n> text",
+			want: "<blockquote>\n<p>quoted\ntext</p>\n</blockquote>\n",
+		},
+		{
+			name: "fenced code",
+			src:  "```go\nif a < b {\n```\nafter",
+			want: "<pre><code>if a &lt; b {\n</code></pre>\n<p>after</p>\n",
+		},
+		{
+			name: "link",
+			src:  "see [the *docs*](https://example.com/?a=1&b=2)",
+			want: "<p>see <a href=\"https://example.com/?a=1&amp;b=2\" rel=\"nofollow noopener\">the <em>docs</em></a></p>\n",
+		},
+		{
+			name: "unsafe link",
+			src:  "[click](javascript:alert(1))",
+			want: "<p>click)</p>\n",
+		},
+		{
+			name: "raw html",
+			src:  "<script>alert('x')</script> <img src=x onerror=alert(1)>",
+			want: "<p>&lt;script&gt;alert(&#39;x&#39;)&lt;/script&gt; &lt;img src=x onerror=alert(1)&gt;</p>\n",
+		},
+		{
+			name: "escapes",
+			src:  `\*not em\* \<b\>`,
+			want: "<p>*not em* \\&lt;b&gt;</p>\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := renderMarkdown(tt.src)
+			if got != tt.want {
+				t.Errorf("html:\nwant:\n%q\ngot:\n%q", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"sync"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+)
+
+// Категории ошибок хранилища.
+const (
+	ErrorNotFound   = "not_found"  // объект не найден
+	ErrorValidation = "validation" // запрос отклонён проверкой входных данных или прав
+	ErrorConflict   = "conflict"   // запрос противоречит состоянию данных или ограничению
+	ErrorConnection = "connection" // БД недоступна или соединение прервано
+	ErrorTimeout    = "timeout"    // истекло время выполнения запроса или ожидания блокировки
+	ErrorUnknown    = "unknown"
+)
+
+// Сборщик метрик хранилища, например адаптер к Prometheus.
+type MetricsCollector interface {
+	// CountError вызывается для каждого запроса к БД, завершившегося ошибкой
+	// категории category, после всех повторов по RetryPolicy.
+	CountError(category string)
+}
+
+// WithMetrics включает подсчёт ошибок запросов к БД по категориям ErrorCategory.
+// Отсутствие строки в ответе на запрос одной строки считается ошибкой ErrorNotFound,
+// даже если метод хранилища возвращает для него пустой результат.
+func WithMetrics(m MetricsCollector) Option {
+	return func(o *options) {
+		o.metrics = m
+	}
+}
+
+// Счётчики ошибок по категориям в памяти, реализуют MetricsCollector.
+// Нулевое значение готово к использованию.
+type ErrorCounters struct {
+	mu     sync.Mutex
+	counts map[string]int64
+}
+
+// CountError увеличивает счётчик категории category.
+func (c *ErrorCounters) CountError(category string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.counts == nil {
+		c.counts = make(map[string]int64)
+	}
+	c.counts[category]++
+}
+
+// Counts возвращает копию счётчиков по категориям.
+func (c *ErrorCounters) Counts() map[string]int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	counts := make(map[string]int64, len(c.counts))
+	for category, n := range c.counts {
+		counts[category] = n
+	}
+	return counts
+}
+
+// Ошибки пакета по категориям.
+var errorCategories = map[string][]error{
+	ErrorNotFound: {
+		pgx.ErrNoRows, ErrTaskNotFound, ErrUserNotFound, ErrLabelNotFound, ErrLabelRuleNotFound,
+		ErrEscalationRuleNotFound, ErrFormNotFound, ErrJobNotFound, ErrRevisionNotFound,
+		ErrRotationNotFound, ErrSessionNotFound, ErrShareLinkNotFound, ErrSLAPolicyNotFound,
+		ErrTokenNotFound, ErrTaskNotArchived, ErrNoCurrentTask, ErrPreparedTxNotFound,
+	},
+	ErrorValidation: {
+		ErrNoTasksToAdd, ErrEmptyLabel, ErrSameUser, ErrNoDuplicates, ErrSelfMerge,
+		ErrClosedBeforeOpened, ErrInvalidVisibility, ErrInvalidArchive, ErrInvalidLabelRule,
+		ErrInvalidPattern, ErrInvalidBackup, ErrInvalidDuration, ErrInvalidEscalationRule,
+		ErrInvalidOrder, ErrInvalidCursor, ErrInvalidState, ErrInvalidForm, ErrInvalidFormValue,
+		ErrInvalidField, ErrRequiredField, ErrNoJob, ErrInvalidFlagReason, ErrInvalidModeration,
+		ErrPermissionDenied, ErrInvalidRole, ErrInvalidRotation, ErrInvalidShareLink,
+		ErrInvalidToken, ErrInvalidLocale, ErrInvalidGID, ErrTwoPhaseDisabled,
+	},
+	ErrorConflict: {
+		ErrDuplicateTitle, ErrQuotaExceeded, ErrRateLimited, ErrJobStarted, ErrTaskClosed, ErrReadOnly,
+		ErrTwoPhaseStarted,
+	},
+	ErrorConnection: {
+		ErrStorageUnavailable, io.EOF, io.ErrUnexpectedEOF,
+	},
+	ErrorTimeout: {
+		context.DeadlineExceeded,
+	},
+}
+
+// ErrorCategory возвращает категорию ошибки хранилища для метрик и сопоставления
+// с ответами API, для nil - пустую строку. Кроме ошибок пакета учитываются
+// коды ошибок Postgres и сетевые ошибки.
+func ErrorCategory(err error) string {
+	if err == nil {
+		return ""
+	}
+	for category, errs := range errorCategories {
+		for _, target := range errs {
+			if errors.Is(err, target) {
+				return category
+			}
+		}
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch {
+		// query_canceled по statement_timeout, lock_not_available по lock_timeout
+		case pgErr.Code == "57014" || pgErr.Code == "55P03":
+			return ErrorTimeout
+		// unique_violation, serialization_failure, deadlock_detected
+		case pgErr.Code == "23505" || pgErr.Code == "40001" || pgErr.Code == "40P01":
+			return ErrorConflict
+		// data_exception и прочие нарушения ограничений
+		case pgErr.Code[:2] == "22" || pgErr.Code[:2] == "23":
+			return ErrorValidation
+		// connection_exception, admin_shutdown и другие причины недоступности сервера
+		case pgErr.Code[:2] == "08" || pgErr.Code[:2] == "57":
+			return ErrorConnection
+		}
+		return ErrorUnknown
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		if netErr.Timeout() {
+			return ErrorTimeout
+		}
+		return ErrorConnection
+	}
+
+	return ErrorUnknown
+}
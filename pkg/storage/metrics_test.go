@@ -0,0 +1,55 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+)
+
+func TestErrorCategory(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{"nil", nil, ""},
+		{"no rows", pgx.ErrNoRows, ErrorNotFound},
+		{"wrapped not found", taskError("TaskByID", 1, ErrTaskNotFound), ErrorNotFound},
+		{"required field", fmt.Errorf("%w: %s", ErrRequiredField, FieldTitle), ErrorValidation},
+		{"duplicate title", ErrDuplicateTitle, ErrorConflict},
+		{"unique violation", &pgconn.PgError{Code: "23505"}, ErrorConflict},
+		{"check violation", &pgconn.PgError{Code: "23514"}, ErrorValidation},
+		{"statement timeout", &pgconn.PgError{Code: "57014"}, ErrorTimeout},
+		{"deadline", context.DeadlineExceeded, ErrorTimeout},
+		{"connection failure", &pgconn.PgError{Code: "08006"}, ErrorConnection},
+		{"breaker open", ErrStorageUnavailable, ErrorConnection},
+		{"syntax error", &pgconn.PgError{Code: "42601"}, ErrorUnknown},
+		{"other", fmt.Errorf("boom"), ErrorUnknown},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ErrorCategory(tt.err); got != tt.want {
+				t.Errorf("category: want %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestConn_runMetrics(t *testing.T) {
+	counters := &ErrorCounters{}
+	c := &conn{metrics: counters}
+
+	c.run(context.Background(), "SELECT 1", false, func(context.Context) error { return nil })
+	c.run(context.Background(), "SELECT 1", false, func(context.Context) error { return pgx.ErrNoRows })
+	c.run(context.Background(), "SELECT 1", false, func(context.Context) error {
+		return &pgconn.PgError{Code: "QT001"}
+	})
+
+	got := counters.Counts()
+	if len(got) != 2 || got[ErrorNotFound] != 1 || got[ErrorConflict] != 1 {
+		t.Errorf("counts: want 1 not_found and 1 conflict, got %v", got)
+	}
+}
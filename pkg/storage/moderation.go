@@ -0,0 +1,180 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// Причины жалоб на задачи.
+const (
+	FlagSpam     = "spam"
+	FlagAbuse    = "abuse"
+	FlagOffTopic = "off-topic"
+	FlagOther    = "other"
+)
+
+// Решения модератора по жалобам.
+const (
+	ModerationHide    = "hide"    // задача становится приватной
+	ModerationDelete  = "delete"  // задача удаляется
+	ModerationDismiss = "dismiss" // жалобы отклоняются, задача не меняется
+)
+
+var (
+	ErrInvalidFlagReason = fmt.Errorf("invalid flag reason")
+	ErrInvalidModeration = fmt.Errorf("invalid moderation action")
+	ErrTaskNotFlagged    = fmt.Errorf("task has no pending flags")
+)
+
+// Задача в очереди модерации.
+type FlaggedTask struct {
+	Task         Task
+	Flags        int      // количество нерассмотренных жалоб
+	Reasons      []string // причины жалоб без повторов
+	FirstFlagged int64    // время первой нерассмотренной жалобы
+}
+
+// FlagTask отправляет жалобу пользователя хранилища на доступную ему задачу и возвращает её id.
+// Повторная жалоба того же пользователя до решения модератора заменяет причину и пояснение.
+func (s *Storage) FlagTask(taskID int, reason, note string) (int, error) {
+	err := s.authorizeWrite(RoleViewer)
+	if err != nil {
+		return 0, err
+	}
+
+	switch reason {
+	case FlagSpam, FlagAbuse, FlagOffTopic, FlagOther:
+	default:
+		return 0, ErrInvalidFlagReason
+	}
+
+	ctx := context.Background()
+	var id int
+	err = s.db.QueryRow(ctx, `
+		INSERT INTO task_flags (task_id, reporter_id, reason, note)
+		SELECT id, $3, $4, $5
+		FROM tasks
+		WHERE id = $1 AND tenant_id = $2 AND can_access($3, tasks)
+		ON CONFLICT (task_id, reporter_id) WHERE resolved IS NULL DO UPDATE
+		SET reason = EXCLUDED.reason, note = EXCLUDED.note
+		RETURNING id
+	`,
+		taskID,
+		s.tenantID,
+		s.userID,
+		reason,
+		note,
+	).Scan(&id)
+	if err == pgx.ErrNoRows {
+		return 0, ErrTaskNotFound
+	}
+
+	return id, err
+}
+
+// ModerationQueue возвращает задачи с нерассмотренными жалобами,
+// начиная с задач с наибольшим количеством жалоб.
+func (s *Storage) ModerationQueue() ([]FlaggedTask, error) {
+	err := s.authorize(RoleMaintainer)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+	rows, err := s.db.Query(ctx, `
+		SELECT `+taskColumnsOf("t")+`, count(*), array_agg(DISTINCT f.reason ORDER BY f.reason), min(f.created)
+		FROM tasks AS t
+		JOIN task_flags AS f
+		ON f.task_id = t.id
+		WHERE f.resolved IS NULL AND t.tenant_id = $1
+		GROUP BY t.id
+		ORDER BY count(*) DESC, min(f.created), t.id
+	`,
+		s.tenantID,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return collectRows(rows, func(row pgx.Row) (FlaggedTask, error) {
+		var f FlaggedTask
+		var err error
+		f.Task, err = s.scanTask(row, &f.Flags, &f.Reasons, &f.FirstFlagged)
+		return f, err
+	})
+}
+
+// ResolveFlags применяет к задаче решение модератора action по всем её нерассмотренным жалобам.
+// Решение записывается в журнал аудита вместе с количеством рассмотренных жалоб.
+func (s *Storage) ResolveFlags(taskID int, action string) error {
+	err := s.authorizeWrite(RoleMaintainer)
+	if err != nil {
+		return err
+	}
+
+	switch action {
+	case ModerationHide, ModerationDelete, ModerationDismiss:
+	default:
+		return ErrInvalidModeration
+	}
+
+	ctx := context.Background()
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx, `
+		UPDATE task_flags AS f
+		SET resolved = extract(epoch from now()), resolution = $2
+		FROM tasks AS t
+		WHERE f.task_id = t.id AND f.resolved IS NULL AND t.id = $1 AND t.tenant_id = $3
+	`,
+		taskID,
+		action,
+		s.tenantID,
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrTaskNotFlagged
+	}
+	flags := tag.RowsAffected()
+
+	switch action {
+	case ModerationHide:
+		_, err = tx.Exec(ctx, `
+			UPDATE tasks
+			SET visibility = $2
+			WHERE id = $1
+		`,
+			taskID,
+			VisibilityPrivate,
+		)
+	case ModerationDelete:
+		_, err = tx.Exec(ctx, `
+			DELETE FROM tasks
+			WHERE id = $1
+		`,
+			taskID,
+		)
+	}
+	if err != nil {
+		return err
+	}
+
+	err = s.audit(ctx, tx, AuditTaskModerate, map[string]interface{}{
+		"task_id": taskID,
+		"action":  action,
+		"flags":   flags,
+	})
+	if err != nil {
+		return err
+	}
+
+	return s.commit(ctx, tx)
+}
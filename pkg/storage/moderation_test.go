@@ -0,0 +1,102 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestStorage_ModerationQueue(t *testing.T) {
+	db, err := storageConnect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close(context.Background()) })
+
+	first := db.AsUser(newTestUser(t, db, "First reporter"))
+	second := db.AsUser(newTestUser(t, db, "Second reporter"))
+	spam := newTestTask(t, db, "Cheap watches")
+	offTopic := newTestTask(t, db, "Weather")
+
+	id, err := first.FlagTask(spam, FlagAbuse, "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// повторная жалоба заменяет предыдущую
+	again, err := first.FlagTask(spam, FlagSpam, "ads")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if again != id {
+		t.Errorf("flag id: want %d, got %d", id, again)
+	}
+	for _, f := range []struct {
+		s      *Storage
+		taskID int
+		reason string
+	}{
+		{second, spam, FlagOther},
+		{second, offTopic, FlagOffTopic},
+	} {
+		_, err = f.s.FlagTask(f.taskID, f.reason, "")
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	_, err = first.FlagTask(spam, "boring", "")
+	if !errors.Is(err, ErrInvalidFlagReason) {
+		t.Errorf("error: want %v, got %v", ErrInvalidFlagReason, err)
+	}
+
+	queue, err := db.ModerationQueue()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	got := make(map[int]FlaggedTask)
+	for _, f := range queue {
+		got[f.Task.ID] = f
+	}
+	if f := got[spam]; f.Flags != 2 || len(f.Reasons) != 2 || f.Reasons[0] != FlagOther || f.Reasons[1] != FlagSpam {
+		t.Errorf("spam flags: want 2 with reasons [other spam], got %+v", f)
+	}
+	if f := got[offTopic]; f.Flags != 1 {
+		t.Errorf("off-topic flags: want 1, got %d", f.Flags)
+	}
+	_, err = first.ModerationQueue()
+	if !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("error: want %v, got %v", ErrPermissionDenied, err)
+	}
+
+	err = db.ResolveFlags(spam, ModerationHide)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	ok, err := db.CanAccess(first.userID, spam)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if ok {
+		t.Errorf("hidden task is accessible to reporter")
+	}
+	err = db.ResolveFlags(spam, ModerationDismiss)
+	if !errors.Is(err, ErrTaskNotFlagged) {
+		t.Errorf("error: want %v, got %v", ErrTaskNotFlagged, err)
+	}
+
+	err = db.ResolveFlags(offTopic, ModerationDelete)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	_, err = db.TaskByID(offTopic)
+	if !errors.Is(err, ErrTaskNotFound) {
+		t.Errorf("error: want %v, got %v", ErrTaskNotFound, err)
+	}
+
+	entries, err := db.AuditLog(AuditFilter{Action: AuditTaskModerate})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(entries) < 2 {
+		t.Errorf("audit entries: want at least 2, got %d", len(entries))
+	}
+}
@@ -0,0 +1,86 @@
+package storage
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// Период, за который изменения задач попадают в UserWork.Recent, в секундах.
+const recentActivityWindow = 7 * 24 * 60 * 60
+
+// Задачи для домашней страницы пользователя.
+type UserWork struct {
+	Assigned []Task // открытые задачи, назначенные пользователю
+	Awaiting []Task // открытые задачи пользователя, назначенные другим
+	Recent   []Task // задачи с явным доступом пользователя, изменённые за последнюю неделю
+}
+
+// MyWork возвращает задачи для домашней страницы пользователя userID.
+// Отложенные задачи не возвращаются до окончания срока, см. SnoozeTask.
+// Все списки запрашиваются одним пакетом запросов за одно обращение к серверу.
+func (s *Storage) MyWork(userID int) (UserWork, error) {
+	b := new(pgx.Batch)
+	b.Queue(`
+		SELECT `+taskColumns+`
+		FROM tasks
+		WHERE
+			assigned_id = $1 AND closed = 0 AND NOT snoozed(tasks) AND
+			tenant_id = $2 AND can_access($3, tasks)
+		ORDER BY opened, id
+	`,
+		userID,
+		s.tenantID,
+		s.userID,
+	)
+	b.Queue(`
+		SELECT `+taskColumns+`
+		FROM tasks
+		WHERE
+			author_id = $1 AND assigned_id NOT IN (0, $1) AND closed = 0 AND NOT snoozed(tasks) AND
+			tenant_id = $2 AND can_access($3, tasks)
+		ORDER BY opened, id
+	`,
+		userID,
+		s.tenantID,
+		s.userID,
+	)
+	b.Queue(`
+		SELECT `+taskColumnsOf("t")+`
+		FROM tasks AS t
+		JOIN task_grants AS g
+		ON g.task_id = t.id
+		WHERE
+			g.user_id = $1 AND t.updated >= extract(epoch from now()) - $4 AND NOT snoozed(t) AND
+			t.tenant_id = $2 AND can_access($3, t)
+		ORDER BY t.updated DESC, t.id
+	`,
+		userID,
+		s.tenantID,
+		s.userID,
+		recentActivityWindow,
+	)
+
+	var work UserWork
+	ctx := context.Background()
+	err := s.db.SendBatch(ctx, b, func(br pgx.BatchResults) error {
+		for _, list := range []*[]Task{&work.Assigned, &work.Awaiting, &work.Recent} {
+			rows, err := br.Query()
+			if err != nil {
+				return err
+			}
+			*list, err = collectRows(rows, func(row pgx.Row) (Task, error) {
+				return s.scanTask(row)
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return UserWork{}, err
+	}
+
+	return work, nil
+}
@@ -0,0 +1,68 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestStorage_MyWork(t *testing.T) {
+	db, err := storageConnect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close(context.Background()) })
+
+	tenant := db.ForTenant(1192)
+	userID := newTestUser(t, db, "Home User")
+	otherID := newTestUser(t, db, "Other User")
+
+	assigned := newTestTask(t, tenant, "Assigned")
+	err = tenant.UpdateTask(assigned, userID, 0, "", "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	closed := newTestTask(t, tenant, "Closed")
+	err = tenant.UpdateTask(closed, userID, time.Now().Unix(), "", "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	awaiting := newTestTask(t, tenant, "Awaiting")
+	err = tenant.UpdateTask(awaiting, otherID, 0, "", "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// NewTask не сохраняет автора
+	_, err = db.db.Exec(context.Background(), `UPDATE tasks SET author_id = $1 WHERE id = $2`, userID, awaiting)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	watched := newTestTask(t, tenant, "Watched")
+	err = tenant.GrantAccess(watched, userID)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	work, err := tenant.MyWork(userID)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		tasks []Task
+		want  int
+	}{
+		{"assigned", work.Assigned, assigned},
+		{"awaiting", work.Awaiting, awaiting},
+		{"recent", work.Recent, watched},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if len(tt.tasks) != 1 || tt.tasks[0].ID != tt.want {
+				t.Errorf("tasks: want [%d], got %+v", tt.want, tt.tasks)
+			}
+		})
+	}
+}
@@ -0,0 +1,222 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// Представительный запрос для проверки планов.
+type PlanQuery struct {
+	Name string
+	SQL  string
+	Args []interface{}
+}
+
+// Свойства плана запроса, которые сравниваются с эталоном.
+// Эталон хранится в JSON, например в репозитории рядом с тестами CI.
+type PlanSummary struct {
+	Query    string   `json:"query"`
+	SeqScans []string `json:"seq_scans,omitempty"` // таблицы, которые читаются последовательным сканированием
+	Indexes  []string `json:"indexes,omitempty"`   // индексы, по которым читаются таблицы
+	Rows     float64  `json:"rows"`                // оценка количества строк результата
+}
+
+// Ухудшение плана запроса по сравнению с эталоном.
+type PlanRegression struct {
+	Query  string
+	Reason string
+}
+
+// Узел плана EXPLAIN (FORMAT JSON).
+type planNode struct {
+	NodeType     string     `json:"Node Type"`
+	RelationName string     `json:"Relation Name"`
+	IndexName    string     `json:"Index Name"`
+	PlanRows     float64    `json:"Plan Rows"`
+	Plans        []planNode `json:"Plans"`
+}
+
+// PlanQueries возвращает запросы основных методов чтения задач рабочего пространства
+// для CapturePlans. Тексты запросов повторяют запросы методов, указанных в именах,
+// значения параметров подобраны под тестовые данные db_init/init.sql.
+func (s *Storage) PlanQueries() []PlanQuery {
+	filtered := func(orderBy string) string {
+		return labelSubtreeSQL + `
+			SELECT ` + taskColumnsOf("t") + `
+			FROM tasks AS t
+			WHERE ` + taskFilterSQL + `
+			ORDER BY ` + orderBy + `
+			LIMIT 51`
+	}
+
+	return []PlanQuery{
+		{
+			Name: "TaskByID",
+			SQL: `SELECT ` + taskColumns + `
+				FROM tasks
+				WHERE id = $1 AND tenant_id = $2 AND can_access($3, tasks)`,
+			Args: []interface{}{1, s.tenantID, s.userID},
+		},
+		{
+			Name: "TasksByAuthorID",
+			SQL: `SELECT ` + taskColumns + `
+				FROM tasks
+				WHERE author_id = $1 AND tenant_id = $2 AND can_access($3, tasks)`,
+			Args: []interface{}{1, s.tenantID, s.userID},
+		},
+		{
+			Name: "TasksFiltered",
+			SQL:  filtered("t.id ASC, t.id ASC"),
+			Args: []interface{}{"", s.tenantID, s.userID, 0, 0, ""},
+		},
+		{
+			Name: "TasksFiltered/label",
+			SQL:  filtered("t.id ASC, t.id ASC"),
+			Args: []interface{}{"Bug", s.tenantID, s.userID, 0, 0, ""},
+		},
+		{
+			Name: "TasksFiltered/open by opened",
+			SQL:  filtered("t.opened DESC, t.id DESC"),
+			Args: []interface{}{"", s.tenantID, s.userID, 0, 0, TaskStateOpen},
+		},
+		{
+			Name: "NewTaskWithDuplicates",
+			SQL: `SELECT ` + taskColumns + `, similarity(title, $1)
+				FROM tasks
+				WHERE
+					(lower(title) = lower($1) OR (title % $1 AND similarity(title, $1) >= $2)) AND
+					closed = 0 AND
+					id <> $3 AND
+					tenant_id = $4 AND
+					can_access($5, tasks)
+				ORDER BY 8 DESC, id
+				LIMIT $6`,
+			Args: []interface{}{"Fix login issue", duplicateSimilarity, 0, s.tenantID, s.userID, duplicateCandidates},
+		},
+	}
+}
+
+// CapturePlans строит планы запросов queries без их выполнения (EXPLAIN без ANALYZE)
+// и возвращает их свойства для сравнения с эталоном функцией ComparePlans.
+// Планы зависят от статистики таблиц, поэтому эталон снимается на БД с похожим
+// объёмом данных, например наполненной утилитой loadgen.
+func (s *Storage) CapturePlans(ctx context.Context, queries []PlanQuery) ([]PlanSummary, error) {
+	err := s.authorize(RoleAdmin)
+	if err != nil {
+		return nil, err
+	}
+
+	summaries := make([]PlanSummary, 0, len(queries))
+	for _, q := range queries {
+		var plan string
+		err = s.db.QueryRow(ctx, `EXPLAIN (FORMAT JSON) `+q.SQL, q.Args...).Scan(&plan)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", q.Name, err)
+		}
+		summary, err := summarizePlan(plan)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", q.Name, err)
+		}
+		summary.Query = q.Name
+		summaries = append(summaries, summary)
+	}
+
+	return summaries, nil
+}
+
+// summarizePlan возвращает свойства плана в формате EXPLAIN (FORMAT JSON).
+func summarizePlan(plan string) (PlanSummary, error) {
+	var explained []struct {
+		Plan planNode `json:"Plan"`
+	}
+	err := json.Unmarshal([]byte(plan), &explained)
+	if err != nil {
+		return PlanSummary{}, err
+	}
+	if len(explained) == 0 {
+		return PlanSummary{}, fmt.Errorf("empty plan")
+	}
+
+	seqScans := make(map[string]bool)
+	indexes := make(map[string]bool)
+	var walk func(n planNode)
+	walk = func(n planNode) {
+		if n.NodeType == "Seq Scan" {
+			seqScans[n.RelationName] = true
+		}
+		if n.IndexName != "" {
+			indexes[n.IndexName] = true
+		}
+		for _, child := range n.Plans {
+			walk(child)
+		}
+	}
+	walk(explained[0].Plan)
+
+	return PlanSummary{
+		SeqScans: sortedKeys(seqScans),
+		Indexes:  sortedKeys(indexes),
+		Rows:     explained[0].Plan.PlanRows,
+	}, nil
+}
+
+// sortedKeys возвращает ключи множества по возрастанию, для пустого множества - nil.
+func sortedKeys(set map[string]bool) []string {
+	var keys []string
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// ComparePlans сравнивает свойства планов current с эталоном baseline и возвращает
+// ухудшения: новые последовательные сканирования, неиспользуемые больше индексы
+// и рост оценки количества строк больше чем в maxRowsGrowth раз (0 - не проверять).
+// Запросы без эталона тоже возвращаются, чтобы эталон не забыли обновить.
+func ComparePlans(baseline, current []PlanSummary, maxRowsGrowth float64) []PlanRegression {
+	base := make(map[string]PlanSummary, len(baseline))
+	for _, p := range baseline {
+		base[p.Query] = p
+	}
+
+	var regressions []PlanRegression
+	for _, p := range current {
+		b, ok := base[p.Query]
+		if !ok {
+			regressions = append(regressions, PlanRegression{Query: p.Query, Reason: "no baseline"})
+			continue
+		}
+
+		for _, table := range p.SeqScans {
+			if !contains(b.SeqScans, table) {
+				regressions = append(regressions, PlanRegression{Query: p.Query, Reason: "sequential scan on " + table})
+			}
+		}
+		for _, index := range b.Indexes {
+			if !contains(p.Indexes, index) {
+				regressions = append(regressions, PlanRegression{Query: p.Query, Reason: "index " + index + " is no longer used"})
+			}
+		}
+		if maxRowsGrowth > 0 && p.Rows > max(b.Rows, 1)*maxRowsGrowth {
+			regressions = append(regressions, PlanRegression{
+				Query:  p.Query,
+				Reason: fmt.Sprintf("estimated rows grew from %.0f to %.0f", b.Rows, p.Rows),
+			})
+		}
+	}
+
+	return regressions
+}
+
+// contains сообщает, есть ли строка s в списке list.
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
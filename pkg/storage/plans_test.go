@@ -0,0 +1,97 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestSummarizePlan(t *testing.T) {
+	plan := `[{"Plan": {
+		"Node Type": "Limit", "Plan Rows": 51,
+		"Plans": [{
+			"Node Type": "Nested Loop", "Plan Rows": 120,
+			"Plans": [
+				{"Node Type": "Seq Scan", "Relation Name": "labels", "Plan Rows": 1},
+				{"Node Type": "Index Scan", "Relation Name": "tasks", "Index Name": "tasks_pkey", "Plan Rows": 120},
+				{"Node Type": "Bitmap Index Scan", "Index Name": "tasks_labels_label_id_idx", "Plan Rows": 10}
+			]
+		}]
+	}}]`
+
+	got, err := summarizePlan(plan)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	want := PlanSummary{
+		SeqScans: []string{"labels"},
+		Indexes:  []string{"tasks_labels_label_id_idx", "tasks_pkey"},
+		Rows:     51,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("summary: want %+v, got %+v", want, got)
+	}
+
+	_, err = summarizePlan(`[]`)
+	if err == nil {
+		t.Error("error: want empty plan error, got nil")
+	}
+}
+
+func TestComparePlans(t *testing.T) {
+	baseline := []PlanSummary{
+		{Query: "TaskByID", Indexes: []string{"tasks_pkey"}, Rows: 1},
+		{Query: "TasksFiltered", SeqScans: []string{"labels"}, Indexes: []string{"tasks_pkey"}, Rows: 51},
+	}
+	current := []PlanSummary{
+		{Query: "TaskByID", SeqScans: []string{"tasks"}, Rows: 30},
+		{Query: "TasksFiltered", SeqScans: []string{"labels"}, Indexes: []string{"tasks_pkey"}, Rows: 51},
+		{Query: "TasksSnoozed", Rows: 10},
+	}
+
+	got := ComparePlans(baseline, current, 10)
+	want := []PlanRegression{
+		{Query: "TaskByID", Reason: "sequential scan on tasks"},
+		{Query: "TaskByID", Reason: "index tasks_pkey is no longer used"},
+		{Query: "TaskByID", Reason: "estimated rows grew from 1 to 30"},
+		{Query: "TasksSnoozed", Reason: "no baseline"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("regressions: want %+v, got %+v", want, got)
+	}
+
+	if got := ComparePlans(baseline, baseline, 10); len(got) != 0 {
+		t.Errorf("same plans: want no regressions, got %+v", got)
+	}
+}
+
+func TestStorage_CapturePlans(t *testing.T) {
+	db, err := storageConnect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close(context.Background()) })
+
+	queries := db.PlanQueries()
+	plans, err := db.CapturePlans(context.Background(), queries)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(plans) != len(queries) {
+		t.Fatalf("plans: want %d, got %d", len(queries), len(plans))
+	}
+	for i, p := range plans {
+		if p.Query != queries[i].Name || p.Rows <= 0 {
+			t.Errorf("plan %d: want query %q with estimated rows, got %+v", i, queries[i].Name, p)
+		}
+	}
+	if regressions := ComparePlans(plans, plans, 10); len(regressions) != 0 {
+		t.Errorf("same plans: want no regressions, got %+v", regressions)
+	}
+
+	_, err = db.AsUser(newTestUser(t, db, "Reporter")).CapturePlans(context.Background(), queries)
+	if !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("error: want %v, got %v", ErrPermissionDenied, err)
+	}
+}
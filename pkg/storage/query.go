@@ -0,0 +1,77 @@
+package storage
+
+import (
+	"context"
+	"strings"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// Столбцы задачи в порядке полей, которые сканирует scanTask.
+// При добавлении столбца в Task достаточно изменить taskColumns и scanTask.
+const taskColumns = `id, opened, closed, author_id, assigned_id, title, content`
+
+// taskColumnsOf возвращает столбцы задачи с префиксом псевдонима таблицы.
+func taskColumnsOf(alias string) string {
+	columns := strings.Split(taskColumns, ", ")
+	for i := range columns {
+		columns[i] = alias + "." + columns[i]
+	}
+	return strings.Join(columns, ", ")
+}
+
+// scanTask сканирует строку со столбцами taskColumns, за которыми следуют
+// дополнительные столбцы extra, и расшифровывает содержимое задачи.
+func (s *Storage) scanTask(row pgx.Row, extra ...interface{}) (Task, error) {
+	var t Task
+	var opened, closed int64
+	dest := append([]interface{}{
+		&t.ID,
+		&opened,
+		&closed,
+		&t.AuthorID,
+		&t.AssignedID,
+		&t.Title,
+		&t.Content,
+	}, extra...)
+	err := row.Scan(dest...)
+	if err != nil {
+		return Task{}, err
+	}
+	t.Opened = unixTime(opened)
+	t.Closed = closedTime(closed)
+	t.Content, err = s.decrypt(t.Content)
+	if err != nil {
+		return Task{}, err
+	}
+
+	return t, nil
+}
+
+// queryTasks выполняет запрос, возвращающий столбцы taskColumns, и возвращает список задач.
+func (s *Storage) queryTasks(ctx context.Context, sql string, args ...interface{}) ([]Task, error) {
+	rows, err := s.db.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return collectRows(rows, func(row pgx.Row) (Task, error) {
+		return s.scanTask(row)
+	})
+}
+
+// collectRows сканирует все строки результата функцией scan и закрывает rows.
+func collectRows[T any](rows pgx.Rows, scan func(pgx.Row) (T, error)) ([]T, error) {
+	defer rows.Close()
+
+	var items []T
+	for rows.Next() {
+		item, err := scan(rows)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+
+	return items, rows.Err()
+}
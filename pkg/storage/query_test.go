@@ -0,0 +1,10 @@
+package storage
+
+import "testing"
+
+func TestTaskColumnsOf(t *testing.T) {
+	want := "t.id, t.opened, t.closed, t.author_id, t.assigned_id, t.title, t.content"
+	if got := taskColumnsOf("t"); got != want {
+		t.Errorf("columns: want %q, got %q", want, got)
+	}
+}
@@ -0,0 +1,98 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v4"
+)
+
+var ErrQuotaExceeded = fmt.Errorf("quota exceeded")
+
+// Квоты рабочего пространства, нулевое значение - без ограничения.
+// Квоты мягкие: одновременные изменения могут немного их превысить.
+type Quota struct {
+	MaxOpenTasks int // создание и повторное открытие задач сверх квоты возвращают ErrQuotaExceeded
+}
+
+// Использование квот рабочим пространством.
+type QuotaUsage struct {
+	TenantID     int
+	OpenTasks    int
+	MaxOpenTasks int // 0 - без ограничения
+}
+
+// SetQuota устанавливает квоты рабочего пространства.
+// Уже превышенная квота не закрывает задачи, но запрещает открывать новые.
+// Квоты задаёт оператор, поэтому метод доступен только системному пользователю.
+func (s *Storage) SetQuota(q Quota) error {
+	err := s.authorizeSystemWrite()
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	_, err = s.db.Exec(ctx, `
+		INSERT INTO tenant_quotas (tenant_id, max_open_tasks)
+		VALUES ($1, NULLIF($2, 0))
+		ON CONFLICT (tenant_id) DO UPDATE
+		SET max_open_tasks = EXCLUDED.max_open_tasks
+	`,
+		s.tenantID,
+		q.MaxOpenTasks,
+	)
+
+	return err
+}
+
+// Quota возвращает квоты рабочего пространства.
+func (s *Storage) Quota() (Quota, error) {
+	var q Quota
+	ctx := context.Background()
+	err := s.db.QueryRow(ctx, `
+		SELECT COALESCE(max_open_tasks, 0)
+		FROM tenant_quotas
+		WHERE tenant_id = $1
+	`,
+		s.tenantID,
+	).Scan(&q.MaxOpenTasks)
+	if err == pgx.ErrNoRows {
+		return Quota{}, nil
+	}
+
+	return q, err
+}
+
+// QuotaUsage возвращает использование квот всеми рабочими пространствами,
+// начиная с наиболее близких к исчерпанию квот. Доступен только системному пользователю.
+func (s *Storage) QuotaUsage(ctx context.Context) ([]QuotaUsage, error) {
+	err := s.authorizeSystem()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Query(ctx, `
+		SELECT
+			COALESCE(q.tenant_id, t.tenant_id),
+			COALESCE(t.open_tasks, 0),
+			COALESCE(q.max_open_tasks, 0)
+		FROM tenant_quotas AS q
+		FULL JOIN (
+			SELECT tenant_id, count(*) AS open_tasks
+			FROM tasks
+			WHERE closed = 0
+			GROUP BY tenant_id
+		) AS t
+		ON t.tenant_id = q.tenant_id
+		ORDER BY COALESCE(t.open_tasks, 0)::float / NULLIF(q.max_open_tasks, 0) DESC NULLS LAST, 1
+	`)
+	if err != nil {
+		return nil, err
+	}
+
+	return collectRows(rows, func(row pgx.Row) (QuotaUsage, error) {
+		var u QuotaUsage
+		err := row.Scan(&u.TenantID, &u.OpenTasks, &u.MaxOpenTasks)
+		return u, err
+	})
+}
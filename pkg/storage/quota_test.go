@@ -0,0 +1,92 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+func TestStorage_QuotaSystemOnly(t *testing.T) {
+	s, err := NewWithPool(&pgxpool.Pool{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	admin := s.ForTenant(1205).AsUser(1)
+
+	err = admin.SetQuota(Quota{MaxOpenTasks: 1000})
+	if !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("SetQuota error: want %v, got %v", ErrPermissionDenied, err)
+	}
+	_, err = admin.QuotaUsage(context.Background())
+	if !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("QuotaUsage error: want %v, got %v", ErrPermissionDenied, err)
+	}
+}
+
+func TestStorage_Quota(t *testing.T) {
+	db, err := storageConnect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close(context.Background()) })
+
+	tenant := db.ForTenant(1205)
+	ctx := context.Background()
+	err = tenant.SetQuota(Quota{MaxOpenTasks: 2})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	t.Cleanup(func() { db.db.Exec(ctx, `DELETE FROM tenant_quotas WHERE tenant_id = 1205`) })
+
+	q, err := tenant.Quota()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if q.MaxOpenTasks != 2 {
+		t.Errorf("max open tasks: want 2, got %d", q.MaxOpenTasks)
+	}
+
+	first := newTestTask(t, tenant, "First")
+	newTestTask(t, tenant, "Second")
+	_, err = tenant.NewTask(Task{Title: "Third"})
+	if !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("error: want %v, got %v", ErrQuotaExceeded, err)
+	}
+	err = tenant.NewTasks([]Task{{Title: "Third"}})
+	if !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("error: want %v, got %v", ErrQuotaExceeded, err)
+	}
+
+	usage, err := db.QuotaUsage(ctx)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var found bool
+	for _, u := range usage {
+		if u.TenantID == 1205 {
+			found = true
+			if u.OpenTasks != 2 || u.MaxOpenTasks != 2 {
+				t.Errorf("usage: want 2 of 2, got %+v", u)
+			}
+		}
+	}
+	if !found {
+		t.Errorf("usage: tenant 1205 not found")
+	}
+
+	// выполненная задача освобождает место
+	err = tenant.UpdateTask(first, 0, time.Now().Unix(), "", "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	newTestTask(t, tenant, "Third")
+
+	err = tenant.SetQuota(Quota{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	newTestTask(t, tenant, "Unlimited")
+}
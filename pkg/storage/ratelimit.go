@@ -0,0 +1,130 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+)
+
+var ErrRateLimited = fmt.Errorf("rate limit exceeded")
+
+// Ограничение частоты запросов: ведро ёмкостью Burst запросов,
+// которое пополняется со скоростью Rate запросов в секунду.
+type RateLimit struct {
+	Rate  float64
+	Burst int
+}
+
+// Allow списывает один запрос пользователя из ведра ограничения key.
+// Состояние ведра хранится в БД, поэтому ограничение сохраняется при перезапуске
+// и действует для всех экземпляров API. Если запросов не осталось, возвращает
+// ErrRateLimited и время, через которое запрос будет разрешён.
+func (s *Storage) Allow(ctx context.Context, userID int, key string, limit RateLimit) (time.Duration, error) {
+	if s.db.readOnly {
+		return 0, ErrReadOnly
+	}
+
+	ok, err := s.takeToken(ctx, userID, key, limit)
+	if err != nil || ok {
+		return 0, err
+	}
+
+	// первый запрос пользователя создаёт полное ведро
+	tag, err := s.db.Exec(ctx, `
+		INSERT INTO rate_limits (tenant_id, user_id, key, tokens, updated)
+		VALUES ($1, $2, $3, $4, extract(epoch from clock_timestamp()))
+		ON CONFLICT DO NOTHING
+	`,
+		s.tenantID,
+		userID,
+		key,
+		float64(limit.Burst-1),
+	)
+	if err != nil {
+		return 0, err
+	}
+	if tag.RowsAffected() == 1 && limit.Burst >= 1 {
+		return 0, nil
+	}
+	if tag.RowsAffected() == 0 {
+		// ведро могли создать одновременным запросом
+		ok, err = s.takeToken(ctx, userID, key, limit)
+		if err != nil || ok {
+			return 0, err
+		}
+	}
+
+	var tokens float64
+	err = s.db.QueryRow(ctx, `
+		SELECT LEAST($4, tokens + (extract(epoch from clock_timestamp()) - updated) * $5)
+		FROM rate_limits
+		WHERE tenant_id = $1 AND user_id = $2 AND key = $3
+	`,
+		s.tenantID,
+		userID,
+		key,
+		float64(limit.Burst),
+		limit.Rate,
+	).Scan(&tokens)
+	if err != nil {
+		return 0, err
+	}
+
+	return retryAfter(tokens, limit.Rate), ErrRateLimited
+}
+
+// takeToken списывает запрос из ведра, если после пополнения в нём есть хотя бы один запрос.
+// Строка ведра блокируется, поэтому одновременные запросы не списывают один запрос дважды.
+func (s *Storage) takeToken(ctx context.Context, userID int, key string, limit RateLimit) (bool, error) {
+	tag, err := s.db.Exec(ctx, `
+		UPDATE rate_limits
+		SET
+			tokens = LEAST($4, tokens + (extract(epoch from clock_timestamp()) - updated) * $5) - 1,
+			updated = extract(epoch from clock_timestamp())
+		WHERE
+			tenant_id = $1 AND user_id = $2 AND key = $3 AND
+			LEAST($4, tokens + (extract(epoch from clock_timestamp()) - updated) * $5) >= 1
+	`,
+		s.tenantID,
+		userID,
+		key,
+		float64(limit.Burst),
+		limit.Rate,
+	)
+	if err != nil {
+		return false, err
+	}
+
+	return tag.RowsAffected() == 1, nil
+}
+
+// retryAfter возвращает время пополнения ведра с tokens запросами до одного запроса.
+func retryAfter(tokens, rate float64) time.Duration {
+	if tokens >= 1 {
+		return 0
+	}
+	if rate <= 0 {
+		return time.Duration(math.MaxInt64)
+	}
+	return time.Duration(math.Ceil((1 - tokens) / rate * float64(time.Second)))
+}
+
+// ResetRateLimit удаляет состояние ограничения key пользователя, восстанавливая полное ведро.
+func (s *Storage) ResetRateLimit(ctx context.Context, userID int, key string) error {
+	err := s.authorizeWrite(RoleAdmin)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.Exec(ctx, `
+		DELETE FROM rate_limits
+		WHERE tenant_id = $1 AND user_id = $2 AND key = $3
+	`,
+		s.tenantID,
+		userID,
+		key,
+	)
+
+	return err
+}
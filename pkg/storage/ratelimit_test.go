@@ -0,0 +1,73 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestRetryAfter(t *testing.T) {
+	tests := []struct {
+		name   string
+		tokens float64
+		rate   float64
+		want   time.Duration
+	}{
+		{name: "available", tokens: 1.5, rate: 1, want: 0},
+		{name: "empty", tokens: 0, rate: 2, want: 500 * time.Millisecond},
+		{name: "partial", tokens: 0.75, rate: 0.5, want: 500 * time.Millisecond},
+		{name: "no refill", tokens: 0, rate: 0, want: time.Duration(math.MaxInt64)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := retryAfter(tt.tokens, tt.rate)
+			if got != tt.want {
+				t.Errorf("retry after: want %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestStorage_Allow(t *testing.T) {
+	db, err := storageConnect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close(context.Background()) })
+
+	userID := newTestUser(t, db, "Busy User")
+	ctx := context.Background()
+	limit := RateLimit{Rate: 0.1, Burst: 3}
+
+	for i := 0; i < limit.Burst; i++ {
+		_, err = db.Allow(ctx, userID, "api", limit)
+		if err != nil {
+			t.Fatalf("request %d: Unexpected error: %v", i, err)
+		}
+	}
+	wait, err := db.Allow(ctx, userID, "api", limit)
+	if !errors.Is(err, ErrRateLimited) {
+		t.Fatalf("error: want %v, got %v", ErrRateLimited, err)
+	}
+	if wait <= 0 || wait > 10*time.Second {
+		t.Errorf("retry after: want (0, 10s], got %v", wait)
+	}
+
+	// ограничения с разными названиями независимы
+	_, err = db.Allow(ctx, userID, "search", limit)
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	err = db.ResetRateLimit(ctx, userID, "api")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	_, err = db.Allow(ctx, userID, "api", limit)
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
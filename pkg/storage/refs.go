@@ -0,0 +1,89 @@
+package storage
+
+import (
+	"context"
+	"regexp"
+	"strconv"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// Ссылка на задачу в сообщении коммита или описании запроса на слияние.
+type TaskRef struct {
+	TaskID int
+	Closes bool // ссылке предшествует ключевое слово закрытия, например "fixes #12"
+}
+
+// Ссылка вида #12, перед которой может стоять ключевое слово закрытия.
+var taskRefRe = regexp.MustCompile(`(?i)(?:\b(close[sd]?|fix(?:e[sd])?|resolve[sd]?):?\s+)?#(\d+)\b`)
+
+// ParseTaskRefs находит в тексте ссылки на задачи в порядке их первого упоминания.
+// Ссылка закрывает задачу, если хотя бы одному её упоминанию предшествует ключевое слово
+// close, fix или resolve в любой форме.
+func ParseTaskRefs(text string) []TaskRef {
+	var refs []TaskRef
+	index := make(map[int]int)
+	for _, m := range taskRefRe.FindAllStringSubmatch(text, -1) {
+		id, err := strconv.Atoi(m[2])
+		if err != nil || id == 0 {
+			continue
+		}
+		closes := m[1] != ""
+		if i, ok := index[id]; ok {
+			refs[i].Closes = refs[i].Closes || closes
+			continue
+		}
+		index[id] = len(refs)
+		refs = append(refs, TaskRef{TaskID: id, Closes: closes})
+	}
+	return refs
+}
+
+// CloseReferencedTasks закрывает открытые задачи, которые закрывает текст коммита
+// или запроса на слияние, указывая время закрытия closed. Если closed раньше
+// создания какой-либо из задач, задачи не закрываются и возвращается ErrClosedBeforeOpened.
+// Возвращает ID закрытых задач.
+func (s *Storage) CloseReferencedTasks(text string, closed int64) ([]int, error) {
+	err := s.authorizeWrite(RoleReporter)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []int
+	for _, ref := range ParseTaskRefs(text) {
+		if ref.Closes {
+			ids = append(ids, ref.TaskID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	ctx := context.Background()
+	rows, err := s.db.Query(ctx, `
+		UPDATE tasks
+		SET closed = $2
+		WHERE id = ANY($1) AND tenant_id = $3 AND COALESCE(closed, 0) = 0 AND can_access($4, tasks)
+		RETURNING id
+	`,
+		ids,
+		closed,
+		s.tenantID,
+		s.userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	closedIDs, err := collectRows(rows, func(row pgx.Row) (int, error) {
+		var id int
+		err := row.Scan(&id)
+		return id, err
+	})
+	// ошибка ограничения UPDATE ... RETURNING приходит при чтении строк
+	if closedBeforeOpened(err) {
+		return nil, ErrClosedBeforeOpened
+	}
+
+	return closedIDs, err
+}
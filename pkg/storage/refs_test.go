@@ -0,0 +1,87 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestParseTaskRefs(t *testing.T) {
+	tests := []struct {
+		text string
+		want []TaskRef
+	}{
+		{text: "Refactor storage", want: nil},
+		{text: "Update docs, see #12", want: []TaskRef{{TaskID: 12}}},
+		{text: "Fixes #3", want: []TaskRef{{TaskID: 3, Closes: true}}},
+		{
+			text: "resolved: #4, closes #5 and touches #6",
+			want: []TaskRef{{TaskID: 4, Closes: true}, {TaskID: 5, Closes: true}, {TaskID: 6}},
+		},
+		{text: "See #7\n\nFix #7", want: []TaskRef{{TaskID: 7, Closes: true}}},
+		{text: "prefix #0 and #12a", want: nil},
+		{text: "fixup #8", want: []TaskRef{{TaskID: 8}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			got := ParseTaskRefs(tt.text)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("refs: want %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestStorage_CloseReferencedTasks(t *testing.T) {
+	db, err := storageConnect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close(context.Background()) })
+
+	tenant := db.ForTenant(1182)
+	fixed := newTestTask(t, tenant, "Fixed")
+	mentioned := newTestTask(t, tenant, "Mentioned")
+
+	text := "Fix search\n\nFixes #" + strconv.Itoa(fixed) + ", see #" + strconv.Itoa(mentioned)
+	now := time.Now().Unix()
+	_, err = tenant.CloseReferencedTasks(text, 1700000000)
+	if !errors.Is(err, ErrClosedBeforeOpened) {
+		t.Errorf("error: want %v, got %v", ErrClosedBeforeOpened, err)
+	}
+	closed, err := tenant.CloseReferencedTasks(text, now)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(closed, []int{fixed}) {
+		t.Errorf("closed: want %v, got %v", []int{fixed}, closed)
+	}
+
+	task, err := tenant.TaskByID(fixed)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if task.ClosedUnix() != now {
+		t.Errorf("closed: want %d, got %d", now, task.ClosedUnix())
+	}
+	task, err = tenant.TaskByID(mentioned)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if task.Closed != nil {
+		t.Errorf("mentioned task closed: %v", task.Closed)
+	}
+
+	// закрытые задачи повторно не закрываются
+	closed, err = tenant.CloseReferencedTasks(text, now+3600)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(closed) != 0 {
+		t.Errorf("closed: want none, got %v", closed)
+	}
+}
@@ -0,0 +1,65 @@
+package storage
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// RenderTaskHTML возвращает содержимое задачи, отрисованное из Markdown в безопасный HTML.
+// Результат кэшируется до следующего изменения задачи, поэтому клиентам не нужно
+// отрисовывать и очищать содержимое самостоятельно.
+// При включённом шифровании кэш хранится в зашифрованном виде.
+func (s *Storage) RenderTaskHTML(taskID int) (string, error) {
+	ctx := context.Background()
+	var version int
+	var cachedVersion *int
+	var cached *string
+	task, err := s.scanTask(s.db.QueryRow(ctx, `
+		SELECT `+taskColumnsOf("t")+`, t.version, h.version, h.html
+		FROM tasks AS t
+		LEFT JOIN task_html AS h
+		ON h.task_id = t.id
+		WHERE t.id = $1 AND t.tenant_id = $2 AND can_access($3, t)
+	`,
+		taskID,
+		s.tenantID,
+		s.userID,
+	), &version, &cachedVersion, &cached)
+	if err == pgx.ErrNoRows {
+		return "", ErrTaskNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+	if cachedVersion != nil && *cachedVersion == version {
+		return s.decrypt(*cached)
+	}
+
+	html := renderMarkdown(task.Content)
+	if s.db.readOnly {
+		return html, nil
+	}
+
+	stored, err := s.encrypt(html)
+	if err != nil {
+		return "", err
+	}
+	// кэш не заменяется HTML более старой версии, отрисованным одновременным запросом
+	_, err = s.db.Exec(ctx, `
+		INSERT INTO task_html (task_id, version, html)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (task_id) DO UPDATE
+		SET version = EXCLUDED.version, html = EXCLUDED.html
+		WHERE task_html.version < EXCLUDED.version
+	`,
+		taskID,
+		version,
+		stored,
+	)
+	if err != nil {
+		return "", err
+	}
+
+	return html, nil
+}
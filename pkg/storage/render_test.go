@@ -0,0 +1,55 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestStorage_RenderTaskHTML(t *testing.T) {
+	db, err := storageConnect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close(context.Background()) })
+
+	taskID := newTestTask(t, db, "Rendered")
+	err = db.UpdateTask(taskID, 0, 0, "", "**first**")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	html, err := db.RenderTaskHTML(taskID)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if want := "<p><strong>first</strong></p>\n"; html != want {
+		t.Errorf("html: want %q, got %q", want, html)
+	}
+	var cached string
+	err = db.db.QueryRow(context.Background(), `SELECT html FROM task_html WHERE task_id = $1`, taskID).Scan(&cached)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if cached != html {
+		t.Errorf("cached html: want %q, got %q", html, cached)
+	}
+
+	// изменение задачи делает кэш недействительным
+	err = db.UpdateTask(taskID, 0, 0, "", "*second*")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	html, err = db.RenderTaskHTML(taskID)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if want := "<p><em>second</em></p>\n"; html != want {
+		t.Errorf("html: want %q, got %q", want, html)
+	}
+
+	_, err = db.RenderTaskHTML(99999999)
+	if !errors.Is(err, ErrTaskNotFound) {
+		t.Errorf("error: want %v, got %v", ErrTaskNotFound, err)
+	}
+}
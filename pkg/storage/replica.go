@@ -0,0 +1,215 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+var ErrNoReplica = fmt.Errorf("no replica configured")
+
+// Политика чтения с реплики.
+type ReplicaPolicy struct {
+	// наибольшее отставание реплики по времени, при большем запросы на чтение
+	// выполняются на основном сервере; 0 - отставание не проверяется
+	MaxLag time.Duration
+	// период проверки отставания, 0 - секунда
+	LagCheckInterval time.Duration
+	// время после записи, в течение которого хранилище читает с основного сервера,
+	// чтобы видеть свои изменения, например задачу сразу после NewTask; 0 - не учитывать записи
+	ReadYourWrites time.Duration
+}
+
+// WithReplica направляет запросы на чтение вне транзакций на реплику pool
+// с учётом политики policy. Запросы на изменение, транзакции и пакеты запросов
+// выполняются на основном сервере. Пул остаётся во владении вызывающего
+// и не закрывается методом Close.
+func WithReplica(pool *pgxpool.Pool, policy ReplicaPolicy) Option {
+	return func(o *options) {
+		o.replica = pool
+		o.replicaPolicy = policy
+	}
+}
+
+// Отставание реплики от основного сервера.
+type ReplicaLag struct {
+	Bytes int64         // объём журнала, ещё не применённого репликой
+	Time  time.Duration // время с фиксации последней применённой транзакции, 0 - реплика применила весь полученный журнал
+}
+
+// ReplicaLag возвращает текущее отставание реплики, заданной WithReplica.
+func (s *Storage) ReplicaLag(ctx context.Context) (ReplicaLag, error) {
+	err := s.authorize(RoleAdmin)
+	if err != nil {
+		return ReplicaLag{}, err
+	}
+	if s.db.replica == nil {
+		return ReplicaLag{}, ErrNoReplica
+	}
+
+	return s.db.replica.measure(ctx, s.db.pool)
+}
+
+// WriteScope возвращает хранилище с отдельным учётом записей для ReplicaPolicy.ReadYourWrites.
+// Без него все копии хранилища, полученные ForTenant, AsUser и другими методами,
+// после записи любой из них читают с основного сервера. Подходит для хранилища
+// одного запроса или сеанса пользователя, чтобы записи других сеансов
+// не отключали чтение с реплики.
+func (s *Storage) WriteScope() *Storage {
+	scoped := *s
+	db := *s.db
+	db.writes = new(writeTracker)
+	scoped.db = &db
+	return &scoped
+}
+
+// Реплика для чтения.
+type replica struct {
+	pool    *pgxpool.Pool
+	policy  ReplicaPolicy
+	now     func() time.Time
+	measure func(ctx context.Context, primary *pgxpool.Pool) (ReplicaLag, error)
+
+	mu       sync.Mutex
+	checked  time.Time     // время последней проверки отставания
+	checking bool          // отставание проверяется другим запросом
+	lag      time.Duration // отставание по последней проверке
+	ok       bool          // последняя проверка выполнена без ошибок
+}
+
+func newReplica(pool *pgxpool.Pool, policy ReplicaPolicy) *replica {
+	r := &replica{pool: pool, policy: policy, now: time.Now}
+	r.measure = r.queryLag
+	return r
+}
+
+// queryLag запрашивает отставание реплики от основного сервера primary.
+func (r *replica) queryLag(ctx context.Context, primary *pgxpool.Pool) (ReplicaLag, error) {
+	var lsn string
+	err := primary.QueryRow(ctx, `SELECT pg_current_wal_lsn()::text`).Scan(&lsn)
+	if err != nil {
+		return ReplicaLag{}, err
+	}
+
+	var lag ReplicaLag
+	var seconds float64
+	// время с последней применённой транзакции растёт и без отставания, пока на основном
+	// сервере нет записей, поэтому оно учитывается, только если полученный журнал не применён
+	err = r.pool.QueryRow(ctx, `
+		SELECT
+			COALESCE(pg_wal_lsn_diff($1::pg_lsn, pg_last_wal_replay_lsn()), 0)::bigint,
+			CASE
+				WHEN pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() THEN 0
+				ELSE COALESCE(extract(epoch FROM now() - pg_last_xact_replay_timestamp()), 0)
+			END::float8
+	`,
+		lsn,
+	).Scan(&lag.Bytes, &seconds)
+	if err != nil {
+		return ReplicaLag{}, err
+	}
+	lag.Bytes = max(lag.Bytes, 0)
+	lag.Time = time.Duration(seconds * float64(time.Second))
+
+	return lag, nil
+}
+
+// usable сообщает, можно ли читать с реплики: отставание по последней проверке
+// не больше MaxLag. Устаревшее значение обновляется одним запросом, остальные
+// пока используют предыдущее. Реплика, отставание которой не удалось проверить,
+// не используется до следующей проверки.
+func (r *replica) usable(ctx context.Context, primary *pgxpool.Pool) bool {
+	if r.policy.MaxLag <= 0 {
+		return true
+	}
+	interval := r.policy.LagCheckInterval
+	if interval <= 0 {
+		interval = time.Second
+	}
+
+	r.mu.Lock()
+	check := !r.checking && r.now().Sub(r.checked) >= interval
+	if check {
+		r.checking = true
+	}
+	lag, ok := r.lag, r.ok
+	r.mu.Unlock()
+
+	if check {
+		l, err := r.measure(ctx, primary)
+		r.mu.Lock()
+		r.checking = false
+		r.checked = r.now()
+		r.lag, r.ok = l.Time, err == nil
+		lag, ok = r.lag, r.ok
+		r.mu.Unlock()
+	}
+
+	return ok && lag <= r.policy.MaxLag
+}
+
+// Время последней записи для чтения своих записей.
+type writeTracker struct {
+	last atomic.Int64 // UnixNano, 0 - записей не было
+}
+
+func (w *writeTracker) wrote(t time.Time) {
+	w.last.Store(t.UnixNano())
+}
+
+// recent сообщает, была ли запись не раньше чем за window до t.
+func (w *writeTracker) recent(t time.Time, window time.Duration) bool {
+	last := w.last.Load()
+	return last != 0 && t.UnixNano()-last < int64(window)
+}
+
+// Запросы, которые изменяют данные или должны выполняться на основном сервере:
+// блокировки строк, последовательности, слоты репликации и рекомендательные блокировки.
+var primarySQL = regexp.MustCompile(`(?i)\b(insert|update|delete|merge|for\s+(key\s+)?share|nextval|setval|pg_\w*(logical|replication|advisory)\w*)\b`)
+
+// readQuery сообщает, что запрос только читает данные и может выполняться на реплике.
+// Запросы, в тексте которых встречаются изменяющие команды, в том числе в строках
+// и комментариях, считаются изменяющими.
+func readQuery(sql string) bool {
+	fields := strings.Fields(sql)
+	if len(fields) == 0 {
+		return false
+	}
+	switch strings.ToUpper(fields[0]) {
+	case "SELECT", "WITH":
+		return !primarySQL.MatchString(sql)
+	}
+	return false
+}
+
+// readPool возвращает исполнитель запроса sql вне транзакции: реплику для запросов
+// на чтение, если она задана, не отстаёт и хранилище недавно не писало,
+// иначе основной сервер или транзакцию, к которой привязано подключение.
+func (c *conn) readPool(ctx context.Context, sql string) querier {
+	if c.tx != nil {
+		return c.tx
+	}
+	if c.replica == nil || !readQuery(sql) {
+		return c.pool
+	}
+	if window := c.replica.policy.ReadYourWrites; window > 0 && c.writes.recent(c.replica.now(), window) {
+		return c.pool
+	}
+	if !c.replica.usable(ctx, c.pool) {
+		return c.pool
+	}
+	return c.replica.pool
+}
+
+// wrote отмечает запись для чтения своих записей.
+func (c *conn) wrote() {
+	if c.replica != nil {
+		c.writes.wrote(c.replica.now())
+	}
+}
@@ -0,0 +1,174 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+func TestReadQuery(t *testing.T) {
+	tests := []struct {
+		sql  string
+		want bool
+	}{
+		{"SELECT id FROM tasks WHERE id = $1", true},
+		{"\n\t\tselect count(*) FROM tasks", true},
+		{"WITH RECURSIVE sub AS (SELECT id FROM labels) SELECT * FROM sub", true},
+		{"SELECT id, updated_at FROM deleted_tasks", true},
+		{"INSERT INTO tasks (title) VALUES ($1) RETURNING id", false},
+		{"WITH moved AS (DELETE FROM tasks RETURNING *) SELECT count(*) FROM moved", false},
+		{"SELECT id FROM tasks WHERE id = $1 FOR UPDATE", false},
+		{"SELECT id FROM tasks FOR KEY SHARE", false},
+		{"SELECT array_agg(nextval('tasks_id_seq')) FROM generate_series(1, $1)", false},
+		{"SELECT data FROM pg_logical_slot_peek_changes($1, NULL, NULL)", false},
+		{"SELECT pg_try_advisory_lock(1)", false},
+		{"EXPLAIN SELECT 1", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		if got := readQuery(tt.sql); got != tt.want {
+			t.Errorf("readQuery(%q): want %v, got %v", tt.sql, tt.want, got)
+		}
+	}
+}
+
+func TestReplica_usable(t *testing.T) {
+	now := time.Unix(0, 0)
+	r := newReplica(&pgxpool.Pool{}, ReplicaPolicy{MaxLag: time.Second, LagCheckInterval: 10 * time.Second})
+	r.now = func() time.Time { return now }
+	var lag time.Duration
+	var lagErr error
+	checks := 0
+	r.measure = func(context.Context, *pgxpool.Pool) (ReplicaLag, error) {
+		checks++
+		return ReplicaLag{Time: lag}, lagErr
+	}
+	ctx := context.Background()
+
+	if !r.usable(ctx, nil) {
+		t.Error("no lag: want usable")
+	}
+	lag = 5 * time.Second
+	if !r.usable(ctx, nil) {
+		t.Error("before next check: want usable")
+	}
+	if checks != 1 {
+		t.Errorf("checks: want 1, got %d", checks)
+	}
+
+	now = now.Add(10 * time.Second)
+	if r.usable(ctx, nil) {
+		t.Error("lag above MaxLag: want not usable")
+	}
+
+	now = now.Add(10 * time.Second)
+	lag, lagErr = 0, errors.New("connection refused")
+	if r.usable(ctx, nil) {
+		t.Error("failed check: want not usable")
+	}
+	if checks != 3 {
+		t.Errorf("checks: want 3, got %d", checks)
+	}
+
+	r = newReplica(&pgxpool.Pool{}, ReplicaPolicy{})
+	r.measure = func(context.Context, *pgxpool.Pool) (ReplicaLag, error) {
+		t.Error("lag checked without MaxLag")
+		return ReplicaLag{}, nil
+	}
+	if !r.usable(ctx, nil) {
+		t.Error("without MaxLag: want usable")
+	}
+}
+
+func TestConn_readPool(t *testing.T) {
+	now := time.Unix(1000, 0)
+	primary, replicaPool := &pgxpool.Pool{}, &pgxpool.Pool{}
+	s, err := NewWithPool(primary, WithReplica(replicaPool, ReplicaPolicy{ReadYourWrites: 5 * time.Second}))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	s.db.replica.now = func() time.Time { return now }
+	ctx := context.Background()
+	read := "SELECT id FROM tasks WHERE id = $1"
+
+	if got := s.db.readPool(ctx, read); got != replicaPool {
+		t.Error("read: want replica")
+	}
+	if got := s.db.readPool(ctx, "UPDATE tasks SET title = $1"); got != primary {
+		t.Error("write: want primary")
+	}
+
+	// запись одной копии хранилища видна всем копиям без WriteScope
+	scope := s.ForTenant(1243).WriteScope()
+	s.ForTenant(1243).db.wrote()
+	if got := s.db.readPool(ctx, read); got != primary {
+		t.Error("read after write: want primary")
+	}
+	if got := scope.db.readPool(ctx, read); got != replicaPool {
+		t.Error("read in another write scope: want replica")
+	}
+
+	now = now.Add(5 * time.Second)
+	if got := s.db.readPool(ctx, read); got != replicaPool {
+		t.Error("read after window: want replica")
+	}
+
+	scope.db.wrote()
+	if got := scope.db.readPool(ctx, read); got != primary {
+		t.Error("read after write in scope: want primary")
+	}
+	if got := s.db.readPool(ctx, read); got != replicaPool {
+		t.Error("read outside scope: want replica")
+	}
+
+	s, err = NewWithPool(primary)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	_, err = s.ReplicaLag(ctx)
+	if err != ErrNoReplica {
+		t.Errorf("error: want %v, got %v", ErrNoReplica, err)
+	}
+}
+
+func TestStorage_ReplicaLag(t *testing.T) {
+	db, err := storageConnect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close(context.Background()) })
+
+	// основной сервер вместо реплики: отставания нет
+	s, err := NewWithPool(db.db.pool, WithReplica(db.db.pool, ReplicaPolicy{
+		MaxLag:         time.Second,
+		ReadYourWrites: time.Second,
+	}))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	tenant := s.ForTenant(1243)
+
+	lag, err := tenant.ReplicaLag(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if lag != (ReplicaLag{}) {
+		t.Errorf("lag: want zero, got %+v", lag)
+	}
+
+	id, err := tenant.NewTask(Task{Title: "Read your writes"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	task, err := tenant.TaskByID(id)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if task.Title != "Read your writes" {
+		t.Errorf("title: want %q, got %q", "Read your writes", task.Title)
+	}
+}
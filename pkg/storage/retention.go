@@ -0,0 +1,280 @@
+package storage
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// Правила хранения задач рабочего пространства, нулевой срок отключает правило.
+// Сроки округляются до секунды.
+type RetentionPolicy struct {
+	ArchiveAfter time.Duration // срок после выполнения задачи до переноса в архив
+	// срок хранения записей об удалённых задачах, по которым клиенты синхронизации
+	// узнают об удалении; клиент, не синхронизировавшийся дольше, удаления не увидит
+	PurgeDeletedAfter time.Duration
+}
+
+// Действия правил хранения в одном рабочем пространстве.
+type RetentionAction struct {
+	TenantID int
+	Archived []int // id задач, перенесённых в архив
+	Purged   int   // количество удалённых записей об удалённых задачах
+}
+
+// Результат применения правил хранения.
+type RetentionReport struct {
+	Key     string            // ключ архива, пустой в режиме предпросмотра и без задач для переноса
+	Actions []RetentionAction // по рабочим пространствам, затронутым запуском
+}
+
+// SetRetentionPolicy заменяет правила хранения задач рабочего пространства.
+func (s *Storage) SetRetentionPolicy(p RetentionPolicy) error {
+	err := s.authorizeWrite(RoleMaintainer)
+	if err != nil {
+		return err
+	}
+	if p.ArchiveAfter < 0 || p.PurgeDeletedAfter < 0 {
+		return ErrInvalidDuration
+	}
+
+	ctx := context.Background()
+	_, err = s.db.Exec(ctx, `
+		INSERT INTO retention_policies (tenant_id, archive_after, purge_deleted_after)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (tenant_id) DO UPDATE
+		SET
+			archive_after = EXCLUDED.archive_after,
+			purge_deleted_after = EXCLUDED.purge_deleted_after
+	`,
+		s.tenantID,
+		int64(p.ArchiveAfter/time.Second),
+		int64(p.PurgeDeletedAfter/time.Second),
+	)
+
+	return err
+}
+
+// RetentionPolicy возвращает правила хранения задач рабочего пространства,
+// для рабочего пространства без правил - пустые.
+func (s *Storage) RetentionPolicy() (RetentionPolicy, error) {
+	var archiveAfter, purgeAfter int64
+	ctx := context.Background()
+	err := s.db.QueryRow(ctx, `
+		SELECT archive_after, purge_deleted_after
+		FROM retention_policies
+		WHERE tenant_id = $1
+	`,
+		s.tenantID,
+	).Scan(&archiveAfter, &purgeAfter)
+	if err == pgx.ErrNoRows {
+		return RetentionPolicy{}, nil
+	}
+
+	return RetentionPolicy{
+		ArchiveAfter:      time.Duration(archiveAfter) * time.Second,
+		PurgeDeletedAfter: time.Duration(purgeAfter) * time.Second,
+	}, err
+}
+
+// Записи об удалённых задачах d, срок хранения которых по правилам p истёк.
+const retentionPurgeSQL = `
+	FROM deleted_tasks AS d
+	JOIN retention_policies AS p
+	ON p.tenant_id = d.tenant_id
+	WHERE p.purge_deleted_after > 0 AND d.deleted < extract(epoch from now()) - p.purge_deleted_after`
+
+// ApplyRetention применяет правила хранения всех рабочих пространств: переносит
+// до limit выполненных задач в один архив в хранилище store, как ArchiveClosedTasks,
+// и удаляет записи об удалённых задачах с истёкшим сроком хранения.
+// В режиме предпросмотра preview ничего не меняется, а возвращаются действия,
+// которые выполнил бы запуск в тот же момент. Рассчитан на запуск по расписанию.
+// Доступен только системному пользователю.
+func (s *Storage) ApplyRetention(ctx context.Context, store ObjectStore, prefix string, limit int, preview bool) (RetentionReport, error) {
+	if preview {
+		err := s.authorizeSystem()
+		if err != nil {
+			return RetentionReport{}, err
+		}
+		return s.applyRetention(ctx, store, prefix, limit, true)
+	}
+
+	err := s.authorizeSystemWrite()
+	if err != nil {
+		return RetentionReport{}, err
+	}
+	err = s.startJob(ctx, JobRetention, 0)
+	if err != nil {
+		return RetentionReport{}, err
+	}
+
+	report, err := s.applyRetention(ctx, store, prefix, limit, false)
+	return report, s.finishJob(ctx, err)
+}
+
+// applyRetention применяет правила хранения или, с preview, возвращает их действия для ApplyRetention.
+func (s *Storage) applyRetention(ctx context.Context, store ObjectStore, prefix string, limit int, preview bool) (RetentionReport, error) {
+	// задачи выбираются и выгружаются на снимке данных без блокировок,
+	// как в ArchiveClosedTasks
+	tx, err := s.db.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return RetentionReport{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx, `
+		SELECT t.tenant_id, t.id
+		FROM tasks AS t
+		JOIN retention_policies AS p
+		ON p.tenant_id = t.tenant_id
+		WHERE p.archive_after > 0 AND t.closed <> 0 AND t.closed < extract(epoch from now()) - p.archive_after
+		ORDER BY t.id
+		LIMIT $1
+	`,
+		limit,
+	)
+	if err != nil {
+		return RetentionReport{}, err
+	}
+	archived, err := collectRows(rows, scanTenantPair)
+	if err != nil {
+		return RetentionReport{}, err
+	}
+
+	if preview {
+		rows, err = tx.Query(ctx, `SELECT d.tenant_id, count(*)`+retentionPurgeSQL+` GROUP BY d.tenant_id`)
+		if err != nil {
+			return RetentionReport{}, err
+		}
+		purged, err := collectRows(rows, scanTenantPair)
+		if err != nil {
+			return RetentionReport{}, err
+		}
+		return retentionReport(archived, purged), nil
+	}
+
+	var key string
+	var digests map[int]string
+	if len(archived) > 0 {
+		ids := make([]int, len(archived))
+		for i, a := range archived {
+			ids[i] = a[1]
+		}
+		key, digests, err = uploadArchive(ctx, tx, store, prefix, ids)
+		if err != nil {
+			return RetentionReport{}, err
+		}
+	}
+	tx.Rollback(ctx)
+
+	report, err := s.removeRetained(ctx, key, archived, digests)
+	if key != "" && (err != nil || report.Key == "") {
+		// архив без задач в БД не нужен, ошибка удаления не важнее ошибки фиксации
+		store.Delete(ctx, key)
+	}
+
+	return report, err
+}
+
+// removeRetained удаляет записи об удалённых задачах с истёкшим сроком хранения
+// и задачи archived, загруженные в архив key с отпечатками digests, для applyRetention.
+// Ключ отчёта пустой, если ни одна задача не удалена.
+func (s *Storage) removeRetained(ctx context.Context, key string, archived [][2]int, digests map[int]string) (RetentionReport, error) {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return RetentionReport{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx, `
+		WITH purged AS (
+			DELETE FROM deleted_tasks
+			WHERE task_id IN (SELECT d.task_id`+retentionPurgeSQL+`)
+			RETURNING tenant_id
+		)
+		SELECT tenant_id, count(*) FROM purged GROUP BY tenant_id
+	`)
+	if err != nil {
+		return RetentionReport{}, err
+	}
+	purged, err := collectRows(rows, scanTenantPair)
+	if err != nil {
+		return RetentionReport{}, err
+	}
+	var purgedTotal int
+	for _, p := range purged {
+		purgedTotal += p[1]
+	}
+	// записи об удалённых задачах уже удалены, осталось удалить задачи
+	err = s.jobProgress(ctx, purgedTotal, purgedTotal+len(archived))
+	if err != nil {
+		return RetentionReport{}, err
+	}
+
+	var removed []int
+	if len(digests) > 0 {
+		removed, err = removeArchived(ctx, tx, key, digests)
+		if err != nil {
+			return RetentionReport{}, err
+		}
+	}
+	kept := make(map[int]bool, len(removed))
+	for _, id := range removed {
+		kept[id] = true
+	}
+	// задачи, изменённые во время загрузки, остаются в БД до следующего запуска
+	var moved [][2]int
+	for _, a := range archived {
+		if kept[a[1]] {
+			moved = append(moved, a)
+		}
+	}
+
+	err = s.commit(ctx, tx)
+	if err != nil {
+		return RetentionReport{}, err
+	}
+	report := retentionReport(moved, purged)
+	if len(moved) > 0 {
+		report.Key = key
+	}
+
+	return report, nil
+}
+
+// retentionReport возвращает отчёт по парам рабочего пространства и id перенесённой задачи
+// archived и парам рабочего пространства и количества удалённых записей purged.
+func retentionReport(archived, purged [][2]int) RetentionReport {
+	actions := make(map[int]*RetentionAction)
+	action := func(tenantID int) *RetentionAction {
+		if actions[tenantID] == nil {
+			actions[tenantID] = &RetentionAction{TenantID: tenantID}
+		}
+		return actions[tenantID]
+	}
+	for _, a := range archived {
+		action(a[0]).Archived = append(action(a[0]).Archived, a[1])
+	}
+	for _, p := range purged {
+		action(p[0]).Purged = p[1]
+	}
+
+	var report RetentionReport
+	for _, a := range actions {
+		report.Actions = append(report.Actions, *a)
+	}
+	sort.Slice(report.Actions, func(i, j int) bool {
+		return report.Actions[i].TenantID < report.Actions[j].TenantID
+	})
+
+	return report
+}
+
+// scanTenantPair сканирует строку из id рабочего пространства и целого значения.
+func scanTenantPair(row pgx.Row) ([2]int, error) {
+	var v [2]int
+	err := row.Scan(&v[0], &v[1])
+	return v, err
+}
@@ -0,0 +1,111 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+func TestStorage_ApplyRetention(t *testing.T) {
+	db, err := storageConnect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close(context.Background()) })
+
+	tenant := db.ForTenant(1229)
+	ctx := context.Background()
+	t.Cleanup(func() { db.db.Exec(ctx, `DELETE FROM retention_policies WHERE tenant_id = 1229`) })
+
+	err = tenant.SetRetentionPolicy(RetentionPolicy{ArchiveAfter: -time.Hour})
+	if !errors.Is(err, ErrInvalidDuration) {
+		t.Errorf("error: want %v, got %v", ErrInvalidDuration, err)
+	}
+	policy := RetentionPolicy{ArchiveAfter: 30 * 24 * time.Hour, PurgeDeletedAfter: 90 * 24 * time.Hour}
+	err = tenant.SetRetentionPolicy(policy)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	got, err := tenant.RetentionPolicy()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got != policy {
+		t.Errorf("policy: want %+v, got %+v", policy, got)
+	}
+
+	old := newTestTask(t, tenant, "Old")
+	recent := newTestTask(t, tenant, "Recent")
+	_, err = db.db.Exec(ctx, `
+		UPDATE tasks
+		SET opened = extract(epoch from now()) - 3600 * 24 * 60, closed = extract(epoch from now()) - 3600 * 24 * 40
+		WHERE id = $1
+	`, old)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	err = tenant.UpdateTask(recent, 0, time.Now().Unix(), "", "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	_, err = db.db.Exec(ctx, `
+		INSERT INTO deleted_tasks (task_id, tenant_id, deleted)
+		VALUES (-1229, 1229, extract(epoch from now()) - 3600 * 24 * 100), (-1230, 1229, extract(epoch from now()))
+	`)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	t.Cleanup(func() { db.db.Exec(ctx, `DELETE FROM deleted_tasks WHERE tenant_id = 1229`) })
+
+	want := RetentionAction{TenantID: 1229, Archived: []int{old}, Purged: 1}
+	store := memStore{}
+	for _, preview := range []bool{true, false} {
+		report, err := db.ApplyRetention(ctx, store, "", 1000, preview)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		var action RetentionAction
+		for _, a := range report.Actions {
+			if a.TenantID == 1229 {
+				action = a
+			}
+		}
+		if len(action.Archived) != 1 || action.Archived[0] != old || action.Purged != want.Purged {
+			t.Errorf("preview %v: want %+v, got %+v", preview, want, action)
+		}
+		if preview && (report.Key != "" || len(store) != 0) {
+			t.Errorf("preview: want no archive, got %q", report.Key)
+		}
+	}
+
+	_, err = tenant.TaskByID(old)
+	if !errors.Is(err, ErrTaskNotFound) {
+		t.Errorf("archived task error: want %v, got %v", ErrTaskNotFound, err)
+	}
+	_, err = tenant.TaskByID(recent)
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	err = tenant.RehydrateTask(ctx, store, old)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func TestStorage_RetentionSystemOnly(t *testing.T) {
+	s, err := NewWithPool(&pgxpool.Pool{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	admin := s.ForTenant(1229).AsUser(1)
+
+	for _, preview := range []bool{true, false} {
+		_, err = admin.ApplyRetention(context.Background(), memStore{}, "", 10, preview)
+		if !errors.Is(err, ErrPermissionDenied) {
+			t.Errorf("preview %v error: want %v, got %v", preview, ErrPermissionDenied, err)
+		}
+	}
+}
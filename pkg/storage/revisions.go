@@ -0,0 +1,198 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v4"
+)
+
+var (
+	ErrRevisionNotFound = fmt.Errorf("revision not found")
+	ErrRevisionMismatch = fmt.Errorf("revisions belong to different tasks")
+)
+
+// Снимок названия и содержимого задачи.
+type Revision struct {
+	ID      int
+	TaskID  int
+	Created int64
+	Title   string
+	Content string
+}
+
+// TaskRevisions возвращает снимки задачи в хронологическом порядке.
+// Снимок сохраняется при создании задачи и при каждом изменении названия или содержимого.
+func (s *Storage) TaskRevisions(taskID int) ([]Revision, error) {
+	ctx := context.Background()
+	rows, err := s.db.Query(ctx, `
+		SELECT
+			r.id,
+			r.task_id,
+			r.created,
+			COALESCE(r.title, ''),
+			COALESCE(r.content, '')
+		FROM task_revisions AS r
+		JOIN tasks AS t
+		ON t.id = r.task_id
+		WHERE r.task_id = $1 AND t.tenant_id = $2 AND can_access($3, t)
+		ORDER BY r.id
+	`,
+		taskID,
+		s.tenantID,
+		s.userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return collectRows(rows, s.scanRevision)
+}
+
+// scanRevision сканирует снимок задачи и расшифровывает его содержимое.
+func (s *Storage) scanRevision(row pgx.Row) (Revision, error) {
+	var r Revision
+	err := row.Scan(
+		&r.ID,
+		&r.TaskID,
+		&r.Created,
+		&r.Title,
+		&r.Content,
+	)
+	if err != nil {
+		return Revision{}, err
+	}
+	r.Content, err = s.decrypt(r.Content)
+
+	return r, err
+}
+
+// revision возвращает снимок задачи по ID.
+func (s *Storage) revision(revisionID int) (Revision, error) {
+	r, err := s.scanRevision(s.db.QueryRow(context.Background(), `
+		SELECT
+			r.id,
+			r.task_id,
+			r.created,
+			COALESCE(r.title, ''),
+			COALESCE(r.content, '')
+		FROM task_revisions AS r
+		JOIN tasks AS t
+		ON t.id = r.task_id
+		WHERE r.id = $1 AND t.tenant_id = $2 AND can_access($3, t)
+	`,
+		revisionID,
+		s.tenantID,
+		s.userID,
+	))
+	if err == pgx.ErrNoRows {
+		return r, ErrRevisionNotFound
+	}
+
+	return r, err
+}
+
+// DiffRevisions возвращает разницу между двумя снимками одной задачи в формате unified diff.
+// Первая строка сравниваемого текста - название задачи, далее через пустую строку - содержимое.
+func (s *Storage) DiffRevisions(a, b int) (string, error) {
+	from, err := s.revision(a)
+	if err != nil {
+		return "", err
+	}
+	to, err := s.revision(b)
+	if err != nil {
+		return "", err
+	}
+	if from.TaskID != to.TaskID {
+		return "", ErrRevisionMismatch
+	}
+
+	return unifiedDiff(
+		fmt.Sprintf("revision %d", from.ID),
+		fmt.Sprintf("revision %d", to.ID),
+		from.Title+"\n\n"+from.Content,
+		to.Title+"\n\n"+to.Content,
+	), nil
+}
+
+// RevertTask восстанавливает название и содержимое задачи из снимка revisionID.
+// Если withLabels, восстанавливаются и метки задачи на момент снимка
+// (метки, удалённые с тех пор, пропускаются).
+// Восстановление и запись в историю выполняются в одной транзакции.
+func (s *Storage) RevertTask(taskID, revisionID int, withLabels bool) error {
+	err := s.authorizeWrite(RoleReporter)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var labelIDs []int
+	err = tx.QueryRow(ctx, `
+		UPDATE tasks AS t
+		SET
+			title = r.title,
+			content = r.content
+		FROM task_revisions AS r
+		WHERE
+			r.id = $2 AND
+			r.task_id = t.id AND
+			t.id = $1 AND
+			t.tenant_id = $3 AND
+			can_access($4, t)
+		RETURNING r.label_ids
+	`,
+		taskID,
+		revisionID,
+		s.tenantID,
+		s.userID,
+	).Scan(&labelIDs)
+	if err == pgx.ErrNoRows {
+		return ErrRevisionNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	if withLabels {
+		_, err = tx.Exec(ctx, `
+			DELETE FROM tasks_labels
+			WHERE task_id = $1
+		`,
+			taskID,
+		)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(ctx, `
+			INSERT INTO tasks_labels (task_id, label_id)
+			SELECT $1, id
+			FROM labels
+			WHERE id = ANY($2)
+		`,
+			taskID,
+			labelIDs,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO task_history (task_id, field, new_value)
+		VALUES ($1, 'revert', $2::integer::text)
+	`,
+		taskID,
+		revisionID,
+	)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
@@ -0,0 +1,144 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+)
+
+func TestStorage_TaskRevisions(t *testing.T) {
+	db, err := storageConnect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close(context.Background()) })
+
+	taskID := newTestTask(t, db, "Draft")
+	otherID := newTestTask(t, db, "Other task")
+	err = db.UpdateTask(taskID, 0, 0, "Final", "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// изменение ответственного не создаёт снимок
+	err = db.UpdateTask(taskID, 1, 0, "", "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	revisions, err := db.TaskRevisions(taskID)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(revisions) != 2 {
+		t.Fatalf("revisions num: want 2, got %d", len(revisions))
+	}
+	if revisions[0].Title != "Draft" || revisions[1].Title != "Final" {
+		t.Errorf("revisions: want Draft, Final, got %+v", revisions)
+	}
+
+	diff, err := db.DiffRevisions(revisions[0].ID, revisions[1].ID)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	want := "--- revision " + strconv.Itoa(revisions[0].ID) + "\n+++ revision " + strconv.Itoa(revisions[1].ID) + "\n" +
+		"@@ -1,3 +1,3 @@\n-Draft\n+Final\n \n Test content\n"
+	if diff != want {
+		t.Errorf("diff:\nwant:\n%s\ngot:\n%s", want, diff)
+	}
+
+	other, err := db.TaskRevisions(otherID)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	_, err = db.DiffRevisions(revisions[0].ID, other[0].ID)
+	if !errors.Is(err, ErrRevisionMismatch) {
+		t.Errorf("error: want %v, got %v", ErrRevisionMismatch, err)
+	}
+	_, err = db.DiffRevisions(revisions[0].ID, 99999999)
+	if !errors.Is(err, ErrRevisionNotFound) {
+		t.Errorf("error: want %v, got %v", ErrRevisionNotFound, err)
+	}
+}
+
+func TestStorage_RevertTask(t *testing.T) {
+	db, err := storageConnect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close(context.Background()) })
+
+	tests := []struct {
+		name        string
+		withLabels  bool
+		wantLabeled bool
+	}{
+		{"title and content only", false, false},
+		{"with labels", true, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			taskID := newTestTask(t, db, "Original title")
+			addTestLabel(t, db, taskID, "Documentation")
+			// снимок с меткой
+			err := db.UpdateTask(taskID, 0, 0, "", "Original content")
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			revisions, err := db.TaskRevisions(taskID)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			original := revisions[len(revisions)-1]
+
+			err = db.UpdateTask(taskID, 0, 0, "Broken title", "Broken content")
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			_, err = db.db.Exec(context.Background(), `DELETE FROM tasks_labels WHERE task_id = $1`, taskID)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			err = db.RevertTask(taskID, original.ID, tt.withLabels)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			task, err := db.TaskByID(taskID)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if task.Title != "Original title" || task.Content != "Original content" {
+				t.Errorf("task: want original title and content, got %+v", task)
+			}
+			tasks, err := db.TasksByLabel("Documentation")
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			labeled := false
+			for _, task := range tasks {
+				if task.ID == taskID {
+					labeled = true
+				}
+			}
+			if labeled != tt.wantLabeled {
+				t.Errorf("task labeled: want %v, got %v", tt.wantLabeled, labeled)
+			}
+			history, err := db.TaskHistory(taskID)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if len(history) == 0 || history[len(history)-1].Field != "revert" {
+				t.Errorf("task history: want revert entry, got %+v", history)
+			}
+		})
+	}
+
+	taskID := newTestTask(t, db, "Task")
+	err = db.RevertTask(taskID, 99999999, false)
+	if !errors.Is(err, ErrRevisionNotFound) {
+		t.Errorf("error: want %v, got %v", ErrRevisionNotFound, err)
+	}
+}
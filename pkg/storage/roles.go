@@ -0,0 +1,149 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// Роли пользователей.
+const (
+	RoleAdmin      = "admin"      // полный доступ, включая управление ролями и токенами
+	RoleMaintainer = "maintainer" // удаление, объединение и переназначение задач
+	RoleReporter   = "reporter"   // создание и изменение задач
+	RoleViewer     = "viewer"     // только чтение
+)
+
+var (
+	ErrPermissionDenied = fmt.Errorf("permission denied")
+	ErrInvalidRole      = fmt.Errorf("invalid role")
+)
+
+// Уровни ролей, роль с большим уровнем включает права ролей с меньшим.
+var roleLevels = map[string]int{
+	RoleViewer:     1,
+	RoleReporter:   2,
+	RoleMaintainer: 3,
+	RoleAdmin:      4,
+}
+
+// authorizeWrite проверяет, что хранилище доступно для записи
+// и у пользователя хранилища есть права роли required.
+func (s *Storage) authorizeWrite(required string) error {
+	if s.db.readOnly {
+		return ErrReadOnly
+	}
+	return s.authorize(required)
+}
+
+// authorizeSystemWrite проверяет, что хранилище доступно для записи
+// и работает от имени системного пользователя.
+func (s *Storage) authorizeSystemWrite() error {
+	if s.db.readOnly {
+		return ErrReadOnly
+	}
+	return s.authorizeSystem()
+}
+
+// authorizeSystem проверяет, что хранилище работает от имени системного пользователя 0.
+// Операции над данными всех рабочих пространств недоступны пользователям рабочих
+// пространств, в том числе администраторам.
+func (s *Storage) authorizeSystem() error {
+	if s.userID != 0 {
+		return ErrPermissionDenied
+	}
+	return nil
+}
+
+// authorize проверяет, что у пользователя хранилища есть права роли required.
+// Системный пользователь 0 имеет все права.
+func (s *Storage) authorize(required string) error {
+	if s.userID == 0 {
+		return nil
+	}
+
+	var role string
+	err := s.db.QueryRow(context.Background(), `
+		SELECT role
+		FROM users
+		WHERE id = $1 AND tenant_id = $2
+	`,
+		s.userID,
+		s.tenantID,
+	).Scan(&role)
+	if err == pgx.ErrNoRows {
+		return ErrPermissionDenied
+	}
+	if err != nil {
+		return err
+	}
+
+	if roleLevels[role] < roleLevels[required] {
+		return ErrPermissionDenied
+	}
+
+	return nil
+}
+
+// UserRole возвращает роль пользователя.
+func (s *Storage) UserRole(userID int) (string, error) {
+	var role string
+	err := s.db.QueryRow(context.Background(), `
+		SELECT role
+		FROM users
+		WHERE id = $1 AND tenant_id = $2
+	`,
+		userID,
+		s.tenantID,
+	).Scan(&role)
+	if err == pgx.ErrNoRows {
+		return "", ErrUserNotFound
+	}
+
+	return role, err
+}
+
+// SetRole назначает пользователю роль.
+func (s *Storage) SetRole(userID int, role string) error {
+	if _, ok := roleLevels[role]; !ok {
+		return ErrInvalidRole
+	}
+	err := s.authorizeWrite(RoleAdmin)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx, `
+		UPDATE users
+		SET role = $2
+		WHERE id = $1 AND tenant_id = $3
+	`,
+		userID,
+		role,
+		s.tenantID,
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrUserNotFound
+	}
+
+	err = s.audit(ctx, tx, AuditRoleChange, map[string]interface{}{
+		"user_id": userID,
+		"role":    role,
+	})
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
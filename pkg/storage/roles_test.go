@@ -0,0 +1,86 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestStorage_Roles(t *testing.T) {
+	db, err := storageConnect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close(context.Background()) })
+
+	userID := newTestUser(t, db, "Role User")
+	taskID := newTestTask(t, db, "Role task")
+	user := db.AsUser(userID)
+
+	role, err := db.UserRole(userID)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if role != RoleReporter {
+		t.Errorf("default role: want %s, got %s", RoleReporter, role)
+	}
+
+	tests := []struct {
+		name         string
+		role         string
+		wantCreate   error
+		wantDelete   error
+		wantSetRoles error
+	}{
+		{"viewer", RoleViewer, ErrPermissionDenied, ErrPermissionDenied, ErrPermissionDenied},
+		{"reporter", RoleReporter, nil, ErrPermissionDenied, ErrPermissionDenied},
+		{"maintainer", RoleMaintainer, nil, nil, ErrPermissionDenied},
+		{"admin", RoleAdmin, nil, nil, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := db.SetRole(userID, tt.role)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			id, err := user.NewTask(Task{Title: "Created by " + tt.role})
+			if !errors.Is(err, tt.wantCreate) {
+				t.Errorf("create error: want %v, got %v", tt.wantCreate, err)
+			}
+			if err == nil {
+				t.Cleanup(func() {
+					err := db.DeleteTask(id)
+					if err != nil {
+						t.Errorf("Can't remove test task: %v", err)
+					}
+				})
+			}
+
+			err = user.DeleteTask(99999)
+			if !errors.Is(err, tt.wantDelete) {
+				t.Errorf("delete error: want %v, got %v", tt.wantDelete, err)
+			}
+
+			err = user.SetRole(userID, tt.role)
+			if !errors.Is(err, tt.wantSetRoles) {
+				t.Errorf("set role error: want %v, got %v", tt.wantSetRoles, err)
+			}
+
+			_, err = user.TaskByID(taskID)
+			if err != nil {
+				t.Errorf("read error: want %v, got %v", nil, err)
+			}
+		})
+	}
+
+	err = db.SetRole(userID, "owner")
+	if !errors.Is(err, ErrInvalidRole) {
+		t.Errorf("error: want %v, got %v", ErrInvalidRole, err)
+	}
+	err = db.SetRole(99999, RoleViewer)
+	if !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("error: want %v, got %v", ErrUserNotFound, err)
+	}
+}
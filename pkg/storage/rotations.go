@@ -0,0 +1,211 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+var (
+	ErrRotationNotFound = fmt.Errorf("rotation not found")
+	ErrInvalidRotation  = fmt.Errorf("rotation shift must be positive")
+	ErrNoOnCall         = fmt.Errorf("nobody is on call")
+)
+
+// График дежурств: участники Members дежурят по очереди сменами длительностью Shift,
+// первая смена начинается в Starts.
+type Rotation struct {
+	ID      int
+	Name    string
+	Starts  time.Time
+	Shift   time.Duration
+	Members []int
+}
+
+// CreateRotation создаёт график дежурств и возвращает его id.
+func (s *Storage) CreateRotation(r Rotation) (int, error) {
+	err := s.authorizeWrite(RoleMaintainer)
+	if err != nil {
+		return 0, err
+	}
+	if r.Shift < time.Second {
+		return 0, ErrInvalidRotation
+	}
+
+	ctx := context.Background()
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	var id int
+	err = tx.QueryRow(ctx, `
+		INSERT INTO rotations (tenant_id, name, starts, shift)
+		VALUES ($1, $2, $3, $4) RETURNING id
+	`,
+		s.tenantID,
+		r.Name,
+		r.Starts.Unix(),
+		int64(r.Shift/time.Second),
+	).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+
+	err = setRotationMembers(ctx, tx, id, r.Members)
+	if err != nil {
+		return 0, err
+	}
+
+	return id, tx.Commit(ctx)
+}
+
+// SetRotationMembers заменяет участников графика дежурств, порядок дежурства задаётся порядком members.
+func (s *Storage) SetRotationMembers(rotationID int, members []int) error {
+	err := s.authorizeWrite(RoleMaintainer)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx, `
+		DELETE FROM rotation_members AS m
+		USING rotations AS r
+		WHERE m.rotation_id = r.id AND r.id = $1 AND r.tenant_id = $2
+	`,
+		rotationID,
+		s.tenantID,
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		var exists bool
+		err = tx.QueryRow(ctx, `
+			SELECT EXISTS (SELECT 1 FROM rotations WHERE id = $1 AND tenant_id = $2)
+		`,
+			rotationID,
+			s.tenantID,
+		).Scan(&exists)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return ErrRotationNotFound
+		}
+	}
+
+	err = setRotationMembers(ctx, tx, rotationID, members)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// setRotationMembers добавляет участников графика в порядке дежурства.
+func setRotationMembers(ctx context.Context, tx pgx.Tx, rotationID int, members []int) error {
+	_, err := tx.Exec(ctx, `
+		INSERT INTO rotation_members (rotation_id, position, user_id)
+		SELECT $1, m.position, m.user_id
+		FROM unnest($2::integer[]) WITH ORDINALITY AS m(user_id, position)
+	`,
+		rotationID,
+		members,
+	)
+
+	return err
+}
+
+// Rotations возвращает графики дежурств рабочего пространства.
+func (s *Storage) Rotations() ([]Rotation, error) {
+	ctx := context.Background()
+	rows, err := s.db.Query(ctx, `
+		SELECT
+			r.id,
+			r.name,
+			r.starts,
+			r.shift,
+			COALESCE(array_agg(m.user_id ORDER BY m.position) FILTER (WHERE m.user_id IS NOT NULL), '{}')
+		FROM rotations AS r
+		LEFT JOIN rotation_members AS m
+		ON m.rotation_id = r.id
+		WHERE r.tenant_id = $1
+		GROUP BY r.id
+		ORDER BY r.id
+	`,
+		s.tenantID,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return collectRows(rows, func(row pgx.Row) (Rotation, error) {
+		var r Rotation
+		var starts, shift int64
+		err := row.Scan(&r.ID, &r.Name, &starts, &shift, &r.Members)
+		r.Starts = unixTime(starts)
+		r.Shift = time.Duration(shift) * time.Second
+		return r, err
+	})
+}
+
+// DeleteRotation удаляет график дежурств вместе с использующими его правилами эскалации.
+func (s *Storage) DeleteRotation(rotationID int) error {
+	err := s.authorizeWrite(RoleMaintainer)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	tag, err := s.db.Exec(ctx, `
+		DELETE FROM rotations
+		WHERE id = $1 AND tenant_id = $2
+	`,
+		rotationID,
+		s.tenantID,
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrRotationNotFound
+	}
+
+	return nil
+}
+
+// CurrentOnCall возвращает ID текущего дежурного графика.
+// Если график ещё не начался или в нём нет участников, возвращает ErrNoOnCall.
+func (s *Storage) CurrentOnCall(rotationID int) (int, error) {
+	ctx := context.Background()
+	var userID *int
+	err := s.db.QueryRow(ctx, `
+		SELECT on_call(id, extract(epoch from now())::bigint)
+		FROM rotations
+		WHERE id = $1 AND tenant_id = $2
+	`,
+		rotationID,
+		s.tenantID,
+	).Scan(&userID)
+	if err == pgx.ErrNoRows {
+		return 0, ErrRotationNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+	if userID == nil {
+		return 0, ErrNoOnCall
+	}
+
+	return *userID, nil
+}
@@ -0,0 +1,78 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestStorage_CurrentOnCall(t *testing.T) {
+	db, err := storageConnect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close(context.Background()) })
+
+	tenant := db.ForTenant(1196)
+	first := newTestUser(t, db, "First On Call")
+	second := newTestUser(t, db, "Second On Call")
+
+	// идёт вторая смена
+	id, err := tenant.CreateRotation(Rotation{
+		Name:    "Support",
+		Starts:  time.Now().Add(-36 * time.Hour),
+		Shift:   24 * time.Hour,
+		Members: []int{first, second},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	t.Cleanup(func() { tenant.DeleteRotation(id) })
+
+	got, err := tenant.CurrentOnCall(id)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got != second {
+		t.Errorf("on call: want %d, got %d", second, got)
+	}
+
+	err = tenant.SetRotationMembers(id, []int{second, first})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	got, err = tenant.CurrentOnCall(id)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got != first {
+		t.Errorf("on call: want %d, got %d", first, got)
+	}
+	rotations, err := tenant.Rotations()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(rotations) != 1 || !reflect.DeepEqual(rotations[0].Members, []int{second, first}) {
+		t.Errorf("rotations: want members %v, got %+v", []int{second, first}, rotations)
+	}
+
+	err = tenant.SetRotationMembers(id, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	_, err = tenant.CurrentOnCall(id)
+	if !errors.Is(err, ErrNoOnCall) {
+		t.Errorf("error: want %v, got %v", ErrNoOnCall, err)
+	}
+
+	_, err = tenant.CurrentOnCall(-1)
+	if !errors.Is(err, ErrRotationNotFound) {
+		t.Errorf("error: want %v, got %v", ErrRotationNotFound, err)
+	}
+	_, err = tenant.CreateRotation(Rotation{Name: "Broken"})
+	if !errors.Is(err, ErrInvalidRotation) {
+		t.Errorf("error: want %v, got %v", ErrInvalidRotation, err)
+	}
+}
@@ -0,0 +1,264 @@
+package storage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Хранилище объектов для резервных копий и архивов.
+type ObjectStore interface {
+	Put(ctx context.Context, key string, body io.ReadSeeker) error
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	List(ctx context.Context, prefix string) ([]string, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// Клиент S3-совместимого хранилища с адресацией бакета в пути (подходит для AWS S3 и MinIO).
+type s3Client struct {
+	endpoint  string
+	region    string
+	bucket    string
+	accessKey string
+	secretKey string
+	http      *http.Client
+}
+
+// NewS3Store возвращает ObjectStore для бакета S3-совместимого хранилища.
+func NewS3Store(endpoint, region, bucket, accessKey, secretKey string) ObjectStore {
+	return &s3Client{
+		endpoint:  strings.TrimSuffix(endpoint, "/"),
+		region:    region,
+		bucket:    bucket,
+		accessKey: accessKey,
+		secretKey: secretKey,
+		http:      http.DefaultClient,
+	}
+}
+
+// Put загружает объект.
+func (c *s3Client) Put(ctx context.Context, key string, body io.ReadSeeker) error {
+	h := sha256.New()
+	size, err := io.Copy(h, body)
+	if err != nil {
+		return err
+	}
+	_, err = body.Seek(0, io.SeekStart)
+	if err != nil {
+		return err
+	}
+
+	req, err := c.request(ctx, http.MethodPut, key, nil, body, hex.EncodeToString(h.Sum(nil)))
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	resp, err := c.do(req)
+	if err != nil {
+		return err
+	}
+
+	return resp.Body.Close()
+}
+
+// Get возвращает содержимое объекта.
+func (c *s3Client) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	req, err := c.request(ctx, http.MethodGet, key, nil, nil, emptySHA256)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.Body, nil
+}
+
+// List возвращает отсортированные ключи объектов с префиксом prefix.
+func (c *s3Client) List(ctx context.Context, prefix string) ([]string, error) {
+	var keys []string
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		req, err := c.request(ctx, http.MethodGet, "", query, nil, emptySHA256)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := c.do(req)
+		if err != nil {
+			return nil, err
+		}
+
+		var result struct {
+			Contents []struct {
+				Key string
+			}
+			IsTruncated           bool
+			NextContinuationToken string
+		}
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		for _, obj := range result.Contents {
+			keys = append(keys, obj.Key)
+		}
+		if !result.IsTruncated {
+			break
+		}
+		token = result.NextContinuationToken
+	}
+	sort.Strings(keys)
+
+	return keys, nil
+}
+
+// Delete удаляет объект.
+func (c *s3Client) Delete(ctx context.Context, key string) error {
+	req, err := c.request(ctx, http.MethodDelete, key, nil, nil, emptySHA256)
+	if err != nil {
+		return err
+	}
+	resp, err := c.do(req)
+	if err != nil {
+		return err
+	}
+
+	return resp.Body.Close()
+}
+
+// SHA-256 пустого тела запроса.
+const emptySHA256 = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// request создаёт подписанный запрос к объекту key бакета.
+func (c *s3Client) request(ctx context.Context, method, key string, query url.Values, body io.Reader, payloadHash string) (*http.Request, error) {
+	u, err := url.Parse(c.endpoint + "/" + c.bucket + "/" + key)
+	if err != nil {
+		return nil, err
+	}
+	u.RawQuery = strings.ReplaceAll(query.Encode(), "+", "%20")
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	signV4(req, payloadHash, c.accessKey, c.secretKey, c.region, "s3", time.Now())
+
+	return req, nil
+}
+
+// do выполняет запрос и возвращает ошибку для ответов с кодом не 2xx.
+func (c *s3Client) do(req *http.Request) (*http.Response, error) {
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		resp.Body.Close()
+		return nil, fmt.Errorf("s3 %s %s: %s: %s", req.Method, req.URL.Path, resp.Status, msg)
+	}
+
+	return resp, nil
+}
+
+// signV4 подписывает запрос по алгоритму AWS Signature Version 4.
+// Подписываются заголовок Host и все заголовки X-Amz-*.
+func signV4(req *http.Request, payloadHash, accessKey, secretKey, region, service string, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		name = strings.ToLower(name)
+		if strings.HasPrefix(name, "x-amz-") {
+			headers[name] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		path,
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+secretKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKey, scope, signedHeaders, signature,
+	))
+}
+
+// canonicalQuery возвращает параметры запроса, отсортированные и закодированные по правилам SigV4.
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var parts []string
+	for _, k := range keys {
+		values := append([]string(nil), query[k]...)
+		sort.Strings(values)
+		for _, v := range values {
+			parts = append(parts, awsEscape(k)+"="+awsEscape(v))
+		}
+	}
+
+	return strings.Join(parts, "&")
+}
+
+// awsEscape кодирует строку, оставляя только незарезервированные символы RFC 3986.
+func awsEscape(s string) string {
+	return strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,117 @@
+package storage
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSignV4(t *testing.T) {
+	// Пример get-vanilla из набора тестов AWS Signature Version 4.
+	req, err := http.NewRequest(http.MethodGet, "https://example.amazonaws.com/", nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	now := time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)
+	signV4(req, emptySHA256, "AKIDEXAMPLE", "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY", "us-east-1", "service", now)
+
+	want := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, " +
+		"SignedHeaders=host;x-amz-date, " +
+		"Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31"
+	if got := req.Header.Get("Authorization"); got != want {
+		t.Errorf("Authorization: want %q, got %q", want, got)
+	}
+}
+
+// Хранилище объектов в памяти.
+type memStore map[string][]byte
+
+func (m memStore) Put(ctx context.Context, key string, body io.ReadSeeker) error {
+	b, err := io.ReadAll(body)
+	m[key] = b
+	return err
+}
+
+func (m memStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	return io.NopCloser(bytes.NewReader(m[key])), nil
+}
+
+func (m memStore) List(ctx context.Context, prefix string) ([]string, error) {
+	var keys []string
+	for k := range m {
+		if strings.HasPrefix(k, prefix) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+func (m memStore) Delete(ctx context.Context, key string) error {
+	delete(m, key)
+	return nil
+}
+
+func TestBackupJob_prune(t *testing.T) {
+	store := memStore{
+		"daily/tasks-20240103T000000Z.jsonl.gz": nil,
+		"daily/tasks-20240101T000000Z.jsonl.gz": nil,
+		"daily/tasks-20240102T000000Z.jsonl.gz": nil,
+		"daily/notes.txt":                       nil,
+		"other/tasks-20230101T000000Z.jsonl.gz": nil,
+	}
+	job := &BackupJob{store: store, prefix: "daily/", keep: 2}
+
+	err := job.prune(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	got, _ := store.List(context.Background(), "")
+	want := []string{
+		"daily/notes.txt",
+		"daily/tasks-20240102T000000Z.jsonl.gz",
+		"daily/tasks-20240103T000000Z.jsonl.gz",
+		"other/tasks-20230101T000000Z.jsonl.gz",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("keys: want %v, got %v", want, got)
+	}
+}
+
+func TestBackupJob_Run(t *testing.T) {
+	db, err := storageConnect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close(context.Background()) })
+
+	store := memStore{}
+	job := &BackupJob{storage: db, store: store, prefix: "daily/", keep: 1}
+	key, err := job.Run(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !strings.HasPrefix(key, "daily/tasks-") {
+		t.Errorf("key: want prefix %q, got %q", "daily/tasks-", key)
+	}
+
+	zr, err := gzip.NewReader(bytes.NewReader(store[key]))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	backup, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !bytes.HasPrefix(backup, []byte(`{"format":"tasks-backup","version":1}`)) {
+		t.Errorf("stored backup doesn't start with a header: %.100s", backup)
+	}
+}
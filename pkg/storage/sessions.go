@@ -0,0 +1,163 @@
+package storage
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+var ErrSessionNotFound = fmt.Errorf("session not found")
+
+// Сессия веб-интерфейса. Секрет сессии в БД не хранится.
+type Session struct {
+	ID       int
+	TenantID int
+	UserID   int
+	Created  int64
+	Expires  int64
+}
+
+// CreateSession создаёт сессию пользователя со сроком действия ttl и возвращает её секрет,
+// который передаётся клиенту, например в cookie. В БД сохраняется хэш секрета.
+// Для пользователя другого рабочего пространства возвращается ErrUserNotFound.
+// Создание сессии записывается в журнал аудита.
+func (s *Storage) CreateSession(ctx context.Context, userID int, ttl time.Duration) (string, Session, error) {
+	err := s.authorizeWrite(RoleAdmin)
+	if err != nil {
+		return "", Session{}, err
+	}
+
+	buf := make([]byte, tokenSize)
+	_, err = rand.Read(buf)
+	if err != nil {
+		return "", Session{}, err
+	}
+	token := hex.EncodeToString(buf)
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return "", Session{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	session, err := scanSession(tx.QueryRow(ctx, `
+		INSERT INTO sessions (tenant_id, user_id, token_hash, expires)
+		SELECT $1, id, $3, extract(epoch from now())::BIGINT + $4
+		FROM users
+		WHERE id = $2 AND tenant_id = $1
+		RETURNING
+			id,
+			tenant_id,
+			user_id,
+			created,
+			expires
+	`,
+		s.tenantID,
+		userID,
+		hashToken(token),
+		int64(ttl/time.Second),
+	))
+	if err == pgx.ErrNoRows {
+		return "", Session{}, ErrUserNotFound
+	}
+	if err != nil {
+		return "", Session{}, err
+	}
+
+	err = s.audit(ctx, tx, AuditSessionCreate, map[string]interface{}{
+		"session_id": session.ID,
+		"user_id":    userID,
+		"expires":    session.Expires,
+	})
+	if err != nil {
+		return "", Session{}, err
+	}
+
+	return token, session, s.commit(ctx, tx)
+}
+
+// GetSession возвращает сессию по секрету.
+// Поиск выполняется по всем рабочим пространствам, чтобы веб-интерфейс
+// мог получить хранилище через ForTenant(session.TenantID).AsUser(session.UserID).
+// Для неизвестных и истёкших сессий возвращает ErrSessionNotFound.
+func (s *Storage) GetSession(ctx context.Context, token string) (Session, error) {
+	session, err := scanSession(s.db.QueryRow(ctx, `
+		SELECT
+			id,
+			tenant_id,
+			user_id,
+			created,
+			expires
+		FROM sessions
+		WHERE token_hash = $1 AND expires > extract(epoch from now())
+	`,
+		hashToken(token),
+	))
+	if err == pgx.ErrNoRows {
+		return Session{}, ErrSessionNotFound
+	}
+
+	return session, err
+}
+
+// scanSession сканирует сессию.
+func scanSession(row pgx.Row) (Session, error) {
+	var session Session
+	err := row.Scan(
+		&session.ID,
+		&session.TenantID,
+		&session.UserID,
+		&session.Created,
+		&session.Expires,
+	)
+
+	return session, err
+}
+
+// DeleteSession удаляет сессию по секрету, например при выходе пользователя.
+func (s *Storage) DeleteSession(ctx context.Context, token string) error {
+	if s.db.readOnly {
+		return ErrReadOnly
+	}
+
+	tag, err := s.db.Exec(ctx, `
+		DELETE FROM sessions
+		WHERE token_hash = $1
+	`,
+		hashToken(token),
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrSessionNotFound
+	}
+
+	return nil
+}
+
+// ExpireSessions удаляет истёкшие сессии рабочего пространства и возвращает их количество.
+// Системный пользователь удаляет истёкшие сессии во всех рабочих пространствах.
+func (s *Storage) ExpireSessions(ctx context.Context) (int, error) {
+	err := s.authorizeWrite(RoleAdmin)
+	if err != nil {
+		return 0, err
+	}
+
+	tag, err := s.db.Exec(ctx, `
+		DELETE FROM sessions
+		WHERE expires <= extract(epoch from now()) AND (tenant_id = $1 OR $2)
+	`,
+		s.tenantID,
+		s.authorizeSystem() == nil,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	return int(tag.RowsAffected()), nil
+}
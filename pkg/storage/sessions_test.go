@@ -0,0 +1,115 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestStorage_Sessions(t *testing.T) {
+	db, err := storageConnect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close(context.Background()) })
+
+	userID := newTestUser(t, db, "Web User")
+	ctx := context.Background()
+
+	token, session, err := db.CreateSession(ctx, userID, time.Hour)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if session.UserID != userID || session.Expires-session.Created != 3600 {
+		t.Errorf("session: want user:%d ttl:3600, got %+v", userID, session)
+	}
+	expiredToken, _, err := db.CreateSession(ctx, userID, -time.Second)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	_, _, err = db.ForTenant(1146).CreateSession(ctx, userID, time.Hour)
+	if !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("error: want %v, got %v", ErrUserNotFound, err)
+	}
+
+	entries, err := db.AuditLog(AuditFilter{Action: AuditSessionCreate})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(entries) < 2 {
+		t.Fatalf("audit log: want at least 2 %s entries, got %d", AuditSessionCreate, len(entries))
+	}
+	var payload struct {
+		SessionID int `json:"session_id"`
+		UserID    int `json:"user_id"`
+	}
+	err = json.Unmarshal(entries[len(entries)-2].Payload, &payload)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if payload.SessionID != session.ID || payload.UserID != userID {
+		t.Errorf("audit payload: want session %d user %d, got %s", session.ID, userID, entries[len(entries)-2].Payload)
+	}
+
+	got, err := db.GetSession(ctx, token)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got != session {
+		t.Errorf("session: want %+v, got %+v", session, got)
+	}
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"unknown session", "not-a-session"},
+		{"expired session", expiredToken},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := db.GetSession(ctx, tt.token)
+			if !errors.Is(err, ErrSessionNotFound) {
+				t.Errorf("error: want %v, got %v", ErrSessionNotFound, err)
+			}
+		})
+	}
+
+	// администратор рабочего пространства не удаляет сессии других рабочих пространств
+	var adminID int
+	err = db.db.QueryRow(ctx, `INSERT INTO users (tenant_id, name, role) VALUES (1185, 'Session admin', 'admin') RETURNING id`).Scan(&adminID)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	t.Cleanup(func() { db.db.Exec(ctx, `DELETE FROM users WHERE id = $1`, adminID) })
+	n, err := db.ForTenant(1185).AsUser(adminID).ExpireSessions(ctx)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if n != 0 {
+		t.Errorf("expired sessions of another tenant: want 0, got %d", n)
+	}
+	n, err = db.ExpireSessions(ctx)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if n < 1 {
+		t.Errorf("expired sessions: want at least 1, got %d", n)
+	}
+	err = db.DeleteSession(ctx, expiredToken)
+	if !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("error: want %v, got %v", ErrSessionNotFound, err)
+	}
+
+	err = db.DeleteSession(ctx, token)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	_, err = db.GetSession(ctx, token)
+	if !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("error: want %v, got %v", ErrSessionNotFound, err)
+	}
+}
@@ -0,0 +1,266 @@
+package storage
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+var (
+	ErrShareLinkNotFound = fmt.Errorf("share link not found")
+	ErrInvalidShareLink  = fmt.Errorf("invalid share link")
+)
+
+// Публичная ссылка на задачу. Секрет ссылки в БД не хранится.
+type ShareLink struct {
+	ID        int
+	TenantID  int
+	TaskID    int
+	CreatedBy int
+	Created   int64
+	Expires   int64
+	Revoked   int64
+}
+
+// Просмотр задачи по публичной ссылке.
+type ShareLinkView struct {
+	Viewed int64
+	Client string
+}
+
+// CreateShareLink создаёт публичную ссылку на задачу и возвращает её id и секрет.
+// Секрет возвращается только один раз, в БД сохраняется его хэш.
+// Создать ссылку можно только на доступную пользователю хранилища задачу.
+// Если expires равен 0, ссылка бессрочная.
+func (s *Storage) CreateShareLink(taskID int, expires int64) (int, string, error) {
+	err := s.authorizeWrite(RoleReporter)
+	if err != nil {
+		return 0, "", err
+	}
+	ok, err := s.CanAccess(s.userID, taskID)
+	if err != nil {
+		return 0, "", err
+	}
+	if !ok {
+		return 0, "", ErrTaskNotFound
+	}
+
+	buf := make([]byte, tokenSize)
+	_, err = rand.Read(buf)
+	if err != nil {
+		return 0, "", err
+	}
+	token := hex.EncodeToString(buf)
+
+	ctx := context.Background()
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return 0, "", err
+	}
+	defer tx.Rollback(ctx)
+
+	var id int
+	err = tx.QueryRow(ctx, `
+		INSERT INTO share_links (tenant_id, task_id, created_by, token_hash, expires)
+		VALUES ($1, $2, $3, $4, $5) RETURNING id;
+	`,
+		s.tenantID,
+		taskID,
+		s.userID,
+		hashToken(token),
+		expires,
+	).Scan(&id)
+	if err != nil {
+		return 0, "", err
+	}
+
+	err = s.audit(ctx, tx, AuditShareCreate, map[string]interface{}{
+		"link_id": id,
+		"task_id": taskID,
+		"expires": expires,
+	})
+	if err != nil {
+		return 0, "", err
+	}
+
+	return id, token, s.commit(ctx, tx)
+}
+
+// ShareLinks возвращает публичные ссылки на задачу, включая отозванные и истёкшие.
+// Для недоступной пользователю хранилища задачи ссылки не возвращаются.
+func (s *Storage) ShareLinks(taskID int) ([]ShareLink, error) {
+	err := s.authorize(RoleReporter)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+	rows, err := s.db.Query(ctx, `
+		SELECT
+			l.id,
+			l.tenant_id,
+			l.task_id,
+			l.created_by,
+			l.created,
+			l.expires,
+			l.revoked
+		FROM share_links AS l
+		JOIN tasks AS t ON t.id = l.task_id
+		WHERE l.task_id = $1 AND l.tenant_id = $2 AND can_access($3, t)
+		ORDER BY l.id
+	`,
+		taskID,
+		s.tenantID,
+		s.userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return collectRows(rows, scanShareLink)
+}
+
+// scanShareLink сканирует публичную ссылку.
+func scanShareLink(row pgx.Row) (ShareLink, error) {
+	var l ShareLink
+	err := row.Scan(
+		&l.ID,
+		&l.TenantID,
+		&l.TaskID,
+		&l.CreatedBy,
+		&l.Created,
+		&l.Expires,
+		&l.Revoked,
+	)
+
+	return l, err
+}
+
+// RevokeShareLink отзывает публичную ссылку по ID.
+// Ссылки на недоступные пользователю хранилища задачи не отзываются, как и отсутствующие.
+func (s *Storage) RevokeShareLink(linkID int) error {
+	err := s.authorizeWrite(RoleReporter)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx, `
+		UPDATE share_links AS l
+		SET revoked = extract(epoch from now())
+		FROM tasks AS t
+		WHERE l.id = $1 AND l.revoked = 0 AND l.tenant_id = $2 AND t.id = l.task_id AND can_access($3, t)
+	`,
+		linkID,
+		s.tenantID,
+		s.userID,
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrShareLinkNotFound
+	}
+
+	err = s.audit(ctx, tx, AuditShareRevoke, map[string]interface{}{
+		"link_id": linkID,
+	})
+	if err != nil {
+		return err
+	}
+
+	return s.commit(ctx, tx)
+}
+
+// SharedTask возвращает задачу по секрету публичной ссылки и записывает просмотр
+// в журнал ссылки. client описывает клиента, например адрес и User-Agent.
+// Ссылка даёт доступ только на чтение одной задачи независимо от её видимости,
+// API не должно разрешать по ней другие действия.
+// Для неизвестных, отозванных и истёкших ссылок возвращает ErrInvalidShareLink.
+func (s *Storage) SharedTask(ctx context.Context, token, client string) (Task, error) {
+	link, err := scanShareLink(s.db.QueryRow(ctx, `
+		SELECT
+			id,
+			tenant_id,
+			task_id,
+			created_by,
+			created,
+			expires,
+			revoked
+		FROM share_links
+		WHERE token_hash = $1
+	`,
+		hashToken(token),
+	))
+	if err == pgx.ErrNoRows {
+		return Task{}, ErrInvalidShareLink
+	}
+	if err != nil {
+		return Task{}, err
+	}
+	if link.Revoked != 0 || (link.Expires != 0 && link.Expires <= time.Now().Unix()) {
+		return Task{}, ErrInvalidShareLink
+	}
+
+	task, err := s.ForTenant(link.TenantID).AsUser(0).TaskByID(link.TaskID)
+	if err != nil {
+		return Task{}, err
+	}
+
+	if !s.db.readOnly {
+		_, err = s.db.Exec(ctx, `
+			INSERT INTO share_link_views (link_id, client)
+			VALUES ($1, $2)
+		`,
+			link.ID,
+			client,
+		)
+		if err != nil {
+			return Task{}, err
+		}
+	}
+
+	return task, nil
+}
+
+// ShareLinkViews возвращает журнал просмотров задачи по публичной ссылке, начиная с последних.
+// Для ссылки на недоступную пользователю хранилища задачу просмотры не возвращаются.
+func (s *Storage) ShareLinkViews(linkID int) ([]ShareLinkView, error) {
+	err := s.authorize(RoleReporter)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+	rows, err := s.db.Query(ctx, `
+		SELECT v.viewed, v.client
+		FROM share_link_views AS v
+		JOIN share_links AS l ON l.id = v.link_id
+		JOIN tasks AS t ON t.id = l.task_id
+		WHERE v.link_id = $1 AND l.tenant_id = $2 AND can_access($3, t)
+		ORDER BY v.viewed DESC
+	`,
+		linkID,
+		s.tenantID,
+		s.userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return collectRows(rows, func(row pgx.Row) (ShareLinkView, error) {
+		var v ShareLinkView
+		err := row.Scan(&v.Viewed, &v.Client)
+		return v, err
+	})
+}
@@ -0,0 +1,111 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestStorage_ShareLinks(t *testing.T) {
+	db, err := storageConnect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close(context.Background()) })
+
+	tenant := db.ForTenant(1188)
+	taskID := newTestTask(t, tenant, "Shared")
+	err = tenant.SetVisibility(taskID, VisibilityPrivate)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	ctx := context.Background()
+
+	id, token, err := tenant.CreateShareLink(taskID, 0)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	_, expiredToken, err := tenant.CreateShareLink(taskID, time.Now().Unix()-1)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// частная задача доступна по ссылке без учётной записи
+	task, err := db.SharedTask(ctx, token, "127.0.0.1")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if task.ID != taskID {
+		t.Errorf("task: want %d, got %d", taskID, task.ID)
+	}
+	views, err := tenant.ShareLinkViews(id)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(views) != 1 || views[0].Client != "127.0.0.1" {
+		t.Errorf("views: want one from 127.0.0.1, got %+v", views)
+	}
+
+	links, err := tenant.ShareLinks(taskID)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(links) != 2 {
+		t.Errorf("links num: want 2, got %d", len(links))
+	}
+
+	// пользователь рабочего пространства без доступа к частной задаче не видит её ссылки
+	var outsiderID int
+	err = db.db.QueryRow(ctx, `INSERT INTO users (tenant_id, name) VALUES (1188, 'Share outsider') RETURNING id`).Scan(&outsiderID)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	t.Cleanup(func() { db.db.Exec(ctx, `DELETE FROM users WHERE id = $1`, outsiderID) })
+	outsider := tenant.AsUser(outsiderID)
+	links, err = outsider.ShareLinks(taskID)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(links) != 0 {
+		t.Errorf("outsider links num: want 0, got %d", len(links))
+	}
+	views, err = outsider.ShareLinkViews(id)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(views) != 0 {
+		t.Errorf("outsider views: want none, got %+v", views)
+	}
+	err = outsider.RevokeShareLink(id)
+	if !errors.Is(err, ErrShareLinkNotFound) {
+		t.Errorf("outsider error: want %v, got %v", ErrShareLinkNotFound, err)
+	}
+
+	err = tenant.RevokeShareLink(id)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	err = tenant.RevokeShareLink(id)
+	if !errors.Is(err, ErrShareLinkNotFound) {
+		t.Errorf("error: want %v, got %v", ErrShareLinkNotFound, err)
+	}
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"unknown link", "not-a-link"},
+		{"expired link", expiredToken},
+		{"revoked link", token},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := db.SharedTask(ctx, tt.token, "")
+			if !errors.Is(err, ErrInvalidShareLink) {
+				t.Errorf("error: want %v, got %v", ErrInvalidShareLink, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,216 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+var (
+	ErrLabelNotFound     = fmt.Errorf("label not found")
+	ErrSLAPolicyNotFound = fmt.Errorf("sla policy not found")
+)
+
+// Соглашение об уровне обслуживания для задач с меткой Label.
+// Политика с пустой меткой действует для задач, на метки которых нет политик.
+// Если задаче подходят несколько политик, действуют самые строгие сроки.
+type SLAPolicy struct {
+	ID            int
+	Label         string
+	RespondWithin time.Duration // срок назначения ответственного, 0 - без срока
+	ResolveWithin time.Duration // срок выполнения, 0 - без срока
+}
+
+// Состояние соглашения об уровне обслуживания для задачи.
+// Ответом на задачу считается первое назначение ответственного.
+type SLAState struct {
+	Task      Task
+	RespondBy *time.Time    // срок ответа, nil - без срока
+	ResolveBy *time.Time    // срок выполнения, nil - без срока
+	Responded *time.Time    // время ответа, nil - ответа не было
+	Remaining time.Duration // время до ближайшего невыполненного срока, отрицательное после его истечения
+	Breached  bool          // хотя бы один срок нарушен
+}
+
+// SetSLAPolicy создаёт или заменяет политику для метки и возвращает её id.
+func (s *Storage) SetSLAPolicy(p SLAPolicy) (int, error) {
+	err := s.authorizeWrite(RoleMaintainer)
+	if err != nil {
+		return 0, err
+	}
+
+	ctx := context.Background()
+	labelID, err := s.labelID(ctx, p.Label)
+	if err != nil {
+		return 0, err
+	}
+
+	var id int
+	err = s.db.QueryRow(ctx, `
+		INSERT INTO sla_policies (tenant_id, label_id, respond_within, resolve_within)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (tenant_id, COALESCE(label_id, 0)) DO UPDATE
+		SET respond_within = EXCLUDED.respond_within, resolve_within = EXCLUDED.resolve_within
+		RETURNING id
+	`,
+		s.tenantID,
+		labelID,
+		int64(p.RespondWithin/time.Second),
+		int64(p.ResolveWithin/time.Second),
+	).Scan(&id)
+
+	return id, err
+}
+
+// SLAPolicies возвращает политики рабочего пространства, начиная с политики без метки.
+func (s *Storage) SLAPolicies() ([]SLAPolicy, error) {
+	ctx := context.Background()
+	rows, err := s.db.Query(ctx, `
+		SELECT p.id, COALESCE(l.name, ''), p.respond_within, p.resolve_within
+		FROM sla_policies AS p
+		LEFT JOIN labels AS l
+		ON l.id = p.label_id
+		WHERE p.tenant_id = $1
+		ORDER BY p.label_id NULLS FIRST, p.id
+	`,
+		s.tenantID,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return collectRows(rows, func(row pgx.Row) (SLAPolicy, error) {
+		var p SLAPolicy
+		var respond, resolve int64
+		err := row.Scan(&p.ID, &p.Label, &respond, &resolve)
+		p.RespondWithin = time.Duration(respond) * time.Second
+		p.ResolveWithin = time.Duration(resolve) * time.Second
+		return p, err
+	})
+}
+
+// DeleteSLAPolicy удаляет политику по ID.
+func (s *Storage) DeleteSLAPolicy(policyID int) error {
+	err := s.authorizeWrite(RoleMaintainer)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	tag, err := s.db.Exec(ctx, `
+		DELETE FROM sla_policies
+		WHERE id = $1 AND tenant_id = $2
+	`,
+		policyID,
+		s.tenantID,
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrSLAPolicyNotFound
+	}
+
+	return nil
+}
+
+// TaskSLA возвращает состояние соглашения об уровне обслуживания для задачи.
+func (s *Storage) TaskSLA(taskID int) (SLAState, error) {
+	ctx := context.Background()
+	state, err := s.scanSLAState(s.db.QueryRow(ctx, `
+		SELECT `+taskColumnsOf("t")+`, sla.respond_by, sla.resolve_by, t.responded
+		FROM tasks AS t, task_sla(t) AS sla
+		WHERE t.id = $1 AND t.tenant_id = $2 AND can_access($3, t)
+	`,
+		taskID,
+		s.tenantID,
+		s.userID,
+	))
+	if err == pgx.ErrNoRows {
+		return state, ErrTaskNotFound
+	}
+
+	return state, err
+}
+
+// TasksBreachingSLA возвращает открытые задачи, невыполненный срок которых
+// истёк или истечёт в течение window, в порядке ближайшего срока.
+func (s *Storage) TasksBreachingSLA(window time.Duration) ([]SLAState, error) {
+	ctx := context.Background()
+	rows, err := s.db.Query(ctx, `
+		SELECT `+taskColumnsOf("t")+`, sla.respond_by, sla.resolve_by, t.responded
+		FROM tasks AS t, task_sla(t) AS sla
+		WHERE
+			t.closed = 0 AND
+			LEAST(CASE WHEN t.responded IS NULL THEN sla.respond_by END, sla.resolve_by) <=
+				extract(epoch from now()) + $3 AND
+			t.tenant_id = $1 AND can_access($2, t)
+		ORDER BY LEAST(CASE WHEN t.responded IS NULL THEN sla.respond_by END, sla.resolve_by), t.id
+	`,
+		s.tenantID,
+		s.userID,
+		int64(window/time.Second),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return collectRows(rows, s.scanSLAState)
+}
+
+// scanSLAState сканирует задачу со сроками соглашения и вычисляет его состояние.
+func (s *Storage) scanSLAState(row pgx.Row) (SLAState, error) {
+	var respondBy, resolveBy, responded *int64
+	task, err := s.scanTask(row, &respondBy, &resolveBy, &responded)
+	if err != nil {
+		return SLAState{}, err
+	}
+
+	return slaState(task, respondBy, resolveBy, responded, time.Now()), nil
+}
+
+// slaState вычисляет состояние соглашения для задачи со сроками respondBy и resolveBy
+// и временем ответа responded на момент now.
+// Выполнение задачи без назначения ответственного считается ответом.
+func slaState(task Task, respondBy, resolveBy, responded *int64, now time.Time) SLAState {
+	st := SLAState{Task: task}
+	if respondBy != nil {
+		st.RespondBy = closedTime(*respondBy)
+	}
+	if resolveBy != nil {
+		st.ResolveBy = closedTime(*resolveBy)
+	}
+	if responded != nil {
+		st.Responded = closedTime(*responded)
+	}
+
+	end := now
+	if task.Closed != nil {
+		end = *task.Closed
+	}
+	answered := end
+	if st.Responded != nil {
+		answered = *st.Responded
+	}
+
+	var next *time.Time
+	if st.RespondBy != nil {
+		st.Breached = answered.After(*st.RespondBy)
+		if st.Responded == nil && task.Closed == nil {
+			next = st.RespondBy
+		}
+	}
+	if st.ResolveBy != nil {
+		st.Breached = st.Breached || end.After(*st.ResolveBy)
+		if task.Closed == nil && (next == nil || st.ResolveBy.Before(*next)) {
+			next = st.ResolveBy
+		}
+	}
+	if next != nil {
+		st.Remaining = next.Sub(now)
+	}
+
+	return st
+}
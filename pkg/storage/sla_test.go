@@ -0,0 +1,140 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSLAState(t *testing.T) {
+	now := unixTime(1700010000)
+	sec := func(v int64) *int64 { return &v }
+
+	tests := []struct {
+		name          string
+		task          Task
+		respondBy     *int64
+		resolveBy     *int64
+		responded     *int64
+		wantRemaining time.Duration
+		wantBreached  bool
+	}{
+		{
+			name: "no policy",
+			task: Task{Opened: unixTime(1700000000)},
+		},
+		{
+			name:          "awaiting response",
+			task:          Task{Opened: unixTime(1700000000)},
+			respondBy:     sec(1700013600),
+			resolveBy:     sec(1700086400),
+			wantRemaining: time.Hour,
+		},
+		{
+			name:          "response overdue",
+			task:          Task{Opened: unixTime(1700000000)},
+			respondBy:     sec(1700003600),
+			resolveBy:     sec(1700086400),
+			wantRemaining: -6400 * time.Second,
+			wantBreached:  true,
+		},
+		{
+			name:          "responded in time",
+			task:          Task{Opened: unixTime(1700000000)},
+			respondBy:     sec(1700003600),
+			resolveBy:     sec(1700013600),
+			responded:     sec(1700001800),
+			wantRemaining: time.Hour,
+		},
+		{
+			name:         "resolved late",
+			task:         Task{Opened: unixTime(1700000000), Closed: closedTime(1700009000)},
+			resolveBy:    sec(1700007200),
+			responded:    sec(1700001800),
+			wantBreached: true,
+		},
+		{
+			name:      "closed without response",
+			task:      Task{Opened: unixTime(1700000000), Closed: closedTime(1700001000)},
+			respondBy: sec(1700003600),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := slaState(tt.task, tt.respondBy, tt.resolveBy, tt.responded, now)
+			if got.Remaining != tt.wantRemaining {
+				t.Errorf("remaining: want %v, got %v", tt.wantRemaining, got.Remaining)
+			}
+			if got.Breached != tt.wantBreached {
+				t.Errorf("breached: want %v, got %v", tt.wantBreached, got.Breached)
+			}
+		})
+	}
+}
+
+func TestStorage_TasksBreachingSLA(t *testing.T) {
+	db, err := storageConnect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close(context.Background()) })
+
+	tenant := db.ForTenant(1194)
+	ctx := context.Background()
+	_, err = db.db.Exec(ctx, `INSERT INTO labels (tenant_id, name) VALUES (1194, 'Urgent')`)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	t.Cleanup(func() { db.db.Exec(ctx, `DELETE FROM labels WHERE tenant_id = 1194`) })
+
+	_, err = tenant.SetSLAPolicy(SLAPolicy{ResolveWithin: 24 * time.Hour})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	urgentID, err := tenant.SetSLAPolicy(SLAPolicy{Label: "Urgent", RespondWithin: time.Hour})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	_, err = tenant.SetSLAPolicy(SLAPolicy{Label: "Missing"})
+	if !errors.Is(err, ErrLabelNotFound) {
+		t.Errorf("error: want %v, got %v", ErrLabelNotFound, err)
+	}
+
+	urgent := newTestTask(t, tenant, "Urgent")
+	addTestLabel(t, tenant, urgent, "Urgent")
+	normal := newTestTask(t, tenant, "Normal")
+
+	state, err := tenant.TaskSLA(normal)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if state.ResolveBy == nil || state.RespondBy != nil {
+		t.Errorf("normal task deadlines: want resolve only, got %+v", state)
+	}
+
+	tasks, err := tenant.TasksBreachingSLA(2 * time.Hour)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(tasks) != 1 || tasks[0].Task.ID != urgent {
+		t.Errorf("breaching tasks: want [%d], got %+v", urgent, tasks)
+	}
+
+	err = tenant.DeleteSLAPolicy(urgentID)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	policies, err := tenant.SLAPolicies()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(policies) != 1 || policies[0].Label != "" {
+		t.Errorf("policies: want default only, got %+v", policies)
+	}
+	err = tenant.DeleteSLAPolicy(policies[0].ID)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
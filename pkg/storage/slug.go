@@ -0,0 +1,47 @@
+package storage
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// TaskBySlug возвращает задачу по имени для адресов страниц, например "fix-login-timeout".
+// Имя получается из названия при создании задачи и не меняется при переименовании.
+func (s *Storage) TaskBySlug(slug string) (Task, error) {
+	ctx := context.Background()
+	task, err := s.scanTask(s.db.QueryRow(ctx, `
+		SELECT `+taskColumns+`
+		FROM tasks
+		WHERE slug = $1 AND tenant_id = $2 AND can_access($3, tasks)
+	`,
+		slug,
+		s.tenantID,
+		s.userID,
+	))
+	if err == pgx.ErrNoRows {
+		return task, opError("TaskBySlug", "task", "slug="+slug, ErrTaskNotFound)
+	}
+
+	return task, opError("TaskBySlug", "task", "slug="+slug, err)
+}
+
+// TaskSlug возвращает имя задачи для адресов страниц.
+func (s *Storage) TaskSlug(taskID int) (string, error) {
+	ctx := context.Background()
+	var slug string
+	err := s.db.QueryRow(ctx, `
+		SELECT slug
+		FROM tasks
+		WHERE id = $1 AND tenant_id = $2 AND can_access($3, tasks)
+	`,
+		taskID,
+		s.tenantID,
+		s.userID,
+	).Scan(&slug)
+	if err == pgx.ErrNoRows {
+		return "", taskError("TaskSlug", taskID, ErrTaskNotFound)
+	}
+
+	return slug, taskError("TaskSlug", taskID, err)
+}
@@ -0,0 +1,54 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestStorage_TaskBySlug(t *testing.T) {
+	db, err := storageConnect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close(context.Background()) })
+
+	tenant := db.ForTenant(1227)
+	tests := []struct {
+		title string
+		want  string
+	}{
+		{"Fix login timeout!", "fix-login-timeout"},
+		{"Fix login: timeout", "fix-login-timeout-2"},
+		{"Ошибка входа", "oshibka-vkhoda"},
+		{"???", "task"},
+	}
+	ids := make([]int, len(tests))
+	for i, tt := range tests {
+		ids[i] = newTestTask(t, tenant, tt.title)
+	}
+	for i, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			id := ids[i]
+			slug, err := tenant.TaskSlug(id)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if slug != tt.want {
+				t.Errorf("slug: want %q, got %q", tt.want, slug)
+			}
+			task, err := tenant.TaskBySlug(slug)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if task.ID != id {
+				t.Errorf("task: want %d, got %d", id, task.ID)
+			}
+		})
+	}
+
+	_, err = db.ForTenant(1226).TaskBySlug("fix-login-timeout")
+	if !errors.Is(err, ErrTaskNotFound) {
+		t.Errorf("error: want %v, got %v", ErrTaskNotFound, err)
+	}
+}
@@ -0,0 +1,81 @@
+package storage
+
+import (
+	"context"
+	"time"
+)
+
+// SnoozeTask откладывает задачу до момента until: до этого времени задача
+// не возвращается в списках текущей работы, например MyWork.
+func (s *Storage) SnoozeTask(taskID int, until time.Time) error {
+	return s.setSnoozed(taskID, until.Unix())
+}
+
+// UnsnoozeTask возвращает отложенную задачу в списки текущей работы.
+func (s *Storage) UnsnoozeTask(taskID int) error {
+	return s.setSnoozed(taskID, 0)
+}
+
+// setSnoozed устанавливает время, до которого отложена задача, 0 снимает откладывание.
+func (s *Storage) setSnoozed(taskID int, until int64) error {
+	err := s.authorizeWrite(RoleReporter)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	tag, err := s.db.Exec(ctx, `
+		UPDATE tasks
+		SET snoozed_until = NULLIF($2, 0)
+		WHERE id = $1 AND tenant_id = $3 AND can_access($4, tasks)
+	`,
+		taskID,
+		until,
+		s.tenantID,
+		s.userID,
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrTaskNotFound
+	}
+
+	return nil
+}
+
+// TasksSnoozed возвращает отложенные задачи в порядке окончания срока откладывания.
+func (s *Storage) TasksSnoozed() ([]Task, error) {
+	ctx := context.Background()
+	return s.queryTasks(ctx, `
+		SELECT `+taskColumns+`
+		FROM tasks
+		WHERE snoozed(tasks) AND tenant_id = $1 AND can_access($2, tasks)
+		ORDER BY snoozed_until, id
+	`,
+		s.tenantID,
+		s.userID,
+	)
+}
+
+// UnsnoozeTasks снимает откладывание с задач во всех рабочих пространствах, срок которых истёк,
+// и возвращает их количество. Задачи возвращаются в списки и без этого, но после снятия
+// их изменение отражается во времени изменения и видно клиентам синхронизации.
+// Доступен только системному пользователю.
+func (s *Storage) UnsnoozeTasks(ctx context.Context) (int, error) {
+	err := s.authorizeSystemWrite()
+	if err != nil {
+		return 0, err
+	}
+
+	tag, err := s.db.Exec(ctx, `
+		UPDATE tasks
+		SET snoozed_until = NULL
+		WHERE snoozed_until <= extract(epoch from now())
+	`)
+	if err != nil {
+		return 0, err
+	}
+
+	return int(tag.RowsAffected()), nil
+}
@@ -0,0 +1,82 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+func TestStorage_UnsnoozeTasksSystemOnly(t *testing.T) {
+	s, err := NewWithPool(&pgxpool.Pool{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	_, err = s.ForTenant(1193).AsUser(1).UnsnoozeTasks(context.Background())
+	if !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("error: want %v, got %v", ErrPermissionDenied, err)
+	}
+}
+
+func TestStorage_SnoozeTask(t *testing.T) {
+	db, err := storageConnect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close(context.Background()) })
+
+	tenant := db.ForTenant(1193)
+	userID := newTestUser(t, db, "Snoozing User")
+	taskID := newTestTask(t, tenant, "Snoozed")
+	err = tenant.UpdateTask(taskID, userID, 0, "", "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	err = tenant.SnoozeTask(taskID, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	work, err := tenant.MyWork(userID)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(work.Assigned) != 0 {
+		t.Errorf("assigned: want none, got %+v", work.Assigned)
+	}
+	snoozed, err := tenant.TasksSnoozed()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(snoozed) != 1 || snoozed[0].ID != taskID {
+		t.Errorf("snoozed: want [%d], got %+v", taskID, snoozed)
+	}
+
+	// истёкший срок возвращает задачу в списки и снимается UnsnoozeTasks
+	err = tenant.SnoozeTask(taskID, time.Now().Add(-time.Second))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	work, err = tenant.MyWork(userID)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(work.Assigned) != 1 {
+		t.Errorf("assigned: want [%d], got %+v", taskID, work.Assigned)
+	}
+	n, err := db.UnsnoozeTasks(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if n < 1 {
+		t.Errorf("unsnoozed: want at least 1, got %d", n)
+	}
+
+	err = tenant.UnsnoozeTask(-1)
+	if !errors.Is(err, ErrTaskNotFound) {
+		t.Errorf("error: want %v, got %v", ErrTaskNotFound, err)
+	}
+}
@@ -0,0 +1,205 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"os"
+
+	"github.com/jackc/pgx/v4"
+	_ "modernc.org/sqlite"
+)
+
+// Схема файла экспорта SQLite.
+const sqliteSchema = `
+CREATE TABLE users (
+    id INTEGER PRIMARY KEY,
+    name TEXT NOT NULL,
+    role TEXT NOT NULL
+);
+
+CREATE TABLE labels (
+    id INTEGER PRIMARY KEY,
+    name TEXT NOT NULL
+);
+
+CREATE TABLE tasks (
+    id INTEGER PRIMARY KEY,
+    opened INTEGER NOT NULL,
+    closed INTEGER NOT NULL,
+    author_id INTEGER REFERENCES users(id),
+    assigned_id INTEGER REFERENCES users(id),
+    title TEXT,
+    content TEXT,
+    duplicate_of INTEGER REFERENCES tasks(id),
+    parent_id INTEGER REFERENCES tasks(id),
+    visibility TEXT NOT NULL,
+    updated INTEGER NOT NULL,
+    version INTEGER NOT NULL
+);
+
+CREATE TABLE tasks_labels (
+    task_id INTEGER REFERENCES tasks(id),
+    label_id INTEGER REFERENCES labels(id)
+);
+`
+
+// ExportSQLite сохраняет пользователей, метки и задачи рабочего пространства
+// в новый файл базы данных SQLite по пути path. Содержимое задач экспортируется расшифрованным.
+// Если файл уже существует, возвращается ошибка.
+func (s *Storage) ExportSQLite(path string) error {
+	err := s.authorize(RoleAdmin)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	f.Close()
+
+	err = s.exportSQLite(path)
+	if err != nil {
+		os.Remove(path)
+	}
+
+	return err
+}
+
+func (s *Storage) exportSQLite(path string) error {
+	ctx := context.Background()
+	src, err := s.db.BeginTx(ctx, pgx.TxOptions{
+		IsoLevel:   pgx.RepeatableRead,
+		AccessMode: pgx.ReadOnly,
+	})
+	if err != nil {
+		return err
+	}
+	defer src.Rollback(ctx)
+
+	dst, err := sql.Open("sqlite", path)
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+
+	tx, err := dst.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, sqliteSchema)
+	if err != nil {
+		return err
+	}
+
+	err = copySQLite(ctx, src, tx, `
+		SELECT
+			id,
+			name,
+			role
+		FROM users
+		WHERE tenant_id = $1
+		ORDER BY id
+	`, `INSERT INTO users (id, name, role) VALUES (?, ?, ?)`, nil, s.tenantID)
+	if err != nil {
+		return err
+	}
+
+	err = copySQLite(ctx, src, tx, `
+		SELECT
+			id,
+			name
+		FROM labels
+		WHERE tenant_id = $1
+		ORDER BY id
+	`, `INSERT INTO labels (id, name) VALUES (?, ?)`, nil, s.tenantID)
+	if err != nil {
+		return err
+	}
+
+	// содержимое задачи - седьмой столбец
+	decryptContent := func(values []interface{}) error {
+		content, _ := values[6].(string)
+		plain, err := s.decrypt(content)
+		values[6] = plain
+		return err
+	}
+	err = copySQLite(ctx, src, tx, `
+		SELECT
+			id,
+			opened,
+			closed,
+			author_id,
+			assigned_id,
+			title,
+			content,
+			duplicate_of,
+			parent_id,
+			visibility,
+			updated,
+			version
+		FROM tasks
+		WHERE tenant_id = $1
+		ORDER BY id
+	`, `
+		INSERT INTO tasks (
+			id, opened, closed, author_id, assigned_id, title, content,
+			duplicate_of, parent_id, visibility, updated, version
+		)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, decryptContent, s.tenantID)
+	if err != nil {
+		return err
+	}
+
+	err = copySQLite(ctx, src, tx, `
+		SELECT
+			tl.task_id,
+			tl.label_id
+		FROM tasks_labels AS tl
+		JOIN tasks AS t ON t.id = tl.task_id
+		WHERE t.tenant_id = $1
+	`, `INSERT INTO tasks_labels (task_id, label_id) VALUES (?, ?)`, nil, s.tenantID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// copySQLite копирует результат запроса query в SQLite запросом insert.
+// Функция prepare, если задана, может изменить значения строки перед вставкой.
+func copySQLite(ctx context.Context, src pgx.Tx, dst *sql.Tx, query, insert string, prepare func([]interface{}) error, args ...interface{}) error {
+	stmt, err := dst.PrepareContext(ctx, insert)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	rows, err := src.Query(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		values, err := rows.Values()
+		if err != nil {
+			return err
+		}
+		if prepare != nil {
+			err = prepare(values)
+			if err != nil {
+				return err
+			}
+		}
+		_, err = stmt.ExecContext(ctx, values...)
+		if err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
@@ -0,0 +1,64 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+)
+
+func TestStorage_ExportSQLite(t *testing.T) {
+	db, err := storageConnect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close(context.Background()) })
+
+	taskID := newTestTask(t, db, "Export me")
+	addTestLabel(t, db, taskID, "Export")
+
+	path := filepath.Join(t.TempDir(), "tasks.db")
+	err = db.ExportSQLite(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	lite, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { lite.Close() })
+
+	tasks, err := db.TasksAll()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var count int
+	err = lite.QueryRow(`SELECT count(*) FROM tasks`).Scan(&count)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if count != len(tasks) {
+		t.Errorf("tasks: want %d, got %d", len(tasks), count)
+	}
+
+	var title, label string
+	err = lite.QueryRow(`
+		SELECT t.title, l.name
+		FROM tasks AS t
+		JOIN tasks_labels AS tl ON tl.task_id = t.id
+		JOIN labels AS l ON l.id = tl.label_id
+		WHERE t.id = ?
+	`, taskID).Scan(&title, &label)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if title != "Export me" || label != "Export" {
+		t.Errorf("task: want %q with label %q, got %q with label %q", "Export me", "Export", title, label)
+	}
+
+	err = db.ExportSQLite(path)
+	if err == nil {
+		t.Error("error: want file exists error, got nil")
+	}
+}
@@ -0,0 +1,65 @@
+package storage
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// Количество задач ответственного.
+type AssigneeStats struct {
+	AssignedID int
+	Open       int64
+	Closed     int64
+	Refreshed  int64 // время обновления статистики
+}
+
+// RefreshStats обновляет материализованное представление со статистикой задач.
+// С concurrently чтение статистики не блокируется на время обновления,
+// но обновление выполняется дольше.
+func (s *Storage) RefreshStats(ctx context.Context, concurrently bool) error {
+	err := s.authorizeWrite(RoleAdmin)
+	if err != nil {
+		return err
+	}
+
+	sql := `REFRESH MATERIALIZED VIEW task_stats`
+	if concurrently {
+		sql = `REFRESH MATERIALIZED VIEW CONCURRENTLY task_stats`
+	}
+	_, err = s.db.Exec(ctx, sql)
+
+	return err
+}
+
+// AssigneeStats возвращает количество открытых и выполненных задач по ответственным
+// рабочего пространства на момент последнего вызова RefreshStats.
+// Статистика учитывает все задачи независимо от их видимости.
+func (s *Storage) AssigneeStats() ([]AssigneeStats, error) {
+	rows, err := s.db.Query(context.Background(), `
+		SELECT
+			assigned_id,
+			open,
+			closed,
+			refreshed
+		FROM task_stats
+		WHERE tenant_id = $1
+		ORDER BY assigned_id
+	`,
+		s.tenantID,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return collectRows(rows, func(row pgx.Row) (AssigneeStats, error) {
+		var st AssigneeStats
+		err := row.Scan(
+			&st.AssignedID,
+			&st.Open,
+			&st.Closed,
+			&st.Refreshed,
+		)
+		return st, err
+	})
+}
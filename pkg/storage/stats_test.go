@@ -0,0 +1,48 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestStorage_AssigneeStats(t *testing.T) {
+	db, err := storageConnect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close(context.Background()) })
+
+	tenant := db.ForTenant(1178)
+	userID := newTestUser(t, db, "Stats assignee")
+	for _, closed := range []int64{0, 0, time.Now().Unix()} {
+		id, err := tenant.NewTask(Task{Title: "Stats", AssignedID: userID})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		t.Cleanup(func() { tenant.DeleteTask(id) })
+		if closed > 0 {
+			err = tenant.UpdateTask(id, 0, closed, "", "")
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+		}
+	}
+
+	for _, concurrently := range []bool{false, true} {
+		err = tenant.RefreshStats(context.Background(), concurrently)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		stats, err := tenant.AssigneeStats()
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if len(stats) != 1 {
+			t.Fatalf("stats: want 1 assignee, got %+v", stats)
+		}
+		if stats[0].AssignedID != userID || stats[0].Open != 2 || stats[0].Closed != 1 {
+			t.Errorf("stats: want assignee %d with 2 open and 1 closed, got %+v", userID, stats[0])
+		}
+	}
+}
@@ -3,6 +3,7 @@ package storage
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
@@ -12,24 +13,49 @@ var (
 	ErrNoTasksToAdd = fmt.Errorf("empty tasks slice")
 	ErrTaskNotFound = fmt.Errorf("task not found")
 	ErrEmptyLabel   = fmt.Errorf("label cannot be empty")
+	ErrSameUser     = fmt.Errorf("source and target users are the same")
+	ErrNoDuplicates = fmt.Errorf("empty duplicates slice")
+	ErrSelfMerge    = fmt.Errorf("task cannot be merged into itself")
+	ErrUserNotFound = fmt.Errorf("user not found")
+
+	ErrClosedBeforeOpened = fmt.Errorf("task cannot be closed before it was opened")
 )
 
 // Хранилище данных.
+// Все запросы выполняются в рамках рабочего пространства tenantID
+// и с правами пользователя userID (0 - системный доступ без ограничений).
+// Если задан keys, содержимое задач хранится в зашифрованном виде.
 type Storage struct {
-	db *pgxpool.Pool
+	db       *conn
+	tenantID int
+	userID   int
+	keys     KeyProvider
+	dryRun   *DryRunReport // пробный запуск, изменения откатываются
+	jobID    int           // задание для записи хода длительных операций, 0 - без задания
 }
 
-func (s *Storage) Ping() error {
-	return s.db.Ping(context.Background())
+// Ping проверяет соединение с БД.
+func (s *Storage) Ping(ctx context.Context) error {
+	return s.db.Ping(ctx)
 }
 
-func (s *Storage) Close() {
-	s.db.Close()
+// Close закрывает пул соединений: новые запросы отклоняются, а выполняющиеся
+// дожидаются завершения до отмены ctx. Если ctx отменён раньше, возвращает ошибку
+// контекста, а пул закрывается в фоне по завершении оставшихся запросов.
+// Пул, переданный через WithPool, не закрывается.
+func (s *Storage) Close(ctx context.Context) error {
+	return s.db.Close(ctx)
 }
 
-// Конструктор, принимает строку подключения к БД.
-func New(constr string) (*Storage, error) {
-	db, err := pgxpool.Connect(context.Background(), constr)
+// Конструктор, принимает строку подключения к БД и опции.
+// С опцией WithPool строка подключения не используется.
+func New(constr string, opts ...Option) (*Storage, error) {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	db, err := connect(context.Background(), constr, o)
 	if err != nil {
 		return nil, err
 	}
@@ -39,297 +65,387 @@ func New(constr string) (*Storage, error) {
 	return &s, nil
 }
 
+// NewWithPool создаёт хранилище поверх готового пула соединений приложения.
+// Пул остаётся во владении вызывающего и не закрывается методом Close.
+func NewWithPool(pool *pgxpool.Pool, opts ...Option) (*Storage, error) {
+	return New("", append(opts, WithPool(pool))...)
+}
+
+// ForTenant возвращает хранилище, все запросы и вставки которого
+// ограничены рабочим пространством tenantID.
+// Хранилище использует общий пул соединений, поэтому Close
+// закрывает соединения для всех рабочих пространств.
+func (s *Storage) ForTenant(tenantID int) *Storage {
+	scoped := *s
+	scoped.tenantID = tenantID
+	return &scoped
+}
+
+// AsUser возвращает хранилище, запросы на чтение которого возвращают
+// только задачи, доступные пользователю userID.
+func (s *Storage) AsUser(userID int) *Storage {
+	scoped := *s
+	scoped.userID = userID
+	return &scoped
+}
+
 // Задача.
 type Task struct {
-	ID         int
-	Opened     int64
-	Closed     int64
-	AuthorID   int
-	AssignedID int
+	ID         int        `json:"id"`
+	Opened     time.Time  `json:"opened"`           // время создания в UTC
+	Closed     *time.Time `json:"closed,omitempty"` // время выполнения в UTC, nil для открытой задачи
+	AuthorID   int        `json:"author_id"`
+	AssignedID int        `json:"assigned_id"`
+	Title      string     `json:"title"`
+	Content    string     `json:"content"`
+}
+
+// OpenedUnix возвращает время создания задачи в секундах Unix.
+func (t Task) OpenedUnix() int64 {
+	return t.Opened.Unix()
+}
+
+// ClosedUnix возвращает время выполнения задачи в секундах Unix, 0 для открытой задачи.
+func (t Task) ClosedUnix() int64 {
+	if t.Closed == nil {
+		return 0
+	}
+	return t.Closed.Unix()
+}
+
+// unixTime преобразует секунды Unix из БД во время в UTC.
+func unixTime(sec int64) time.Time {
+	return time.Unix(sec, 0).UTC()
+}
+
+// closedTime преобразует время выполнения из БД, 0 означает открытую задачу.
+func closedTime(sec int64) *time.Time {
+	if sec == 0 {
+		return nil
+	}
+	t := unixTime(sec)
+	return &t
+}
+
+// Данные для создания подзадачи.
+type NewTaskInput struct {
 	Title      string
 	Content    string
+	AssignedID int
+}
+
+// Параметры копирования задачи.
+type CloneOptions struct {
+	Labels   bool // копировать метки
+	Assignee bool // сохранить ответственного
 }
 
 // Deprecated: Tasks возвращает список задач из БД.
 func (s *Storage) Tasks(taskID, authorID int) ([]Task, error) {
-	rows, err := s.db.Query(context.Background(), `
-		SELECT 
-			id,
-			opened,
-			closed,
-			author_id,
-			assigned_id,
-			title,
-			content
+	return s.queryTasks(context.Background(), `
+		SELECT `+taskColumns+`
 		FROM tasks
 		WHERE
 			($1 = 0 OR id = $1) AND
-			($2 = 0 OR author_id = $2)
+			($2 = 0 OR author_id = $2) AND
+			tenant_id = $3 AND
+			can_access($4, tasks)
 		ORDER BY id;
 	`,
 		taskID,
 		authorID,
+		s.tenantID,
+		s.userID,
 	)
-	if err != nil {
-		return nil, err
-	}
-	var tasks []Task
-	// итерирование по результату выполнения запроса
-	// и сканирование каждой строки в переменную
-	for rows.Next() {
-		var t Task
-		err = rows.Scan(
-			&t.ID,
-			&t.Opened,
-			&t.Closed,
-			&t.AuthorID,
-			&t.AssignedID,
-			&t.Title,
-			&t.Content,
-		)
-		if err != nil {
-			return nil, err
-		}
-		// добавление переменной в массив результатов
-		tasks = append(tasks, t)
-
-	}
-	// ВАЖНО не забыть проверить rows.Err()
-	return tasks, rows.Err()
 }
 
 // TasksAll возвращает список задач из БД.
 func (s *Storage) TasksAll() ([]Task, error) {
 	ctx := context.Background()
-	rows, err := s.db.Query(ctx, `
-		SELECT
-			id,
-			opened,
-			closed,
-			author_id,
-			assigned_id,
-			title,
-			content
+	return s.queryTasks(ctx, `
+		SELECT `+taskColumns+`
 		FROM tasks
-	`)
-	if err != nil {
-		return nil, err
-	}
-
-	var tasks []Task
-	for rows.Next() {
-		var t Task
-		err = rows.Scan(
-			&t.ID,
-			&t.Opened,
-			&t.Closed,
-			&t.AuthorID,
-			&t.AssignedID,
-			&t.Title,
-			&t.Content,
-		)
-		if err != nil {
-			return nil, err
-		}
-		tasks = append(tasks, t)
-	}
-
-	return tasks, rows.Err()
+		WHERE tenant_id = $1 AND can_access($2, tasks)
+	`,
+		s.tenantID,
+		s.userID,
+	)
 }
 
 // TasksByID возвращает задачу по ID.
 func (s *Storage) TaskByID(taskID int) (Task, error) {
 	ctx := context.Background()
-	var task Task
-	err := s.db.QueryRow(ctx, `
-		SELECT
-			id,
-			opened,
-			closed,
-			author_id,
-			assigned_id,
-			title,
-			content
+	task, err := s.scanTask(s.db.QueryRow(ctx, `
+		SELECT `+taskColumns+`
 		FROM tasks
-		WHERE id = $1
+		WHERE id = $1 AND tenant_id = $2 AND can_access($3, tasks)
 	`,
 		taskID,
-	).Scan(
-		&task.ID,
-		&task.Opened,
-		&task.Closed,
-		&task.AuthorID,
-		&task.AssignedID,
-		&task.Title,
-		&task.Content,
-	)
-
+		s.tenantID,
+		s.userID,
+	))
 	if err == pgx.ErrNoRows {
-		return task, ErrTaskNotFound
+		return task, taskError("TaskByID", taskID, ErrTaskNotFound)
 	}
 
-	return task, err
+	return task, taskError("TaskByID", taskID, err)
 }
 
 // TaskByAuthorID возвращает список задач из БД по ID автора.
 func (s *Storage) TasksByAuthorID(authorID int) ([]Task, error) {
 	ctx := context.Background()
-	rows, err := s.db.Query(ctx, `
-		SELECT
-			id,
-			opened,
-			closed,
-			author_id,
-			assigned_id,
-			title,
-			content
+	return s.queryTasks(ctx, `
+		SELECT `+taskColumns+`
 		FROM tasks
-		WHERE author_id = $1
+		WHERE author_id = $1 AND tenant_id = $2 AND can_access($3, tasks)
 	`,
 		authorID,
+		s.tenantID,
+		s.userID,
 	)
-	if err != nil {
-		return nil, err
-	}
-
-	var tasks []Task
-	for rows.Next() {
-		var t Task
-		err = rows.Scan(
-			&t.ID,
-			&t.Opened,
-			&t.Closed,
-			&t.AuthorID,
-			&t.AssignedID,
-			&t.Title,
-			&t.Content,
-		)
-		if err != nil {
-			return nil, err
-		}
-		tasks = append(tasks, t)
-	}
-
-	return tasks, rows.Err()
 }
 
-// TasksByLabel возвращает список задач из БД по метке.
+// TasksByLabel возвращает список задач из БД по метке, включая задачи с дочерними метками на любой глубине.
+// Для постраничного вывода и сортировки используется TasksFiltered.
 func (s *Storage) TasksByLabel(label string) ([]Task, error) {
 	if label == "" {
 		return nil, ErrEmptyLabel
 	}
 
+	page, err := s.TasksFiltered(TasksFilter{Label: label})
+	return page.Tasks, err
+}
+
+// Subtasks возвращает список подзадач задачи.
+func (s *Storage) Subtasks(parentID int) ([]Task, error) {
 	ctx := context.Background()
-	rows, err := s.db.Query(ctx, `
-		SELECT
-			t.id,
-			t.opened,
-			t.closed,
-			t.author_id,
-			t.assigned_id,
-			t.title,
-			t.content
-		FROM tasks AS t
-		JOIN tasks_labels AS tl
-		ON tl.task_id = t.id
-		JOIN labels AS l
-		ON tl.label_id = l.id
-		WHERE l.name = $1
+	return s.queryTasks(ctx, `
+		SELECT `+taskColumns+`
+		FROM tasks
+		WHERE parent_id = $1 AND tenant_id = $2 AND can_access($3, tasks)
+		ORDER BY id
 	`,
-		label)
-	if err != nil {
-		return nil, err
-	}
+		parentID,
+		s.tenantID,
+		s.userID,
+	)
+}
 
-	var tasks []Task
-	for rows.Next() {
-		var t Task
-		err = rows.Scan(
-			&t.ID,
-			&t.Opened,
-			&t.Closed,
-			&t.AuthorID,
-			&t.AssignedID,
-			&t.Title,
-			&t.Content,
+// insertTaskSQL добавляет задачу с ответственным по умолчанию, метками по умолчанию
+// и метками подходящих ей правил автоматической разметки.
+// Параметры: рабочее пространство, название, сохраняемый текст, открытый текст задачи,
+// значения пользовательских полей (NULL - без значений), автор, ответственный
+// (0 - ответственный по умолчанию) и родительская задача (0 - без родительской);
+// правила проверяются по открытому тексту, так как сохраняемый может быть зашифрован.
+const insertTaskSQL = `
+	WITH intake AS (
+		SELECT default_assignee, label_ids
+		FROM intake_settings
+		WHERE tenant_id = $1
+	), task AS (
+		INSERT INTO tasks (tenant_id, title, content, author_id, assigned_id, parent_id, fields)
+		VALUES (
+			$1, $2, $3, $6,
+			CASE WHEN $7 > 0 THEN $7 ELSE COALESCE((SELECT default_assignee FROM intake), 0) END,
+			NULLIF($8, 0),
+			COALESCE($5::jsonb, '{}')
 		)
-		if err != nil {
-			return nil, err
-		}
-		tasks = append(tasks, t)
+		RETURNING id, author_id
+	), labeled AS (
+		INSERT INTO tasks_labels (task_id, label_id)
+		SELECT task.id, l.id
+		FROM task, labels AS l
+		WHERE
+			l.tenant_id = $1 AND (
+				l.id IN (SELECT unnest(label_ids) FROM intake) OR
+				EXISTS (
+					SELECT 1
+					FROM label_rules AS r
+					WHERE
+						r.label_id = l.id AND r.enabled AND
+						label_rule_matches(r.title_pattern, r.content_pattern, r.author_id, $2, $4, task.author_id)
+				)
+			)
+	)
+	SELECT id FROM task
+`
+
+// NewTask создаёт новую задачу с учётом настроек приёма задач и возвращает её id.
+func (s *Storage) NewTask(t Task) (int, error) {
+	err := s.authorizeWrite(RoleReporter)
+	if err != nil {
+		return 0, opError("NewTask", "task", "", err)
 	}
 
-	return tasks, rows.Err()
+	// автор и ответственный новой задачи задаются не вызывающим, а настройками приёма
+	id, err := s.insertTask(context.Background(), s.db, Task{Title: t.Title, Content: t.Content}, 0, nil)
+	return id, opError("NewTask", "task", "", err)
 }
 
-// NewTask создаёт новую задачу и возвращает её id.
-func (s *Storage) NewTask(t Task) (int, error) {
+// Исполнитель запроса, возвращающего одну строку: подключение или транзакция.
+type rowQuerier interface {
+	QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row
+}
+
+// insertTask проверяет обязательные поля и добавляет задачу t с автором t.AuthorID,
+// ответственным t.AssignedID (0 - по умолчанию), родительской задачей parentID
+// (0 - без родительской) и значениями пользовательских полей fields в формате JSON
+// (nil - без значений) запросом через q.
+func (s *Storage) insertTask(ctx context.Context, q rowQuerier, t Task, parentID int, fields []byte) (int, error) {
+	intake, err := s.intakeSettings(ctx)
+	if err != nil {
+		return 0, err
+	}
+	err = intake.checkRequired(t)
+	if err != nil {
+		return 0, err
+	}
+
+	content, err := s.encrypt(t.Content)
+	if err != nil {
+		return 0, err
+	}
+
 	var id int
-	err := s.db.QueryRow(context.Background(), `
-		INSERT INTO tasks (title, content)
-		VALUES ($1, $2) RETURNING id;
-		`,
+	err = q.QueryRow(ctx, insertTaskSQL,
+		s.tenantID,
 		t.Title,
+		content,
 		t.Content,
+		fields,
+		t.AuthorID,
+		t.AssignedID,
+		parentID,
 	).Scan(&id)
 	return id, err
 }
 
-// NewTasks создает несколько новых задач
+// Количество задач, которые NewTasks отправляет в БД одним пакетом.
+const importChunkSize = 500
+
+// NewTasks создает несколько новых задач.
+// Задачи создаются в одной транзакции пакетами по 500, в задание WithJob
+// после каждого пакета записывается количество отправленных задач.
 func (s *Storage) NewTasks(tasks []Task) error {
+	err := s.authorizeWrite(RoleReporter)
+	if err != nil {
+		return opError("NewTasks", "task", "", err)
+	}
+
 	if len(tasks) == 0 {
-		return ErrNoTasksToAdd
+		return opError("NewTasks", "task", "", ErrNoTasksToAdd)
 	}
 
 	ctx := context.Background()
+	err = s.startJob(ctx, JobImport, len(tasks))
+	if err != nil {
+		return opError("NewTasks", "task", "", err)
+	}
+
+	return opError("NewTasks", "task", "", s.finishJob(ctx, s.newTasks(ctx, tasks)))
+}
+
+// newTasks создаёт задачи tasks для NewTasks.
+func (s *Storage) newTasks(ctx context.Context, tasks []Task) error {
+	intake, err := s.intakeSettings(ctx)
+	if err != nil {
+		return err
+	}
+	for _, t := range tasks {
+		err = intake.checkRequired(t)
+		if err != nil {
+			return err
+		}
+	}
+
 	tx, err := s.db.Begin(ctx)
 	if err != nil {
 		return err
 	}
 	defer tx.Rollback(ctx)
 
+	for start := 0; start < len(tasks); start += importChunkSize {
+		end := min(start+importChunkSize, len(tasks))
+		err = s.insertTasks(ctx, tx, tasks[start:end])
+		if err != nil {
+			return err
+		}
+
+		err = s.jobProgress(ctx, end, len(tasks))
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit(ctx)
+}
+
+// insertTasks создаёт задачи tasks одним пакетом в транзакции tx.
+func (s *Storage) insertTasks(ctx context.Context, tx pgx.Tx, tasks []Task) error {
 	batch := new(pgx.Batch)
 	for _, t := range tasks {
-		batch.Queue(`
-        INSERT INTO tasks (title, content)
-		VALUES ($1, $2);
-        `,
+		content, err := s.encrypt(t.Content)
+		if err != nil {
+			return err
+		}
+		batch.Queue(insertTaskSQL,
+			s.tenantID,
 			t.Title,
+			content,
 			t.Content,
+			nil,
+			0,
+			0,
+			0,
 		)
 	}
 
-	res := tx.SendBatch(ctx, batch)
-	err = res.Close()
-	if err != nil {
-		return err
+	err := tx.SendBatch(ctx, batch).Close()
+	if quotaViolation(err) {
+		return ErrQuotaExceeded
+	}
+	if duplicateTitle(err) {
+		return ErrDuplicateTitle
 	}
 
-	return tx.Commit(ctx)
+	return err
 }
 
 // UpdateTask обновляет задачу по id.
 // Обновляет соответствующие атрибуты в случае если передан не нулевой параметр.
 // Обновление происходит в один SQL запрос.
+// Время выполнения раньше времени создания задачи отклоняется с ErrClosedBeforeOpened.
+// Задачи, недоступные пользователю хранилища, не изменяются, как и отсутствующие.
 func (s *Storage) UpdateTask(taskID, assignedID int, closed int64, title, content string) error {
+	err := s.authorizeWrite(RoleReporter)
+	if err != nil {
+		return taskError("UpdateTask", taskID, err)
+	}
+	content, err = s.encrypt(content)
+	if err != nil {
+		return taskError("UpdateTask", taskID, err)
+	}
+
 	ctx := context.Background()
-	_, err := s.db.Exec(ctx, `
+	_, err = s.db.Exec(ctx, `
 		UPDATE tasks
 		SET
 			closed = CASE WHEN $2 > 0 THEN $2 ELSE closed END,
 			assigned_id = CASE WHEN $3 > 0 THEN $3 ELSE assigned_id END,
 			title = CASE WHEN $4 <> '' THEN $4 ELSE title END,
 			content = CASE WHEN $5 <> '' THEN $5 ELSE content END
-		WHERE id = $1
+		WHERE id = $1 AND tenant_id = $6 AND can_access($7, tasks)
 	`,
 		taskID,
 		closed,
 		assignedID,
 		title,
 		content,
+		s.tenantID,
+		s.userID,
 	)
 	if err != nil {
-		return err
+		return taskError("UpdateTask", taskID, err)
 	}
 
 	return nil
@@ -337,16 +453,372 @@ func (s *Storage) UpdateTask(taskID, assignedID int, closed int64, title, conten
 
 // DeleteTask удаляет задачу по ID.
 func (s *Storage) DeleteTask(taskID int) error {
+	err := s.authorizeWrite(RoleMaintainer)
+	if err != nil {
+		return taskError("DeleteTask", taskID, err)
+	}
+
 	ctx := context.Background()
-	_, err := s.db.Exec(ctx, `
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return taskError("DeleteTask", taskID, err)
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx, `
 		DELETE FROM tasks
-		WHERE id = $1
+		WHERE id = $1 AND tenant_id = $2
 	`,
 		taskID,
+		s.tenantID,
+	)
+	if err != nil {
+		return taskError("DeleteTask", taskID, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return nil
+	}
+
+	err = s.audit(ctx, tx, AuditTaskDelete, map[string]interface{}{
+		"task_id": taskID,
+	})
+	if err != nil {
+		return taskError("DeleteTask", taskID, err)
+	}
+
+	return taskError("DeleteTask", taskID, s.commit(ctx, tx))
+}
+
+// ReassignTasks переназначает задачи пользователя fromUserID на пользователя toUserID,
+// например на время отпуска или при увольнении сотрудника.
+// Если onlyOpen, переназначаются только незакрытые задачи.
+// Переназначение, записи в историю и в журнал аудита выполняются в одной транзакции.
+// Возвращает количество переназначенных задач.
+func (s *Storage) ReassignTasks(fromUserID, toUserID int, onlyOpen bool) (int, error) {
+	err := s.authorizeWrite(RoleMaintainer)
+	if err != nil {
+		return 0, userError("ReassignTasks", fromUserID, err)
+	}
+
+	if fromUserID == toUserID {
+		return 0, userError("ReassignTasks", fromUserID, ErrSameUser)
+	}
+
+	ctx := context.Background()
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return 0, userError("ReassignTasks", fromUserID, err)
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx, `
+		WITH reassigned AS (
+			UPDATE tasks
+			SET assigned_id = $2
+			WHERE assigned_id = $1 AND (NOT $3 OR closed = 0) AND tenant_id = $4
+			RETURNING id
+		), history AS (
+			INSERT INTO task_history (task_id, field, old_value, new_value)
+			SELECT id, 'assigned_id', $1::integer::text, $2::integer::text
+			FROM reassigned
+		)
+		SELECT id FROM reassigned ORDER BY id
+	`,
+		fromUserID,
+		toUserID,
+		onlyOpen,
+		s.tenantID,
+	)
+	if err != nil {
+		return 0, userError("ReassignTasks", fromUserID, err)
+	}
+	ids, err := collectRows(rows, func(row pgx.Row) (int, error) {
+		var id int
+		err := row.Scan(&id)
+		return id, err
+	})
+	if err != nil {
+		return 0, userError("ReassignTasks", fromUserID, err)
+	}
+
+	err = s.audit(ctx, tx, AuditTaskReassign, map[string]interface{}{
+		"from_user_id": fromUserID,
+		"to_user_id":   toUserID,
+		"only_open":    onlyOpen,
+		"tasks":        len(ids),
+		"task_ids":     ids,
+	})
+	if err != nil {
+		return 0, userError("ReassignTasks", fromUserID, err)
+	}
+
+	return len(ids), userError("ReassignTasks", fromUserID, s.commit(ctx, tx))
+}
+
+// MergeTasks объединяет задачи-дубликаты с основной задачей primaryID.
+// Метки дубликатов переносятся на основную задачу, сами дубликаты закрываются
+// с указанием duplicate_of. Все изменения, записи в историю и в журнал аудита
+// выполняются в одной транзакции.
+func (s *Storage) MergeTasks(primaryID int, duplicateIDs []int) error {
+	err := s.authorizeWrite(RoleMaintainer)
+	if err != nil {
+		return taskError("MergeTasks", primaryID, err)
+	}
+
+	if len(duplicateIDs) == 0 {
+		return taskError("MergeTasks", primaryID, ErrNoDuplicates)
+	}
+	seen := make(map[int]bool, len(duplicateIDs))
+	var ids []int
+	for _, id := range duplicateIDs {
+		if id == primaryID {
+			return taskError("MergeTasks", primaryID, ErrSelfMerge)
+		}
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+
+	ctx := context.Background()
+	err = s.startJob(ctx, JobMerge, len(ids))
+	if err != nil {
+		return taskError("MergeTasks", primaryID, err)
+	}
+
+	return taskError("MergeTasks", primaryID, s.finishJob(ctx, s.mergeTasks(ctx, primaryID, ids)))
+}
+
+// mergeTasks объединяет различные задачи ids с задачей primaryID для MergeTasks.
+func (s *Storage) mergeTasks(ctx context.Context, primaryID int, ids []int) error {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var found int
+	err = tx.QueryRow(ctx, `
+		SELECT count(*)
+		FROM tasks
+		WHERE (id = $1 OR id = ANY($2)) AND tenant_id = $3
+	`,
+		primaryID,
+		ids,
+		s.tenantID,
+	).Scan(&found)
+	if err != nil {
+		return err
+	}
+	if found != len(ids)+1 {
+		return ErrTaskNotFound
+	}
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO tasks_labels (task_id, label_id)
+		SELECT DISTINCT $1::integer, tl.label_id
+		FROM tasks_labels AS tl
+		WHERE tl.task_id = ANY($2) AND NOT EXISTS (
+			SELECT 1
+			FROM tasks_labels AS p
+			WHERE p.task_id = $1 AND p.label_id = tl.label_id
+		)
+	`,
+		primaryID,
+		ids,
 	)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	_, err = tx.Exec(ctx, `
+		UPDATE tasks
+		SET
+			closed = CASE WHEN closed > 0 THEN closed ELSE extract(epoch from now()) END,
+			duplicate_of = $1
+		WHERE id = ANY($2)
+	`,
+		primaryID,
+		ids,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO task_history (task_id, field, new_value)
+		SELECT id, 'duplicate_of', $1::integer::text
+		FROM unnest($2::integer[]) AS id
+		UNION ALL
+		SELECT $1, 'merged', id::text
+		FROM unnest($2::integer[]) AS id
+	`,
+		primaryID,
+		ids,
+	)
+	if err != nil {
+		return err
+	}
+
+	err = s.audit(ctx, tx, AuditTaskMerge, map[string]interface{}{
+		"primary_id":    primaryID,
+		"duplicate_ids": ids,
+	})
+	if err != nil {
+		return err
+	}
+
+	return s.commit(ctx, tx)
+}
+
+// CloneTask создаёт копию задачи и возвращает новую задачу.
+// Метки и ответственный копируются в зависимости от opts. Копия создаётся
+// как в NewTask, с учётом настроек приёма задач и правил автоматической разметки.
+func (s *Storage) CloneTask(taskID int, opts CloneOptions) (Task, error) {
+	err := s.authorizeWrite(RoleReporter)
+	if err != nil {
+		return Task{}, taskError("CloneTask", taskID, err)
+	}
+
+	ctx := context.Background()
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return Task{}, taskError("CloneTask", taskID, err)
+	}
+	defer tx.Rollback(ctx)
+
+	source, err := s.scanTask(tx.QueryRow(ctx, `
+		SELECT `+taskColumns+`
+		FROM tasks
+		WHERE id = $1 AND tenant_id = $2 AND can_access($3, tasks)
+	`,
+		taskID,
+		s.tenantID,
+		s.userID,
+	))
+	if err == pgx.ErrNoRows {
+		return Task{}, taskError("CloneTask", taskID, ErrTaskNotFound)
+	}
+	if err != nil {
+		return Task{}, taskError("CloneTask", taskID, err)
+	}
+
+	clone := Task{AuthorID: source.AuthorID, Title: source.Title, Content: source.Content}
+	if opts.Assignee {
+		clone.AssignedID = source.AssignedID
+	}
+	id, err := s.insertTask(ctx, tx, clone, 0, nil)
+	if err != nil {
+		return Task{}, taskError("CloneTask", taskID, err)
+	}
+	task, err := s.scanTask(tx.QueryRow(ctx, `
+		SELECT `+taskColumns+`
+		FROM tasks
+		WHERE id = $1
+	`,
+		id,
+	))
+	if err != nil {
+		return Task{}, taskError("CloneTask", taskID, err)
+	}
+
+	if opts.Labels {
+		_, err = tx.Exec(ctx, `
+			INSERT INTO tasks_labels (task_id, label_id)
+			SELECT $1, label_id
+			FROM tasks_labels
+			WHERE task_id = $2 AND label_id NOT IN (SELECT label_id FROM tasks_labels WHERE task_id = $1)
+		`,
+			task.ID,
+			taskID,
+		)
+		if err != nil {
+			return Task{}, taskError("CloneTask", taskID, err)
+		}
+	}
+
+	return task, taskError("CloneTask", taskID, tx.Commit(ctx))
+}
+
+// SplitTask разбивает задачу на несколько подзадач, созданных из parts.
+// Подзадачи наследуют автора исходной задачи и создаются как в NewTask, с учётом
+// настроек приёма задач и правил автоматической разметки. Исходная задача закрывается,
+// если closeOriginal. Все изменения выполняются в одной транзакции.
+// Возвращает id созданных подзадач или ErrTaskNotFound, если исходная задача
+// недоступна пользователю хранилища.
+func (s *Storage) SplitTask(taskID int, parts []NewTaskInput, closeOriginal bool) ([]int, error) {
+	err := s.authorizeWrite(RoleReporter)
+	if err != nil {
+		return nil, taskError("SplitTask", taskID, err)
+	}
+
+	if len(parts) == 0 {
+		return nil, taskError("SplitTask", taskID, ErrNoTasksToAdd)
+	}
+
+	ctx := context.Background()
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return nil, taskError("SplitTask", taskID, err)
+	}
+	defer tx.Rollback(ctx)
+
+	var authorID int
+	err = tx.QueryRow(ctx, `
+		SELECT author_id
+		FROM tasks
+		WHERE id = $1 AND tenant_id = $2 AND can_access($3, tasks)
+		FOR UPDATE
+	`,
+		taskID,
+		s.tenantID,
+		s.userID,
+	).Scan(&authorID)
+	if err == pgx.ErrNoRows {
+		return nil, taskError("SplitTask", taskID, ErrTaskNotFound)
+	}
+	if err != nil {
+		return nil, taskError("SplitTask", taskID, err)
+	}
+
+	ids := make([]int, 0, len(parts))
+	for _, p := range parts {
+		id, err := s.insertTask(ctx, tx, Task{
+			AuthorID:   authorID,
+			AssignedID: p.AssignedID,
+			Title:      p.Title,
+			Content:    p.Content,
+		}, taskID, nil)
+		if err != nil {
+			return nil, taskError("SplitTask", taskID, err)
+		}
+		ids = append(ids, id)
+	}
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO task_history (task_id, field, new_value)
+		SELECT $1, 'subtask', id::text
+		FROM unnest($2::integer[]) AS id
+	`,
+		taskID,
+		ids,
+	)
+	if err != nil {
+		return nil, taskError("SplitTask", taskID, err)
+	}
+
+	if closeOriginal {
+		_, err = tx.Exec(ctx, `
+			UPDATE tasks
+			SET closed = extract(epoch from now())
+			WHERE id = $1 AND closed = 0
+		`,
+			taskID,
+		)
+		if err != nil {
+			return nil, taskError("SplitTask", taskID, err)
+		}
+	}
+
+	return ids, taskError("SplitTask", taskID, tx.Commit(ctx))
 }
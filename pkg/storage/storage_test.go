@@ -1,12 +1,20 @@
 package storage
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
 	"reflect"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
+
+	embeddedpostgres "github.com/fergusstrange/embedded-postgres"
+	"github.com/jackc/pgx/v4"
 )
 
 var (
@@ -14,6 +22,9 @@ var (
 	ErrDBNotResponding = fmt.Errorf("DB not responding")
 )
 
+// Схема, в которой выполняются тесты пакета, пустая - схема по умолчанию.
+var testSchema string
+
 func postgresConf() Config {
 	conf := Config{
 		User:     "postgres",
@@ -21,11 +32,177 @@ func postgresConf() Config {
 		Host:     "localhost",
 		Port:     "5433",
 		DBName:   "tasks",
+		Schema:   testSchema,
 	}
 
 	return conf
 }
 
+// TestMain готовит БД для тестов пакета по переменным окружения.
+//
+// С POSTGRES_EMBEDDED=1 тесты выполняются на встроенном Postgres вместо контейнера
+// Docker: при первом запуске скачивается сборка Postgres, сервер запускается
+// на порту 5433 во временном каталоге и получает схему из db_init/init.sql,
+// а после тестов останавливается.
+//
+// С POSTGRES_TEST_SCHEMA=1 тесты выполняются в отдельной схеме с уникальным именем,
+// созданной по db_init/init.sql и удаляемой после тестов, поэтому одновременные
+// запуски тестов на одной БД не видят данных друг друга и тестовых данных БД.
+func TestMain(m *testing.M) {
+	os.Exit(runTests(m))
+}
+
+// runTests запускает тесты пакета для TestMain и возвращает код завершения.
+func runTests(m *testing.M) int {
+	if os.Getenv("POSTGRES_EMBEDDED") != "" {
+		stop, err := startEmbeddedPostgres()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Can't start embedded Postgres: %v\n", err)
+			return 1
+		}
+		defer func() {
+			err := stop()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Can't stop embedded Postgres: %v\n", err)
+			}
+		}()
+	}
+
+	if os.Getenv("POSTGRES_TEST_SCHEMA") != "" {
+		drop, err := createTestSchema()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Can't create test schema: %v\n", err)
+			return 1
+		}
+		defer func() {
+			err := drop()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Can't drop test schema: %v\n", err)
+			}
+		}()
+	}
+
+	return m.Run()
+}
+
+// startEmbeddedPostgres запускает встроенный Postgres с параметрами postgresConf
+// и создаёт в нём БД по db_init/init.sql. Возвращает функцию остановки сервера.
+func startEmbeddedPostgres() (func() error, error) {
+	if os.Getenv("POSTGRES_PASSWORD") == "" {
+		os.Setenv("POSTGRES_PASSWORD", "postgres")
+	}
+	conf := postgresConf()
+
+	dir, err := os.MkdirTemp("", "tasks-postgres-*")
+	if err != nil {
+		return nil, err
+	}
+	var port uint32
+	fmt.Sscan(conf.Port, &port)
+	var log bytes.Buffer
+	pg := embeddedpostgres.NewDatabase(embeddedpostgres.DefaultConfig().
+		Port(port).
+		Username(conf.User).
+		Password(conf.Password).
+		RuntimePath(dir).
+		StartParameters(map[string]string{"max_prepared_transactions": "10"}).
+		Logger(&log))
+	err = pg.Start()
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, fmt.Errorf("%w\n%s", err, log.String())
+	}
+	stop := func() error {
+		defer os.RemoveAll(dir)
+		return pg.Stop()
+	}
+
+	ctx := context.Background()
+	admin := conf
+	admin.DBName = "postgres"
+	conn, err := pgx.Connect(ctx, admin.ConString())
+	if err == nil {
+		_, err = conn.Exec(ctx, `CREATE DATABASE `+conf.DBName)
+		conn.Close(ctx)
+	}
+	if err == nil {
+		err = loadSchema(conf)
+	}
+	if err != nil {
+		stop()
+		return nil, err
+	}
+
+	return stop, nil
+}
+
+// createTestSchema создаёт схему с уникальным именем по db_init/init.sql и выполняет
+// в ней тесты пакета. Возвращает функцию удаления схемы.
+func createTestSchema() (func() error, error) {
+	conf := postgresConf()
+	name := "test_storage_" + strconv.FormatInt(time.Now().UnixNano(), 36)
+
+	ctx := context.Background()
+	conn, err := pgx.Connect(ctx, conf.ConString())
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close(ctx)
+	// расширение создаётся в public до схемы, иначе оно попадёт в схему
+	// теста и будет удалено вместе с ней
+	_, err = conn.Exec(ctx, `CREATE EXTENSION IF NOT EXISTS pg_trgm SCHEMA public`)
+	if err != nil {
+		return nil, err
+	}
+	_, err = conn.Exec(ctx, `CREATE SCHEMA `+name)
+	if err != nil {
+		return nil, err
+	}
+	drop := func() error {
+		conn, err := pgx.Connect(ctx, conf.ConString())
+		if err != nil {
+			return err
+		}
+		defer conn.Close(ctx)
+		_, err = conn.Exec(ctx, `DROP SCHEMA `+name+` CASCADE`)
+		return err
+	}
+
+	conf.Schema = name
+	err = loadSchema(conf)
+	if err != nil {
+		drop()
+		return nil, err
+	}
+	testSchema = name
+
+	return drop, nil
+}
+
+// loadSchema создаёт таблицы по db_init/init.sql в БД и схеме conf. Скрипт рассчитан
+// на psql и сам создаёт БД, поэтому выполняется его часть после переключения
+// на БД командой \c.
+func loadSchema(conf Config) error {
+	script, err := os.ReadFile(filepath.Join("..", "..", "db_init", "init.sql"))
+	if err != nil {
+		return err
+	}
+	_, schema, ok := strings.Cut(string(script), `\c `+conf.DBName+`;`)
+	if !ok {
+		return fmt.Errorf("init.sql: no \\c %s", conf.DBName)
+	}
+
+	ctx := context.Background()
+	conn, err := pgx.Connect(ctx, conf.ConString())
+	if err != nil {
+		return err
+	}
+	defer conn.Close(ctx)
+	_, err = conn.Exec(ctx, schema)
+
+	return err
+}
+
 func storageConnect() (*Storage, error) {
 	conf := postgresConf()
 	db, err := New(conf.ConString())
@@ -33,7 +210,7 @@ func storageConnect() (*Storage, error) {
 		return nil, ErrConnectDB
 	}
 
-	err = db.Ping()
+	err = db.Ping(context.Background())
 	if err != nil {
 		return nil, ErrDBNotResponding
 	}
@@ -46,7 +223,7 @@ func TestStorage_Tasks(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	defer db.Close()
+	defer db.Close(context.Background())
 
 	wantTasksCnt := 5
 	tasks, err := db.Tasks(0, 0)
@@ -63,7 +240,7 @@ func TestStorage_TasksAll(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	defer db.Close()
+	defer db.Close(context.Background())
 
 	wantTasksCnt := 5
 	tasks, err := db.TasksAll()
@@ -80,7 +257,7 @@ func TestStorage_TasksByTaskIDExists(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	defer db.Close()
+	defer db.Close(context.Background())
 
 	wantTasksCnt := 1
 	for targetTaskID := 1; targetTaskID <= 5; targetTaskID++ {
@@ -103,7 +280,7 @@ func TestStorage_TasksByTaskIDDoesNotExist(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	defer db.Close()
+	defer db.Close(context.Background())
 
 	wantTasksCnt := 0
 	targetTaskID := 42
@@ -121,7 +298,7 @@ func TestStorage_TasksByID(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	defer db.Close()
+	defer db.Close(context.Background())
 
 	tasks, err := db.TasksAll()
 	if err != nil {
@@ -143,7 +320,7 @@ func TestStorage_TasksByIDDoesNotExist(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	defer db.Close()
+	defer db.Close(context.Background())
 
 	targetID := 99999
 	_, err = db.TaskByID(targetID)
@@ -157,7 +334,7 @@ func TestStorage_TasksByAuthorIDExists(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	defer db.Close()
+	defer db.Close(context.Background())
 
 	wantTasksCnt := 2
 	targetAuthorID := 4
@@ -181,7 +358,7 @@ func TestStorage_TasksByAuthorIDDoesNotExist(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	defer db.Close()
+	defer db.Close(context.Background())
 
 	wantTasksCnt := 0
 	targetAuthorID := 42
@@ -199,7 +376,7 @@ func TestStorage_TasksByLabel(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	defer db.Close()
+	defer db.Close(context.Background())
 
 	tests := []struct {
 		name        string
@@ -253,7 +430,7 @@ func TestStorage_NewTasks(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	defer db.Close()
+	defer db.Close(context.Background())
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -285,7 +462,7 @@ func TestStorage_UpdateTaskAllFields(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	defer db.Close()
+	defer db.Close(context.Background())
 
 	targetTaskID := 3
 	newClosed := time.Now().Unix() + 1000
@@ -309,8 +486,8 @@ func TestStorage_UpdateTaskAllFields(t *testing.T) {
 	if updatedTask.AssignedID != newAssignedID {
 		t.Errorf("task.assigned_id: want %d, got %d", newAssignedID, updatedTask.AssignedID)
 	}
-	if updatedTask.Closed != newClosed {
-		t.Errorf("task.assigned_id: want %d, got %d", newClosed, updatedTask.Closed)
+	if updatedTask.ClosedUnix() != newClosed {
+		t.Errorf("task.assigned_id: want %d, got %d", newClosed, updatedTask.ClosedUnix())
 	}
 	if updatedTask.Title != newTitle {
 		t.Errorf("task.assigned_id: want %s, got %s", newTitle, updatedTask.Title)
@@ -325,7 +502,7 @@ func TestStorage_UpdateTaskPartialFields(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	defer db.Close()
+	defer db.Close(context.Background())
 
 	targetTaskID := 5
 	type param struct {
@@ -376,8 +553,8 @@ func TestStorage_UpdateTaskPartialFields(t *testing.T) {
 			if tt.AssignedID == 0 && updatedTask.AssignedID != taskBeforeUpdate.AssignedID {
 				t.Errorf("task.assigned_id: want %d, got %d", taskBeforeUpdate.AssignedID, updatedTask.AssignedID)
 			}
-			if tt.Closed == 0 && updatedTask.Closed != taskBeforeUpdate.Closed {
-				t.Errorf("task.assigned_id: want %d, got %d", taskBeforeUpdate.Closed, updatedTask.Closed)
+			if tt.Closed == 0 && updatedTask.ClosedUnix() != taskBeforeUpdate.ClosedUnix() {
+				t.Errorf("task.assigned_id: want %d, got %d", taskBeforeUpdate.ClosedUnix(), updatedTask.ClosedUnix())
 			}
 			if tt.Title == "" && updatedTask.Title != taskBeforeUpdate.Title {
 				t.Errorf("task.assigned_id: want %s, got %s", taskBeforeUpdate.Title, updatedTask.Title)
@@ -389,12 +566,33 @@ func TestStorage_UpdateTaskPartialFields(t *testing.T) {
 	}
 }
 
+func TestStorage_UpdateTaskClosedBeforeOpened(t *testing.T) {
+	db, err := storageConnect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close(context.Background())
+
+	taskID := newTestTask(t, db, "Closed too early")
+	err = db.UpdateTask(taskID, 0, 1700000000, "", "")
+	if !errors.Is(err, ErrClosedBeforeOpened) {
+		t.Errorf("error: want %v, got %v", ErrClosedBeforeOpened, err)
+	}
+	task, err := db.TaskByID(taskID)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if task.Closed != nil {
+		t.Errorf("closed: want nil, got %v", task.Closed)
+	}
+}
+
 func TestStorage_DeleteTaskIDExists(t *testing.T) {
 	db, err := storageConnect()
 	if err != nil {
 		t.Fatal(err)
 	}
-	defer db.Close()
+	defer db.Close(context.Background())
 
 	tasks, err := db.Tasks(0, 0)
 	if err != nil {
@@ -442,7 +640,7 @@ func TestStorage_DeleteTaskIDDoesNotExist(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	defer db.Close()
+	defer db.Close(context.Background())
 
 	targetID := 9999
 	err = db.DeleteTask(targetID)
@@ -472,7 +670,7 @@ func TestStorage_NewTask(t *testing.T) {
 		if err != nil {
 			t.Errorf("Can't remove new task: %v", err)
 		}
-		db.Close()
+		db.Close(context.Background())
 	}
 
 	newTask := Task{
@@ -495,3 +693,463 @@ func TestStorage_NewTask(t *testing.T) {
 		t.Errorf("Unexpected error: %v", err)
 	}
 }
+
+// newTestUser добавляет в БД временного пользователя и удаляет его по завершении теста.
+func newTestUser(t *testing.T, db *Storage, name string) int {
+	t.Helper()
+
+	var id int
+	err := db.db.QueryRow(context.Background(), `
+		INSERT INTO users (name) VALUES ($1) RETURNING id
+	`, name).Scan(&id)
+	if err != nil {
+		t.Fatalf("Can't create test user: %v", err)
+	}
+	t.Cleanup(func() {
+		_, err := db.db.Exec(context.Background(), `DELETE FROM users WHERE id = $1`, id)
+		if err != nil {
+			t.Errorf("Can't remove test user: %v", err)
+		}
+	})
+
+	return id
+}
+
+// newTestTask добавляет в БД временную задачу и удаляет её по завершении теста.
+func newTestTask(t *testing.T, db *Storage, title string) int {
+	t.Helper()
+
+	id, err := db.NewTask(Task{Title: title, Content: "Test content"})
+	if err != nil {
+		t.Fatalf("Can't create test task: %v", err)
+	}
+	t.Cleanup(func() {
+		err := db.DeleteTask(id)
+		if err != nil {
+			t.Errorf("Can't remove test task: %v", err)
+		}
+	})
+
+	return id
+}
+
+func TestStorage_ReassignTasks(t *testing.T) {
+	db, err := storageConnect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close(context.Background()) })
+
+	fromUserID := newTestUser(t, db, "Leaving User")
+	toUserID := newTestUser(t, db, "Receiving User")
+	openTaskID := newTestTask(t, db, "Open task")
+	closedTaskID := newTestTask(t, db, "Closed task")
+
+	err = db.UpdateTask(openTaskID, fromUserID, 0, "", "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	err = db.UpdateTask(closedTaskID, fromUserID, time.Now().Unix()+1000, "", "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		onlyOpen bool
+		wantCnt  int
+		wantTask int
+	}{
+		{"only open tasks", true, 1, openTaskID},
+		{"remaining closed tasks", false, 1, closedTaskID},
+		{"nothing left to reassign", false, 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cnt, err := db.ReassignTasks(fromUserID, toUserID, tt.onlyOpen)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if cnt != tt.wantCnt {
+				t.Errorf("reassigned tasks: want %d, got %d", tt.wantCnt, cnt)
+			}
+			if tt.wantTask == 0 {
+				return
+			}
+
+			task, err := db.TaskByID(tt.wantTask)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if task.AssignedID != toUserID {
+				t.Errorf("task.assigned_id: want %d, got %d", toUserID, task.AssignedID)
+			}
+			history, err := db.TaskHistory(tt.wantTask)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if len(history) != 1 || history[0].Field != "assigned_id" {
+				t.Errorf("task history: want one assigned_id entry, got %+v", history)
+			}
+		})
+	}
+
+	_, err = db.ReassignTasks(fromUserID, fromUserID, false)
+	if !errors.Is(err, ErrSameUser) {
+		t.Errorf("error: want %v, got %v", ErrSameUser, err)
+	}
+}
+
+// addTestLabel вешает на задачу существующую метку.
+func addTestLabel(t *testing.T, db *Storage, taskID int, label string) {
+	t.Helper()
+
+	_, err := db.db.Exec(context.Background(), `
+		INSERT INTO tasks_labels (task_id, label_id)
+		SELECT $1, id FROM labels WHERE name = $2
+	`, taskID, label)
+	if err != nil {
+		t.Fatalf("Can't add label %q to task %d: %v", label, taskID, err)
+	}
+}
+
+func TestStorage_MergeTasks(t *testing.T) {
+	db, err := storageConnect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close(context.Background()) })
+
+	primaryID := newTestTask(t, db, "Login fails")
+	dup1ID := newTestTask(t, db, "Can't log in")
+	dup2ID := newTestTask(t, db, "Login is broken")
+	addTestLabel(t, db, dup1ID, "Documentation")
+	addTestLabel(t, db, dup2ID, "Documentation")
+
+	err = db.MergeTasks(primaryID, []int{dup1ID, dup2ID})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	tasks, err := db.TasksByLabel("Documentation")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	labeled := 0
+	for _, task := range tasks {
+		if task.ID == primaryID {
+			labeled++
+		}
+	}
+	if labeled != 1 {
+		t.Errorf("primary task labels: want label once, got %d times", labeled)
+	}
+
+	for _, id := range []int{dup1ID, dup2ID} {
+		task, err := db.TaskByID(id)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if task.Closed == nil {
+			t.Errorf("duplicate task id:%d wasn't closed", id)
+		}
+		history, err := db.TaskHistory(id)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if len(history) != 1 || history[0].Field != "duplicate_of" {
+			t.Errorf("task history: want one duplicate_of entry, got %+v", history)
+		}
+	}
+
+	tests := []struct {
+		name         string
+		duplicateIDs []int
+		wantErr      error
+	}{
+		{"no duplicates", nil, ErrNoDuplicates},
+		{"merge into itself", []int{dup1ID, primaryID}, ErrSelfMerge},
+		{"duplicate doesn't exist", []int{99999}, ErrTaskNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := db.MergeTasks(primaryID, tt.duplicateIDs)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("error: want %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestStorage_CloneTask(t *testing.T) {
+	db, err := storageConnect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close(context.Background()) })
+
+	userID := newTestUser(t, db, "Assignee")
+	srcID := newTestTask(t, db, "Weekly report")
+	addTestLabel(t, db, srcID, "Enhancement")
+	err = db.UpdateTask(srcID, userID, 0, "", "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name         string
+		opts         CloneOptions
+		wantAssigned int
+		wantLabeled  bool
+	}{
+		{"plain copy", CloneOptions{}, 0, false},
+		{"with labels", CloneOptions{Labels: true}, 0, true},
+		{"with assignee", CloneOptions{Assignee: true}, userID, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clone, err := db.CloneTask(srcID, tt.opts)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			t.Cleanup(func() {
+				err := db.DeleteTask(clone.ID)
+				if err != nil {
+					t.Errorf("Can't remove cloned task: %v", err)
+				}
+			})
+
+			if clone.ID == srcID {
+				t.Fatalf("clone has the same id as the source task")
+			}
+			if clone.Title != "Weekly report" || clone.Content != "Test content" {
+				t.Errorf("clone title/content don't match source: %+v", clone)
+			}
+			if clone.AssignedID != tt.wantAssigned {
+				t.Errorf("clone.assigned_id: want %d, got %d", tt.wantAssigned, clone.AssignedID)
+			}
+
+			tasks, err := db.TasksByLabel("Enhancement")
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			labeled := false
+			for _, task := range tasks {
+				if task.ID == clone.ID {
+					labeled = true
+				}
+			}
+			if labeled != tt.wantLabeled {
+				t.Errorf("clone labeled: want %v, got %v", tt.wantLabeled, labeled)
+			}
+		})
+	}
+
+	_, err = db.CloneTask(99999, CloneOptions{})
+	if !errors.Is(err, ErrTaskNotFound) {
+		t.Errorf("error: want %v, got %v", ErrTaskNotFound, err)
+	}
+}
+
+func TestStorage_SplitTask(t *testing.T) {
+	db, err := storageConnect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close(context.Background()) })
+
+	parts := []NewTaskInput{
+		{Title: "Backend part", Content: "API changes"},
+		{Title: "Frontend part", Content: "UI changes"},
+	}
+
+	tests := []struct {
+		name          string
+		closeOriginal bool
+	}{
+		{"keep original open", false},
+		{"close original", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			taskID := newTestTask(t, db, "Big feature")
+
+			ids, err := db.SplitTask(taskID, parts, tt.closeOriginal)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			t.Cleanup(func() {
+				for _, id := range ids {
+					err := db.DeleteTask(id)
+					if err != nil {
+						t.Errorf("Can't remove subtask: %v", err)
+					}
+				}
+			})
+
+			subtasks, err := db.Subtasks(taskID)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if len(subtasks) != len(parts) {
+				t.Fatalf("subtasks num: want %d, got %d", len(parts), len(subtasks))
+			}
+			for i, task := range subtasks {
+				if task.ID != ids[i] || task.Title != parts[i].Title {
+					t.Errorf("subtask: want id:%d %q, got id:%d %q", ids[i], parts[i].Title, task.ID, task.Title)
+				}
+			}
+
+			original, err := db.TaskByID(taskID)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if closed := original.Closed != nil; closed != tt.closeOriginal {
+				t.Errorf("original closed: want %v, got %v", tt.closeOriginal, closed)
+			}
+		})
+	}
+
+	_, err = db.SplitTask(99999, parts, false)
+	if !errors.Is(err, ErrTaskNotFound) {
+		t.Errorf("error: want %v, got %v", ErrTaskNotFound, err)
+	}
+	_, err = db.SplitTask(99999, nil, false)
+	if !errors.Is(err, ErrNoTasksToAdd) {
+		t.Errorf("error: want %v, got %v", ErrNoTasksToAdd, err)
+	}
+}
+
+func TestStorage_ForTenant(t *testing.T) {
+	db, err := storageConnect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close(context.Background()) })
+
+	const tenantID = 42
+	tenant := db.ForTenant(tenantID)
+
+	tasks, err := tenant.TasksAll()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(tasks) != 0 {
+		t.Fatalf("tenant tasks num: want 0, got %d", len(tasks))
+	}
+
+	tenantTaskID := newTestTask(t, tenant, "Tenant task")
+	defaultTaskID := newTestTask(t, db, "Default tenant task")
+
+	tasks, err = tenant.TasksAll()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(tasks) != 1 || tasks[0].ID != tenantTaskID {
+		t.Errorf("tenant tasks: want only task id:%d, got %+v", tenantTaskID, tasks)
+	}
+
+	_, err = tenant.TaskByID(defaultTaskID)
+	if !errors.Is(err, ErrTaskNotFound) {
+		t.Errorf("error: want %v, got %v", ErrTaskNotFound, err)
+	}
+	_, err = db.TaskByID(tenantTaskID)
+	if !errors.Is(err, ErrTaskNotFound) {
+		t.Errorf("error: want %v, got %v", ErrTaskNotFound, err)
+	}
+
+	err = tenant.UpdateTask(defaultTaskID, 0, 0, "Hijacked", "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	task, err := db.TaskByID(defaultTaskID)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if task.Title == "Hijacked" {
+		t.Errorf("task from another tenant was updated")
+	}
+}
+
+func TestTask_UnixShims(t *testing.T) {
+	open := Task{Opened: unixTime(1700000000), Closed: closedTime(0)}
+	if open.Closed != nil {
+		t.Errorf("closed: want nil, got %v", open.Closed)
+	}
+	if got := open.ClosedUnix(); got != 0 {
+		t.Errorf("closed: want 0, got %d", got)
+	}
+	if got := open.OpenedUnix(); got != 1700000000 {
+		t.Errorf("opened: want 1700000000, got %d", got)
+	}
+	if loc := open.Opened.Location(); loc != time.UTC {
+		t.Errorf("location: want UTC, got %v", loc)
+	}
+
+	closed := Task{Closed: closedTime(1700000100)}
+	if got := closed.ClosedUnix(); got != 1700000100 {
+		t.Errorf("closed: want 1700000100, got %d", got)
+	}
+}
+
+// Количество задач в рабочем пространстве бенчмарков чтения.
+const benchTasks = 10000
+
+// benchTaskBatch возвращает n задач с неповторяющимися названиями, начиная с номера from.
+func benchTaskBatch(from, n int) []Task {
+	verbs := []string{"Fix", "Add", "Remove", "Refactor", "Document"}
+	nouns := []string{"login page", "search index", "export", "notifications", "settings"}
+	tasks := make([]Task, n)
+	for i := range tasks {
+		num := from + i
+		tasks[i] = Task{
+			Title:   fmt.Sprintf("%s %s %d", verbs[num%len(verbs)], nouns[num/len(verbs)%len(nouns)], num),
+			Content: "Benchmark content",
+		}
+	}
+	return tasks
+}
+
+// newBenchTasks добавляет в рабочее пространство db n задач и удаляет задачи
+// рабочего пространства по завершении бенчмарка.
+func newBenchTasks(b *testing.B, db *Storage, n int) {
+	b.Helper()
+
+	b.Cleanup(func() {
+		_, err := db.db.Exec(context.Background(), `DELETE FROM tasks WHERE tenant_id = $1`, db.tenantID)
+		if err != nil {
+			b.Errorf("Can't remove benchmark tasks: %v", err)
+		}
+	})
+	if n == 0 {
+		return
+	}
+	err := db.NewTasks(benchTaskBatch(0, n))
+	if err != nil {
+		b.Fatalf("Can't create benchmark tasks: %v", err)
+	}
+}
+
+func BenchmarkStorage_NewTasks(b *testing.B) {
+	db, err := storageConnect()
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() { db.Close(context.Background()) })
+
+	tenant := db.ForTenant(1237)
+	newBenchTasks(b, tenant, 0)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		err = tenant.NewTasks(benchTaskBatch(i*importChunkSize, importChunkSize))
+		if err != nil {
+			b.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	b.ReportMetric(float64(b.N*importChunkSize)/b.Elapsed().Seconds(), "tasks/s")
+}
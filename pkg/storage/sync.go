@@ -0,0 +1,275 @@
+package storage
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// Изменения задач для инкрементальной синхронизации клиентов.
+type TaskDelta struct {
+	Created []Task // задачи, созданные начиная с since
+	Updated []Task // задачи, созданные раньше since и изменённые начиная с since
+	Deleted []int  // id задач, удалённых начиная с since
+	Until   int64  // время среза, значение since для следующей синхронизации
+	// версии созданных и изменённых задач по id,
+	// клиент передаёт их в TaskChange.Version при отправке изменений
+	Versions map[int]int
+}
+
+// TasksModifiedSince возвращает задачи, созданные, изменённые или удалённые
+// начиная с момента since (включительно, с точностью до секунды).
+// Удалённые приватные задачи возвращаются только пользователям, у которых
+// был к ним доступ. Все выборки выполняются на одном снимке данных.
+func (s *Storage) TasksModifiedSince(since int64) (TaskDelta, error) {
+	delta := TaskDelta{Versions: make(map[int]int)}
+
+	ctx := context.Background()
+	tx, err := s.db.BeginTx(ctx, pgx.TxOptions{
+		IsoLevel:   pgx.RepeatableRead,
+		AccessMode: pgx.ReadOnly,
+	})
+	if err != nil {
+		return delta, err
+	}
+	defer tx.Rollback(ctx)
+
+	err = tx.QueryRow(ctx, `SELECT extract(epoch from now())::bigint`).Scan(&delta.Until)
+	if err != nil {
+		return delta, err
+	}
+
+	rows, err := tx.Query(ctx, `
+		SELECT `+taskColumns+`, version
+		FROM tasks
+		WHERE
+			updated >= $1 AND
+			tenant_id = $2 AND
+			can_access($3, tasks)
+		ORDER BY id
+	`,
+		since,
+		s.tenantID,
+		s.userID,
+	)
+	if err != nil {
+		return delta, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var version int
+		t, err := s.scanTask(rows, &version)
+		if err != nil {
+			return delta, err
+		}
+		delta.Versions[t.ID] = version
+		if t.OpenedUnix() >= since {
+			delta.Created = append(delta.Created, t)
+		} else {
+			delta.Updated = append(delta.Updated, t)
+		}
+	}
+	if rows.Err() != nil {
+		return delta, rows.Err()
+	}
+
+	rows, err = tx.Query(ctx, `
+		SELECT task_id
+		FROM deleted_tasks
+		WHERE
+			deleted >= $1 AND
+			tenant_id = $2 AND
+			($3 = 0 OR viewers IS NULL OR $3 = ANY(viewers))
+		ORDER BY task_id
+	`,
+		since,
+		s.tenantID,
+		s.userID,
+	)
+	if err != nil {
+		return delta, err
+	}
+	delta.Deleted, err = collectRows(rows, func(row pgx.Row) (int, error) {
+		var id int
+		err := row.Scan(&id)
+		return id, err
+	})
+
+	return delta, err
+}
+
+// Изменение задачи, сделанное клиентом без связи с сервером.
+// Нулевые значения атрибутов означают, что атрибут не изменялся.
+type TaskChange struct {
+	TaskID     int   // 0 - новая задача
+	Version    int   // версия задачи, на основе которой сделано изменение
+	Delete     bool  // удалить задачу
+	AssignedID int   // ответственный
+	Closed     int64 // время выполнения
+	Title      string
+	Content    string
+}
+
+// Применённое изменение.
+type AppliedChange struct {
+	Index   int // индекс изменения в переданном списке
+	TaskID  int // id задачи, для новых задач - присвоенный id
+	Version int // новая версия задачи, 0 для удалённых задач
+}
+
+// Конфликт изменения с текущим состоянием задачи на сервере.
+type TaskConflict struct {
+	Index   int // индекс изменения в переданном списке
+	Change  TaskChange
+	Current Task // текущее состояние задачи на сервере
+	Version int  // текущая версия задачи на сервере
+	Deleted bool // задача удалена на сервере
+}
+
+// Результат применения изменений клиента.
+type SyncResult struct {
+	Applied   []AppliedChange
+	Conflicts []TaskConflict
+}
+
+// ApplyClientChanges применяет изменения клиента в одной транзакции.
+// Изменение применяется, только если версия задачи на сервере совпадает с версией,
+// на основе которой оно сделано. Остальные изменения возвращаются как конфликты
+// вместе с текущим состоянием задачи для разрешения на клиенте; изменения задач,
+// недоступных пользователю, возвращаются как конфликты с удалённой задачей.
+// Новые задачи создаются как в NewTask, с учётом настроек приёма задач
+// и правил автоматической разметки. Время выполнения раньше времени создания задачи
+// на сервере, например у задачи, созданной и выполненной без связи, или из-за
+// расхождения часов клиента, заменяется временем создания.
+func (s *Storage) ApplyClientChanges(changes []TaskChange) (SyncResult, error) {
+	var res SyncResult
+	err := s.authorizeWrite(RoleReporter)
+	if err != nil {
+		return res, err
+	}
+	for _, c := range changes {
+		if c.Delete {
+			err = s.authorize(RoleMaintainer)
+			if err != nil {
+				return res, err
+			}
+			break
+		}
+	}
+
+	ctx := context.Background()
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return res, err
+	}
+	defer tx.Rollback(ctx)
+
+	for i, c := range changes {
+		applied := AppliedChange{Index: i, TaskID: c.TaskID}
+		content, err := s.encrypt(c.Content)
+		if err != nil {
+			return SyncResult{}, err
+		}
+
+		switch {
+		case c.TaskID == 0:
+			applied.TaskID, err = s.insertTask(ctx, tx, Task{
+				AssignedID: c.AssignedID,
+				Title:      c.Title,
+				Content:    c.Content,
+			}, 0, nil)
+			if err != nil {
+				return SyncResult{}, err
+			}
+			// время выполнения клиента задаётся после создания задачи
+			err = tx.QueryRow(ctx, `
+				WITH changed AS (
+					UPDATE tasks
+					SET closed = GREATEST($2, opened)
+					WHERE id = $1 AND $2 > 0
+					RETURNING version
+				)
+				SELECT version FROM changed
+				UNION ALL
+				SELECT version FROM tasks WHERE id = $1 AND NOT EXISTS (SELECT 1 FROM changed)
+			`,
+				applied.TaskID,
+				c.Closed,
+			).Scan(&applied.Version)
+
+		case c.Delete:
+			err = tx.QueryRow(ctx, `
+				DELETE FROM tasks
+				WHERE id = $1 AND version = $2 AND tenant_id = $3 AND can_access($4, tasks)
+				RETURNING id
+			`,
+				c.TaskID,
+				c.Version,
+				s.tenantID,
+				s.userID,
+			).Scan(&applied.TaskID)
+			if err == nil {
+				err = s.audit(ctx, tx, AuditTaskDelete, map[string]interface{}{
+					"task_id": c.TaskID,
+				})
+			}
+
+		default:
+			err = tx.QueryRow(ctx, `
+				UPDATE tasks
+				SET
+					closed = CASE WHEN $3 > 0 THEN GREATEST($3, opened) ELSE closed END,
+					assigned_id = CASE WHEN $4 > 0 THEN $4 ELSE assigned_id END,
+					title = CASE WHEN $5 <> '' THEN $5 ELSE title END,
+					content = CASE WHEN $6 <> '' THEN $6 ELSE content END
+				WHERE id = $1 AND version = $2 AND tenant_id = $7 AND can_access($8, tasks)
+				RETURNING version
+			`,
+				c.TaskID,
+				c.Version,
+				c.Closed,
+				c.AssignedID,
+				c.Title,
+				content,
+				s.tenantID,
+				s.userID,
+			).Scan(&applied.Version)
+		}
+
+		if err == pgx.ErrNoRows {
+			conflict, err := s.conflict(ctx, tx, i, c)
+			if err != nil {
+				return SyncResult{}, err
+			}
+			res.Conflicts = append(res.Conflicts, conflict)
+			continue
+		}
+		if err != nil {
+			return SyncResult{}, err
+		}
+		res.Applied = append(res.Applied, applied)
+	}
+
+	return res, s.commit(ctx, tx)
+}
+
+// conflict возвращает конфликт изменения c с текущим состоянием задачи.
+func (s *Storage) conflict(ctx context.Context, tx pgx.Tx, index int, c TaskChange) (TaskConflict, error) {
+	conflict := TaskConflict{Index: index, Change: c}
+	current, err := s.scanTask(tx.QueryRow(ctx, `
+		SELECT `+taskColumns+`, version
+		FROM tasks
+		WHERE id = $1 AND tenant_id = $2 AND can_access($3, tasks)
+	`,
+		c.TaskID,
+		s.tenantID,
+		s.userID,
+	), &conflict.Version)
+	if err == pgx.ErrNoRows {
+		conflict.Deleted = true
+		return conflict, nil
+	}
+	conflict.Current = current
+
+	return conflict, err
+}
@@ -0,0 +1,241 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestStorage_TasksModifiedSince(t *testing.T) {
+	conn, err := storageConnect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close(context.Background()) })
+	// отдельное рабочее пространство, чтобы не видеть изменений других тестов
+	db := conn.ForTenant(1154)
+
+	oldID := newTestTask(t, db, "Old task")
+	deletedID, err := db.NewTask(Task{Title: "Deleted task"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// задачи созданы "в прошлом", чтобы отличать их от новых
+	_, err = db.db.Exec(context.Background(), `
+		UPDATE tasks SET opened = opened - 100, updated = updated - 100 WHERE id = ANY($1)
+	`, []int{oldID, deletedID})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	since := time.Now().Unix() - 10
+	delta, err := db.TasksModifiedSince(since)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(delta.Created)+len(delta.Updated)+len(delta.Deleted) != 0 {
+		t.Errorf("delta: want no changes, got %+v", delta)
+	}
+	if delta.Until < since {
+		t.Errorf("delta.until: want >= %d, got %d", since, delta.Until)
+	}
+
+	newID := newTestTask(t, db, "New task")
+	err = db.UpdateTask(oldID, 0, 0, "Old task renamed", "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	err = db.DeleteTask(deletedID)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	delta, err = db.TasksModifiedSince(since)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(delta.Created) != 1 || delta.Created[0].ID != newID {
+		t.Errorf("created: want task id:%d, got %+v", newID, delta.Created)
+	}
+	if len(delta.Updated) != 1 || delta.Updated[0].ID != oldID {
+		t.Errorf("updated: want task id:%d, got %+v", oldID, delta.Updated)
+	}
+	if len(delta.Deleted) != 1 || delta.Deleted[0] != deletedID {
+		t.Errorf("deleted: want task id:%d, got %v", deletedID, delta.Deleted)
+	}
+
+	// удаление приватной задачи видно только пользователям с доступом к ней
+	ctx := context.Background()
+	var userID int
+	err = conn.db.QueryRow(ctx, `INSERT INTO users (tenant_id, name) VALUES (1154, 'Sync outsider') RETURNING id`).Scan(&userID)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	t.Cleanup(func() { conn.db.Exec(ctx, `DELETE FROM users WHERE id = $1`, userID) })
+	privateID, err := db.NewTask(Task{Title: "Private deleted task"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	err = db.SetVisibility(privateID, VisibilityPrivate)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	err = db.DeleteTask(privateID)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	delta, err = db.AsUser(userID).TasksModifiedSince(since)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for _, id := range delta.Deleted {
+		if id == privateID {
+			t.Errorf("deleted: want private task id:%d hidden, got %v", privateID, delta.Deleted)
+		}
+	}
+}
+
+func TestStorage_ApplyClientChanges(t *testing.T) {
+	conn, err := storageConnect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close(context.Background()) })
+	db := conn.ForTenant(1155)
+
+	taskID := newTestTask(t, db, "Synced task")
+	staleID := newTestTask(t, db, "Stale task")
+	deleteID, err := db.NewTask(Task{Title: "Task to delete"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	delta, err := db.TasksModifiedSince(0)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// изменение на сервере после синхронизации клиента
+	err = db.UpdateTask(staleID, 0, 0, "Changed on server", "")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	changes := []TaskChange{
+		{Title: "Created offline"},
+		{TaskID: taskID, Version: delta.Versions[taskID], Title: "Renamed offline", Closed: 1},
+		{TaskID: staleID, Version: delta.Versions[staleID], Title: "Renamed offline"},
+		{TaskID: deleteID, Version: delta.Versions[deleteID], Delete: true},
+		{TaskID: 99999, Version: 1, Title: "Unknown task"},
+		// выполнена без связи до создания на сервере
+		{Title: "Closed offline", Closed: time.Now().Unix() - 3600},
+	}
+	res, err := db.ApplyClientChanges(changes)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	t.Cleanup(func() {
+		for _, a := range res.Applied {
+			if a.Index == 0 || a.Index == 5 {
+				err := db.DeleteTask(a.TaskID)
+				if err != nil {
+					t.Errorf("Can't remove test task: %v", err)
+				}
+			}
+		}
+	})
+
+	if len(res.Applied) != 4 {
+		t.Fatalf("applied changes: want 4, got %+v", res.Applied)
+	}
+	if res.Applied[1].TaskID != taskID || res.Applied[1].Version != delta.Versions[taskID]+1 {
+		t.Errorf("applied change: want task id:%d version %d, got %+v", taskID, delta.Versions[taskID]+1, res.Applied[1])
+	}
+	task, err := db.TaskByID(taskID)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if task.Title != "Renamed offline" {
+		t.Errorf("task.title: want %q, got %q", "Renamed offline", task.Title)
+	}
+	if task.ClosedUnix() != task.OpenedUnix() {
+		t.Errorf("task.closed: want opened %d, got %d", task.OpenedUnix(), task.ClosedUnix())
+	}
+	closedOffline, err := db.TaskByID(res.Applied[3].TaskID)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if closedOffline.ClosedUnix() != closedOffline.OpenedUnix() {
+		t.Errorf("created task closed: want opened %d, got %d", closedOffline.OpenedUnix(), closedOffline.ClosedUnix())
+	}
+	_, err = db.TaskByID(deleteID)
+	if !errors.Is(err, ErrTaskNotFound) {
+		t.Errorf("error: want %v, got %v", ErrTaskNotFound, err)
+	}
+
+	if len(res.Conflicts) != 2 {
+		t.Fatalf("conflicts: want 2, got %+v", res.Conflicts)
+	}
+	stale := res.Conflicts[0]
+	if stale.Index != 2 || stale.Deleted || stale.Current.Title != "Changed on server" {
+		t.Errorf("conflict: want server state of task id:%d, got %+v", staleID, stale)
+	}
+	if !res.Conflicts[1].Deleted {
+		t.Errorf("conflict: want deleted task, got %+v", res.Conflicts[1])
+	}
+}
+
+func TestStorage_ApplyClientChangesAccess(t *testing.T) {
+	conn, err := storageConnect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close(context.Background()) })
+	db := conn.ForTenant(1155)
+	ctx := context.Background()
+
+	var userID int
+	err = conn.db.QueryRow(ctx, `INSERT INTO users (tenant_id, name) VALUES (1155, 'Sync reporter') RETURNING id`).Scan(&userID)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	privateID := newTestTask(t, db, "Private task")
+	t.Cleanup(func() { conn.db.Exec(ctx, `DELETE FROM users WHERE id = $1`, userID) })
+	err = db.SetVisibility(privateID, VisibilityPrivate)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	delta, err := db.TasksModifiedSince(0)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// изменение недоступной задачи выглядит как конфликт с удалённой задачей
+	res, err := db.AsUser(userID).ApplyClientChanges([]TaskChange{
+		{TaskID: privateID, Version: delta.Versions[privateID], Title: "Renamed by outsider"},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(res.Applied) != 0 || len(res.Conflicts) != 1 || !res.Conflicts[0].Deleted {
+		t.Errorf("private task change: want deleted conflict, got %+v", res)
+	}
+	task, err := db.TaskByID(privateID)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if task.Title != "Private task" {
+		t.Errorf("task.title: want %q, got %q", "Private task", task.Title)
+	}
+
+	// новые задачи проверяются настройками приёма
+	err = db.SetIntakeSettings(IntakeSettings{RequiredFields: []string{FieldContent}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	t.Cleanup(func() { conn.db.Exec(ctx, `DELETE FROM intake_settings WHERE tenant_id = 1155`) })
+	_, err = db.ApplyClientChanges([]TaskChange{{Title: "Created offline without content"}})
+	if !errors.Is(err, ErrRequiredField) {
+		t.Errorf("error: want %v, got %v", ErrRequiredField, err)
+	}
+}
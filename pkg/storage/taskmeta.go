@@ -0,0 +1,73 @@
+package storage
+
+import (
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// Сведения о задаче без содержимого для списков, в которых содержимое не показывается.
+type TaskMeta struct {
+	ID          int
+	Title       string
+	AuthorID    int
+	AssignedID  int
+	Opened      time.Time
+	Closed      *time.Time // nil для открытой задачи
+	Updated     time.Time
+	TitleSize   int // длина названия в символах
+	ContentSize int // размер сохранённого содержимого в байтах, при шифровании - зашифрованного
+}
+
+// Страница списка сведений о задачах.
+type TaskMetaPage struct {
+	Tasks []TaskMeta
+	Next  string // курсор следующей страницы, пустой для последней страницы
+}
+
+// TasksMeta возвращает страницу сведений о задачах, подходящих под фильтр f,
+// так же как TasksFiltered, но без чтения и расшифровки содержимого задач.
+func (s *Storage) TasksMeta(f TasksFilter) (TaskMetaPage, error) {
+	tasks, next, err := filteredPage(s, f, `
+			t.id,
+			t.title,
+			t.author_id,
+			t.assigned_id,
+			t.opened,
+			t.closed,
+			t.updated,
+			char_length(t.title),
+			octet_length(t.content)
+		`,
+		scanTaskMeta,
+		func(m TaskMeta) Task {
+			return Task{ID: m.ID, Title: m.Title, Opened: m.Opened, Closed: m.Closed}
+		},
+	)
+	return TaskMetaPage{Tasks: tasks, Next: next}, err
+}
+
+// scanTaskMeta сканирует сведения о задаче.
+func scanTaskMeta(row pgx.Row) (TaskMeta, error) {
+	var m TaskMeta
+	var opened, closed, updated int64
+	err := row.Scan(
+		&m.ID,
+		&m.Title,
+		&m.AuthorID,
+		&m.AssignedID,
+		&opened,
+		&closed,
+		&updated,
+		&m.TitleSize,
+		&m.ContentSize,
+	)
+	if err != nil {
+		return TaskMeta{}, err
+	}
+	m.Opened = unixTime(opened)
+	m.Closed = closedTime(closed)
+	m.Updated = unixTime(updated)
+
+	return m, nil
+}
@@ -0,0 +1,41 @@
+package storage
+
+import (
+	"context"
+	"testing"
+)
+
+func TestStorage_TasksMeta(t *testing.T) {
+	db, err := storageConnect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close(context.Background()) })
+
+	tenant := db.ForTenant(1217)
+	first := newTestTask(t, tenant, "Первая")
+	second := newTestTask(t, tenant, "Second")
+
+	page, err := tenant.TasksMeta(TasksFilter{Limit: 1})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(page.Tasks) != 1 || page.Next == "" {
+		t.Fatalf("page: want 1 task and next cursor, got %+v", page)
+	}
+	meta := page.Tasks[0]
+	if meta.ID != first || meta.Title != "Первая" || meta.TitleSize != 6 || meta.ContentSize != len("Test content") {
+		t.Errorf("meta: want task %d with sizes 6 and %d, got %+v", first, len("Test content"), meta)
+	}
+	if meta.Closed != nil || meta.Opened.IsZero() || meta.Updated.IsZero() {
+		t.Errorf("meta: want open task with timestamps, got %+v", meta)
+	}
+
+	page, err = tenant.TasksMeta(TasksFilter{Limit: 1, Cursor: page.Next})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(page.Tasks) != 1 || page.Tasks[0].ID != second || page.Next != "" {
+		t.Errorf("page: want last task %d, got %+v", second, page)
+	}
+}
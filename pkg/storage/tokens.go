@@ -0,0 +1,220 @@
+package storage
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+var (
+	ErrTokenNotFound = fmt.Errorf("token not found")
+	ErrInvalidToken  = fmt.Errorf("invalid token")
+)
+
+// Длина секрета токена в байтах.
+const tokenSize = 32
+
+// Токен доступа к API. Секрет токена в БД не хранится.
+type APIToken struct {
+	ID       int
+	TenantID int
+	UserID   int
+	Name     string
+	Created  int64
+	Expires  int64
+	Revoked  int64
+}
+
+// hashToken возвращает SHA-256 секрета токена в hex.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateToken создаёт токен доступа к API для пользователя и возвращает его id и секрет.
+// Секрет возвращается только один раз, в БД сохраняется его хэш.
+// Если expires равен 0, токен бессрочный. Для пользователя другого рабочего
+// пространства возвращается ErrUserNotFound.
+func (s *Storage) CreateToken(userID int, name string, expires int64) (int, string, error) {
+	err := s.authorizeWrite(RoleAdmin)
+	if err != nil {
+		return 0, "", err
+	}
+
+	buf := make([]byte, tokenSize)
+	_, err = rand.Read(buf)
+	if err != nil {
+		return 0, "", err
+	}
+	token := hex.EncodeToString(buf)
+
+	ctx := context.Background()
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return 0, "", err
+	}
+	defer tx.Rollback(ctx)
+
+	var id int
+	err = tx.QueryRow(ctx, `
+		INSERT INTO api_tokens (tenant_id, user_id, name, token_hash, expires)
+		SELECT $1, id, $3, $4, $5
+		FROM users
+		WHERE id = $2 AND tenant_id = $1
+		RETURNING id;
+	`,
+		s.tenantID,
+		userID,
+		name,
+		hashToken(token),
+		expires,
+	).Scan(&id)
+	if err == pgx.ErrNoRows {
+		return 0, "", ErrUserNotFound
+	}
+	if err != nil {
+		return 0, "", err
+	}
+
+	err = s.audit(ctx, tx, AuditTokenCreate, map[string]interface{}{
+		"token_id": id,
+		"user_id":  userID,
+		"name":     name,
+		"expires":  expires,
+	})
+	if err != nil {
+		return 0, "", err
+	}
+
+	return id, token, tx.Commit(ctx)
+}
+
+// ListTokens возвращает список токенов пользователя.
+// Если userID равен 0, возвращаются токены всех пользователей.
+// Чужие токены доступны только администратору.
+func (s *Storage) ListTokens(userID int) ([]APIToken, error) {
+	if userID == 0 || userID != s.userID {
+		err := s.authorize(RoleAdmin)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	ctx := context.Background()
+	rows, err := s.db.Query(ctx, `
+		SELECT
+			id,
+			tenant_id,
+			user_id,
+			name,
+			created,
+			expires,
+			revoked
+		FROM api_tokens
+		WHERE
+			($1 = 0 OR user_id = $1) AND
+			tenant_id = $2
+		ORDER BY id
+	`,
+		userID,
+		s.tenantID,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return collectRows(rows, scanToken)
+}
+
+// scanToken сканирует токен доступа к API.
+func scanToken(row pgx.Row) (APIToken, error) {
+	var t APIToken
+	err := row.Scan(
+		&t.ID,
+		&t.TenantID,
+		&t.UserID,
+		&t.Name,
+		&t.Created,
+		&t.Expires,
+		&t.Revoked,
+	)
+
+	return t, err
+}
+
+// RevokeToken отзывает токен по ID.
+func (s *Storage) RevokeToken(tokenID int) error {
+	err := s.authorizeWrite(RoleAdmin)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx, `
+		UPDATE api_tokens
+		SET revoked = extract(epoch from now())
+		WHERE id = $1 AND revoked = 0 AND tenant_id = $2
+	`,
+		tokenID,
+		s.tenantID,
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrTokenNotFound
+	}
+
+	err = s.audit(ctx, tx, AuditTokenRevoke, map[string]interface{}{
+		"token_id": tokenID,
+	})
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// ValidateToken проверяет секрет токена и возвращает сам токен.
+// Проверка выполняется по всем рабочим пространствам, чтобы middleware
+// могла получить хранилище через ForTenant(token.TenantID).
+// Для неизвестных, отозванных и истёкших токенов возвращает ErrInvalidToken.
+func (s *Storage) ValidateToken(ctx context.Context, token string) (APIToken, error) {
+	t, err := scanToken(s.db.QueryRow(ctx, `
+		SELECT
+			id,
+			tenant_id,
+			user_id,
+			name,
+			created,
+			expires,
+			revoked
+		FROM api_tokens
+		WHERE token_hash = $1
+	`,
+		hashToken(token),
+	))
+	if err == pgx.ErrNoRows {
+		return APIToken{}, ErrInvalidToken
+	}
+	if err != nil {
+		return APIToken{}, err
+	}
+
+	if t.Revoked != 0 || (t.Expires != 0 && t.Expires <= time.Now().Unix()) {
+		return APIToken{}, ErrInvalidToken
+	}
+
+	return t, nil
+}
@@ -0,0 +1,86 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestStorage_Tokens(t *testing.T) {
+	db, err := storageConnect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close(context.Background()) })
+
+	userID := newTestUser(t, db, "Bot")
+	ctx := context.Background()
+
+	id, token, err := db.CreateToken(userID, "CI", 0)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	_, expiredToken, err := db.CreateToken(userID, "Expired", time.Now().Unix()-1)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	tokens, err := db.ListTokens(userID)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(tokens) != 2 {
+		t.Errorf("tokens num: want 2, got %d", len(tokens))
+	}
+	tokens, err = db.AsUser(userID).ListTokens(userID)
+	if err != nil || len(tokens) != 2 {
+		t.Errorf("own tokens: want 2, got %d (%v)", len(tokens), err)
+	}
+	_, err = db.AsUser(userID).ListTokens(0)
+	if !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("error: want %v, got %v", ErrPermissionDenied, err)
+	}
+	_, _, err = db.ForTenant(1146).CreateToken(userID, "Foreign", 0)
+	if !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("error: want %v, got %v", ErrUserNotFound, err)
+	}
+
+	got, err := db.ValidateToken(ctx, token)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got.ID != id || got.UserID != userID {
+		t.Errorf("token: want id:%d user:%d, got %+v", id, userID, got)
+	}
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"unknown token", "not-a-token"},
+		{"expired token", expiredToken},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := db.ValidateToken(ctx, tt.token)
+			if !errors.Is(err, ErrInvalidToken) {
+				t.Errorf("error: want %v, got %v", ErrInvalidToken, err)
+			}
+		})
+	}
+
+	err = db.RevokeToken(id)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	_, err = db.ValidateToken(ctx, token)
+	if !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("error: want %v, got %v", ErrInvalidToken, err)
+	}
+	err = db.RevokeToken(id)
+	if !errors.Is(err, ErrTokenNotFound) {
+		t.Errorf("error: want %v, got %v", ErrTokenNotFound, err)
+	}
+}
@@ -0,0 +1,142 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v4"
+)
+
+var ErrInvalidLocale = fmt.Errorf("invalid locale")
+
+// SetTaskTranslation сохраняет перевод названия и содержимого задачи на язык locale,
+// заменяя существующий перевод.
+func (s *Storage) SetTaskTranslation(taskID int, locale, title, content string) error {
+	err := s.authorizeWrite(RoleReporter)
+	if err != nil {
+		return err
+	}
+	if locale == "" {
+		return ErrInvalidLocale
+	}
+	content, err = s.encrypt(content)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	tag, err := s.db.Exec(ctx, `
+		INSERT INTO task_translations (task_id, locale, title, content)
+		SELECT id, $2, $3, $4
+		FROM tasks
+		WHERE id = $1 AND tenant_id = $5
+		ON CONFLICT (task_id, locale) DO UPDATE
+		SET title = EXCLUDED.title, content = EXCLUDED.content
+	`,
+		taskID,
+		locale,
+		title,
+		content,
+		s.tenantID,
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrTaskNotFound
+	}
+
+	return nil
+}
+
+// DeleteTaskTranslation удаляет перевод задачи на язык locale.
+func (s *Storage) DeleteTaskTranslation(taskID int, locale string) error {
+	err := s.authorizeWrite(RoleReporter)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	_, err = s.db.Exec(ctx, `
+		DELETE FROM task_translations AS tr
+		USING tasks AS t
+		WHERE tr.task_id = t.id AND tr.task_id = $1 AND tr.locale = $2 AND t.tenant_id = $3
+	`,
+		taskID,
+		locale,
+		s.tenantID,
+	)
+
+	return err
+}
+
+// TaskTranslations возвращает языки, на которые переведена задача.
+func (s *Storage) TaskTranslations(taskID int) ([]string, error) {
+	ctx := context.Background()
+	rows, err := s.db.Query(ctx, `
+		SELECT tr.locale
+		FROM task_translations AS tr
+		JOIN tasks AS t
+		ON t.id = tr.task_id
+		WHERE tr.task_id = $1 AND t.tenant_id = $2 AND can_access($3, t)
+		ORDER BY tr.locale
+	`,
+		taskID,
+		s.tenantID,
+		s.userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return collectRows(rows, func(row pgx.Row) (string, error) {
+		var locale string
+		err := row.Scan(&locale)
+		return locale, err
+	})
+}
+
+// TaskByIDLocalized возвращает задачу по ID с названием и содержимым на языке locale.
+// Если перевода на locale нет, используется перевод на основной язык
+// (en для en-US), а при его отсутствии - исходный текст задачи.
+func (s *Storage) TaskByIDLocalized(taskID int, locale string) (Task, error) {
+	language, _, _ := strings.Cut(locale, "-")
+
+	ctx := context.Background()
+	var title, content *string
+	task, err := s.scanTask(s.db.QueryRow(ctx, `
+		SELECT `+taskColumnsOf("t")+`, tr.title, tr.content
+		FROM tasks AS t
+		LEFT JOIN LATERAL (
+			SELECT title, content
+			FROM task_translations
+			WHERE task_id = t.id AND locale IN ($4, $5)
+			ORDER BY locale = $4 DESC
+			LIMIT 1
+		) AS tr ON true
+		WHERE t.id = $1 AND t.tenant_id = $2 AND can_access($3, t)
+	`,
+		taskID,
+		s.tenantID,
+		s.userID,
+		locale,
+		language,
+	), &title, &content)
+	if err == pgx.ErrNoRows {
+		return task, ErrTaskNotFound
+	}
+	if err != nil {
+		return task, err
+	}
+
+	if title != nil {
+		task.Title = *title
+		task.Content, err = s.decrypt(*content)
+		if err != nil {
+			return Task{}, err
+		}
+	}
+
+	return task, nil
+}
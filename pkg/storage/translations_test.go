@@ -0,0 +1,79 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestStorage_TaskByIDLocalized(t *testing.T) {
+	db, err := storageConnect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close(context.Background()) })
+
+	tenant := db.ForTenant(1189)
+	taskID := newTestTask(t, tenant, "Original")
+	err = tenant.SetTaskTranslation(taskID, "en", "English", "English content")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	err = tenant.SetTaskTranslation(taskID, "pt-BR", "Português", "Conteúdo")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		locale  string
+		title   string
+		content string
+	}{
+		{"pt-BR", "Português", "Conteúdo"},
+		{"en-US", "English", "English content"},
+		{"en", "English", "English content"},
+		{"de", "Original", "Test content"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.locale, func(t *testing.T) {
+			task, err := tenant.TaskByIDLocalized(taskID, tt.locale)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if task.Title != tt.title || task.Content != tt.content {
+				t.Errorf("task: want %q/%q, got %q/%q", tt.title, tt.content, task.Title, task.Content)
+			}
+		})
+	}
+
+	locales, err := tenant.TaskTranslations(taskID)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(locales, []string{"en", "pt-BR"}) {
+		t.Errorf("locales: want %v, got %v", []string{"en", "pt-BR"}, locales)
+	}
+
+	err = tenant.DeleteTaskTranslation(taskID, "en")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	task, err := tenant.TaskByIDLocalized(taskID, "en")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if task.Title != "Original" {
+		t.Errorf("title: want %q, got %q", "Original", task.Title)
+	}
+
+	err = tenant.SetTaskTranslation(taskID, "", "Title", "Content")
+	if !errors.Is(err, ErrInvalidLocale) {
+		t.Errorf("error: want %v, got %v", ErrInvalidLocale, err)
+	}
+	err = db.ForTenant(1).SetTaskTranslation(taskID, "en", "Title", "Content")
+	if !errors.Is(err, ErrTaskNotFound) {
+		t.Errorf("error: want %v, got %v", ErrTaskNotFound, err)
+	}
+}
@@ -0,0 +1,80 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// Наибольшее число интервалов в ответе LabelTrend.
+const maxTrendBuckets = 1000
+
+// Количество задач метки, созданных и выполненных за интервал времени.
+type TrendBucket struct {
+	Start  time.Time // начало интервала
+	Opened int64
+	Closed int64
+}
+
+// LabelTrend возвращает количество созданных и выполненных задач метки label,
+// включая дочерние метки, по интервалам длительности bucket от from до to.
+// Интервалы отсчитываются от from, последний интервал заканчивается в to.
+// Учитываются задачи, доступные пользователю, с текущими метками задач.
+func (s *Storage) LabelTrend(label string, from, to time.Time, bucket time.Duration) ([]TrendBucket, error) {
+	step := int64(bucket / time.Second)
+	if step <= 0 {
+		return nil, ErrInvalidDuration
+	}
+	if n := (to.Unix() - from.Unix() + step - 1) / step; n > maxTrendBuckets {
+		return nil, fmt.Errorf("%w: %d buckets exceed the limit of %d", ErrInvalidDuration, n, maxTrendBuckets)
+	}
+
+	ctx := context.Background()
+	id, err := s.labelID(ctx, label)
+	if err != nil {
+		return nil, err
+	}
+	if id == nil {
+		return nil, ErrEmptyLabel
+	}
+
+	rows, err := s.db.Query(ctx, labelSubtreeSQL+`, labeled AS (
+			SELECT t.opened, t.closed
+			FROM tasks AS t
+			WHERE
+				EXISTS (
+					SELECT 1 FROM tasks_labels AS tl WHERE tl.task_id = t.id AND tl.label_id IN (SELECT id FROM matched)
+				) AND
+				t.tenant_id = $2 AND can_access($3, t)
+		)
+		SELECT
+			b.start,
+			count(*) FILTER (WHERE l.opened >= b.start AND l.opened < LEAST(b.start + $6, $5)),
+			count(*) FILTER (WHERE l.closed >= b.start AND l.closed < LEAST(b.start + $6, $5))
+		FROM generate_series($4::bigint, $5::bigint - 1, $6::bigint) AS b(start)
+		LEFT JOIN labeled AS l
+		ON l.opened < LEAST(b.start + $6, $5) AND (l.opened >= b.start OR l.closed >= b.start)
+		GROUP BY b.start
+		ORDER BY b.start
+	`,
+		label,
+		s.tenantID,
+		s.userID,
+		from.Unix(),
+		to.Unix(),
+		step,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return collectRows(rows, func(row pgx.Row) (TrendBucket, error) {
+		var b TrendBucket
+		var start int64
+		err := row.Scan(&start, &b.Opened, &b.Closed)
+		b.Start = unixTime(start)
+		return b, err
+	})
+}
@@ -0,0 +1,69 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestStorage_LabelTrend(t *testing.T) {
+	db, err := storageConnect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close(context.Background()) })
+
+	tenant := db.ForTenant(1215)
+	ctx := context.Background()
+	_, err = db.db.Exec(ctx, `INSERT INTO labels (tenant_id, name) VALUES (1215, 'Bug')`)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	t.Cleanup(func() { db.db.Exec(ctx, `DELETE FROM labels WHERE tenant_id = 1215`) })
+
+	day := 24 * time.Hour
+	from := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	// день создания и день выполнения задачи, -1 - открытая задача
+	for _, days := range [][2]int{{0, 1}, {0, -1}, {1, 2}, {2, -1}} {
+		id := newTestTask(t, tenant, "Crash")
+		addTestLabel(t, tenant, id, "Bug")
+		closed := int64(0)
+		if days[1] >= 0 {
+			closed = from.Add(time.Duration(days[1]) * day).Add(time.Hour).Unix()
+		}
+		_, err = db.db.Exec(ctx, `
+			UPDATE tasks SET opened = $2, closed = $3 WHERE id = $1
+		`, id, from.Add(time.Duration(days[0])*day).Unix(), closed)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	got, err := tenant.LabelTrend("Bug", from, from.Add(3*day), day)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	want := []TrendBucket{
+		{Start: from, Opened: 2, Closed: 0},
+		{Start: from.Add(day), Opened: 1, Closed: 1},
+		{Start: from.Add(2 * day), Opened: 1, Closed: 1},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("buckets: want %+v, got %+v", want, got)
+	}
+	for i := range want {
+		if !got[i].Start.Equal(want[i].Start) || got[i].Opened != want[i].Opened || got[i].Closed != want[i].Closed {
+			t.Errorf("bucket %d: want %+v, got %+v", i, want[i], got[i])
+		}
+	}
+
+	_, err = tenant.LabelTrend("Bug", from, from.Add(3*day), 0)
+	if !errors.Is(err, ErrInvalidDuration) {
+		t.Errorf("error: want %v, got %v", ErrInvalidDuration, err)
+	}
+	_, err = tenant.LabelTrend("Feature", from, from.Add(3*day), day)
+	if !errors.Is(err, ErrLabelNotFound) {
+		t.Errorf("error: want %v, got %v", ErrLabelNotFound, err)
+	}
+}
@@ -0,0 +1,192 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+)
+
+var (
+	ErrTwoPhaseDisabled   = fmt.Errorf("two-phase commit is not enabled")
+	ErrTwoPhaseStarted    = fmt.Errorf("two-phase transaction already started")
+	ErrInvalidGID         = fmt.Errorf("invalid global transaction id")
+	ErrPreparedTxNotFound = fmt.Errorf("prepared transaction not found")
+)
+
+// Наибольшая длина глобального идентификатора подготовленной транзакции в Postgres.
+const maxGIDLength = 199
+
+// WithTwoPhaseCommit разрешает транзакции двухфазной фиксации (BeginTwoPhase), чтобы
+// хранилище участвовало в распределённых транзакциях и сагах внешнего координатора.
+// Серверу нужен параметр max_prepared_transactions больше 0. Подготовленная транзакция
+// удерживает блокировки и до COMMIT PREPARED или ROLLBACK PREPARED переживает перезапуск
+// сервера, поэтому координатор должен завершать незавершённые транзакции,
+// находя их методом PreparedTransactions.
+func WithTwoPhaseCommit() Option {
+	return func(o *options) {
+		o.twoPhase = true
+	}
+}
+
+// Транзакция двухфазной фиксации.
+type TwoPhaseTx struct {
+	s  *Storage
+	tx pgx.Tx
+}
+
+// Подготовленная транзакция, ожидающая решения координатора.
+type PreparedTx struct {
+	GID      string
+	Prepared time.Time // время подготовки в UTC
+}
+
+// BeginTwoPhase начинает транзакцию двухфазной фиксации. Методы хранилища, возвращаемого
+// методом Storage транзакции, выполняются в ней, а их собственные транзакции становятся
+// точками сохранения. Транзакция использует одно соединение, поэтому её хранилище нельзя
+// использовать из нескольких горутин, в том числе в ImportTasksParallel. Ошибка запроса
+// вне точки сохранения прерывает транзакцию, после неё транзакцию нужно откатить.
+func (s *Storage) BeginTwoPhase(ctx context.Context) (*TwoPhaseTx, error) {
+	if !s.db.twoPhase {
+		return nil, ErrTwoPhaseDisabled
+	}
+	if s.db.tx != nil {
+		return nil, ErrTwoPhaseStarted
+	}
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// запросы хранилища транзакции журналируются и трассируются подключением,
+	// поэтому оно привязывается к исходной транзакции pgx
+	db := *s.db
+	db.tx = tx.(*connTx).Tx
+	scoped := *s
+	scoped.db = &db
+
+	return &TwoPhaseTx{s: &scoped, tx: db.tx}, nil
+}
+
+// Storage возвращает хранилище, методы которого выполняются в транзакции.
+func (t *TwoPhaseTx) Storage() *Storage {
+	return t.s
+}
+
+// Prepare подготавливает транзакцию к фиксации под глобальным идентификатором gid
+// (PREPARE TRANSACTION), после чего хранилище транзакции больше не используется.
+// Подготовленная транзакция не зависит от соединения и завершается методом CommitPrepared
+// или RollbackPrepared любого экземпляра хранилища. Если транзакция была прервана
+// ошибкой, она откатывается и возвращается pgx.ErrTxCommitRollback.
+func (t *TwoPhaseTx) Prepare(ctx context.Context, gid string) error {
+	err := validateGID(gid)
+	if err != nil {
+		return err
+	}
+
+	tag, err := t.s.db.Exec(ctx, `PREPARE TRANSACTION `+quoteLiteral(gid))
+	// PREPARE TRANSACTION завершает транзакцию сеанса в любом случае,
+	// Rollback только возвращает соединение в пул
+	t.tx.Rollback(ctx)
+	if err != nil {
+		return err
+	}
+	if string(tag) != "PREPARE TRANSACTION" {
+		return pgx.ErrTxCommitRollback
+	}
+
+	return nil
+}
+
+// Rollback откатывает неподготовленную транзакцию.
+// После Prepare возвращает pgx.ErrTxClosed.
+func (t *TwoPhaseTx) Rollback(ctx context.Context) error {
+	return t.tx.Rollback(ctx)
+}
+
+// CommitPrepared фиксирует подготовленную транзакцию gid. Подготовленные транзакции
+// не принадлежат рабочему пространству, поэтому CommitPrepared, RollbackPrepared
+// и PreparedTransactions доступны только системному пользователю.
+func (s *Storage) CommitPrepared(ctx context.Context, gid string) error {
+	return s.finishPrepared(ctx, `COMMIT PREPARED `, gid)
+}
+
+// RollbackPrepared откатывает подготовленную транзакцию gid.
+func (s *Storage) RollbackPrepared(ctx context.Context, gid string) error {
+	return s.finishPrepared(ctx, `ROLLBACK PREPARED `, gid)
+}
+
+// finishPrepared завершает подготовленную транзакцию gid командой command.
+func (s *Storage) finishPrepared(ctx context.Context, command, gid string) error {
+	if !s.db.twoPhase {
+		return ErrTwoPhaseDisabled
+	}
+	if s.db.tx != nil {
+		return ErrTwoPhaseStarted
+	}
+	err := s.authorizeSystemWrite()
+	if err != nil {
+		return err
+	}
+	err = validateGID(gid)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.Exec(ctx, command+quoteLiteral(gid))
+	var pgErr *pgconn.PgError
+	// undefined_object
+	if errors.As(err, &pgErr) && pgErr.Code == "42704" {
+		return ErrPreparedTxNotFound
+	}
+
+	return err
+}
+
+// PreparedTransactions возвращает подготовленные транзакции текущей БД всех рабочих
+// пространств, начиная с самых старых, для завершения координатором после сбоя.
+func (s *Storage) PreparedTransactions(ctx context.Context) ([]PreparedTx, error) {
+	if !s.db.twoPhase {
+		return nil, ErrTwoPhaseDisabled
+	}
+	err := s.authorizeSystem()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Query(ctx, `
+		SELECT gid, prepared
+		FROM pg_prepared_xacts
+		WHERE database = current_database()
+		ORDER BY prepared, gid
+	`)
+	if err != nil {
+		return nil, err
+	}
+
+	return collectRows(rows, func(row pgx.Row) (PreparedTx, error) {
+		var p PreparedTx
+		err := row.Scan(&p.GID, &p.Prepared)
+		p.Prepared = p.Prepared.UTC()
+		return p, err
+	})
+}
+
+// validateGID проверяет глобальный идентификатор подготовленной транзакции.
+func validateGID(gid string) error {
+	if gid == "" || len(gid) > maxGIDLength || strings.ContainsRune(gid, 0) {
+		return ErrInvalidGID
+	}
+	return nil
+}
+
+// quoteLiteral возвращает строковую константу SQL со значением s. Команды
+// двухфазной фиксации не принимают параметры, поэтому идентификатор подставляется в текст.
+func quoteLiteral(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
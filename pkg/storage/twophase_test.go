@@ -0,0 +1,167 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+func TestValidateGID(t *testing.T) {
+	tests := []struct {
+		gid  string
+		want error
+	}{
+		{"saga-42/step-1", nil},
+		{"it's fine", nil},
+		{strings.Repeat("x", maxGIDLength), nil},
+		{"", ErrInvalidGID},
+		{strings.Repeat("x", maxGIDLength+1), ErrInvalidGID},
+		{"a\x00b", ErrInvalidGID},
+	}
+
+	for _, tt := range tests {
+		if err := validateGID(tt.gid); err != tt.want {
+			t.Errorf("validateGID(%q): want %v, got %v", tt.gid, tt.want, err)
+		}
+	}
+
+	if got, want := quoteLiteral("it's"), `'it''s'`; got != want {
+		t.Errorf("quoteLiteral: want %s, got %s", want, got)
+	}
+}
+
+func TestStorage_TwoPhaseDisabled(t *testing.T) {
+	s, err := NewWithPool(&pgxpool.Pool{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	ctx := context.Background()
+
+	_, err = s.BeginTwoPhase(ctx)
+	if err != ErrTwoPhaseDisabled {
+		t.Errorf("BeginTwoPhase error: want %v, got %v", ErrTwoPhaseDisabled, err)
+	}
+	err = s.CommitPrepared(ctx, "gid")
+	if err != ErrTwoPhaseDisabled {
+		t.Errorf("CommitPrepared error: want %v, got %v", ErrTwoPhaseDisabled, err)
+	}
+	_, err = s.PreparedTransactions(ctx)
+	if err != ErrTwoPhaseDisabled {
+		t.Errorf("PreparedTransactions error: want %v, got %v", ErrTwoPhaseDisabled, err)
+	}
+}
+
+func TestStorage_TwoPhaseSystemOnly(t *testing.T) {
+	s, err := NewWithPool(&pgxpool.Pool{}, WithTwoPhaseCommit())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	admin := s.ForTenant(1244).AsUser(1)
+	ctx := context.Background()
+
+	err = admin.CommitPrepared(ctx, "gid")
+	if !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("CommitPrepared error: want %v, got %v", ErrPermissionDenied, err)
+	}
+	err = admin.RollbackPrepared(ctx, "gid")
+	if !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("RollbackPrepared error: want %v, got %v", ErrPermissionDenied, err)
+	}
+	_, err = admin.PreparedTransactions(ctx)
+	if !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("PreparedTransactions error: want %v, got %v", ErrPermissionDenied, err)
+	}
+}
+
+func TestStorage_TwoPhaseCommit(t *testing.T) {
+	db, err := storageConnect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close(context.Background()) })
+
+	s, err := NewWithPool(db.db.pool, WithTwoPhaseCommit())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	tenant := s.ForTenant(1244)
+	ctx := context.Background()
+
+	prepare := func(gid, title string) int {
+		t.Helper()
+		tx, err := tenant.BeginTwoPhase(ctx)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		id, err := tx.Storage().NewTask(Task{Title: title})
+		if err != nil {
+			tx.Rollback(ctx)
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		_, err = tx.Storage().BeginTwoPhase(ctx)
+		if err != ErrTwoPhaseStarted {
+			t.Errorf("nested BeginTwoPhase error: want %v, got %v", ErrTwoPhaseStarted, err)
+		}
+		err = tx.Prepare(ctx, gid)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		t.Cleanup(func() { tenant.RollbackPrepared(context.Background(), gid) })
+		err = tx.Rollback(ctx)
+		if err != pgx.ErrTxClosed {
+			t.Errorf("Rollback after Prepare error: want %v, got %v", pgx.ErrTxClosed, err)
+		}
+		return id
+	}
+
+	committed := prepare("synth-1244-commit", "Two-phase commit")
+	rolledBack := prepare("synth-1244-rollback", "Two-phase rollback")
+
+	// подготовленные изменения не видны до фиксации
+	_, err = tenant.TaskByID(committed)
+	if !errors.Is(err, ErrTaskNotFound) {
+		t.Errorf("error before commit: want %v, got %v", ErrTaskNotFound, err)
+	}
+
+	prepared, err := tenant.PreparedTransactions(ctx)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	gids := make(map[string]bool)
+	for _, p := range prepared {
+		gids[p.GID] = true
+	}
+	if !gids["synth-1244-commit"] || !gids["synth-1244-rollback"] {
+		t.Errorf("prepared: want both transactions, got %+v", prepared)
+	}
+
+	err = tenant.CommitPrepared(ctx, "synth-1244-commit")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	task, err := tenant.TaskByID(committed)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if task.Title != "Two-phase commit" {
+		t.Errorf("title: want %q, got %q", "Two-phase commit", task.Title)
+	}
+
+	err = tenant.RollbackPrepared(ctx, "synth-1244-rollback")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	_, err = tenant.TaskByID(rolledBack)
+	if !errors.Is(err, ErrTaskNotFound) {
+		t.Errorf("error after rollback: want %v, got %v", ErrTaskNotFound, err)
+	}
+
+	err = tenant.CommitPrepared(ctx, "synth-1244-commit")
+	if err != ErrPreparedTxNotFound {
+		t.Errorf("error: want %v, got %v", ErrPreparedTxNotFound, err)
+	}
+}